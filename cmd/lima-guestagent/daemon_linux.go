@@ -1,17 +1,25 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
 	"errors"
+	"fmt"
 	"net"
 	"net/http"
 	"os"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/lima-vm/lima/pkg/guestagent"
+	"github.com/lima-vm/lima/pkg/guestagent/api"
 	"github.com/lima-vm/lima/pkg/guestagent/api/server"
+	"github.com/lima-vm/lima/pkg/vsock"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"golang.org/x/sys/unix"
 )
 
 func newDaemonCommand() *cobra.Command {
@@ -55,7 +63,7 @@ func daemonAction(cmd *cobra.Command, args []string) error {
 	}
 	r := mux.NewRouter()
 	server.AddRoutes(r, backend)
-	srv := &http.Server{Handler: r}
+	srv := &http.Server{Handler: requireVSockToken(r), ConnContext: connContext}
 	err = os.RemoveAll(socket)
 	if err != nil {
 		return err
@@ -67,6 +75,81 @@ func daemonAction(cmd *cobra.Command, args []string) error {
 	if err := os.Chmod(socket, 0777); err != nil {
 		return err
 	}
+	// The host agent connects over vsock when QEMU provides a vsock device, i.e., on Linux hosts
+	if vl, err := vsock.Listen(api.VSockPort); err != nil {
+		logrus.WithError(err).Debug("not serving the guest agent on vsock")
+	} else {
+		logrus.Infof("serving the guest agent on vsock port %d", api.VSockPort)
+		go func() {
+			if err := srv.Serve(vl); err != nil {
+				logrus.WithError(err).Warn("failed to serve the guest agent on vsock")
+			}
+		}()
+	}
 	logrus.Infof("serving the guest agent on %q", socket)
 	return srv.Serve(l)
 }
+
+// vsockTokenFile is the token installed from the cidata, which the host agent has to present over vsock.
+const vsockTokenFile = "/etc/lima-guestagent.token"
+
+type vsockConnKey struct{}
+
+// requireVSockToken rejects the requests over vsock without the token of the instance in the Authorization header.
+// The token is read on every request, so that the token updated by the boot script is used without restarting the agent.
+// The requests over the UNIX socket are not authenticated with the token, as the socket is only accessible in the guest.
+func requireVSockToken(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(vsockConnKey{}).(bool); !ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+		token, err := os.ReadFile(vsockTokenFile)
+		if err != nil {
+			logrus.WithError(err).Warn("rejected the request over vsock, as the token cannot be read")
+			http.Error(w, "the token of the guest agent is not available", http.StatusForbidden)
+			return
+		}
+		expected := "Bearer " + strings.TrimSpace(string(token))
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(expected)) != 1 {
+			logrus.Warnf("rejected the request over vsock with an invalid token: %s %s", r.Method, r.URL.Path)
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// errExecOverVSock is returned for the commands requested over vsock.
+var errExecOverVSock = errors.New("running commands is not allowed over vsock")
+
+// connContext runs the commands requested over the UNIX socket with the credential of the client,
+// as the socket is accessible to all the users of the guest.
+// The commands requested over vsock are refused, as they would run as the root.
+func connContext(ctx context.Context, c net.Conn) context.Context {
+	uc, ok := c.(*net.UnixConn)
+	if !ok {
+		ctx = context.WithValue(ctx, vsockConnKey{}, true)
+		return guestagent.WithExecCredential(ctx, nil, errExecOverVSock)
+	}
+	credErr := func(err error) context.Context {
+		return guestagent.WithExecCredential(ctx, nil, fmt.Errorf("failed to get the credential of the client: %w", err))
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return credErr(err)
+	}
+	var (
+		ucred    *unix.Ucred
+		ucredErr error
+	)
+	if err := raw.Control(func(fd uintptr) {
+		ucred, ucredErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	}); err != nil {
+		return credErr(err)
+	}
+	if ucredErr != nil {
+		return credErr(ucredErr)
+	}
+	return guestagent.WithExecCredential(ctx, &syscall.Credential{Uid: ucred.Uid, Gid: ucred.Gid}, nil)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/spf13/cobra"
+)
+
+func newConsoleCommand() *cobra.Command {
+	consoleCommand := &cobra.Command{
+		Use:   "console [flags] INSTANCE",
+		Short: "Show the output of the serial console of an instance",
+		Long: `Show the output of the serial console of an instance.
+The output is followed until interrupted, including the output after restarts of the instance.`,
+		Args:              cobra.ExactArgs(1),
+		RunE:              consoleAction,
+		ValidArgsFunction: consoleBashComplete,
+	}
+	consoleCommand.Flags().Bool("from-start", true, "show the existing output from the beginning")
+	consoleCommand.Flags().BoolP("follow", "f", true, "keep showing the new output")
+	return consoleCommand
+}
+
+func consoleAction(cmd *cobra.Command, args []string) error {
+	instName := args[0]
+	if _, err := store.Inspect(instName); err != nil {
+		return err
+	}
+	fromStart, err := cmd.Flags().GetBool("from-start")
+	if err != nil {
+		return err
+	}
+	follow, err := cmd.Flags().GetBool("follow")
+	if err != nil {
+		return err
+	}
+	w := cmd.OutOrStdout()
+	return store.TailSerialLog(cmd.Context(), instName, fromStart, follow, func(line string) {
+		fmt.Fprintln(w, line)
+	})
+}
+
+func consoleBashComplete(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return bashCompleteInstanceNames(cmd)
+}
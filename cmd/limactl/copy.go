@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/coreos/go-semver/semver"
+	"github.com/lima-vm/lima/pkg/limayaml"
 	"github.com/lima-vm/lima/pkg/osutil"
 	"github.com/lima-vm/lima/pkg/sshutil"
 	"github.com/lima-vm/lima/pkg/store"
@@ -52,6 +53,7 @@ func copyAction(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	instDirs := make(map[string]string)
+	instSSH := make(map[string]limayaml.SSH)
 	scpFlags := []string{}
 	scpArgs := []string{}
 	debug, err := cmd.Flags().GetBool("debug")
@@ -92,6 +94,11 @@ func copyAction(cmd *cobra.Command, args []string) error {
 				scpArgs = append(scpArgs, fmt.Sprintf("scp://%s@127.0.0.1:%d/%s", u.Username, inst.SSHLocalPort, path[1]))
 			}
 			instDirs[instName] = inst.Dir
+			y, err := inst.LoadYAML()
+			if err != nil {
+				return err
+			}
+			instSSH[instName] = y.SSH
 		default:
 			return fmt.Errorf("path %q contains multiple colons", arg)
 		}
@@ -102,25 +109,31 @@ func copyAction(cmd *cobra.Command, args []string) error {
 	scpFlags = append(scpFlags, "-3", "--")
 	scpArgs = append(scpFlags, scpArgs...)
 
-	var sshOpts []string
+	var sshArgs []string
 	if len(instDirs) == 1 {
 		// Only one (instance) host is involved; we can use the instance-specific
 		// arguments such as ControlPath.  This is preferred as we can multiplex
 		// sessions without re-authenticating (MaxSessions permitting).
-		for _, instDir := range instDirs {
-			sshOpts, err = sshutil.SSHOpts(instDir, false, false)
+		for instName, instDir := range instDirs {
+			sshOpts, err := sshutil.SSHOpts(instDir, false, false, false)
 			if err != nil {
 				return err
 			}
+			sshArgs = sshutil.SSHArgs(sshOpts, *instSSH[instName].Address, *instSSH[instName].ProxyJump)
 		}
 	} else {
 		// Copying among multiple hosts; we can't pass in host-specific options.
-		sshOpts, err = sshutil.CommonOpts(false)
+		for instName, ssh := range instSSH {
+			if *ssh.Address != "127.0.0.1" || *ssh.ProxyJump != "" {
+				return fmt.Errorf("instance %q is connected through `ssh.address` or `ssh.proxyJump`, which is not supported for copying among multiple instances", instName)
+			}
+		}
+		sshOpts, err := sshutil.CommonOpts(false)
 		if err != nil {
 			return err
 		}
+		sshArgs = sshutil.SSHArgsFromOpts(sshOpts)
 	}
-	sshArgs := sshutil.SSHArgsFromOpts(sshOpts)
 
 	sshCmd := exec.Command(arg0, append(sshArgs, scpArgs...)...)
 	sshCmd.Stdin = cmd.InOrStdin()
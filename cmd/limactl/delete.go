@@ -53,10 +53,7 @@ func deleteInstance(inst *store.Instance, force bool) error {
 
 	stopInstanceForcibly(inst)
 
-	if err := os.RemoveAll(inst.Dir); err != nil {
-		return fmt.Errorf("failed to remove %q: %w", inst.Dir, err)
-	}
-	return nil
+	return store.DeleteInstance(inst.Name)
 }
 
 func deleteBashComplete(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
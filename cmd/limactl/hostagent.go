@@ -1,7 +1,6 @@
 package main
 
 import (
-	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -13,6 +12,8 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/lima-vm/lima/pkg/hostagent"
 	"github.com/lima-vm/lima/pkg/hostagent/api/server"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/syslogutil"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -28,6 +29,9 @@ func newHostagentCommand() *cobra.Command {
 	hostagentCommand.Flags().StringP("pidfile", "p", "", "write pid to file")
 	hostagentCommand.Flags().String("socket", "", "hostagent socket")
 	hostagentCommand.Flags().String("nerdctl-archive", "", "local file path (not URL) of nerdctl-full-VERSION-linux-GOARCH.tar.gz")
+	hostagentCommand.Flags().String("log-to", os.Getenv("LIMA_HOSTAGENT_LOG_TO"), "also send logs and events to \"journal\" or \"syslog\"")
+	hostagentCommand.Flags().String("log-level", logrus.DebugLevel.String(), "log level")
+	hostagentCommand.Flags().String("log-format", hostagent.LogFormatJSON, "log format, \"json\" or \"text\" (limactl start only shows the levels of \"json\")")
 	return hostagentCommand
 }
 
@@ -37,8 +41,13 @@ func hostagentAction(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	if pidfile != "" {
-		if _, err := os.Stat(pidfile); !errors.Is(err, os.ErrNotExist) {
-			return fmt.Errorf("pidfile %q already exists", pidfile)
+		// A pidfile left behind by a crashed host agent is removed by ReadPIDFile
+		pid, err := store.ReadPIDFile(pidfile)
+		if err != nil {
+			return err
+		}
+		if pid > 0 {
+			return fmt.Errorf("pidfile %q already exists, and the host agent (pid %d) is still running", pidfile, pid)
 		}
 		if err := os.WriteFile(pidfile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
 			return err
@@ -55,8 +64,8 @@ func hostagentAction(cmd *cobra.Command, args []string) error {
 
 	instName := args[0]
 
-	sigintCh := make(chan os.Signal, 1)
-	signal.Notify(sigintCh, os.Interrupt)
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, hostagent.ShutdownSignals...)
 
 	stdout := &syncWriter{w: cmd.OutOrStdout()}
 	stderr := &syncWriter{w: cmd.ErrOrStderr()}
@@ -70,10 +79,36 @@ func hostagentAction(cmd *cobra.Command, args []string) error {
 	if nerdctlArchive != "" {
 		opts = append(opts, hostagent.WithNerdctlArchive(nerdctlArchive))
 	}
-	ha, err := hostagent.New(instName, stdout, sigintCh, opts...)
+	logLevel, err := cmd.Flags().GetString("log-level")
+	if err != nil {
+		return err
+	}
+	lv, err := logrus.ParseLevel(logLevel)
 	if err != nil {
 		return err
 	}
+	logFormat, err := cmd.Flags().GetString("log-format")
+	if err != nil {
+		return err
+	}
+	opts = append(opts, hostagent.WithLogLevel(lv), hostagent.WithLogFormat(logFormat))
+	ha, err := hostagent.New(instName, stdout, signalCh, opts...)
+	if err != nil {
+		return err
+	}
+	logTo, err := cmd.Flags().GetString("log-to")
+	if err != nil {
+		return err
+	}
+	if logTo != "" {
+		sl, err := syslogutil.New(logTo, instName)
+		if err != nil {
+			return err
+		}
+		defer sl.Close()
+		logrus.AddHook(sl.Hook())
+		ha.SetEventWriter(io.MultiWriter(stdout, sl.EventWriter()))
+	}
 
 	backend := &server.Backend{
 		Agent: ha,
@@ -4,8 +4,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"text/tabwriter"
 	"text/template"
@@ -183,7 +185,7 @@ func listAction(cmd *cobra.Command, args []string) error {
 		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
 			inst.Name,
 			inst.Status,
-			fmt.Sprintf("127.0.0.1:%d", inst.SSHLocalPort),
+			net.JoinHostPort(inst.SSHAddress, strconv.Itoa(inst.SSHLocalPort)),
 			inst.Arch,
 			inst.CPUs,
 			units.BytesSize(float64(inst.Memory)),
@@ -1,9 +1,11 @@
 package main
 
 import (
-	"os"
-	"path/filepath"
+	"fmt"
 
+	"github.com/docker/go-units"
+	"github.com/lima-vm/lima/pkg/downloader"
+	"github.com/lima-vm/lima/pkg/qemu"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -16,15 +18,34 @@ func newPruneCommand() *cobra.Command {
 		RunE:              pruneAction,
 		ValidArgsFunction: cobra.NoFileCompletions,
 	}
+	pruneCommand.Flags().String("max-cache-size", "", "only evict the least recently used downloads until the cache fits in the size (e.g. \"10GiB\")")
 	return pruneCommand
 }
 
 func pruneAction(cmd *cobra.Command, args []string) error {
-	ucd, err := os.UserCacheDir()
+	maxCacheSize, err := cmd.Flags().GetString("max-cache-size")
 	if err != nil {
 		return err
 	}
-	cacheDir := filepath.Join(ucd, "lima")
-	logrus.Infof("Pruning %q", cacheDir)
-	return os.RemoveAll(cacheDir)
+	if err := qemu.PruneImageStore(); err != nil {
+		return err
+	}
+	cacheDir, err := downloader.CacheDir()
+	if err != nil {
+		return err
+	}
+	size, err := downloader.CacheSize(cacheDir)
+	if err != nil {
+		return err
+	}
+	if maxCacheSize != "" {
+		maxSize, err := units.RAMInBytes(maxCacheSize)
+		if err != nil {
+			return fmt.Errorf("invalid --max-cache-size: %w", err)
+		}
+		logrus.Infof("Pruning %q (%s) down to %s", cacheDir, units.BytesSize(float64(size)), units.BytesSize(float64(maxSize)))
+		return downloader.PruneCache(cacheDir, maxSize)
+	}
+	logrus.Infof("Pruning %q (%s)", cacheDir, units.BytesSize(float64(size)))
+	return downloader.ClearCache(cacheDir)
 }
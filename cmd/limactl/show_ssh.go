@@ -87,11 +87,14 @@ func showSSHAction(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	opts, err := sshutil.SSHOpts(inst.Dir, *y.SSH.LoadDotSSHPubKeys, *y.SSH.ForwardAgent)
+	opts, err := sshutil.SSHOpts(inst.Dir, *y.SSH.LoadDotSSHPubKeys, *y.SSH.ForwardAgent, *y.SSH.StrictHostKeyChecking)
 	if err != nil {
 		return err
 	}
-	opts = append(opts, "Hostname=127.0.0.1")
+	opts = append(opts, "Hostname="+*y.SSH.Address)
+	if *y.SSH.ProxyJump != "" {
+		opts = append(opts, "ProxyJump="+*y.SSH.ProxyJump)
+	}
 	opts = append(opts, fmt.Sprintf("Port=%d", inst.SSHLocalPort))
 	return formatSSH(w, instName, format, opts)
 }
@@ -13,7 +13,6 @@ import (
 	"strings"
 
 	"github.com/AlecAivazis/survey/v2"
-	"github.com/containerd/containerd/identifiers"
 	"github.com/lima-vm/lima/pkg/limayaml"
 	networks "github.com/lima-vm/lima/pkg/networks/reconcile"
 	"github.com/lima-vm/lima/pkg/osutil"
@@ -35,6 +34,9 @@ func newStartCommand() *cobra.Command {
 		RunE:              startAction,
 	}
 	startCommand.Flags().Bool("tty", isatty.IsTerminal(os.Stdout.Fd()), "enable TUI interactions such as opening an editor, defaults to true when stdout is a terminal")
+	startCommand.Flags().Bool("dry-run", false, "print the QEMU command line without starting the instance")
+	startCommand.Flags().String("hostagent-log-level", "", "log level of the host agent (default \"debug\")")
+	startCommand.Flags().String("hostagent-log-format", "", "log format of the host agent, \"json\" or \"text\" (default \"json\"; the levels of the logs are only shown for \"json\")")
 	return startCommand
 }
 
@@ -102,7 +104,7 @@ func loadOrCreateInstance(cmd *cobra.Command, args []string) (*store.Instance, e
 	} else {
 		instName = arg
 		logrus.Debugf("interpreting argument %q as an instance name %q", arg, instName)
-		if err := identifiers.Validate(instName); err != nil {
+		if err := store.ValidateInstName(instName); err != nil {
 			return nil, fmt.Errorf("argument must be either an instance name or a YAML file path, got %q: %w", instName, err)
 		}
 		if inst, err := store.Inspect(instName); err == nil {
@@ -126,6 +128,9 @@ func loadOrCreateInstance(cmd *cobra.Command, args []string) (*store.Instance, e
 		return nil, fmt.Errorf("instance name %q too long: %q must be less than UNIX_PATH_MAX=%d characers, but is %d",
 			instName, maxSockName, osutil.UnixPathMax, len(maxSockName))
 	}
+	if err := store.CheckInstNameCollision(instName); err != nil {
+		return nil, err
+	}
 	if _, err := os.Stat(instDir); !errors.Is(err, os.ErrNotExist) {
 		return nil, fmt.Errorf("instance %q already exists (%q)", instName, instDir)
 	}
@@ -272,11 +277,31 @@ func startAction(cmd *cobra.Command, args []string) error {
 		logrus.Warnf("expected status %q, got %q", store.StatusStopped, inst.Status)
 	}
 	ctx := cmd.Context()
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		qCmd, err := start.DryRun(ctx, inst)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(cmd.OutOrStdout(), qCmd)
+		return err
+	}
+	haLogLevel, err := cmd.Flags().GetString("hostagent-log-level")
+	if err != nil {
+		return err
+	}
+	haLogFormat, err := cmd.Flags().GetString("hostagent-log-format")
+	if err != nil {
+		return err
+	}
 	err = networks.Reconcile(ctx, inst.Name)
 	if err != nil {
 		return err
 	}
-	return start.Start(ctx, inst)
+	return start.Start(ctx, inst, start.WithHostAgentLogLevel(haLogLevel), start.WithHostAgentLogFormat(haLogFormat))
 }
 
 func argSeemsHTTPURL(arg string) bool {
@@ -318,7 +343,7 @@ func instNameFromYAMLPath(yamlPath string) (string, error) {
 	s := strings.ToLower(filepath.Base(yamlPath))
 	s = strings.TrimSuffix(strings.TrimSuffix(s, ".yml"), ".yaml")
 	s = strings.ReplaceAll(s, ".", "-")
-	if err := identifiers.Validate(s); err != nil {
+	if err := store.ValidateInstName(s); err != nil {
 		return "", fmt.Errorf("filename %q is invalid: %w", yamlPath, err)
 	}
 	return s, nil
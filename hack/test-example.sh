@@ -160,6 +160,11 @@ if [[ -n ${CHECKS["mount-home"]} ]]; then
 		ERROR "Home directory is not shared?"
 		exit 1
 	fi
+	INFO "Testing that the home directory is mounted read-only"
+	if limactl shell "$NAME" touch "$hometmp/write-test" || [ -e "$hometmp/write-test" ]; then
+		ERROR "Home directory (\"writable: false\") is writable from the guest"
+		exit 1
+	fi
 fi
 
 if [[ -n ${CHECKS["containerd-user"]} ]]; then
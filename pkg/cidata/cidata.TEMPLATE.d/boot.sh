@@ -12,9 +12,14 @@ WARNING() {
 # shellcheck disable=SC2163
 while read -r line; do export "$line"; done <"${LIMA_CIDATA_MNT}"/lima.env
 
-# shellcheck disable=SC2163
+# The values in etc_environment are enclosed in double quotes, as in pam_env(8), and are not escaped
 while read -r line; do
-	[ "$(expr "$line" : '#')" -eq 0 ] && export "$line"
+	[ "$(expr "$line" : '#')" -eq 0 ] || continue
+	name="${line%%=*}"
+	value="${line#*=}"
+	value="${value#\"}"
+	value="${value%\"}"
+	export "$name=$value"
 done <"${LIMA_CIDATA_MNT}"/etc_environment
 
 CODE=0
@@ -10,7 +10,8 @@ for f in \
 	ip_tables ip6_tables iptable_nat ip6table_nat iptable_filter ip6table_filter \
 	nf_tables \
 	x_tables xt_MASQUERADE xt_addrtype xt_comment xt_conntrack xt_mark xt_multiport xt_nat xt_tcpudp \
-	overlay; do
+	overlay \
+	vmw_vsock_virtio_transport; do
 	echo "Loading kernel module \"$f\""
 	if ! modprobe "$f"; then
 		echo >&2 "Faild to load \"$f\" (negligible if it is built-in the kernel)"
@@ -0,0 +1,15 @@
+#!/bin/sh
+set -eux
+
+test -n "${LIMA_CIDATA_TIMEZONE}" || exit 0
+
+zoneinfo="/usr/share/zoneinfo/${LIMA_CIDATA_TIMEZONE}"
+if [ ! -f "${zoneinfo}" ]; then
+	echo >&2 "${zoneinfo} does not exist (Hint: install tzdata)"
+	exit 0
+fi
+ln -sf "${zoneinfo}" /etc/localtime
+# Debian and its derivatives also record the name in /etc/timezone
+if [ -f /etc/timezone ]; then
+	echo "${LIMA_CIDATA_TIMEZONE}" >/etc/timezone
+fi
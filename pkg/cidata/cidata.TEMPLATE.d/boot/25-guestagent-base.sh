@@ -15,6 +15,9 @@ done
 # Install or update the guestagent binary
 install -m 755 "${LIMA_CIDATA_MNT}"/lima-guestagent /usr/local/bin/lima-guestagent
 
+# Install the token required from the host agent over vsock
+install -m 600 "${LIMA_CIDATA_MNT}"/guestagent.token /etc/lima-guestagent.token
+
 # Launch the guestagent service
 if [ -f /sbin/openrc-init ]; then
 	# Install the openrc lima-guestagent service script
@@ -10,6 +10,16 @@ update_fuse_conf() {
 	fi
 }
 
+INSTALL_SSHFS=0
+INSTALL_NFS=0
+if [ "${LIMA_CIDATA_MOUNTS}" -gt 0 ]; then
+	if [ "${LIMA_CIDATA_MOUNTTYPE}" = "nfs" ]; then
+		INSTALL_NFS=1
+	else
+		INSTALL_SSHFS=1
+	fi
+fi
+
 INSTALL_IPTABLES=0
 if [ "${LIMA_CIDATA_CONTAINERD_SYSTEM}" = 1 ] || [ "${LIMA_CIDATA_CONTAINERD_USER}" = 1 ]; then
 	INSTALL_IPTABLES=1
@@ -23,11 +33,16 @@ if command -v apt-get >/dev/null 2>&1; then
 	DEBIAN_FRONTEND=noninteractive
 	export DEBIAN_FRONTEND
 	apt-get update
-	if [ "${LIMA_CIDATA_MOUNTS}" -gt 0 ]; then
+	if [ "${INSTALL_SSHFS}" = 1 ]; then
 		if ! command -v sshfs >/dev/null 2>&1; then
 			apt-get install -y sshfs
 		fi
 	fi
+	if [ "${INSTALL_NFS}" = 1 ]; then
+		if ! command -v mount.nfs >/dev/null 2>&1; then
+			apt-get install -y nfs-common
+		fi
+	fi
 	if [ "${INSTALL_IPTABLES}" = 1 ]; then
 		if [ ! -e /usr/sbin/iptables ]; then
 			apt-get install -y iptables
@@ -39,7 +54,7 @@ if command -v apt-get >/dev/null 2>&1; then
 		fi
 	fi
 elif command -v dnf >/dev/null 2>&1; then
-	if [ "${LIMA_CIDATA_MOUNTS}" -gt 0 ]; then
+	if [ "${INSTALL_SSHFS}" = 1 ]; then
 		if ! command -v sshfs >/dev/null 2>&1; then
 			if grep -q "release 8" /etc/system-release; then
 				dnf install --enablerepo powertools -y fuse-sshfs
@@ -48,6 +63,11 @@ elif command -v dnf >/dev/null 2>&1; then
 			fi
 		fi
 	fi
+	if [ "${INSTALL_NFS}" = 1 ]; then
+		if ! command -v mount.nfs >/dev/null 2>&1; then
+			dnf install -y nfs-utils
+		fi
+	fi
 	if [ "${INSTALL_IPTABLES}" = 1 ]; then
 		if [ ! -e /usr/sbin/iptables ]; then
 			dnf install -y iptables
@@ -66,18 +86,28 @@ elif command -v dnf >/dev/null 2>&1; then
 		fi
 	fi
 elif command -v pacman >/dev/null 2>&1; then
-	if [ "${LIMA_CIDATA_MOUNTS}" -gt 0 ]; then
+	if [ "${INSTALL_SSHFS}" = 1 ]; then
 		if ! command -v sshfs >/dev/null 2>&1; then
 			pacman -Syu --noconfirm sshfs
 		fi
 	fi
+	if [ "${INSTALL_NFS}" = 1 ]; then
+		if ! command -v mount.nfs >/dev/null 2>&1; then
+			pacman -Syu --noconfirm nfs-utils
+		fi
+	fi
 	# other dependencies are preinstalled on Arch Linux (https://linuximages.de/openstack/arch/)
 elif command -v zypper >/dev/null 2>&1; then
-	if [ "${LIMA_CIDATA_MOUNTS}" -gt 0 ]; then
+	if [ "${INSTALL_SSHFS}" = 1 ]; then
 		if ! command -v sshfs >/dev/null 2>&1; then
 			zypper install -y sshfs
 		fi
 	fi
+	if [ "${INSTALL_NFS}" = 1 ]; then
+		if ! command -v mount.nfs >/dev/null 2>&1; then
+			zypper install -y nfs-client
+		fi
+	fi
 	if [ "${INSTALL_IPTABLES}" = 1 ]; then
 		if [ ! -e /usr/sbin/iptables ]; then
 			zypper install -y iptables
@@ -89,12 +119,18 @@ elif command -v zypper >/dev/null 2>&1; then
 		fi
 	fi
 elif command -v apk >/dev/null 2>&1; then
-	if [ "${LIMA_CIDATA_MOUNTS}" -gt 0 ]; then
+	if [ "${INSTALL_SSHFS}" = 1 ]; then
 		if ! command -v sshfs >/dev/null 2>&1; then
 			apk update
 			apk add sshfs
 		fi
 	fi
+	if [ "${INSTALL_NFS}" = 1 ]; then
+		if ! command -v mount.nfs >/dev/null 2>&1; then
+			apk update
+			apk add nfs-utils
+		fi
+	fi
 	if [ "${INSTALL_IPTABLES}" = 1 ]; then
 		if ! command -v iptables >/dev/null 2>&1; then
 			apk update
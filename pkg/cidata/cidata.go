@@ -1,6 +1,9 @@
 package cidata
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -97,12 +100,16 @@ func GenerateISO9660(instDir, name string, y *limayaml.LimaYAML, udpDNSLocalPort
 	}
 	args := TemplateArgs{
 		Name:         name,
+		Hostname:     *y.Hostname,
+		Timezone:     *y.Timezone,
+		MountType:    *y.MountType,
 		User:         u.Username,
 		UID:          uid,
 		Containerd:   Containerd{System: *y.Containerd.System, User: *y.Containerd.User},
 		SlirpNICName: qemu.SlirpNICName,
 		SlirpGateway: qemu.SlirpGateway,
 		SlirpDNS:     qemu.SlirpDNS,
+		SlirpIPv6:    *y.Network.IPv6,
 	}
 
 	// change instance id on every boot so network config will be processed again
@@ -127,8 +134,7 @@ func GenerateISO9660(instDir, name string, y *limayaml.LimaYAML, udpDNSLocalPort
 		args.Mounts = append(args.Mounts, expanded)
 	}
 
-	slirpMACAddress := limayaml.MACAddress(instDir)
-	args.Networks = append(args.Networks, Network{MACAddress: slirpMACAddress, Interface: qemu.SlirpNICName})
+	args.Networks = append(args.Networks, Network{MACAddress: y.Network.MACAddress, Interface: qemu.SlirpNICName})
 	for _, nw := range y.Networks {
 		args.Networks = append(args.Networks, Network{MACAddress: nw.MACAddress, Interface: nw.Interface})
 	}
@@ -161,6 +167,31 @@ func GenerateISO9660(instDir, name string, y *limayaml.LimaYAML, udpDNSLocalPort
 		return err
 	}
 
+	if *y.CloudInit.UserData != "" {
+		userDataPath, err := localpathutil.Expand(*y.CloudInit.UserData)
+		if err != nil {
+			return err
+		}
+		custom, err := os.ReadFile(userDataPath)
+		if err != nil {
+			return err
+		}
+		for i, f := range layout {
+			if f.Path != "user-data" {
+				continue
+			}
+			generated, err := io.ReadAll(f.Reader)
+			if err != nil {
+				return err
+			}
+			merged, err := mergeUserData(generated, custom)
+			if err != nil {
+				return fmt.Errorf("failed to merge %q: %w", userDataPath, err)
+			}
+			layout[i].Reader = bytes.NewReader(merged)
+		}
+	}
+
 	for i, f := range y.Provision {
 		switch f.Mode {
 		case limayaml.ProvisionModeSystem, limayaml.ProvisionModeUser:
@@ -196,9 +227,38 @@ func GenerateISO9660(instDir, name string, y *limayaml.LimaYAML, udpDNSLocalPort
 		})
 	}
 
+	token, err := GuestAgentToken(instDir)
+	if err != nil {
+		return err
+	}
+	layout = append(layout, iso9660util.Entry{
+		Path:   "guestagent.token",
+		Reader: strings.NewReader(token),
+	})
+
 	return iso9660util.Write(filepath.Join(instDir, filenames.CIDataISO), "cidata", layout)
 }
 
+// GuestAgentToken returns the token of the instance, which the host agent presents to the guest agent over vsock.
+// The token is created in the instance directory on the first call, and kept across restarts.
+func GuestAgentToken(instDir string) (string, error) {
+	tokenPath := filepath.Join(instDir, filenames.GuestAgentToken)
+	if b, err := os.ReadFile(tokenPath); err == nil {
+		return strings.TrimSpace(string(b)), nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	if err := os.WriteFile(tokenPath, []byte(token), 0600); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
 func GuestAgentBinary(arch string) (io.ReadCloser, error) {
 	if arch == "" {
 		return nil, errors.New("arch must be set")
@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 
 	"github.com/lima-vm/lima/pkg/iso9660util"
+	"github.com/lima-vm/lima/pkg/limayaml"
 
 	"github.com/containerd/containerd/identifiers"
 	"github.com/lima-vm/lima/pkg/templateutil"
@@ -29,16 +30,20 @@ type Network struct {
 }
 type TemplateArgs struct {
 	Name            string // instance name
+	Hostname        string // guest hostname
+	Timezone        string // guest timezone, e.g. "Asia/Tokyo"; empty to leave unchanged
 	IID             string // instance id
 	User            string // user name
 	UID             int
 	SSHPubKeys      []string
 	Mounts          []string // abs path, accessible by the User
+	MountType       string
 	Containerd      Containerd
 	Networks        []Network
 	SlirpNICName    string
 	SlirpGateway    string
 	SlirpDNS        string
+	SlirpIPv6       bool
 	UDPDNSLocalPort int
 	TCPDNSLocalPort int
 	Env             map[string]string
@@ -66,6 +71,12 @@ func ValidateTemplateArgs(args TemplateArgs) error {
 			return fmt.Errorf("field mounts[%d] must be absolute, got %q", i, f)
 		}
 	}
+	// Env also contains the proxy variables of the host, which are not validated by limayaml.Validate
+	for k, v := range args.Env {
+		if err := limayaml.ValidateEnv(k, v); err != nil {
+			return fmt.Errorf("field Env: %w", err)
+		}
+	}
 	return nil
 }
 
@@ -2,6 +2,7 @@ package cidata
 
 import (
 	"io"
+	"strings"
 	"testing"
 
 	"gotest.tools/v3/assert"
@@ -29,3 +30,34 @@ func TestTemplate(t *testing.T) {
 		t.Log(string(b))
 	}
 }
+
+func TestTemplateEnv(t *testing.T) {
+	args := TemplateArgs{
+		Name:       "default",
+		User:       "foo",
+		UID:        501,
+		SSHPubKeys: []string{"ssh-rsa dummy foo@example.com"},
+		Env: map[string]string{
+			"FOO": `a b 'c' #d`,
+		},
+	}
+	layout, err := ExecuteTemplate(args)
+	assert.NilError(t, err)
+	var found bool
+	for _, f := range layout {
+		if f.Path != "etc_environment" {
+			continue
+		}
+		b, err := io.ReadAll(f.Reader)
+		assert.NilError(t, err)
+		assert.Assert(t, strings.Contains(string(b), "\nFOO=\"a b 'c' #d\"\n"), string(b))
+		found = true
+	}
+	assert.Assert(t, found, "etc_environment was not found")
+
+	for _, v := range []string{`"c"`, `\c`, `$d`, "`d`", "a\nb"} {
+		args.Env = map[string]string{"FOO": v}
+		_, err := ExecuteTemplate(args)
+		assert.ErrorContains(t, err, "must not contain", v)
+	}
+}
@@ -0,0 +1,57 @@
+package cidata
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const cloudConfigHeader = "#cloud-config"
+
+// mergeUserData merges the custom cloud-config into the cloud-config generated by Lima.
+//
+// Top-level lists (e.g., `packages`, `runcmd`, `write_files`) are concatenated, with the entries
+// generated by Lima coming first. So the Lima user is always created.
+// Other top-level keys in the custom cloud-config override the ones generated by Lima.
+func mergeUserData(lima, custom []byte) ([]byte, error) {
+	if !bytes.HasPrefix(custom, []byte(cloudConfigHeader)) {
+		return nil, fmt.Errorf("custom user-data must begin with %q", cloudConfigHeader)
+	}
+	var limaCfg, customCfg yaml.MapSlice
+	if err := yaml.Unmarshal(lima, &limaCfg); err != nil {
+		return nil, fmt.Errorf("internal error: failed to parse the user-data generated by Lima: %w", err)
+	}
+	if err := yaml.Unmarshal(custom, &customCfg); err != nil {
+		return nil, fmt.Errorf("failed to parse custom user-data: %w", err)
+	}
+	for _, item := range customCfg {
+		idx := -1
+		for i := range limaCfg {
+			if limaCfg[i].Key == item.Key {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			limaCfg = append(limaCfg, item)
+			continue
+		}
+		limaList, limaIsList := limaCfg[idx].Value.([]interface{})
+		customList, customIsList := item.Value.([]interface{})
+		if limaIsList && customIsList {
+			limaCfg[idx].Value = append(limaList, customList...)
+			continue
+		}
+		if limaIsList || customIsList {
+			return nil, fmt.Errorf("custom user-data: key %v must be a list", item.Key)
+		}
+		limaCfg[idx].Value = item.Value
+	}
+	b, err := yaml.Marshal(limaCfg)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strings.Join([]string{cloudConfigHeader, string(b)}, "\n")), nil
+}
@@ -0,0 +1,76 @@
+package cidata
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestMergeUserData(t *testing.T) {
+	lima := []byte(`#cloud-config
+growpart:
+  mode: auto
+users:
+  - name: foo
+runcmd:
+  - echo lima
+`)
+	custom := []byte(`#cloud-config
+growpart:
+  mode: "off"
+users:
+  - name: bar
+runcmd:
+  - echo custom
+packages:
+  - vim
+`)
+	merged, err := mergeUserData(lima, custom)
+	assert.NilError(t, err)
+	expected := `#cloud-config
+growpart:
+  mode: "off"
+users:
+- name: foo
+- name: bar
+runcmd:
+- echo lima
+- echo custom
+packages:
+- vim
+`
+	assert.Equal(t, expected, string(merged))
+
+	_, err = mergeUserData(lima, []byte("packages: [vim]\n"))
+	assert.ErrorContains(t, err, "must begin with")
+
+	_, err = mergeUserData(lima, []byte("#cloud-config\nruncmd: echo\n"))
+	assert.ErrorContains(t, err, "must be a list")
+}
+
+func TestMergeUserDataTemplate(t *testing.T) {
+	args := TemplateArgs{
+		Name:         "default",
+		User:         "foo",
+		UID:          501,
+		SSHPubKeys:   []string{"ssh-rsa dummy foo@example.com"},
+		DNSAddresses: []string{"192.168.5.3"},
+	}
+	layout, err := ExecuteTemplate(args)
+	assert.NilError(t, err)
+	for _, f := range layout {
+		if f.Path != "user-data" {
+			continue
+		}
+		b, err := io.ReadAll(f.Reader)
+		assert.NilError(t, err)
+		merged, err := mergeUserData(b, []byte("#cloud-config\npackages: [vim]\n"))
+		assert.NilError(t, err)
+		assert.Assert(t, strings.Contains(string(merged), "name: foo"))
+		assert.Assert(t, strings.Contains(string(merged), "- vim"))
+		return
+	}
+	t.Fatal("user-data was not found")
+}
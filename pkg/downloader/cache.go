@@ -0,0 +1,159 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// CacheDirEnv overrides the cache dir used by WithCache.
+	CacheDirEnv = "LIMA_CACHE_DIR"
+	// CacheMaxSizeEnv limits the size of the cache used by WithCache, e.g. "20GiB".
+	CacheMaxSizeEnv = "LIMA_CACHE_MAX_SIZE"
+)
+
+// CacheDir returns $LIMA_CACHE_DIR, or filepath.Join(os.UserCacheDir(), "lima") when the variable is not set.
+func CacheDir() (string, error) {
+	if dir := os.Getenv(CacheDirEnv); dir != "" {
+		return dir, nil
+	}
+	ucd, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(ucd, "lima"), nil
+}
+
+// CacheMaxSize returns the value of $LIMA_CACHE_MAX_SIZE in bytes, or 0 (unlimited) when the variable is not set.
+func CacheMaxSize() (int64, error) {
+	s := os.Getenv(CacheMaxSizeEnv)
+	if s == "" {
+		return 0, nil
+	}
+	size, err := units.RAMInBytes(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid $%s: %w", CacheMaxSizeEnv, err)
+	}
+	return size, nil
+}
+
+// CacheEntry is a cached download.
+type CacheEntry struct {
+	Path     string // "/Users/foo/Library/Caches/lima/download/by-url-sha256/<SHA256_OF_URL>"
+	URL      string
+	Size     int64
+	LastUsed time.Time // the modification time of the `data` file
+}
+
+func cacheEntriesDir(cacheDir string) string {
+	return filepath.Join(cacheDir, "download", "by-url-sha256")
+}
+
+// CacheEntries returns the cached downloads in the cache dir, least recently used first.
+func CacheEntries(cacheDir string) ([]CacheEntry, error) {
+	dirEntries, err := os.ReadDir(cacheEntriesDir(cacheDir))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var entries []CacheEntry
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() {
+			continue
+		}
+		entry := CacheEntry{
+			Path: filepath.Join(cacheEntriesDir(cacheDir), dirEntry.Name()),
+		}
+		if b, err := os.ReadFile(filepath.Join(entry.Path, "url")); err == nil {
+			entry.URL = string(b)
+		}
+		if st, err := os.Stat(filepath.Join(entry.Path, "data")); err == nil {
+			entry.LastUsed = st.ModTime()
+		}
+		err := filepath.WalkDir(entry.Path, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.Type().IsRegular() {
+				info, err := d.Info()
+				if err != nil {
+					return err
+				}
+				entry.Size += info.Size()
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].LastUsed.Before(entries[j].LastUsed)
+	})
+	return entries, nil
+}
+
+// CacheSize returns the total size of the cached downloads in the cache dir.
+func CacheSize(cacheDir string) (int64, error) {
+	entries, err := CacheEntries(cacheDir)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, entry := range entries {
+		total += entry.Size
+	}
+	return total, nil
+}
+
+// PruneCache removes the least recently used downloads from the cache dir,
+// until the total size does not exceed maxSize.
+func PruneCache(cacheDir string, maxSize int64) error {
+	return pruneCache(cacheDir, maxSize, "")
+}
+
+// pruneCache is like PruneCache but never removes the entry keep.
+func pruneCache(cacheDir string, maxSize int64, keep string) error {
+	entries, err := CacheEntries(cacheDir)
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, entry := range entries {
+		total += entry.Size
+	}
+	for _, entry := range entries {
+		if total <= maxSize {
+			break
+		}
+		if entry.Path == keep {
+			continue
+		}
+		logrus.Infof("Evicting %q (%s) from the cache", entry.URL, units.BytesSize(float64(entry.Size)))
+		if err := os.RemoveAll(entry.Path); err != nil {
+			return err
+		}
+		total -= entry.Size
+	}
+	if total > maxSize {
+		logrus.Warnf("The cache size (%s) exceeds the limit (%s)",
+			units.BytesSize(float64(total)), units.BytesSize(float64(maxSize)))
+	}
+	return nil
+}
+
+// ClearCache removes the cache dir, including the cached downloads and any other files in it.
+func ClearCache(cacheDir string) error {
+	return os.RemoveAll(cacheDir)
+}
@@ -0,0 +1,78 @@
+package downloader
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestCache(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat("x", 100)))
+	}))
+	t.Cleanup(ts.Close)
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+
+	for i, name := range []string{"a", "b", "c"} {
+		_, err := Download("", ts.URL+"/"+name, WithCacheDir(cacheDir), WithRetry(1, 0))
+		assert.NilError(t, err)
+		entries, err := CacheEntries(cacheDir)
+		assert.NilError(t, err)
+		// make the order of the modification times deterministic
+		past := time.Now().Add(time.Duration(i-10) * time.Minute)
+		assert.NilError(t, os.Chtimes(filepath.Join(entries[len(entries)-1].Path, "data"), past, past))
+	}
+	size, err := CacheSize(cacheDir)
+	assert.NilError(t, err)
+	assert.Equal(t, int64(3*100+len(ts.URL+"/a")*3), size)
+
+	// using "a" from the cache makes "b" the least recently used one
+	r, err := Download("", ts.URL+"/a", WithCacheDir(cacheDir))
+	assert.NilError(t, err)
+	assert.Equal(t, StatusUsedCache, r.Status)
+	assert.DeepEqual(t, cachedURLs(t, cacheDir), []string{ts.URL + "/b", ts.URL + "/c", ts.URL + "/a"})
+
+	// downloading "d" evicts "b" and "c"
+	_, err = Download("", ts.URL+"/d", WithCacheDir(cacheDir), WithCacheMaxSize(250), WithRetry(1, 0))
+	assert.NilError(t, err)
+	urls := cachedURLs(t, cacheDir)
+	sort.Strings(urls)
+	assert.DeepEqual(t, urls, []string{ts.URL + "/a", ts.URL + "/d"})
+
+	entries, err := CacheEntries(cacheDir)
+	assert.NilError(t, err)
+	for _, entry := range entries {
+		if entry.URL == ts.URL+"/d" {
+			past := time.Now().Add(-time.Hour)
+			assert.NilError(t, os.Chtimes(filepath.Join(entry.Path, "data"), past, past))
+		}
+	}
+	assert.NilError(t, PruneCache(cacheDir, 150))
+	assert.DeepEqual(t, cachedURLs(t, cacheDir), []string{ts.URL + "/a"})
+
+	assert.NilError(t, os.WriteFile(filepath.Join(cacheDir, "other"), nil, 0644))
+	assert.NilError(t, ClearCache(cacheDir))
+	size, err = CacheSize(cacheDir)
+	assert.NilError(t, err)
+	assert.Equal(t, int64(0), size)
+	_, err = os.Stat(cacheDir)
+	assert.Assert(t, errors.Is(err, os.ErrNotExist))
+}
+
+func cachedURLs(t *testing.T, cacheDir string) []string {
+	entries, err := CacheEntries(cacheDir)
+	assert.NilError(t, err)
+	var urls []string
+	for _, entry := range entries {
+		urls = append(urls, entry.URL)
+	}
+	return urls
+}
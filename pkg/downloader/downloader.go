@@ -1,14 +1,19 @@
 package downloader
 
 import (
+	"context"
 	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/cheggaaa/pb/v3"
@@ -17,6 +22,7 @@ import (
 	"github.com/mattn/go-isatty"
 	"github.com/opencontainers/go-digest"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/net/http/httpproxy"
 )
 
 type Status = string
@@ -32,24 +38,44 @@ type Result struct {
 	Status          Status
 	CachePath       string // "/Users/foo/Library/Caches/lima/download/by-url-sha256/<SHA256_OF_URL>/data"
 	ValidatedDigest bool
+	// Remote is the remote location that was used, set by DownloadMirrors
+	Remote string
 }
 
+const (
+	DefaultMaxAttempts  = 5
+	DefaultRetryBackoff = time.Second
+	maxRetryBackoff     = 30 * time.Second
+)
+
 type options struct {
 	cacheDir       string // default: empty (disables caching)
+	cacheMaxSize   int64  // default: 0 (unlimited)
 	expectedDigest digest.Digest
+	maxAttempts    int             // default: DefaultMaxAttempts
+	retryBackoff   time.Duration   // default: DefaultRetryBackoff
+	proxy          string          // default: empty (use $HTTPS_PROXY and $HTTP_PROXY)
+	caCert         string          // default: empty (use the system CA pool only)
+	ctx            context.Context // default: context.Background()
 }
 
 type Opt func(*options) error
 
-// WithCache enables caching using filepath.Join(os.UserCacheDir(), "lima") as the cache dir.
+// WithCache enables caching using CacheDir() as the cache dir, limited to CacheMaxSize().
 func WithCache() Opt {
 	return func(o *options) error {
-		ucd, err := os.UserCacheDir()
+		cacheDir, err := CacheDir()
+		if err != nil {
+			return err
+		}
+		maxSize, err := CacheMaxSize()
 		if err != nil {
 			return err
 		}
-		cacheDir := filepath.Join(ucd, "lima")
-		return WithCacheDir(cacheDir)(o)
+		if err := WithCacheDir(cacheDir)(o); err != nil {
+			return err
+		}
+		return WithCacheMaxSize(maxSize)(o)
 	}
 }
 
@@ -62,6 +88,19 @@ func WithCacheDir(cacheDir string) Opt {
 	}
 }
 
+// WithCacheMaxSize limits the total size of the cache dir.
+// The least recently used downloads are evicted after downloading a new one, when the limit is exceeded.
+// Zero value means unlimited.
+func WithCacheMaxSize(maxSize int64) Opt {
+	return func(o *options) error {
+		if maxSize < 0 {
+			return fmt.Errorf("expected the max cache size to be non-negative, got %d", maxSize)
+		}
+		o.cacheMaxSize = maxSize
+		return nil
+	}
+}
+
 // WithExpectedDigest is used to validate the downloaded file against the expected digest.
 //
 // The digest is not verified in the following cases:
@@ -87,6 +126,69 @@ func WithExpectedDigest(expectedDigest digest.Digest) Opt {
 	}
 }
 
+// WithRetry sets the max number of attempts for downloading a remote resource,
+// and the initial backoff between the attempts. The backoff is doubled after each attempt.
+//
+// Only transient failures are retried: HTTP 5xx, HTTP 429, and connection resets.
+// maxAttempts = 1 disables retrying.
+func WithRetry(maxAttempts int, backoff time.Duration) Opt {
+	return func(o *options) error {
+		if maxAttempts < 1 {
+			return fmt.Errorf("expected max attempts to be at least 1, got %d", maxAttempts)
+		}
+		if backoff < 0 {
+			return fmt.Errorf("expected backoff to be non-negative, got %v", backoff)
+		}
+		o.maxAttempts = maxAttempts
+		o.retryBackoff = backoff
+		return nil
+	}
+}
+
+// WithContext sets the context for downloading remote resources.
+// Canceling ctx aborts the download in progress, and stops retrying.
+func WithContext(ctx context.Context) Opt {
+	return func(o *options) error {
+		if ctx == nil {
+			return errors.New("expected a non-nil context")
+		}
+		o.ctx = ctx
+		return nil
+	}
+}
+
+// WithProxy sets the proxy URL for downloading remote resources, overriding $HTTPS_PROXY and $HTTP_PROXY.
+// $NO_PROXY is still honored.
+// Empty value falls back to the environment variables.
+func WithProxy(proxy string) Opt {
+	return func(o *options) error {
+		if proxy != "" {
+			if _, err := url.Parse(proxy); err != nil {
+				return fmt.Errorf("invalid proxy URL %q: %w", proxy, err)
+			}
+		}
+		o.proxy = proxy
+		return nil
+	}
+}
+
+// WithCACert sets the path of a PEM bundle of the CA certificates to be trusted
+// in addition to the system CA pool.
+// Empty value uses the system CA pool only.
+func WithCACert(caCert string) Opt {
+	return func(o *options) error {
+		if caCert != "" {
+			var err error
+			caCert, err = localpathutil.Expand(caCert)
+			if err != nil {
+				return err
+			}
+		}
+		o.caCert = caCert
+		return nil
+	}
+}
+
 // Download downloads the remote resource into the local path.
 //
 // Download caches the remote resource if WithCache or WithCacheDir option is specified.
@@ -97,7 +199,11 @@ func WithExpectedDigest(expectedDigest digest.Digest) Opt {
 //
 // The local path can be an empty string for "caching only" mode.
 func Download(local, remote string, opts ...Opt) (*Result, error) {
-	var o options
+	o := options{
+		maxAttempts:  DefaultMaxAttempts,
+		retryBackoff: DefaultRetryBackoff,
+		ctx:          context.Background(),
+	}
 	for _, f := range opts {
 		if err := f(&o); err != nil {
 			return nil, err
@@ -143,7 +249,7 @@ func Download(local, remote string, opts ...Opt) (*Result, error) {
 	}
 
 	if o.cacheDir == "" {
-		if err := downloadHTTP(localPath, remote, o.expectedDigest); err != nil {
+		if err := downloadHTTPWithRetry(localPath, remote, o); err != nil {
 			return nil, err
 		}
 		res := &Result{
@@ -165,6 +271,11 @@ func Download(local, remote string, opts ...Opt) (*Result, error) {
 	}
 	if _, err := os.Stat(shadData); err == nil {
 		logrus.Debugf("file %q is cached as %q", localPath, shadData)
+		// the modification time of the data file is used for evicting the least recently used entries
+		now := time.Now()
+		if err := os.Chtimes(shadData, now, now); err != nil {
+			logrus.WithError(err).Warnf("failed to update the modification time of %q", shadData)
+		}
 		if shadDigestB, err := os.ReadFile(shadDigest); err == nil {
 			logrus.Debugf("Comparing digest %q with the cached digest file %q, not computing the actual digest of %q",
 				o.expectedDigest, shadDigest, shadData)
@@ -197,7 +308,7 @@ func Download(local, remote string, opts ...Opt) (*Result, error) {
 	if err := os.WriteFile(shadURL, []byte(remote), 0644); err != nil {
 		return nil, err
 	}
-	if err := downloadHTTP(shadData, remote, o.expectedDigest); err != nil {
+	if err := downloadHTTPWithRetry(shadData, remote, o); err != nil {
 		return nil, err
 	}
 	// no need to pass the digest to copyLocal(), as we already verified the digest
@@ -209,6 +320,11 @@ func Download(local, remote string, opts ...Opt) (*Result, error) {
 			return nil, err
 		}
 	}
+	if o.cacheMaxSize > 0 {
+		if err := pruneCache(o.cacheDir, o.cacheMaxSize, shad); err != nil {
+			logrus.WithError(err).Warnf("failed to prune the cache %q", o.cacheDir)
+		}
+	}
 	res := &Result{
 		Status:          StatusDownloaded,
 		CachePath:       shadData,
@@ -217,6 +333,38 @@ func Download(local, remote string, opts ...Opt) (*Result, error) {
 	return res, nil
 }
 
+// DownloadMirrors is like Download, but tries the remote mirrors in order until one succeeds.
+// All the mirrors are expected to serve the same content, so the same options (including
+// the expected digest) apply to all of them.
+//
+// Result.Remote is set to the mirror that succeeded.
+// The remaining mirrors are not tried once the context of WithContext is done.
+func DownloadMirrors(local string, remotes []string, opts ...Opt) (*Result, error) {
+	if len(remotes) == 0 {
+		return nil, errors.New("no remote location was specified")
+	}
+	var errs []error
+	for i, remote := range remotes {
+		res, err := Download(local, remote, opts...)
+		if err != nil {
+			if len(remotes) > 1 {
+				logrus.WithError(err).Warnf("Failed to download %q (mirror %d/%d)", remote, i+1, len(remotes))
+			}
+			errs = append(errs, fmt.Errorf("failed to download %q: %w", remote, err))
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				break
+			}
+			continue
+		}
+		res.Remote = remote
+		return res, nil
+	}
+	if len(errs) == 1 {
+		return nil, errs[0]
+	}
+	return nil, fmt.Errorf("failed to download from %d mirrors, errors=%v", len(remotes), errs)
+}
+
 func IsLocal(s string) bool {
 	return !strings.Contains(s, "://") || strings.HasPrefix(s, "file://")
 }
@@ -309,7 +457,93 @@ func createBar(size int64) (*pb.ProgressBar, error) {
 	return bar, nil
 }
 
-func downloadHTTP(localPath, url string, expectedDigest digest.Digest) error {
+// httpStatusError is returned by downloadHTTP for an unexpected HTTP status.
+type httpStatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("expected HTTP status %d, got %s", http.StatusOK, e.Status)
+}
+
+// isRetriable returns true for transient errors: HTTP 5xx, HTTP 429, and connection resets.
+func isRetriable(err error) bool {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500 || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func httpClient(o options) (*http.Client, error) {
+	proxyConfig := httpproxy.FromEnvironment()
+	if o.proxy != "" {
+		proxyConfig.HTTPProxy = o.proxy
+		proxyConfig.HTTPSProxy = o.proxy
+	}
+	proxyFunc := proxyConfig.ProxyFunc()
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.Proxy = func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}
+	if o.caCert != "" {
+		pem, err := os.ReadFile(o.caCert)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			logrus.WithError(err).Warn("Failed to load the system CA pool")
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate was found in %q", o.caCert)
+		}
+		tr.TLSClientConfig = &tls.Config{
+			RootCAs:    pool,
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+	return &http.Client{Transport: tr}, nil
+}
+
+func downloadHTTPWithRetry(localPath, url string, o options) error {
+	client, err := httpClient(o)
+	if err != nil {
+		return err
+	}
+	backoff := o.retryBackoff
+	for attempt := 1; ; attempt++ {
+		err := downloadHTTP(o.ctx, client, localPath, url, o.expectedDigest)
+		if err == nil {
+			if attempt > 1 {
+				logrus.Infof("Downloaded %q (attempt %d/%d)", url, attempt, o.maxAttempts)
+			}
+			return nil
+		}
+		if attempt >= o.maxAttempts || !isRetriable(err) {
+			if attempt > 1 {
+				return fmt.Errorf("failed to download %q after %d attempts: %w", url, attempt, err)
+			}
+			return err
+		}
+		logrus.WithError(err).Warnf("Failed to download %q (attempt %d/%d), retrying in %v", url, attempt, o.maxAttempts, backoff)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-o.ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("failed to download %q after %d attempts: %w", url, attempt, o.ctx.Err())
+		case <-timer.C:
+		}
+		backoff *= 2
+		if backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+func downloadHTTP(ctx context.Context, client *http.Client, localPath, url string, expectedDigest digest.Digest) error {
 	if localPath == "" {
 		return fmt.Errorf("downloadHTTP: got empty localPath")
 	}
@@ -324,13 +558,17 @@ func downloadHTTP(localPath, url string, expectedDigest digest.Digest) error {
 	}
 	defer fileWriter.Close()
 
-	resp, err := http.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("expected HTTP status %d, got %s", http.StatusOK, resp.Status)
+		return &httpStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
 	}
 	bar, err := createBar(resp.ContentLength)
 	if err != nil {
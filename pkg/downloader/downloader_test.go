@@ -1,8 +1,14 @@
 package downloader
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/opencontainers/go-digest"
 	"gotest.tools/v3/assert"
@@ -80,3 +86,100 @@ func TestDownloadRemote(t *testing.T) {
 		assert.Equal(t, StatusUsedCache, r.Status)
 	})
 }
+
+func TestDownloadRetry(t *testing.T) {
+	const content = "hello"
+	newServer := func(failures, failStatus int) (*httptest.Server, *int) {
+		var requests int
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if requests <= failures {
+				w.WriteHeader(failStatus)
+				return
+			}
+			_, _ = w.Write([]byte(content))
+		}))
+		t.Cleanup(ts.Close)
+		return ts, &requests
+	}
+	t.Run("transient", func(t *testing.T) {
+		ts, requests := newServer(2, http.StatusServiceUnavailable)
+		localPath := filepath.Join(t.TempDir(), "data")
+		r, err := Download(localPath, ts.URL, WithRetry(3, 0))
+		assert.NilError(t, err)
+		assert.Equal(t, StatusDownloaded, r.Status)
+		assert.Equal(t, 3, *requests)
+		b, err := os.ReadFile(localPath)
+		assert.NilError(t, err)
+		assert.Equal(t, content, string(b))
+	})
+	t.Run("too many attempts", func(t *testing.T) {
+		ts, requests := newServer(3, http.StatusTooManyRequests)
+		_, err := Download(filepath.Join(t.TempDir(), "data"), ts.URL, WithRetry(3, 0))
+		assert.ErrorContains(t, err, "after 3 attempts")
+		assert.Equal(t, 3, *requests)
+	})
+	t.Run("not found", func(t *testing.T) {
+		ts, requests := newServer(1, http.StatusNotFound)
+		_, err := Download(filepath.Join(t.TempDir(), "data"), ts.URL, WithRetry(3, 0))
+		assert.ErrorContains(t, err, "404")
+		assert.Equal(t, 1, *requests)
+	})
+	t.Run("canceled", func(t *testing.T) {
+		ts, requests := newServer(3, http.StatusServiceUnavailable)
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		// the backoff is interrupted by the context, instead of sleeping for an hour
+		_, err := Download(filepath.Join(t.TempDir(), "data"), ts.URL, WithRetry(3, time.Hour), WithContext(ctx))
+		assert.Assert(t, errors.Is(err, context.DeadlineExceeded), err)
+		assert.Equal(t, 1, *requests)
+	})
+}
+
+func TestDownloadMirrors(t *testing.T) {
+	const content = "hello"
+	contentDigest := digest.FromString(content)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			_, _ = w.Write([]byte(content))
+		case "/corrupted":
+			_, _ = w.Write([]byte("corrupted"))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	t.Cleanup(ts.Close)
+
+	localPath := filepath.Join(t.TempDir(), "data")
+	mirrors := []string{ts.URL + "/blocked", ts.URL + "/corrupted", ts.URL + "/ok"}
+	r, err := DownloadMirrors(localPath, mirrors, WithExpectedDigest(contentDigest), WithRetry(1, 0))
+	assert.NilError(t, err)
+	assert.Equal(t, StatusDownloaded, r.Status)
+	assert.Equal(t, ts.URL+"/ok", r.Remote)
+
+	_, err = DownloadMirrors(filepath.Join(t.TempDir(), "data"), mirrors[:2], WithExpectedDigest(contentDigest), WithRetry(1, 0))
+	assert.ErrorContains(t, err, "failed to download from 2 mirrors")
+}
+
+func TestDownloadProxy(t *testing.T) {
+	const content = "hello"
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		_, _ = w.Write([]byte(content))
+	}))
+	t.Cleanup(proxy.Close)
+	t.Setenv("HTTP_PROXY", "http://127.0.0.1:1")
+	t.Setenv("NO_PROXY", "")
+
+	localPath := filepath.Join(t.TempDir(), "data")
+	_, err := Download(localPath, "http://lima.invalid/data", WithProxy(proxy.URL), WithRetry(1, 0))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, proxied, []string{"http://lima.invalid/data"})
+
+	t.Setenv("NO_PROXY", "lima.invalid")
+	_, err = Download(filepath.Join(t.TempDir(), "data"), "http://lima.invalid/data", WithProxy(proxy.URL), WithRetry(1, 0))
+	assert.ErrorContains(t, err, "lima.invalid")
+	assert.Equal(t, 1, len(proxied))
+}
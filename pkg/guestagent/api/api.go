@@ -10,6 +10,9 @@ var (
 	IPv4loopback1 = net.IPv4(127, 0, 0, 1)
 )
 
+// VSockPort is the vsock port of the guest agent, when the guest has a vsock device.
+const VSockPort = 2222
+
 type IPPort struct {
 	IP   net.IP `json:"ip"`
 	Port int    `json:"port"`
@@ -34,3 +37,26 @@ type Event struct {
 	LocalPortsRemoved []IPPort `json:"localPortsRemoved,omitempty"`
 	Errors            []string `json:"errors,omitempty"`
 }
+
+// ExecRequest is the request of POST /v{N}/exec.
+type ExecRequest struct {
+	// Args is the command and its arguments. The command is looked up in PATH of the guest agent.
+	Args []string `json:"args"`
+	// Stdin is written to the standard input of the command.
+	Stdin []byte `json:"stdin,omitempty"`
+	// Timeout is the timeout in seconds, after which the command and its children are killed.
+	// 0 means no timeout.
+	Timeout int `json:"timeout,omitempty"`
+}
+
+// ExecEvent is streamed in the response of POST /v{N}/exec.
+// The output of the command is split into multiple events; the last event has Exited set.
+type ExecEvent struct {
+	Stdout []byte `json:"stdout,omitempty"`
+	Stderr []byte `json:"stderr,omitempty"`
+	Exited bool   `json:"exited,omitempty"`
+	// ExitCode is -1 when the command could not be started, or was killed by a signal.
+	ExitCode int `json:"exitCode,omitempty"`
+	// Error is set when the command could not be started, or timed out.
+	Error string `json:"error,omitempty"`
+}
@@ -4,9 +4,12 @@ package client
 // Apache License 2.0
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 
 	"github.com/lima-vm/lima/pkg/guestagent/api"
@@ -17,6 +20,9 @@ type GuestAgentClient interface {
 	HTTPClient() *http.Client
 	Info(context.Context) (*api.Info, error)
 	Events(context.Context, func(api.Event)) error
+	// Exec runs the command in the guest, and copies the output to stdout and stderr as it is received.
+	// The exit code of the command is returned.
+	Exec(ctx context.Context, req api.ExecRequest, stdout, stderr io.Writer) (int, error)
 }
 
 // NewGuestAgentClient creates a client.
@@ -80,3 +86,46 @@ func (c *client) Events(ctx context.Context, onEvent func(api.Event)) error {
 		onEvent(ev)
 	}
 }
+
+func (c *client) Exec(ctx context.Context, req api.ExecRequest, stdout, stderr io.Writer) (int, error) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return -1, err
+	}
+	u := fmt.Sprintf("http://%s/%s/exec", c.dummyHost, c.version)
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", u, bytes.NewReader(b))
+	if err != nil {
+		return -1, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := c.HTTPClient().Do(httpReq)
+	if err != nil {
+		return -1, err
+	}
+	defer resp.Body.Close()
+	if err := httpclientutil.Successful(resp); err != nil {
+		return -1, err
+	}
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var ev api.ExecEvent
+		if err := dec.Decode(&ev); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return -1, fmt.Errorf("failed to receive the output of %v: %w", req.Args, err)
+		}
+		if _, err := stdout.Write(ev.Stdout); err != nil {
+			return -1, err
+		}
+		if _, err := stderr.Write(ev.Stderr); err != nil {
+			return -1, err
+		}
+		if ev.Exited {
+			if ev.Error != "" {
+				return ev.ExitCode, fmt.Errorf("failed to execute %v: %s", req.Args, ev.Error)
+			}
+			return ev.ExitCode, nil
+		}
+	}
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/gorilla/mux"
@@ -76,8 +77,48 @@ func (b *Backend) GetEvents(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// PostExec is the handler for POST /v{N}/exec.
+// The request body is api.ExecRequest, and the response is the stream of api.ExecEvent.
+func (b *Backend) PostExec(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var req api.ExecRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		b.onError(w, r, err, http.StatusBadRequest)
+		return
+	}
+	if len(req.Args) == 0 {
+		b.onError(w, r, errors.New("args must not be empty"), http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		panic("http.ResponseWriter has to implement http.Flusher")
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ch := make(chan api.ExecEvent)
+	go b.Agent.Exec(ctx, req, ch)
+
+	enc := json.NewEncoder(w)
+	for ev := range ch {
+		if err := enc.Encode(ev); err != nil {
+			logrus.Warn(err)
+			return
+		}
+		flusher.Flush()
+	}
+}
+
 func AddRoutes(r *mux.Router, b *Backend) {
 	v1 := r.PathPrefix("/v1").Subrouter()
 	v1.Path("/info").Methods("GET").HandlerFunc(b.GetInfo)
 	v1.Path("/events").Methods("GET").HandlerFunc(b.GetEvents)
+	v1.Path("/exec").Methods("POST").HandlerFunc(b.PostExec)
 }
@@ -0,0 +1,128 @@
+package guestagent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/guestagent/api"
+	"github.com/sirupsen/logrus"
+)
+
+// execChunkSize is the maximum size of the output in a single ExecEvent.
+const execChunkSize = 32 * 1024
+
+type execCredentialKey struct{}
+
+type execCredential struct {
+	cred *syscall.Credential
+	err  error
+}
+
+// WithExecCredential returns a context for running the commands of Exec with cred,
+// i.e., with the credential of the peer of the UNIX socket.
+// When err is not nil, Exec refuses to run commands, and returns err as the error of the command.
+// Without WithExecCredential, the commands run with the credential of the guest agent.
+func WithExecCredential(ctx context.Context, cred *syscall.Credential, err error) context.Context {
+	return context.WithValue(ctx, execCredentialKey{}, execCredential{cred: cred, err: err})
+}
+
+// execOutputWriter sends the output written by the command as ExecEvents.
+type execOutputWriter struct {
+	ctx    context.Context
+	ch     chan api.ExecEvent
+	stderr bool
+}
+
+func (w *execOutputWriter) Write(p []byte) (int, error) {
+	for n := 0; n < len(p); {
+		chunk := p[n:]
+		if len(chunk) > execChunkSize {
+			chunk = chunk[:execChunkSize]
+		}
+		// p must not be retained
+		b := append([]byte(nil), chunk...)
+		var ev api.ExecEvent
+		if w.stderr {
+			ev.Stderr = b
+		} else {
+			ev.Stdout = b
+		}
+		select {
+		case <-w.ctx.Done():
+			return n, w.ctx.Err()
+		case w.ch <- ev:
+		}
+		n += len(chunk)
+	}
+	return len(p), nil
+}
+
+func (a *agent) Exec(ctx context.Context, req api.ExecRequest, ch chan api.ExecEvent) {
+	defer close(ch)
+	res := a.exec(ctx, req, ch)
+	res.Exited = true
+	select {
+	case <-ctx.Done():
+	case ch <- res:
+	}
+}
+
+func (a *agent) exec(ctx context.Context, req api.ExecRequest, ch chan api.ExecEvent) api.ExecEvent {
+	failed := func(err error) api.ExecEvent {
+		return api.ExecEvent{ExitCode: -1, Error: err.Error()}
+	}
+	if len(req.Args) == 0 {
+		return failed(errors.New("no command was specified"))
+	}
+	attr := &syscall.SysProcAttr{
+		// The process group is killed on timeout, so that the children do not keep the output open
+		Setpgid: true,
+	}
+	if v, ok := ctx.Value(execCredentialKey{}).(execCredential); ok {
+		if v.err != nil {
+			return failed(v.err)
+		}
+		attr.Credential = v.cred
+	}
+	cmd := exec.Command(req.Args[0], req.Args[1:]...)
+	cmd.SysProcAttr = attr
+	cmd.Stdin = bytes.NewReader(req.Stdin)
+	cmd.Stdout = &execOutputWriter{ctx: ctx, ch: ch}
+	cmd.Stderr = &execOutputWriter{ctx: ctx, ch: ch, stderr: true}
+	logrus.Debugf("executing %v", req.Args)
+	if err := cmd.Start(); err != nil {
+		return failed(err)
+	}
+
+	killCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if req.Timeout > 0 {
+		killCtx, cancel = context.WithTimeout(killCtx, time.Duration(req.Timeout)*time.Second)
+		defer cancel()
+	}
+	waitCh := make(chan error, 1)
+	go func() {
+		waitCh <- cmd.Wait()
+	}()
+	var err error
+	select {
+	case err = <-waitCh:
+	case <-killCtx.Done():
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		err = <-waitCh
+	}
+	res := api.ExecEvent{ExitCode: cmd.ProcessState.ExitCode()}
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(killCtx.Err(), context.DeadlineExceeded):
+		res.Error = fmt.Sprintf("timed out after %d seconds", req.Timeout)
+	case err != nil && !errors.As(err, &exitErr):
+		res.Error = err.Error()
+	}
+	return res
+}
@@ -0,0 +1,61 @@
+package guestagent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/guestagent/api"
+	"gotest.tools/v3/assert"
+)
+
+func runExec(t *testing.T, req api.ExecRequest) (string, string, api.ExecEvent) {
+	return runExecContext(t, context.Background(), req)
+}
+
+func runExecContext(t *testing.T, ctx context.Context, req api.ExecRequest) (string, string, api.ExecEvent) {
+	ch := make(chan api.ExecEvent)
+	go (&agent{}).Exec(ctx, req, ch)
+	var stdout, stderr strings.Builder
+	var last api.ExecEvent
+	for ev := range ch {
+		stdout.Write(ev.Stdout)
+		stderr.Write(ev.Stderr)
+		last = ev
+	}
+	assert.Assert(t, last.Exited)
+	return stdout.String(), stderr.String(), last
+}
+
+func TestExec(t *testing.T) {
+	stdout, stderr, res := runExec(t, api.ExecRequest{
+		Args:  []string{"sh", "-c", "cat; echo err >&2; exit 3"},
+		Stdin: []byte("out\n"),
+	})
+	assert.Equal(t, "out\n", stdout)
+	assert.Equal(t, "err\n", stderr)
+	assert.Equal(t, 3, res.ExitCode)
+	assert.Equal(t, "", res.Error)
+
+	// larger than execChunkSize
+	stdout, _, res = runExec(t, api.ExecRequest{Args: []string{"head", "-c", "100000", "/dev/zero"}})
+	assert.Equal(t, 100000, len(stdout))
+	assert.Equal(t, 0, res.ExitCode)
+
+	_, _, res = runExec(t, api.ExecRequest{Args: []string{"sh", "-c", "sleep 10 & sleep 10"}, Timeout: 1})
+	assert.Equal(t, -1, res.ExitCode)
+	assert.Assert(t, strings.Contains(res.Error, "timed out"), res.Error)
+
+	_, _, res = runExec(t, api.ExecRequest{Args: []string{"/nonexistent"}})
+	assert.Equal(t, -1, res.ExitCode)
+	assert.Assert(t, strings.Contains(res.Error, "no such file"), res.Error)
+}
+
+func TestExecRefused(t *testing.T) {
+	ctx := WithExecCredential(context.Background(), nil, errors.New("not allowed"))
+	stdout, _, res := runExecContext(t, ctx, api.ExecRequest{Args: []string{"echo", "foo"}})
+	assert.Equal(t, "", stdout)
+	assert.Equal(t, -1, res.ExitCode)
+	assert.Equal(t, "not allowed", res.Error)
+}
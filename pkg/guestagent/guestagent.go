@@ -10,4 +10,7 @@ type Agent interface {
 	Info(ctx context.Context) (*api.Info, error)
 	Events(ctx context.Context, ch chan api.Event)
 	LocalPorts(ctx context.Context) ([]api.IPPort, error)
+	// Exec runs the command, and sends the output and the exit status to ch.
+	// ch is closed after sending the event with Exited set.
+	Exec(ctx context.Context, req api.ExecRequest, ch chan api.ExecEvent)
 }
@@ -0,0 +1,10 @@
+package hostagent
+
+import "golang.org/x/sys/unix"
+
+// setThreadAffinity pins the thread tid to the host CPU.
+func setThreadAffinity(tid, hostCPU int) error {
+	var set unix.CPUSet
+	set.Set(hostCPU)
+	return unix.SchedSetaffinity(tid, &set)
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package hostagent
+
+import "errors"
+
+// setThreadAffinity is only implemented on Linux, as validated by limayaml.Validate.
+func setThreadAffinity(tid, hostCPU int) error {
+	return errors.New("CPU pinning is only supported on Linux")
+}
@@ -2,4 +2,17 @@ package api
 
 type Info struct {
 	SSHLocalPort int `json:"sshLocalPort,omitempty"`
+	// CPUs is the number of vCPUs currently plugged into the guest (0 when unknown)
+	CPUs int `json:"cpus,omitempty"`
+}
+
+// CPUs is the response of POST /v{N}/cpus/add and POST /v{N}/cpus/remove
+type CPUs struct {
+	CPUs int `json:"cpus"`
+}
+
+// Balloon is the response of GET /v{N}/balloon
+type Balloon struct {
+	// Size is the current memory size of the guest in bytes, as reported by the balloon device
+	Size int64 `json:"size"`
 }
@@ -8,6 +8,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
 
 	"github.com/lima-vm/lima/pkg/hostagent/api"
 	"github.com/lima-vm/lima/pkg/httpclientutil"
@@ -16,6 +18,14 @@ import (
 type HostAgentClient interface {
 	HTTPClient() *http.Client
 	Info(context.Context) (*api.Info, error)
+	AddCPU(context.Context) (int, error)
+	RemoveCPU(context.Context) (int, error)
+	Restart(context.Context) error
+	Reload(context.Context) error
+	Snapshot(ctx context.Context, name string) error
+	RestoreSnapshot(ctx context.Context, name string) error
+	Balloon(context.Context) (int64, error)
+	SetBalloon(ctx context.Context, sizeBytes int64) error
 }
 
 // NewHostAgentClient creates a client.
@@ -62,3 +72,70 @@ func (c *client) Info(ctx context.Context) (*api.Info, error) {
 	}
 	return &info, nil
 }
+
+func (c *client) AddCPU(ctx context.Context) (int, error) {
+	return c.postCPUs(ctx, "add")
+}
+
+func (c *client) RemoveCPU(ctx context.Context) (int, error) {
+	return c.postCPUs(ctx, "remove")
+}
+
+func (c *client) postCPUs(ctx context.Context, action string) (int, error) {
+	u := fmt.Sprintf("http://%s/%s/cpus/%s", c.dummyHost, c.version, action)
+	resp, err := httpclientutil.Post(ctx, c.HTTPClient(), u)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	var cpus api.CPUs
+	dec := json.NewDecoder(resp.Body)
+	if err := dec.Decode(&cpus); err != nil {
+		return 0, err
+	}
+	return cpus.CPUs, nil
+}
+
+func (c *client) Restart(ctx context.Context) error {
+	return c.post(ctx, "restart")
+}
+
+func (c *client) Reload(ctx context.Context) error {
+	return c.post(ctx, "reload")
+}
+
+func (c *client) Snapshot(ctx context.Context, name string) error {
+	return c.post(ctx, "snapshots/"+url.PathEscape(name)+"/save")
+}
+
+func (c *client) RestoreSnapshot(ctx context.Context, name string) error {
+	return c.post(ctx, "snapshots/"+url.PathEscape(name)+"/restore")
+}
+
+func (c *client) Balloon(ctx context.Context) (int64, error) {
+	u := fmt.Sprintf("http://%s/%s/balloon", c.dummyHost, c.version)
+	resp, err := httpclientutil.Get(ctx, c.HTTPClient(), u)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	var balloon api.Balloon
+	dec := json.NewDecoder(resp.Body)
+	if err := dec.Decode(&balloon); err != nil {
+		return 0, err
+	}
+	return balloon.Size, nil
+}
+
+func (c *client) SetBalloon(ctx context.Context, sizeBytes int64) error {
+	return c.post(ctx, "balloon?size="+strconv.FormatInt(sizeBytes, 10))
+}
+
+func (c *client) post(ctx context.Context, path string) error {
+	u := fmt.Sprintf("http://%s/%s/%s", c.dummyHost, c.version, path)
+	resp, err := httpclientutil.Post(ctx, c.HTTPClient(), u)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
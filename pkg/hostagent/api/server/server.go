@@ -1,12 +1,16 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
 	"github.com/lima-vm/lima/pkg/hostagent"
+	"github.com/lima-vm/lima/pkg/hostagent/api"
 	"github.com/lima-vm/lima/pkg/httputil"
 )
 
@@ -46,7 +50,140 @@ func (b *Backend) GetInfo(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write(m)
 }
 
+func (b *Backend) onCPUs(w http.ResponseWriter, r *http.Request, f func(context.Context) (int, error)) {
+	ctx := r.Context()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	n, err := f(ctx)
+	if err != nil {
+		b.onError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	m, err := json.Marshal(api.CPUs{CPUs: n})
+	if err != nil {
+		b.onError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(m)
+}
+
+// PostCPUsAdd is the handler for POST /v{N}/cpus/add
+func (b *Backend) PostCPUsAdd(w http.ResponseWriter, r *http.Request) {
+	b.onCPUs(w, r, b.Agent.AddCPU)
+}
+
+// PostCPUsRemove is the handler for POST /v{N}/cpus/remove
+func (b *Backend) PostCPUsRemove(w http.ResponseWriter, r *http.Request) {
+	b.onCPUs(w, r, b.Agent.RemoveCPU)
+}
+
+// PostRestart is the handler for POST /v{N}/restart
+func (b *Backend) PostRestart(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if err := b.Agent.Restart(ctx); err != nil {
+		b.onError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PostReload is the handler for POST /v{N}/reload
+func (b *Backend) PostReload(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if err := b.Agent.Reload(ctx); err != nil {
+		b.onError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PostSnapshot is the handler for POST /v{N}/snapshots/{name}/save and POST /v{N}/snapshots/{name}/restore
+func (b *Backend) PostSnapshot(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	vars := mux.Vars(r)
+	f := b.Agent.Snapshot
+	if vars["action"] == "restore" {
+		f = b.Agent.RestoreSnapshot
+	}
+	if err := f(ctx, vars["name"]); err != nil {
+		b.onError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetBalloon is the handler for GET /v{N}/balloon
+func (b *Backend) GetBalloon(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	size, err := b.Agent.Balloon(ctx)
+	if err != nil {
+		b.onError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	m, err := json.Marshal(api.Balloon{Size: size})
+	if err != nil {
+		b.onError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(m)
+}
+
+// PostBalloon is the handler for POST /v{N}/balloon?size={BYTES}
+func (b *Backend) PostBalloon(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	size, err := strconv.ParseInt(r.URL.Query().Get("size"), 10, 64)
+	if err != nil {
+		b.onError(w, r, fmt.Errorf("invalid size: %w", err), http.StatusBadRequest)
+		return
+	}
+	if err := b.Agent.SetBalloon(ctx, size); err != nil {
+		b.onError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetMetrics is the handler for GET /v{N}/metrics, in the Prometheus text format
+func (b *Backend) GetMetrics(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	if err := b.Agent.WriteMetrics(&buf); err != nil {
+		b.onError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(buf.Bytes())
+}
+
 func AddRoutes(r *mux.Router, b *Backend) {
 	v1 := r.PathPrefix("/v1").Subrouter()
 	v1.Path("/info").Methods("GET").HandlerFunc(b.GetInfo)
+	v1.Path("/cpus/add").Methods("POST").HandlerFunc(b.PostCPUsAdd)
+	v1.Path("/cpus/remove").Methods("POST").HandlerFunc(b.PostCPUsRemove)
+	v1.Path("/restart").Methods("POST").HandlerFunc(b.PostRestart)
+	v1.Path("/reload").Methods("POST").HandlerFunc(b.PostReload)
+	v1.Path("/snapshots/{name}/{action:save|restore}").Methods("POST").HandlerFunc(b.PostSnapshot)
+	v1.Path("/balloon").Methods("GET").HandlerFunc(b.GetBalloon)
+	v1.Path("/balloon").Methods("POST").HandlerFunc(b.PostBalloon)
+	v1.Path("/metrics").Methods("GET").HandlerFunc(b.GetMetrics)
 }
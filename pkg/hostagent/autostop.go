@@ -0,0 +1,96 @@
+package hostagent
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lima-vm/sshocker/pkg/ssh"
+	"github.com/sirupsen/logrus"
+)
+
+// activityScript prints the number of the interactive sessions, and the number of the TCP connections of sshd
+// other than the SSH connections themselves, i.e., the connections forwarded from the host.
+// The connections forwarded by QEMU (UDP) are not counted.
+const activityScript = `#!/bin/sh
+who | wc -l
+{ sudo -n ss -Htnp state listening; echo --; sudo -n ss -Htnp state established; } 2>/dev/null | awk '` + sshdForwardsAWK + `'
+`
+
+// sshdForwardsAWK counts the established connections of sshd, whose local port is not a port that sshd listens on,
+// in the output of `ss -Htnp state listening` and `ss -Htnp state established` separated by "--".
+// The session processes of sshd are named "sshd-session" since OpenSSH 9.8.
+// When the listening ports are unknown, the SSH connections are counted too, so that the instance is not stopped.
+const sshdForwardsAWK = `
+$0 == "--" { established = 1; next }
+/\("sshd(-session)?",/ {
+	n = split($3, a, ":")
+	if (!established) listen[a[n]] = 1
+	else if (!(a[n] in listen)) c++
+}
+END { print c + 0 }
+`
+
+// parseActivity parses the output of activityScript, and returns the total number of the sessions and the connections.
+func parseActivity(s string) (int, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return 0, fmt.Errorf("expected 2 numbers, got %q", s)
+	}
+	total := 0
+	for _, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse %q: %w", s, err)
+		}
+		total += n
+	}
+	return total, nil
+}
+
+func (a *HostAgent) sampleActivity() (int, error) {
+	stdout, stderr, err := ssh.ExecuteScript("127.0.0.1", a.sshLocalPort, a.sshConfig, activityScript, "sample activity")
+	if err != nil {
+		return 0, fmt.Errorf("stdout=%q, stderr=%q: %w", stdout, stderr, err)
+	}
+	return parseActivity(stdout)
+}
+
+// watchIdle shuts down the instance when there have been no interactive sessions and no forwarded connections
+// for `autoStop.idleTimeout` seconds. The activity is sampled every minute, or more often for a shorter timeout.
+// A failed sample is considered to be an activity, so that the instance is not stopped when the state is unknown.
+func (a *HostAgent) watchIdle(ctx context.Context) {
+	timeout := time.Duration(*a.limaYAML().AutoStop.IdleTimeout) * time.Second
+	if timeout == 0 {
+		return
+	}
+	interval := time.Minute
+	if timeout < interval {
+		interval = timeout
+	}
+	lastActive := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		n, err := a.sampleActivity()
+		if err != nil {
+			logrus.WithError(err).Debug("failed to sample the activity of the guest")
+		}
+		if err != nil || n > 0 {
+			lastActive = time.Now()
+			continue
+		}
+		if idle := time.Since(lastActive); idle >= timeout {
+			logrus.Infof("The instance has been idle for %v (autoStop.idleTimeout), shutting down", idle.Round(time.Second))
+			a.shutdownOnce.Do(func() {
+				close(a.shutdownCh)
+			})
+			return
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package hostagent
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParseActivity(t *testing.T) {
+	n, err := parseActivity("0\n0\n")
+	assert.NilError(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = parseActivity("1\n2\n")
+	assert.NilError(t, err)
+	assert.Equal(t, 3, n)
+
+	_, err = parseActivity("1\n")
+	assert.ErrorContains(t, err, "expected 2 numbers")
+
+	_, err = parseActivity("1\nfoo\n")
+	assert.ErrorContains(t, err, "failed to parse")
+}
+
+func TestSSHDForwardsAWK(t *testing.T) {
+	if _, err := exec.LookPath("awk"); err != nil {
+		t.Skip(err)
+	}
+	const ssOutput = `0      128          0.0.0.0:22         0.0.0.0:*     users:(("sshd",pid=700,fd=3))
+0      4096       127.0.0.1:8080       0.0.0.0:*     users:(("nginx",pid=800,fd=6))
+0      128             [::]:22            [::]:*     users:(("sshd",pid=700,fd=4))
+--
+0      0          10.0.2.15:22        10.0.2.2:50000 users:(("sshd-session",pid=900,fd=4),("sshd-session",pid=901,fd=4))
+0      0          10.0.2.15:22        10.0.2.2:50001 users:(("sshd",pid=902,fd=4))
+0      0          127.0.0.1:41000     127.0.0.1:8080 users:(("sshd-session",pid=901,fd=9))
+0      0          127.0.0.1:8080      127.0.0.1:41000 users:(("nginx",pid=800,fd=7))
+0      0          127.0.0.1:41022     127.0.0.1:2222 users:(("sshd",pid=902,fd=9))
+0      0          127.0.0.1:41023     127.0.0.1:22   users:(("sshd-foo",pid=903,fd=9))
+`
+	cmd := exec.Command("awk", sshdForwardsAWK)
+	cmd.Stdin = strings.NewReader(ssOutput)
+	out, err := cmd.Output()
+	assert.NilError(t, err)
+	// the forwards to 8080 and 2222, but neither the SSH connections on port 22 nor "sshd-foo"
+	assert.Equal(t, "2", strings.TrimSpace(string(out)))
+
+	cmd = exec.Command("awk", sshdForwardsAWK)
+	cmd.Stdin = strings.NewReader("--\n")
+	out, err = cmd.Output()
+	assert.NilError(t, err)
+	assert.Equal(t, "0", strings.TrimSpace(string(out)))
+}
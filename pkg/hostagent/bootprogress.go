@@ -0,0 +1,100 @@
+package hostagent
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/sirupsen/logrus"
+)
+
+type bootProgressMarker struct {
+	re       *regexp.Regexp
+	progress int
+}
+
+// watchBootProgress tails serial.log, and emits the last status with the updated boot progress
+// whenever a line matches one of `bootProgressMarkers` with a higher progress than the current one.
+func (a *HostAgent) watchBootProgress(ctx context.Context) {
+	var (
+		markers     []bootProgressMarker
+		maxProgress int
+	)
+	for _, m := range a.limaYAML().BootProgressMarkers {
+		// already validated
+		markers = append(markers, bootProgressMarker{re: regexp.MustCompile(m.Pattern), progress: m.Progress})
+		if m.Progress > maxProgress {
+			maxProgress = m.Progress
+		}
+	}
+	serialLog := filepath.Join(a.instDir, filenames.SerialLog)
+	var f *os.File
+	defer func() {
+		if f != nil {
+			_ = f.Close()
+		}
+	}()
+	var (
+		r       *bufio.Reader
+		partial string
+	)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(500 * time.Millisecond):
+		}
+		if f == nil {
+			// serial.log is created by QEMU
+			var err error
+			f, err = os.Open(serialLog)
+			if err != nil {
+				if !errors.Is(err, os.ErrNotExist) {
+					logrus.WithError(err).Warnf("failed to open %q, not watching the boot progress", serialLog)
+					return
+				}
+				continue
+			}
+			r = bufio.NewReader(f)
+		}
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				// keep the incomplete line until the rest of it is written
+				partial += line
+				if !errors.Is(err, io.EOF) {
+					logrus.WithError(err).Warnf("failed to read %q, not watching the boot progress", serialLog)
+					return
+				}
+				break
+			}
+			line, partial = partial+line, ""
+			for _, m := range markers {
+				if !m.re.MatchString(line) {
+					continue
+				}
+				a.updateStatus(ctx, func(*events.Status) bool {
+					if m.progress <= a.bootProgress {
+						return false
+					}
+					a.bootProgress = m.progress
+					logrus.Debugf("boot progress: %d%% (%q)", m.progress, m.re.String())
+					return true
+				})
+			}
+		}
+		a.eventEncMu.Lock()
+		done := a.bootProgress >= maxProgress
+		a.eventEncMu.Unlock()
+		if done {
+			return
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package hostagent
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/sirupsen/logrus"
+)
+
+// staleSockets are the sockets that are only used while QEMU is running,
+// so they are left behind when the host agent crashed.
+// The sockets forwarded with `portForwards` are removed by forwardSSH.
+var staleSockets = []string{
+	filenames.QMPSock,
+	filenames.SerialSock,
+	filenames.SPICESock,
+	filenames.GuestAgentSock,
+	filenames.SSHSock,
+}
+
+// cleanUpStaleFiles removes the files left behind by a host agent that crashed, e.g., "address already in use"
+// for the sockets. It must be called with the lock of the instance held, so that no other host agent is running.
+// Nothing is removed when the QEMU process of the crashed host agent is still running.
+func cleanUpStaleFiles(instDir string) error {
+	// ReadPIDFile removes the PID file if the process is no longer running
+	qemuPID, err := store.ReadPIDFile(filepath.Join(instDir, filenames.QemuPID))
+	if err != nil {
+		return err
+	}
+	if qemuPID > 0 {
+		return fmt.Errorf("QEMU (pid %d) is still running without a host agent (hint: use `limactl stop -f` to kill it)", qemuPID)
+	}
+	for _, f := range staleSockets {
+		path := filepath.Join(instDir, f)
+		if err := os.Remove(path); err == nil {
+			logrus.Debugf("removed the stale socket %q", path)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove the stale socket %q: %w", path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+package hostagent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/digitalocean/go-qemu/qmp"
+	"github.com/digitalocean/go-qemu/qmp/raw"
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/sirupsen/logrus"
+)
+
+// hotpluggedCPUPrefix is the QOM path prefix of CPUs added with device_add.
+// CPUs created from `-smp` live elsewhere and can't be unplugged.
+const hotpluggedCPUPrefix = "/machine/peripheral/"
+
+// cpuUnplugTimeout is how long to wait for the guest to release a CPU after device_del.
+const cpuUnplugTimeout = 10 * time.Second
+
+func countPluggedCPUs(cpus []raw.HotpluggableCPU) int {
+	var n int
+	for _, c := range cpus {
+		if c.QomPath != nil {
+			n += int(c.VcpusCount)
+		}
+	}
+	return n
+}
+
+// CPUs returns the number of vCPUs currently plugged into the guest.
+// QMP is only queried on the first call after QEMU was started, as the number only changes with AddCPU and RemoveCPU.
+func (a *HostAgent) CPUs(ctx context.Context) (int, error) {
+	a.cpuMu.Lock()
+	defer a.cpuMu.Unlock()
+	if a.cpus != 0 {
+		return a.cpus, nil
+	}
+	var n int
+	err := a.withQMP(func(_ qmp.Monitor, rawClient *raw.Monitor) error {
+		cpus, err := rawClient.QueryHotpluggableCpus()
+		if err != nil {
+			return err
+		}
+		n = countPluggedCPUs(cpus)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	a.cpus = n
+	return n, nil
+}
+
+// AddCPU hot-plugs a vCPU into the guest, and returns the new number of vCPUs.
+// The number of vCPUs can't exceed `maxCPUs`.
+func (a *HostAgent) AddCPU(ctx context.Context) (int, error) {
+	a.cpuMu.Lock()
+	defer a.cpuMu.Unlock()
+	var n int
+	err := a.withQMP(func(qmpClient qmp.Monitor, rawClient *raw.Monitor) error {
+		cpus, err := rawClient.QueryHotpluggableCpus()
+		if err != nil {
+			return fmt.Errorf("failed to query hotpluggable CPUs: %w", err)
+		}
+		n = countPluggedCPUs(cpus)
+		if maxCPUs := *a.limaYAML().MaxCPUs; n >= maxCPUs {
+			return fmt.Errorf("can't add a CPU: already %d CPUs (maxCPUs=%d)", n, maxCPUs)
+		}
+		for i, c := range cpus {
+			if c.QomPath != nil {
+				continue
+			}
+			args := map[string]interface{}{
+				"driver": c.Type,
+				"id":     fmt.Sprintf("lima-cpu%d", i),
+			}
+			if c.Props.NodeID != nil {
+				args["node-id"] = *c.Props.NodeID
+			}
+			if c.Props.SocketID != nil {
+				args["socket-id"] = *c.Props.SocketID
+			}
+			if c.Props.CoreID != nil {
+				args["core-id"] = *c.Props.CoreID
+			}
+			if c.Props.ThreadID != nil {
+				args["thread-id"] = *c.Props.ThreadID
+			}
+			cmd, err := json.Marshal(map[string]interface{}{
+				"execute":   "device_add",
+				"arguments": args,
+			})
+			if err != nil {
+				return err
+			}
+			logrus.Infof("Adding CPU %q via QMP", args["id"])
+			if _, err := qmpClient.Run(cmd); err != nil {
+				return fmt.Errorf("failed to add CPU %q: %w", args["id"], err)
+			}
+			n += int(c.VcpusCount)
+			return nil
+		}
+		return errors.New("can't add a CPU: no free CPU slot")
+	})
+	if err != nil {
+		return n, err
+	}
+	a.cpus = n
+	a.emitCPUsEvent(ctx, n)
+	return n, nil
+}
+
+// RemoveCPU hot-unplugs the most recently added vCPU from the guest, and returns the new number of vCPUs.
+// The vCPUs specified by `cpus` can't be removed.
+// An error is returned when the guest does not release the vCPU, e.g., because it doesn't support CPU unplug.
+func (a *HostAgent) RemoveCPU(ctx context.Context) (int, error) {
+	a.cpuMu.Lock()
+	defer a.cpuMu.Unlock()
+	var n int
+	err := a.withQMP(func(_ qmp.Monitor, rawClient *raw.Monitor) error {
+		cpus, err := rawClient.QueryHotpluggableCpus()
+		if err != nil {
+			return fmt.Errorf("failed to query hotpluggable CPUs: %w", err)
+		}
+		n = countPluggedCPUs(cpus)
+		var qomPath string
+		for _, c := range cpus {
+			if c.QomPath != nil && strings.HasPrefix(*c.QomPath, hotpluggedCPUPrefix) {
+				qomPath = *c.QomPath
+			}
+		}
+		if qomPath == "" {
+			return fmt.Errorf("can't remove a CPU: only the %d CPUs present at boot are plugged", n)
+		}
+		id := path.Base(qomPath)
+		logrus.Infof("Removing CPU %q via QMP", id)
+		if err := rawClient.DeviceDel(id); err != nil {
+			return fmt.Errorf("failed to remove CPU %q: %w", id, err)
+		}
+		// device_del only requests the removal; the guest has to release the CPU
+		deadline := time.Now().Add(cpuUnplugTimeout)
+		for time.Now().Before(deadline) {
+			cpus, err = rawClient.QueryHotpluggableCpus()
+			if err != nil {
+				return fmt.Errorf("failed to query hotpluggable CPUs: %w", err)
+			}
+			if !hasCPU(cpus, qomPath) {
+				n = countPluggedCPUs(cpus)
+				return nil
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(500 * time.Millisecond):
+			}
+		}
+		return fmt.Errorf("the guest did not release CPU %q in %v; the guest may not support CPU unplug", id, cpuUnplugTimeout)
+	})
+	if err != nil {
+		// the CPU may still be released later
+		a.cpus = 0
+		return n, err
+	}
+	a.cpus = n
+	a.emitCPUsEvent(ctx, n)
+	return n, nil
+}
+
+func hasCPU(cpus []raw.HotpluggableCPU, qomPath string) bool {
+	for _, c := range cpus {
+		if c.QomPath != nil && *c.QomPath == qomPath {
+			return true
+		}
+	}
+	return false
+}
+
+// emitCPUsEvent emits the last status with the updated number of vCPUs.
+func (a *HostAgent) emitCPUsEvent(ctx context.Context, n int) {
+	a.updateStatus(ctx, func(st *events.Status) bool {
+		st.CPUs = n
+		return true
+	})
+}
+
+// vcpuThreads returns the host thread IDs of the vCPUs, indexed by the vCPU index.
+// `query-cpus-fast` is not covered by go-qemu yet.
+func (a *HostAgent) vcpuThreads() (map[int]int, error) {
+	threads := make(map[int]int)
+	err := a.withQMP(func(qmpClient qmp.Monitor, _ *raw.Monitor) error {
+		out, err := qmpClient.Run([]byte(`{"execute":"query-cpus-fast"}`))
+		if err != nil {
+			return fmt.Errorf("failed to query the vCPUs: %w", err)
+		}
+		var resp struct {
+			Return []struct {
+				CPUIndex int `json:"cpu-index"`
+				ThreadID int `json:"thread-id"`
+			} `json:"return"`
+		}
+		if err := json.Unmarshal(out, &resp); err != nil {
+			return fmt.Errorf("failed to parse the vCPUs: %w", err)
+		}
+		for _, c := range resp.Return {
+			threads[c.CPUIndex] = c.ThreadID
+		}
+		return nil
+	})
+	return threads, err
+}
+
+// pinVCPUs pins the vCPU threads to the host CPUs of `cpu.pinning`, as soon as QMP is available.
+// Failures are logged, as pinning is an optimization; the vCPUs that are not plugged yet are not pinned.
+func (a *HostAgent) pinVCPUs(ctx context.Context, pinning map[int]int) {
+	if len(pinning) == 0 {
+		return
+	}
+	var (
+		threads map[int]int
+		err     error
+	)
+	for i := 0; i < 30; i++ {
+		if threads, err = a.vcpuThreads(); err == nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+	if err != nil {
+		logrus.WithError(err).Warn("failed to get the vCPU threads, not pinning the vCPUs")
+		return
+	}
+	vcpus := make([]int, 0, len(pinning))
+	for vcpu := range pinning {
+		vcpus = append(vcpus, vcpu)
+	}
+	sort.Ints(vcpus)
+	for _, vcpu := range vcpus {
+		hostCPU := pinning[vcpu]
+		tid, ok := threads[vcpu]
+		if !ok {
+			logrus.Warnf("Not pinning vCPU %d to host CPU %d, as the vCPU is not plugged", vcpu, hostCPU)
+			continue
+		}
+		if err := setThreadAffinity(tid, hostCPU); err != nil {
+			if errors.Is(err, os.ErrPermission) {
+				logrus.WithError(err).Warn("Not pinning the vCPUs, as the permission to set the CPU affinity of QEMU is missing")
+				return
+			}
+			logrus.WithError(err).Warnf("failed to pin vCPU %d (thread %d) to host CPU %d", vcpu, tid, hostCPU)
+			continue
+		}
+		logrus.Infof("Pinned vCPU %d (thread %d) to host CPU %d", vcpu, tid, hostCPU)
+	}
+}
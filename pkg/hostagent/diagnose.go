@@ -0,0 +1,72 @@
+package hostagent
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+)
+
+// qemuFailureHint is a hint for a common cause of QEMU failing to start, found in the stderr of QEMU.
+type qemuFailureHint struct {
+	re   *regexp.Regexp
+	code events.ErrorCode
+	hint string
+}
+
+var qemuFailureHints = []qemuFailureHint{
+	{
+		re:   regexp.MustCompile(`(?i)(failed to initialize kvm|could not access kvm kernel module|/dev/kvm|HV_ERROR|HV_DENIED|HV_UNSUPPORTED|hvf.*(not supported|failed)|invalid accelerator)`),
+		code: events.ErrorCodeAcceleration,
+		hint: "hardware acceleration is not available; on Linux, check that /dev/kvm exists and is accessible (e.g., the user is in the \"kvm\" group); on macOS, check that the Hypervisor framework is supported and QEMU is signed with the hypervisor entitlement",
+	},
+	{
+		re:   regexp.MustCompile(`(?i)(could not set up host forwarding rule|address already in use)`),
+		code: events.ErrorCodePreflight,
+		hint: "a port of the host is already in use, e.g., `ssh.localPort` or the port of `portForwards` forwarded by QEMU; choose another port, or stop the process using it",
+	},
+	{
+		re:   regexp.MustCompile(`(?i)(could not load pc bios|could not load (the )?firmware|failed to load firmware|pflash|\.fd'?: no such file)`),
+		code: events.ErrorCodeQEMU,
+		hint: "the UEFI firmware could not be loaded; install the firmware package of QEMU (e.g., \"ovmf\" or \"qemu-efi-aarch64\"), or set `firmware.code`",
+	},
+	{
+		re:   regexp.MustCompile(`(?i)(image is corrupt|not in qcow2 format|could not open .*(diffdisk|basedisk)|invalid (qcow2|image) header|unknown file format|leaked clusters)`),
+		code: events.ErrorCodeQEMU,
+		hint: "the disk image of the instance may be corrupt; check it with `qemu-img check` on the diffdisk in the instance directory, or recreate the instance",
+	},
+	{
+		re:   regexp.MustCompile(`(?i)(cannot set up guest memory|cannot allocate memory)`),
+		code: events.ErrorCodeQEMU,
+		hint: "the host does not have enough free memory for the guest; reduce `memory`, or free memory on the host",
+	},
+}
+
+// diagnoseQEMUFailure returns the hint for the first known cause found in stderr, or nil.
+func diagnoseQEMUFailure(stderr string) *qemuFailureHint {
+	for i, h := range qemuFailureHints {
+		if h.re.MatchString(stderr) {
+			return &qemuFailureHints[i]
+		}
+	}
+	return nil
+}
+
+// readLastLines returns the last n non-empty lines of the file, or an empty string when the file cannot be read.
+func readLastLines(path string, n int) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	tail := &tailBuffer{max: n}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			tail.add(line)
+		}
+	}
+	return tail.String()
+}
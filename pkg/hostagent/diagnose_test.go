@@ -0,0 +1,34 @@
+package hostagent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"gotest.tools/v3/assert"
+)
+
+func TestDiagnoseQEMUFailure(t *testing.T) {
+	testCases := map[string]events.ErrorCode{
+		"Could not access KVM kernel module: Permission denied\nqemu-system-x86_64: failed to initialize kvm: Permission denied":                                                  events.ErrorCodeAcceleration,
+		"qemu-system-aarch64: -accel hvf: Error: HV_UNSUPPORTED":                                                                                                                  events.ErrorCodeAcceleration,
+		"qemu-system-x86_64: -netdev user,id=net0,hostfwd=tcp:127.0.0.1:60022-:22: Could not set up host forwarding rule 'tcp:127.0.0.1:60022-:22'":                               events.ErrorCodePreflight,
+		"qemu-system-x86_64: -drive if=pflash,format=raw,readonly=on,file=/usr/share/OVMF/OVMF_CODE.fd: Could not open '/usr/share/OVMF/OVMF_CODE.fd': No such file or directory": events.ErrorCodeQEMU,
+		"qemu-system-x86_64: -drive file=/home/foo/.lima/default/diffdisk,if=virtio: qcow2: Image is corrupt; cannot be opened read/write":                                        events.ErrorCodeQEMU,
+	}
+	for stderr, code := range testCases {
+		hint := diagnoseQEMUFailure(stderr)
+		assert.Assert(t, hint != nil, stderr)
+		assert.Equal(t, code, hint.code, stderr)
+	}
+	assert.Assert(t, diagnoseQEMUFailure("qemu-system-x86_64: terminating on signal 15") == nil)
+	assert.Assert(t, diagnoseQEMUFailure("") == nil)
+}
+
+func TestReadLastLines(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "serial.log")
+	assert.Equal(t, "", readLastLines(p, 2))
+	assert.NilError(t, os.WriteFile(p, []byte("a\nb\n\r\nc\n\n"), 0600))
+	assert.Equal(t, "b\nc", readLastLines(p, 2))
+}
@@ -1,22 +1,209 @@
 package events
 
 import (
+	"errors"
 	"time"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// Phase is the boot phase of the instance, see Status.Phase.
+type Phase = string
+
+const (
+	// PhaseBooting is from starting QEMU until SSH becomes reachable
+	PhaseBooting Phase = "booting"
+	// PhaseRequirements is from SSH becoming reachable until Running becomes true
+	PhaseRequirements Phase = "requirements"
+	PhaseRunning      Phase = "running"
+	PhaseExiting      Phase = "exiting"
 )
 
 type Status struct {
-	Running bool `json:"running,omitempty"`
+	// Phase is the current boot phase. The durations of the phases are reported in Timings.
+	Phase   Phase `json:"phase,omitempty"`
+	Running bool  `json:"running,omitempty"`
 	// When Degraded is true, Running must be true as well
 	Degraded bool `json:"degraded,omitempty"`
 	// When Exiting is true, Running must be false
 	Exiting bool `json:"exiting,omitempty"`
+	// QEMUExitCode is set when Exiting is true and QEMU has exited.
+	// -1 means that QEMU was terminated by a signal.
+	QEMUExitCode *int `json:"qemuExitCode,omitempty"`
+	// SSHReady is set to true after the first successful connection to the forwarded SSH port
+	SSHReady bool `json:"sshReady,omitempty"`
 
 	Errors []string `json:"errors,omitempty"`
+	// ErrorCodes[i] is the code of Errors[i]. Use AddError to keep them aligned.
+	ErrorCodes []ErrorCode `json:"errorCodes,omitempty"`
 
 	SSHLocalPort int `json:"sshLocalPort,omitempty"`
+	// VNCEndpoint is the "host:port" of the VNC server of the guest, if `video.vnc.enabled` is true
+	VNCEndpoint string `json:"vncEndpoint,omitempty"`
+	// SPICESocket is the path of the SPICE socket, if `video.spice.enabled` is true
+	SPICESocket string `json:"spiceSocket,omitempty"`
+
+	// BootProgress (0-100) is estimated from the serial console log, using `bootProgressMarkers`.
+	// It is 100 when Running is true.
+	BootProgress int `json:"bootProgress,omitempty"`
+
+	// CPUs is the number of vCPUs currently plugged into the guest; only set after a CPU hotplug
+	CPUs int `json:"cpus,omitempty"`
+
+	// CPUUsagePercent and MemoryUsedBytes are the resource usage of the guest,
+	// sampled every `resourceUsage.interval` seconds
+	CPUUsagePercent float64 `json:"cpuUsagePercent,omitempty"`
+	MemoryUsedBytes int64   `json:"memoryUsedBytes,omitempty"`
+	// Disk is the I/O of the disk of the instance, sampled along with the CPU and memory usage
+	Disk *DiskStatus `json:"disk,omitempty"`
+
+	// Mounts is the status of the mounts that have been attempted so far, in the order of `mounts`
+	Mounts []MountStatus `json:"mounts,omitempty"`
+
+	// Networks is the addresses of the network interfaces of the guest (the slirp interface, then `networks`),
+	// set when the guest has booted
+	Networks []NetworkStatus `json:"networks,omitempty"`
+
+	// PortForwards is the status of the forwards of the TCP ports reported by the guest agent, sorted by the guest address
+	PortForwards []PortForwardStatus `json:"portForwards,omitempty"`
+
+	// PendingRestart is the list of the fields of lima.yaml (e.g., "cpus") that have been changed
+	// since QEMU was started, and are not applied until the instance is restarted
+	PendingRestart []string `json:"pendingRestart,omitempty"`
+
+	// PrePull is set while pulling the images listed in `containerd.prePull`
+	PrePull *PrePull `json:"prePull,omitempty"`
+
+	// Timings is set when Running becomes true
+	Timings *Timings `json:"timings,omitempty"`
+}
+
+// AddError appends err to Errors, and its code to ErrorCodes.
+// The errors in a *multierror.Error are appended separately.
+func (st *Status) AddError(err error) {
+	if mErr, ok := err.(*multierror.Error); ok {
+		for _, e := range mErr.Errors {
+			st.AddError(e)
+		}
+		return
+	}
+	st.Errors = append(st.Errors, err.Error())
+	st.ErrorCodes = append(st.ErrorCodes, Code(err))
+}
+
+// ErrorCode classifies the errors in Status.Errors, so that they can be distinguished programmatically.
+type ErrorCode string
+
+const (
+	ErrorCodeUnknown ErrorCode = "unknown"
+	// ErrorCodePreflight is for the checks of the host before starting QEMU, e.g., bridges and hugepages
+	ErrorCodePreflight ErrorCode = "preflight"
+	// ErrorCodeQEMU is for QEMU failing to start, or exiting unexpectedly
+	ErrorCodeQEMU ErrorCode = "qemu"
+	// ErrorCodeAcceleration is for the guest being emulated without hardware acceleration
+	ErrorCodeAcceleration ErrorCode = "acceleration"
+	// ErrorCodeSSH is for SSH not becoming available, e.g., the SSH key being rejected
+	ErrorCodeSSH ErrorCode = "ssh"
+	// ErrorCodeRequirement is for the essential, optional, and final requirements not being satisfied
+	ErrorCodeRequirement ErrorCode = "requirement"
+	// ErrorCodeMount is for the mounts that failed
+	ErrorCodeMount ErrorCode = "mount"
+	// ErrorCodePrePull is for the images listed in `containerd.prePull` that could not be pulled
+	ErrorCodePrePull ErrorCode = "prePull"
+)
+
+type codedError struct {
+	code ErrorCode
+	err  error
+}
+
+func (e *codedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *codedError) Unwrap() error {
+	return e.err
+}
+
+// WithCode annotates err with code. WithCode returns nil if err is nil.
+func WithCode(code ErrorCode, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &codedError{code: code, err: err}
+}
+
+// Code returns the code of err, or ErrorCodeUnknown if err was not annotated with WithCode.
+func Code(err error) ErrorCode {
+	var cErr *codedError
+	if errors.As(err, &cErr) {
+		return cErr.code
+	}
+	return ErrorCodeUnknown
+}
+
+// DiskStatus is the I/O of the disk (the diffdisk) of the instance.
+type DiskStatus struct {
+	// ReadBytes and WriteBytes are the total since QEMU was started
+	ReadBytes  int64 `json:"readBytes"`
+	WriteBytes int64 `json:"writeBytes"`
+	// ReadIOPS and WriteIOPS are the average over the last sampling interval
+	ReadIOPS  float64 `json:"readIOPS"`
+	WriteIOPS float64 `json:"writeIOPS"`
+}
+
+// MountStatus is the status of a mount.
+type MountStatus struct {
+	// MountPoint is the mount point in the guest
+	MountPoint string `json:"mountPoint"`
+	Mounted    bool   `json:"mounted,omitempty"`
+	// Error is set when the mount failed
+	Error string `json:"error,omitempty"`
+}
+
+// NetworkStatus is the status of a network interface of the guest.
+type NetworkStatus struct {
+	Interface  string `json:"interface"`
+	MACAddress string `json:"macAddress,omitempty"`
+	// Addresses are the global IPv4 and IPv6 addresses with the prefix length, e.g. "192.168.5.15/24"
+	Addresses []string `json:"addresses,omitempty"`
+}
+
+// PortForwardStatus is the status of the forward of a TCP port of the guest.
+type PortForwardStatus struct {
+	// GuestAddress is the "ip:port" listened on in the guest
+	GuestAddress string `json:"guestAddress"`
+	// HostAddress is the "ip:port" (or the socket path) on the host.
+	// It differs from the address chosen by `portForwards` when the host port was remapped due to a conflict.
+	HostAddress string `json:"hostAddress,omitempty"`
+	// Error is set when the port is not forwarded due to a conflict
+	Error string `json:"error,omitempty"`
+}
+
+// PrePull is the progress of pulling an image listed in `containerd.prePull`.
+type PrePull struct {
+	Image string `json:"image"`
+	// Index is 1-based
+	Index int  `json:"index"`
+	Total int  `json:"total"`
+	Done  bool `json:"done,omitempty"`
+	// Error is set when Done is true and the image could not be pulled
+	Error string `json:"error,omitempty"`
+}
+
+// Timings contains the durations of the boot phases that take place in the host agent.
+type Timings struct {
+	// QEMUToSSH is the duration from starting QEMU until SSH became reachable
+	QEMUToSSH time.Duration `json:"qemuToSSH,omitempty"`
+	// Requirements is the duration of waiting for the requirements after SSH became reachable
+	Requirements time.Duration `json:"requirements,omitempty"`
+	// Ready is the duration from starting QEMU until Running became true
+	Ready time.Duration `json:"ready,omitempty"`
 }
 
 type Event struct {
 	Time   time.Time `json:"time,omitempty"`
 	Status Status    `json:"status,omitempty"`
+	// Heartbeat is true if the event only re-emits the last status, see `heartbeat.interval`.
+	Heartbeat bool `json:"heartbeat,omitempty"`
 }
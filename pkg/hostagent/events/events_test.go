@@ -0,0 +1,24 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/go-multierror"
+	"gotest.tools/v3/assert"
+)
+
+func TestAddError(t *testing.T) {
+	var st Status
+	st.AddError(errors.New("foo"))
+	st.AddError(fmt.Errorf("wrapped: %w", WithCode(ErrorCodeSSH, errors.New("bar"))))
+	var mErr error
+	mErr = multierror.Append(mErr, WithCode(ErrorCodeRequirement, errors.New("baz")))
+	mErr = multierror.Append(mErr, WithCode(ErrorCodeMount, errors.New("qux")))
+	st.AddError(mErr)
+	assert.DeepEqual(t, st.Errors, []string{"foo", "wrapped: bar", "baz", "qux"})
+	assert.DeepEqual(t, st.ErrorCodes, []ErrorCode{ErrorCodeUnknown, ErrorCodeSSH, ErrorCodeRequirement, ErrorCodeMount})
+
+	assert.NilError(t, WithCode(ErrorCodeQEMU, nil))
+}
@@ -0,0 +1,27 @@
+package hostagent
+
+import (
+	"context"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+)
+
+// watchHeartbeat re-emits the last status every `heartbeat.interval` seconds, so that the consumers of the events
+// can tell a stalled host agent from an idle one by the time of the last event.
+func (a *HostAgent) watchHeartbeat(ctx context.Context) {
+	interval := time.Duration(*a.limaYAML().Heartbeat.Interval) * time.Second
+	if interval == 0 {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		a.eventEncMu.Lock()
+		a.emitEventLocked(events.Event{Status: a.lastStatus, Heartbeat: true})
+		a.eventEncMu.Unlock()
+	}
+}
@@ -8,15 +8,17 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
-	"github.com/digitalocean/go-qemu/qmp"
 	"github.com/digitalocean/go-qemu/qmp/raw"
 	"github.com/hashicorp/go-multierror"
 	"github.com/lima-vm/lima/pkg/cidata"
@@ -26,34 +28,69 @@ import (
 	"github.com/lima-vm/lima/pkg/hostagent/dns"
 	"github.com/lima-vm/lima/pkg/hostagent/events"
 	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/lockutil"
 	"github.com/lima-vm/lima/pkg/qemu"
 	"github.com/lima-vm/lima/pkg/sshutil"
 	"github.com/lima-vm/lima/pkg/store"
 	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/vsock"
 	"github.com/lima-vm/sshocker/pkg/ssh"
 	"github.com/sirupsen/logrus"
 )
 
 type HostAgent struct {
-	y               *limayaml.LimaYAML
+	instName        string
+	nerdctlArchive  string
+	y               *limayaml.LimaYAML // protected by yMu, use limaYAML()
 	sshLocalPort    int
+	vsockCID        uint32 // 0 if the guest has no vsock device
+	guestAgentToken string // presented to the guest agent over vsock
 	udpDNSLocalPort int
 	tcpDNSLocalPort int
 	instDir         string
+	lockFile        *os.File // released when Run returns
 	sshConfig       *ssh.SSHConfig
-	portForwarder   *portForwarder
-	onClose         []func() error // LIFO
+	portForwarder   *portForwarder // protected by yMu, use forwarder()
+	onClose         []func() error // LIFO; protected by onCloseMu, use addOnClose
+	qmp             *qmpConn
 
-	qExe     string
-	qArgs    []string
-	sigintCh chan os.Signal
+	qExe     string   // protected by yMu
+	qArgs    []string // protected by yMu
+	signalCh chan os.Signal
 
-	eventEnc   *json.Encoder
-	eventEncMu sync.Mutex
+	shutdownCh   chan struct{} // closed by Shutdown
+	shutdownOnce sync.Once
+	shutdownErr  error
+	restartCh    chan chan error // receives a channel for the result of Restart
+	runDoneCh    chan struct{}   // closed when Run returns
+	runMu        sync.Mutex
+	runStarted   bool // set when Run is called; protected by runMu
+
+	eventEnc       *json.Encoder
+	eventEncMu     sync.Mutex
+	lastStatus     events.Status              // protected by eventEncMu
+	bootProgress   int                        // protected by eventEncMu
+	pendingRestart []string                   // protected by eventEncMu
+	portForwards   []events.PortForwardStatus // protected by eventEncMu
+
+	onCloseMu  sync.Mutex
+	routinesWG sync.WaitGroup // the routines started by startQEMU, see goRoutine
+
+	configMu sync.Mutex   // serializes Reload and Restart
+	yMu      sync.RWMutex // held for writing by Reload and Restart while replacing the config
+
+	mountsMu     sync.Mutex
+	mounts       []*mount // protected by mountsMu
+	mountsClosed bool     // set when the mounts are closed, so that reloadMounts does not leave new ones; protected by mountsMu
+
+	cpuMu sync.Mutex // serializes CPU hotplug
+	cpus  int        // the number of vCPUs plugged into the guest, 0 when not queried yet; protected by cpuMu
 }
 
 type options struct {
 	nerdctlArchive string // local path, not URL
+	logLevel       *logrus.Level
+	logFormatter   logrus.Formatter
 }
 
 type Opt func(*options) error
@@ -65,28 +102,89 @@ func WithNerdctlArchive(s string) Opt {
 	}
 }
 
+const (
+	// LogFormatJSON is parsed by events.Watch, so that `limactl start` shows the logs of the host agent with their levels
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// WithLogLevel sets the level of the logs. The level of the standard logger is not changed by default.
+func WithLogLevel(lv logrus.Level) Opt {
+	return func(o *options) error {
+		o.logLevel = &lv
+		return nil
+	}
+}
+
+// WithLogFormat sets the format of the logs, LogFormatJSON or LogFormatText.
+// The formatter of the standard logger is not changed by default.
+func WithLogFormat(format string) Opt {
+	return func(o *options) error {
+		switch format {
+		case LogFormatJSON:
+			o.logFormatter = new(logrus.JSONFormatter)
+		case LogFormatText:
+			o.logFormatter = &logrus.TextFormatter{FullTimestamp: true}
+		default:
+			return fmt.Errorf("log format must be %q or %q, got %q", LogFormatJSON, LogFormatText, format)
+		}
+		return nil
+	}
+}
+
+// ShutdownSignals are the signals that shut down the host agent and the guest gracefully.
+// SIGINT is sent by `limactl stop`, SIGTERM by process managers such as systemd.
+var ShutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
 // New creates the HostAgent.
 //
 // stdout is for emitting JSON lines of Events.
-func New(instName string, stdout io.Writer, sigintCh chan os.Signal, opts ...Opt) (*HostAgent, error) {
+// The destination can be changed later with SetEventWriter.
+//
+// signalCh should be notified of ShutdownSignals.
+func New(instName string, stdout io.Writer, signalCh chan os.Signal, opts ...Opt) (_ *HostAgent, retErr error) {
 	var o options
 	for _, f := range opts {
 		if err := f(&o); err != nil {
 			return nil, err
 		}
 	}
+	if o.logLevel != nil {
+		logrus.SetLevel(*o.logLevel)
+	}
+	if o.logFormatter != nil {
+		logrus.SetFormatter(o.logFormatter)
+	}
 	inst, err := store.Inspect(instName)
 	if err != nil {
 		return nil, err
 	}
 
+	// Locked before touching the files of the instance, e.g., cidata.iso and the sockets removed by qemu.Prepare
+	lockFile, err := lockutil.TryLockFile(filepath.Join(inst.Dir, filenames.HostAgentLock))
+	if err != nil {
+		if errors.Is(err, lockutil.ErrLocked) {
+			return nil, fmt.Errorf("instance %q is already running: another host agent holds the lock of %q", instName, inst.Dir)
+		}
+		return nil, err
+	}
+	defer func() {
+		if retErr != nil {
+			_ = lockFile.Close()
+		}
+	}()
+
+	if err := cleanUpStaleFiles(inst.Dir); err != nil {
+		return nil, err
+	}
+
 	y, err := inst.LoadYAML()
 	if err != nil {
 		return nil, err
 	}
 	// y is loaded with FillDefault() already, so no need to care about nil pointers.
 
-	sshLocalPort, err := determineSSHLocalPort(y, instName)
+	sshLocalPort, err := DetermineSSHLocalPort(y, instName)
 	if err != nil {
 		return nil, err
 	}
@@ -107,55 +205,85 @@ func New(instName string, stdout io.Writer, sigintCh chan os.Signal, opts ...Opt
 		return nil, err
 	}
 
+	// On Linux hosts, the guest agent is connected over vsock instead of the socket forwarded over SSH
+	guestAgentToken, err := cidata.GuestAgentToken(inst.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var vsockCID uint32
+	if vsock.HostAvailable() {
+		vsockCID, err = qemu.VSockCID(inst.Dir)
+		if err != nil {
+			return nil, err
+		}
+	}
 	qCfg := qemu.Config{
 		Name:         instName,
 		InstanceDir:  inst.Dir,
 		LimaYAML:     y,
 		SSHLocalPort: sshLocalPort,
+		VSockCID:     vsockCID,
 	}
 	qExe, qArgs, err := qemu.Cmdline(qCfg)
 	if err != nil {
 		return nil, err
 	}
 
-	sshOpts, err := sshutil.SSHOpts(inst.Dir, *y.SSH.LoadDotSSHPubKeys, *y.SSH.ForwardAgent)
+	sshOpts, err := sshutil.SSHOpts(inst.Dir, *y.SSH.LoadDotSSHPubKeys, *y.SSH.ForwardAgent, *y.SSH.StrictHostKeyChecking)
 	if err != nil {
 		return nil, err
 	}
 	sshConfig := &ssh.SSHConfig{
-		AdditionalArgs: sshutil.SSHArgsFromOpts(sshOpts),
+		AdditionalArgs: sshutil.SSHArgs(sshOpts, *y.SSH.Address, *y.SSH.ProxyJump),
 	}
 
-	rules := make([]limayaml.PortForward, 0, 3+len(y.PortForwards))
-	// Block ports 22 and sshLocalPort on all IPs
-	for _, port := range []int{sshGuestPort, sshLocalPort} {
-		rule := limayaml.PortForward{GuestIP: net.IPv4zero, GuestPort: port, Ignore: true}
-		limayaml.FillPortForwardDefaults(&rule, inst.Dir)
-		rules = append(rules, rule)
-	}
-	rules = append(rules, y.PortForwards...)
-	// Default forwards for all non-privileged ports from "127.0.0.1" and "::1"
-	rule := limayaml.PortForward{GuestIP: guestagentapi.IPv4loopback1}
-	limayaml.FillPortForwardDefaults(&rule, inst.Dir)
-	rules = append(rules, rule)
-
 	a := &HostAgent{
+		instName:        instName,
+		nerdctlArchive:  o.nerdctlArchive,
 		y:               y,
 		sshLocalPort:    sshLocalPort,
+		vsockCID:        vsockCID,
+		guestAgentToken: guestAgentToken,
 		udpDNSLocalPort: udpDNSLocalPort,
 		tcpDNSLocalPort: tcpDNSLocalPort,
 		instDir:         inst.Dir,
+		qmp:             &qmpConn{sockPath: filepath.Join(inst.Dir, filenames.QMPSock)},
+		lockFile:        lockFile,
 		sshConfig:       sshConfig,
-		portForwarder:   newPortForwarder(sshConfig, sshLocalPort, rules),
+		portForwarder:   newPortForwarder(sshConfig, sshLocalPort, portForwardRules(y, inst.Dir, sshLocalPort), *y.PortForwardOnConflict),
 		qExe:            qExe,
 		qArgs:           qArgs,
-		sigintCh:        sigintCh,
+		signalCh:        signalCh,
+		shutdownCh:      make(chan struct{}),
+		restartCh:       make(chan chan error),
+		runDoneCh:       make(chan struct{}),
 		eventEnc:        json.NewEncoder(stdout),
 	}
 	return a, nil
 }
 
-func determineSSHLocalPort(y *limayaml.LimaYAML, instName string) (int, error) {
+func portForwardRules(y *limayaml.LimaYAML, instDir string, sshLocalPort int) []limayaml.PortForward {
+	rules := make([]limayaml.PortForward, 0, 3+len(y.PortForwards))
+	// Block ports 22 and sshLocalPort on all IPs
+	for _, port := range []int{sshGuestPort, sshLocalPort} {
+		rule := limayaml.PortForward{GuestIP: net.IPv4zero, GuestPort: port, Ignore: true}
+		limayaml.FillPortForwardDefaults(&rule, instDir)
+		rules = append(rules, rule)
+	}
+	rules = append(rules, y.PortForwards...)
+	if *y.PortForwardPolicy == limayaml.PortForwardPolicyDeny {
+		return rules
+	}
+	// Default forwards for all non-privileged ports from "127.0.0.1" and "::1"
+	rule := limayaml.PortForward{GuestIP: guestagentapi.IPv4loopback1, HostIP: y.Network.HostBind}
+	limayaml.FillPortForwardDefaults(&rule, instDir)
+	rules = append(rules, rule)
+	return rules
+}
+
+// DetermineSSHLocalPort returns `ssh.localPort`, or chooses the port when it is 0.
+// The port of a non-default instance is chosen randomly, so it may vary on each call.
+func DetermineSSHLocalPort(y *limayaml.LimaYAML, instName string) (int, error) {
 	if *y.SSH.LocalPort > 0 {
 		return *y.SSH.LocalPort, nil
 	}
@@ -219,123 +347,517 @@ func findFreeUDPLocalPort() (int, error) {
 	return port, nil
 }
 
+// SetEventWriter redirects the JSON lines of Events to w.
+// Logs are not affected.
+func (a *HostAgent) SetEventWriter(w io.Writer) {
+	a.eventEncMu.Lock()
+	defer a.eventEncMu.Unlock()
+	a.eventEnc = json.NewEncoder(w)
+}
+
 func (a *HostAgent) emitEvent(ctx context.Context, ev events.Event) {
 	a.eventEncMu.Lock()
 	defer a.eventEncMu.Unlock()
+	a.emitEventLocked(ev)
+}
+
+// updateStatus emits the last status modified by mutate. The event is not emitted when mutate returns false.
+// mutate is called with eventEncMu held, so that the concurrent updates by the other routines are not lost
+// between reading and replacing the last status.
+func (a *HostAgent) updateStatus(ctx context.Context, mutate func(st *events.Status) bool) {
+	a.eventEncMu.Lock()
+	defer a.eventEncMu.Unlock()
+	st := a.lastStatus
+	if !mutate(&st) {
+		return
+	}
+	a.emitEventLocked(events.Event{Status: st})
+}
+
+// emitEventLocked emits ev. eventEncMu must be held.
+func (a *HostAgent) emitEventLocked(ev events.Event) {
 	if ev.Time.IsZero() {
 		ev.Time = time.Now()
 	}
+	if ev.Status.Running {
+		a.bootProgress = 100
+	}
+	// The boot progress is tracked separately, so that it is not reset by the events emitted by the other routines
+	ev.Status.BootProgress = a.bootProgress
+	ev.Status.PendingRestart = a.pendingRestart
+	ev.Status.PortForwards = a.portForwards
+	a.lastStatus = ev.Status
 	if err := a.eventEnc.Encode(ev); err != nil {
 		logrus.WithField("event", ev).WithError(err).Error("failed to emit an event")
 	}
+	if err := a.writeEventFile(ev); err != nil {
+		logrus.WithField("event", ev).WithError(err).Warn("failed to write the event to a file")
+	}
+}
+
+// emitPortForwardStatus emits the last status with the updated status of the port forwards.
+func (a *HostAgent) emitPortForwardStatus(ctx context.Context) {
+	statuses := a.forwarder().Status()
+	a.updateStatus(ctx, func(*events.Status) bool {
+		a.portForwards = statuses
+		return true
+	})
+}
+
+// writeEventFile atomically replaces ha.json with ev, so that other processes can read the latest status.
+// See store.ReadHostAgentEvent.
+func (a *HostAgent) writeEventFile(ev events.Event) error {
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	eventFile := filepath.Join(a.instDir, filenames.HostAgentEvent)
+	eventFileTmp := eventFile + ".tmp"
+	if err := os.WriteFile(eventFileTmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(eventFileTmp, eventFile)
 }
 
-func logPipeRoutine(r io.Reader, header string) {
+// logPipeRoutine logs the lines read from r.
+// When tail is not nil, the lines are also kept in tail.
+func logPipeRoutine(r io.Reader, header string, tail *tailBuffer) {
 	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
 		line := scanner.Text()
 		logrus.Debugf("%s: %s", header, line)
+		if tail != nil {
+			tail.add(line)
+		}
+	}
+}
+
+// tailBuffer keeps the last lines written by a process, for reporting them when the process fails.
+type tailBuffer struct {
+	mu    sync.Mutex
+	max   int
+	lines []string
+}
+
+func (t *tailBuffer) add(line string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lines = append(t.lines, line)
+	if len(t.lines) > t.max {
+		t.lines = t.lines[len(t.lines)-t.max:]
 	}
 }
 
-func (a *HostAgent) Run(ctx context.Context) error {
+func (t *tailBuffer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return strings.Join(t.lines, "\n")
+}
+
+func (a *HostAgent) Run(ctx context.Context) (retErr error) {
+	var (
+		qCmd        *exec.Cmd
+		qStderrTail = &tailBuffer{max: 10}
+	)
+	a.runMu.Lock()
+	a.runStarted = true
+	a.runMu.Unlock()
+	defer a.lockFile.Close()
+	defer close(a.runDoneCh)
 	defer func() {
 		exitingEv := events.Event{
 			Status: events.Status{
+				Phase:   events.PhaseExiting,
 				Exiting: true,
 			},
 		}
+		// Distinguish a crash from a clean shutdown
+		if qCmd != nil && qCmd.ProcessState != nil {
+			exitCode := qCmd.ProcessState.ExitCode()
+			exitingEv.Status.QEMUExitCode = &exitCode
+		}
+		if retErr != nil {
+			stderrTail := qStderrTail.String()
+			// The hint is also included in the returned error, so that it is not lost when the events are not watched
+			var hint *qemuFailureHint
+			if events.Code(retErr) == events.ErrorCodeQEMU {
+				hint = diagnoseQEMUFailure(stderrTail)
+			}
+			if hint != nil {
+				retErr = events.WithCode(events.ErrorCodeQEMU, fmt.Errorf("%w (hint: %s)", retErr, hint.hint))
+			}
+			exitingEv.Status.AddError(retErr)
+			if stderrTail != "" {
+				exitingEv.Status.AddError(events.WithCode(events.ErrorCodeQEMU, errors.New("qemu stderr (last lines): "+stderrTail)))
+			}
+			if hint != nil {
+				exitingEv.Status.AddError(events.WithCode(hint.code, errors.New("hint: "+hint.hint)))
+			}
+			// The serial console shows whether the guest failed to boot, e.g., a kernel panic
+			if qCmd != nil && qCmd.ProcessState != nil {
+				if serialTail := readLastLines(filepath.Join(a.instDir, filenames.SerialLog), 10); serialTail != "" {
+					exitingEv.Status.AddError(events.WithCode(events.ErrorCodeQEMU, errors.New("serial console (last lines): "+serialTail)))
+				}
+			}
+		}
 		a.emitEvent(ctx, exitingEv)
 	}()
 
-	if *a.y.UseHostResolver {
+	select {
+	case <-a.shutdownCh:
+		// Shutdown was called before Run, and did not wait for Run
+		logrus.Info("Shutdown was requested before starting QEMU")
+		return nil
+	default:
+	}
+
+	// The error is reported in the Errors of the final event
+	if err := a.preflight(); err != nil {
+		return err
+	}
+
+	if *a.limaYAML().UseHostResolver {
 		dnsServer, err := dns.Start(a.udpDNSLocalPort, a.tcpDNSLocalPort)
 		if err != nil {
-			return fmt.Errorf("cannot start DNS server: %w", err)
+			return events.WithCode(events.ErrorCodePreflight, fmt.Errorf("cannot start DNS server: %w", err))
 		}
 		defer dnsServer.Shutdown()
 	}
 
-	qCmd := exec.CommandContext(ctx, a.qExe, a.qArgs...)
-	qStdout, err := qCmd.StdoutPipe()
+	qCmd, qWaitCh, cancelHA, err := a.startQEMU(ctx, qStderrTail)
 	if err != nil {
 		return err
 	}
-	go logPipeRoutine(qStdout, "qemu[stdout]")
+
+	for {
+		select {
+		case sig := <-a.signalCh:
+			logrus.Infof("Received signal %q, shutting down the host agent", sig)
+			a.stopRoutines(cancelHA)
+			return a.shutdownQEMU(ctx, 3*time.Minute, qCmd, qWaitCh)
+		case <-a.shutdownCh:
+			logrus.Info("Shutdown was requested, shutting down the host agent")
+			a.stopRoutines(cancelHA)
+			a.shutdownErr = a.shutdownQEMU(ctx, 3*time.Minute, qCmd, qWaitCh)
+			return a.shutdownErr
+		case resCh := <-a.restartCh:
+			a.configMu.Lock()
+			// lima.yaml is loaded before shutting down QEMU, so that an invalid config does not stop the instance
+			y, err := store.LoadYAMLByFilePath(filepath.Join(a.instDir, filenames.LimaYAML))
+			if err != nil {
+				a.configMu.Unlock()
+				resCh <- fmt.Errorf("failed to load the config, not restarting: %w", err)
+				continue
+			}
+			logrus.Info("Restart was requested, restarting QEMU")
+			// The routines of the previous boot must have returned before QEMU is started again,
+			// so that they do not register closers or touch the mounts of the next boot
+			a.stopRoutines(cancelHA)
+			if qWaitErr := a.shutdownQEMU(ctx, 3*time.Minute, qCmd, qWaitCh); qWaitErr != nil {
+				logrus.WithError(qWaitErr).Warn("QEMU did not exit cleanly")
+			}
+			err = a.reload(y)
+			if err == nil {
+				err = a.preflight()
+			}
+			if err == nil {
+				qCmd, qWaitCh, cancelHA, err = a.startQEMU(ctx, qStderrTail)
+			}
+			a.configMu.Unlock()
+			resCh <- err
+			if err != nil {
+				return err
+			}
+		case qWaitErr := <-qWaitCh:
+			logrus.WithError(qWaitErr).Info("QEMU has exited")
+			// lint insists that we need to call cancelHA() on all possible codepaths
+			cancelHA()
+			return events.WithCode(events.ErrorCodeQEMU, qWaitErr)
+		}
+	}
+}
+
+// preflight checks the host before starting QEMU.
+func (a *HostAgent) preflight() error {
+	a.yMu.RLock()
+	y, qExe := a.y, a.qExe
+	a.yMu.RUnlock()
+	if err := qemu.CheckBridgeNetworks(qExe, y); err != nil {
+		return events.WithCode(events.ErrorCodePreflight, err)
+	}
+	if err := qemu.CheckHugepages(y); err != nil {
+		return events.WithCode(events.ErrorCodePreflight, err)
+	}
+	if err := qemu.CheckPCIPassthrough(y); err != nil {
+		return events.WithCode(events.ErrorCodePreflight, err)
+	}
+	if err := qemu.CheckVNC(y); err != nil {
+		return events.WithCode(events.ErrorCodePreflight, err)
+	}
+	return nil
+}
+
+// startQEMU starts QEMU, and the routines of the host agent that wait for the guest to boot.
+// The routines are stopped by stopRoutines(cancelHA).
+func (a *HostAgent) startQEMU(ctx context.Context, qStderrTail *tailBuffer) (qCmd *exec.Cmd, qWaitCh chan error, cancelHA context.CancelFunc, err error) {
+	a.yMu.RLock()
+	y, qExe, qArgs := a.y, a.qExe, a.qArgs
+	a.yMu.RUnlock()
+	qCfg := qemu.Config{
+		Name:        a.instName,
+		InstanceDir: a.instDir,
+		LimaYAML:    y,
+	}
+	if err := qemu.Prepare(qCfg); err != nil {
+		return nil, nil, nil, err
+	}
+	spiceSock := filepath.Join(a.instDir, filenames.SPICESock)
+	if *y.Video.SPICE.Enabled {
+		// QEMU fails to listen on the socket left behind by the previous QEMU, e.g., on Restart
+		if err := os.RemoveAll(spiceSock); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	qCmd = exec.CommandContext(ctx, qExe, qArgs...)
+	qStdout, err := qCmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	go logPipeRoutine(qStdout, "qemu[stdout]", nil)
 	qStderr, err := qCmd.StderrPipe()
 	if err != nil {
-		return err
+		return nil, nil, nil, err
 	}
-	go logPipeRoutine(qStderr, "qemu[stderr]")
+	go logPipeRoutine(qStderr, "qemu[stderr]", qStderrTail)
 
 	logrus.Infof("Starting QEMU (hint: to watch the boot progress, see %q)", filepath.Join(a.instDir, filenames.SerialLog))
 	logrus.Debugf("qCmd.Args: %v", qCmd.Args)
 	if err := qCmd.Start(); err != nil {
-		return err
+		return nil, nil, nil, events.WithCode(events.ErrorCodeQEMU, err)
 	}
-	qWaitCh := make(chan error)
+	qStarted := time.Now()
+	qWaitCh = make(chan error)
 	go func() {
 		qWaitCh <- qCmd.Wait()
 	}()
 
 	stBase := events.Status{
 		SSHLocalPort: a.sshLocalPort,
+		VNCEndpoint:  qemu.VNCEndpoint(y),
+	}
+	if *y.Video.SPICE.Enabled {
+		stBase.SPICESocket = spiceSock
 	}
 	stBooting := stBase
+	stBooting.Phase = events.PhaseBooting
+	if w := qemu.TCGWarning(y); w != "" {
+		stBooting.AddError(events.WithCode(events.ErrorCodeAcceleration, errors.New(w)))
+	}
+	if usbWarnings, err := qemu.USBWarnings(y); err != nil {
+		logrus.WithError(err).Debug("failed to check the USB devices of the host")
+	} else {
+		for _, w := range usbWarnings {
+			logrus.Warn(w)
+			stBooting.AddError(events.WithCode(events.ErrorCodePreflight, errors.New(w)))
+		}
+	}
+	a.eventEncMu.Lock()
+	a.bootProgress = 0
+	a.pendingRestart = nil
+	a.portForwards = nil
+	a.eventEncMu.Unlock()
 	a.emitEvent(ctx, events.Event{Status: stBooting})
 
+	a.cpuMu.Lock()
+	a.cpus = 0
+	a.cpuMu.Unlock()
+	a.addOnClose(a.qmp.close)
 	ctxHA, cancelHA := context.WithCancel(ctx)
-	go func() {
+	a.goRoutine(func() { a.connectQMP(ctxHA) })
+	a.goRoutine(func() { a.watchBootProgress(ctxHA) })
+	a.goRoutine(func() { a.watchHeartbeat(ctxHA) })
+	a.goRoutine(func() { a.pinVCPUs(ctxHA, y.CPU.Pinning) })
+	a.goRoutine(func() {
 		stRunning := stBase
-		if haErr := a.startHostAgentRoutines(ctxHA); haErr != nil {
+		stRunning.Phase = events.PhaseRequirements
+		var timings events.Timings
+		if sshErr := a.waitForRequirements(ctxHA, "ssh", a.sshRequirements()); sshErr != nil {
+			stRunning.Degraded = true
+			stRunning.AddError(events.WithCode(events.ErrorCodeSSH, sshErr))
+		} else {
+			stRunning.SSHReady = true
+			a.emitEvent(ctx, events.Event{Status: stRunning})
+		}
+		timings.QEMUToSSH = time.Since(qStarted)
+		if ctxHA.Err() != nil {
+			// QEMU is being shut down or restarted
+			return
+		}
+		if haErr := a.startHostAgentRoutines(ctxHA, &stRunning); haErr != nil {
 			stRunning.Degraded = true
-			stRunning.Errors = append(stRunning.Errors, haErr.Error())
+			stRunning.AddError(haErr)
 		}
+		if pullErr := a.prePullImages(ctxHA, stRunning); pullErr != nil {
+			stRunning.Degraded = true
+			stRunning.AddError(events.WithCode(events.ErrorCodePrePull, pullErr))
+		}
+		if ctxHA.Err() != nil {
+			// QEMU is being shut down or restarted
+			return
+		}
+		timings.Ready = time.Since(qStarted)
+		timings.Requirements = timings.Ready - timings.QEMUToSSH
+		stRunning.Phase = events.PhaseRunning
 		stRunning.Running = true
+		stRunning.Timings = &timings
 		a.emitEvent(ctx, events.Event{Status: stRunning})
+	})
+	return qCmd, qWaitCh, cancelHA, nil
+}
+
+// goRoutine runs f in a goroutine that is waited by stopRoutines.
+// f must return when the context of the routines is cancelled.
+func (a *HostAgent) goRoutine(f func()) {
+	a.routinesWG.Add(1)
+	go func() {
+		defer a.routinesWG.Done()
+		f()
 	}()
+}
 
-	for {
-		select {
-		case <-a.sigintCh:
-			logrus.Info("Received SIGINT, shutting down the host agent")
-			cancelHA()
-			if closeErr := a.close(); closeErr != nil {
-				logrus.WithError(closeErr).Warn("an error during shutting down the host agent")
-			}
-			return a.shutdownQEMU(ctx, 3*time.Minute, qCmd, qWaitCh)
-		case qWaitErr := <-qWaitCh:
-			logrus.WithError(qWaitErr).Info("QEMU has exited")
-			// lint insists that we need to call cancelHA() on all possible codepaths
-			cancelHA()
-			return qWaitErr
-		}
+// stopRoutines cancels the routines started by startQEMU, waits for them to return,
+// and then runs the closers registered by them.
+func (a *HostAgent) stopRoutines(cancelHA context.CancelFunc) {
+	cancelHA()
+	a.routinesWG.Wait()
+	if closeErr := a.close(); closeErr != nil {
+		logrus.WithError(closeErr).Warn("an error during shutting down the host agent")
+	}
+}
+
+// addOnClose registers f to be called by close, in the reverse order of the registration.
+func (a *HostAgent) addOnClose(f func() error) {
+	a.onCloseMu.Lock()
+	a.onClose = append(a.onClose, f)
+	a.onCloseMu.Unlock()
+}
+
+// reload applies y, the reloaded lima.yaml, while QEMU is not running.
+// The cidata ISO and the QEMU command line are regenerated, and the port forwarding rules are updated.
+// The SSH port, the DNS ports, and the SSH options are kept, as they are used by the processes outside QEMU.
+func (a *HostAgent) reload(y *limayaml.LimaYAML) error {
+	if err := cidata.GenerateISO9660(a.instDir, a.instName, y, a.udpDNSLocalPort, a.tcpDNSLocalPort, a.nerdctlArchive); err != nil {
+		return err
+	}
+	qCfg := qemu.Config{
+		Name:         a.instName,
+		InstanceDir:  a.instDir,
+		LimaYAML:     y,
+		SSHLocalPort: a.sshLocalPort,
+		VSockCID:     a.vsockCID,
+	}
+	qExe, qArgs, err := qemu.Cmdline(qCfg)
+	if err != nil {
+		return err
+	}
+	portForwarder := newPortForwarder(a.sshConfig, a.sshLocalPort, portForwardRules(y, a.instDir, a.sshLocalPort), *y.PortForwardOnConflict)
+	a.yMu.Lock()
+	a.y = y
+	a.qExe = qExe
+	a.qArgs = qArgs
+	a.portForwarder = portForwarder
+	a.yMu.Unlock()
+	return nil
+}
+
+// limaYAML returns the current config. The returned value must not be modified;
+// Reload and Restart replace the pointer instead.
+func (a *HostAgent) limaYAML() *limayaml.LimaYAML {
+	a.yMu.RLock()
+	defer a.yMu.RUnlock()
+	return a.y
+}
+
+// forwarder returns the current port forwarder, which is replaced by Restart.
+func (a *HostAgent) forwarder() *portForwarder {
+	a.yMu.RLock()
+	defer a.yMu.RUnlock()
+	return a.portForwarder
+}
+
+// Restart gracefully shuts down QEMU, and starts QEMU again with lima.yaml reloaded,
+// e.g., for applying the changes of `cpus` and `memory`.
+// The mounts and the port forwards are set up again after the guest has booted.
+//
+// Restart returns after QEMU has been started; the boot progress is reported with the events.
+// When lima.yaml is invalid, Restart returns an error without shutting down QEMU.
+// When QEMU fails to start again, Run returns the error too.
+func (a *HostAgent) Restart(ctx context.Context) error {
+	resCh := make(chan error, 1)
+	select {
+	case a.restartCh <- resCh:
+	case <-a.runDoneCh:
+		return errors.New("the host agent is not running")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-resCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown gracefully shuts down QEMU (ACPI powerdown, then kill after the timeout)
+// and waits for Run to return.
+//
+// Shutdown is safe to call concurrently with Run, and can be called multiple times.
+// Shutdown returns nil if QEMU had already exited without being asked to shut down.
+// Shutdown returns nil immediately if Run has not been called; Run then returns without starting QEMU.
+func (a *HostAgent) Shutdown(ctx context.Context) error {
+	a.shutdownOnce.Do(func() {
+		close(a.shutdownCh)
+	})
+	a.runMu.Lock()
+	started := a.runStarted
+	a.runMu.Unlock()
+	if !started {
+		return nil
+	}
+	select {
+	case <-a.runDoneCh:
+		return a.shutdownErr
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
+
 func (a *HostAgent) Info(ctx context.Context) (*hostagentapi.Info, error) {
 	info := &hostagentapi.Info{
 		SSHLocalPort: a.sshLocalPort,
 	}
+	cpus, err := a.CPUs(ctx)
+	if err != nil {
+		logrus.WithError(err).Debug("failed to get the number of CPUs")
+	} else {
+		info.CPUs = cpus
+	}
 	return info, nil
 }
 
 func (a *HostAgent) shutdownQEMU(ctx context.Context, timeout time.Duration, qCmd *exec.Cmd, qWaitCh <-chan error) error {
 	logrus.Info("Shutting down QEMU with ACPI")
-	qmpSockPath := filepath.Join(a.instDir, filenames.QMPSock)
-	qmpClient, err := qmp.NewSocketMonitor("unix", qmpSockPath, 5*time.Second)
+	// The connection was closed by a.close(), so a new connection is made; it is dropped when QEMU exits
+	qmpClient, err := a.qmp.monitor()
 	if err != nil {
-		logrus.WithError(err).Warnf("failed to open the QMP socket %q, forcibly killing QEMU", qmpSockPath)
-		return a.killQEMU(ctx, timeout, qCmd, qWaitCh)
-	}
-	if err := qmpClient.Connect(); err != nil {
-		logrus.WithError(err).Warnf("failed to connect to the QMP socket %q, forcibly killing QEMU", qmpSockPath)
+		logrus.WithError(err).Warn("failed to connect to QMP, forcibly killing QEMU")
 		return a.killQEMU(ctx, timeout, qCmd, qWaitCh)
 	}
-	defer func() { _ = qmpClient.Disconnect() }()
 	rawClient := raw.NewMonitor(qmpClient)
 	logrus.Info("Sending QMP system_powerdown command")
 	if err := rawClient.SystemPowerdown(); err != nil {
-		logrus.WithError(err).Warnf("failed to send system_powerdown command via the QMP socket %q, forcibly killing QEMU", qmpSockPath)
+		logrus.WithError(err).Warnf("failed to send system_powerdown command via the QMP socket %q, forcibly killing QEMU", a.qmp.sockPath)
 		return a.killQEMU(ctx, timeout, qCmd, qWaitCh)
 	}
 	deadline := time.After(timeout)
@@ -360,8 +882,8 @@ func (a *HostAgent) killQEMU(ctx context.Context, timeout time.Duration, qCmd *e
 	return qWaitErr
 }
 
-func (a *HostAgent) startHostAgentRoutines(ctx context.Context) error {
-	a.onClose = append(a.onClose, func() error {
+func (a *HostAgent) startHostAgentRoutines(ctx context.Context, st *events.Status) error {
+	a.addOnClose(func() error {
 		logrus.Debugf("shutting down the SSH master")
 		if exitMasterErr := ssh.ExitMaster("127.0.0.1", a.sshLocalPort, a.sshConfig); exitMasterErr != nil {
 			logrus.WithError(exitMasterErr).Warn("failed to exit SSH master")
@@ -370,13 +892,21 @@ func (a *HostAgent) startHostAgentRoutines(ctx context.Context) error {
 	})
 	var mErr error
 	if err := a.waitForRequirements(ctx, "essential", a.essentialRequirements()); err != nil {
-		mErr = multierror.Append(mErr, err)
+		mErr = multierror.Append(mErr, events.WithCode(events.ErrorCodeRequirement, err))
 	}
-	mounts, err := a.setupMounts(ctx)
+	mounts, err := a.setupMounts(ctx, st, a.limaYAML().Mounts)
 	if err != nil {
-		mErr = multierror.Append(mErr, err)
+		mErr = multierror.Append(mErr, events.WithCode(events.ErrorCodeMount, err))
 	}
-	a.onClose = append(a.onClose, func() error {
+	a.mountsMu.Lock()
+	a.mounts, a.mountsClosed = mounts, false
+	a.mountsMu.Unlock()
+	a.addOnClose(func() error {
+		// a.mounts may have been changed by Reload
+		a.mountsMu.Lock()
+		mounts := a.mounts
+		a.mounts, a.mountsClosed = nil, true
+		a.mountsMu.Unlock()
 		var unmountMErr error
 		for _, m := range mounts {
 			if unmountErr := m.close(); unmountErr != nil {
@@ -385,21 +915,35 @@ func (a *HostAgent) startHostAgentRoutines(ctx context.Context) error {
 		}
 		return unmountMErr
 	})
-	go a.watchGuestAgentEvents(ctx)
+	a.goRoutine(func() { a.watchMounts(ctx) })
+	a.goRoutine(func() { a.watchGuestAgentEvents(ctx) })
 	if err := a.waitForRequirements(ctx, "optional", a.optionalRequirements()); err != nil {
-		mErr = multierror.Append(mErr, err)
+		mErr = multierror.Append(mErr, events.WithCode(events.ErrorCodeRequirement, err))
 	}
 	if err := a.waitForRequirements(ctx, "final", a.finalRequirements()); err != nil {
-		mErr = multierror.Append(mErr, err)
+		mErr = multierror.Append(mErr, events.WithCode(events.ErrorCodeRequirement, err))
+	}
+	// The addresses are informational, so a failure is not a requirement failure
+	if networks, err := a.networkStatus(); err != nil {
+		logrus.WithError(err).Warn("failed to get the addresses of the network interfaces")
+	} else {
+		st.Networks = networks
 	}
+	a.goRoutine(func() { a.watchResourceUsage(ctx) })
+	a.goRoutine(func() { a.watchIdle(ctx) })
 	return mErr
 }
 
+// close runs and removes the closers registered with addOnClose.
 func (a *HostAgent) close() error {
 	logrus.Infof("Shutting down the host agent")
+	a.onCloseMu.Lock()
+	onClose := a.onClose
+	a.onClose = nil
+	a.onCloseMu.Unlock()
 	var mErr error
-	for i := len(a.onClose) - 1; i >= 0; i-- {
-		f := a.onClose[i]
+	for i := len(onClose) - 1; i >= 0; i-- {
+		f := onClose[i]
 		if err := f(); err != nil {
 			mErr = multierror.Append(mErr, err)
 		}
@@ -408,43 +952,54 @@ func (a *HostAgent) close() error {
 }
 
 func (a *HostAgent) watchGuestAgentEvents(ctx context.Context) {
-	// TODO: use vSock (when QEMU for macOS gets support for vSock)
-
-	// Setup all socket forwards and defer their teardown
+	// Setup all socket forwards and reverse forwards, and defer their teardown
 	logrus.Debugf("Forwarding unix sockets")
-	for _, rule := range a.y.PortForwards {
-		if rule.GuestSocket != "" {
-			local := hostAddress(rule, guestagentapi.IPPort{})
-			_ = forwardSSH(ctx, a.sshConfig, a.sshLocalPort, local, rule.GuestSocket, verbForward)
+	for _, rule := range a.limaYAML().PortForwards {
+		if local, remote, ok := staticForwardingAddresses(rule); ok {
+			_ = forwardSSH(ctx, a.sshConfig, a.sshLocalPort, local, remote, verbForward, rule.Reverse)
 		}
 	}
 
 	localUnix := filepath.Join(a.instDir, filenames.GuestAgentSock)
 	remoteUnix := "/run/lima-guestagent.sock"
+	// set to 1 once the guest agent socket is forwarded over SSH, i.e., when vsock is not available
+	var guestAgentForwarded int32
 
-	a.onClose = append(a.onClose, func() error {
+	a.addOnClose(func() error {
 		logrus.Debugf("Stop forwarding unix sockets")
 		var mErr error
-		for _, rule := range a.y.PortForwards {
-			if rule.GuestSocket != "" {
-				local := hostAddress(rule, guestagentapi.IPPort{})
+		// the rules may have been changed by Reload
+		for _, rule := range a.limaYAML().PortForwards {
+			if local, remote, ok := staticForwardingAddresses(rule); ok {
 				// using ctx.Background() because ctx has already been cancelled
-				if err := forwardSSH(context.Background(), a.sshConfig, a.sshLocalPort, local, rule.GuestSocket, verbCancel); err != nil {
+				if err := forwardSSH(context.Background(), a.sshConfig, a.sshLocalPort, local, remote, verbCancel, rule.Reverse); err != nil {
 					mErr = multierror.Append(mErr, err)
 				}
 			}
 		}
-		if err := forwardSSH(context.Background(), a.sshConfig, a.sshLocalPort, localUnix, remoteUnix, verbCancel); err != nil {
-			mErr = multierror.Append(mErr, err)
+		if atomic.LoadInt32(&guestAgentForwarded) != 0 {
+			if err := forwardSSH(context.Background(), a.sshConfig, a.sshLocalPort, localUnix, remoteUnix, verbCancel, false); err != nil {
+				mErr = multierror.Append(mErr, err)
+			}
 		}
 		return mErr
 	})
 
+	interval := time.Duration(*a.limaYAML().GuestAgent.ReconnectInterval) * time.Second
 	for {
-		if !isGuestAgentSocketAccessible(ctx, localUnix) {
-			_ = forwardSSH(ctx, a.sshConfig, a.sshLocalPort, localUnix, remoteUnix, verbForward)
+		var err error
+		client := a.guestAgentVSockClient(ctx, interval)
+		if client == nil {
+			if c, cErr := guestagentclient.NewGuestAgentClient(localUnix); cErr != nil || !isGuestAgentAccessible(ctx, c, interval) {
+				_ = forwardSSH(ctx, a.sshConfig, a.sshLocalPort, localUnix, remoteUnix, verbForward, false)
+				atomic.StoreInt32(&guestAgentForwarded, 1)
+			}
+			client, err = guestagentclient.NewGuestAgentClient(localUnix)
 		}
-		if err := a.processGuestAgentEvents(ctx, localUnix); err != nil {
+		if err == nil {
+			err = a.processGuestAgentEvents(ctx, client)
+		}
+		if err != nil {
 			if !errors.Is(err, context.Canceled) {
 				logrus.WithError(err).Warn("connection to the guest agent was closed unexpectedly")
 			}
@@ -452,26 +1007,77 @@ func (a *HostAgent) watchGuestAgentEvents(ctx context.Context) {
 		select {
 		case <-ctx.Done():
 			return
-		case <-time.After(10 * time.Second):
+		case <-time.After(interval):
 		}
+		a.refreshSocketForwards(ctx)
 	}
 }
 
-func isGuestAgentSocketAccessible(ctx context.Context, localUnix string) bool {
-	client, err := guestagentclient.NewGuestAgentClient(localUnix)
-	if err != nil {
-		return false
+// refreshSocketForwards sets up the forwards of the guest sockets again, when the host socket no longer accepts
+// connections, e.g., after the SSH master connection was restarted. The stale host socket is removed by forwardSSH.
+func (a *HostAgent) refreshSocketForwards(ctx context.Context) {
+	for _, rule := range a.limaYAML().PortForwards {
+		local, remote, ok := staticForwardingAddresses(rule)
+		if !ok || rule.Reverse || !strings.HasPrefix(local, "/") {
+			continue
+		}
+		if conn, err := net.Dial("unix", local); err == nil {
+			_ = conn.Close()
+			continue
+		}
+		logrus.Infof("The forward from %q (guest) to %q (host) is not active, forwarding again", remote, local)
+		if err := forwardSSH(ctx, a.sshConfig, a.sshLocalPort, local, remote, verbForward, false); err != nil {
+			logrus.WithError(err).Warnf("failed to forward %q (guest) to %q (host) again", remote, local)
+		}
 	}
-	_, err = client.Info(ctx)
-	return err == nil
 }
 
-func (a *HostAgent) processGuestAgentEvents(ctx context.Context, localUnix string) error {
-	client, err := guestagentclient.NewGuestAgentClient(localUnix)
-	if err != nil {
-		return err
+// guestAgentVSockClient returns the client of the guest agent over vsock.
+// nil is returned when the guest has no vsock device, or the guest agent does not listen on vsock,
+// so that the caller can fall back to the socket forwarded over SSH.
+func (a *HostAgent) guestAgentVSockClient(ctx context.Context, timeout time.Duration) guestagentclient.GuestAgentClient {
+	if a.vsockCID == 0 {
+		return nil
+	}
+	hc := &http.Client{
+		Transport: &tokenTransport{
+			token: a.guestAgentToken,
+			base: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return vsock.Dial(ctx, a.vsockCID, guestagentapi.VSockPort)
+				},
+			},
+		},
 	}
+	client := guestagentclient.NewGuestAgentClientWithHTTPClient(hc)
+	if !isGuestAgentAccessible(ctx, client, timeout) {
+		logrus.Debugf("the guest agent is not accessible over vsock (CID %d), falling back to SSH", a.vsockCID)
+		return nil
+	}
+	return client
+}
 
+// tokenTransport presents the token of the instance to the guest agent, which requires it over vsock.
+type tokenTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return t.base.RoundTrip(req)
+}
+
+// isGuestAgentAccessible checks whether the guest agent responds within timeout.
+func isGuestAgentAccessible(ctx context.Context, client guestagentclient.GuestAgentClient, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	_, err := client.Info(ctx)
+	return err == nil
+}
+
+func (a *HostAgent) processGuestAgentEvents(ctx context.Context, client guestagentclient.GuestAgentClient) error {
 	info, err := client.Info(ctx)
 	if err != nil {
 		return err
@@ -484,7 +1090,8 @@ func (a *HostAgent) processGuestAgentEvents(ctx context.Context, localUnix strin
 		for _, f := range ev.Errors {
 			logrus.Warnf("received error from the guest: %q", f)
 		}
-		a.portForwarder.OnEvent(ctx, ev)
+		a.forwarder().OnEvent(ctx, ev)
+		a.emitPortForwardStatus(ctx)
 	}
 
 	if err := client.Events(ctx, onEvent); err != nil {
@@ -498,19 +1105,36 @@ const (
 	verbCancel  = "cancel"
 )
 
-func forwardSSH(ctx context.Context, sshConfig *ssh.SSHConfig, port int, local, remote string, verb string) error {
+// forwardSSH forwards remote (guest) to local (host) using `ssh -L`.
+// When reverse is true, local (host) is forwarded to remote (guest) using `ssh -R` instead.
+func forwardSSH(ctx context.Context, sshConfig *ssh.SSHConfig, port int, local, remote string, verb string, reverse bool) error {
+	forward := []string{"-L", local + ":" + remote}
+	if reverse {
+		forward = []string{"-R", remote + ":" + local}
+	}
 	args := sshConfig.Args()
 	args = append(args,
 		"-T",
 		"-O", verb,
-		"-L", local+":"+remote,
+	)
+	args = append(args, forward...)
+	args = append(args,
 		"-N",
 		"-f",
 		"-p", strconv.Itoa(port),
 		"127.0.0.1",
 		"--",
 	)
-	if strings.HasPrefix(local, "/") {
+	if reverse {
+		switch verb {
+		case verbForward:
+			logrus.Infof("Forwarding %q (host) to %q (guest)", local, remote)
+		case verbCancel:
+			logrus.Infof("Stopping forwarding %q (host) to %q (guest)", local, remote)
+		default:
+			panic(fmt.Errorf("invalid verb %q", verb))
+		}
+	} else if strings.HasPrefix(local, "/") {
 		switch verb {
 		case verbForward:
 			logrus.Infof("Forwarding %q (guest) to %q (host)", remote, local)
@@ -533,7 +1157,7 @@ func forwardSSH(ctx context.Context, sshConfig *ssh.SSHConfig, port int, local,
 	}
 	cmd := exec.CommandContext(ctx, sshConfig.Binary(), args...)
 	if out, err := cmd.Output(); err != nil {
-		if verb == verbForward && strings.HasPrefix(local, "/") {
+		if verb == verbForward && !reverse && strings.HasPrefix(local, "/") {
 			logrus.WithError(err).Warnf("Failed to set up forward from %q (guest) to %q (host)", remote, local)
 			if removeErr := os.RemoveAll(local); err != nil {
 				logrus.WithError(removeErr).Warnf("Failed to clean up %q (host) after forwarding failed", local)
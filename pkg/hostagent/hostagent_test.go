@@ -0,0 +1,157 @@
+package hostagent
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/sshocker/pkg/ssh"
+	"github.com/xorcare/pointer"
+	"gotest.tools/v3/assert"
+)
+
+func TestTokenTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+	hc := &http.Client{Transport: &tokenTransport{token: "secret", base: http.DefaultTransport}}
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	assert.NilError(t, err)
+	resp, err := hc.Do(req)
+	assert.NilError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	// the request of the caller is not modified
+	assert.Equal(t, "", req.Header.Get("Authorization"))
+}
+
+func TestUpdateStatus(t *testing.T) {
+	a := &HostAgent{instDir: t.TempDir(), eventEnc: json.NewEncoder(io.Discard)}
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			a.updateStatus(ctx, func(st *events.Status) bool {
+				st.CPUs++
+				return true
+			})
+		}()
+		go func() {
+			defer wg.Done()
+			a.updateStatus(ctx, func(st *events.Status) bool {
+				st.MemoryUsedBytes++
+				return true
+			})
+		}()
+	}
+	wg.Wait()
+	// none of the updates is overwritten by a stale copy of the last status
+	assert.Equal(t, 100, a.lastStatus.CPUs)
+	assert.Equal(t, int64(100), a.lastStatus.MemoryUsedBytes)
+
+	a.updateStatus(ctx, func(st *events.Status) bool {
+		st.CPUs = 0
+		return false
+	})
+	assert.Equal(t, 100, a.lastStatus.CPUs)
+}
+
+// slowSSHServer accepts the connections on a local port without sending the SSH banner for a while,
+// so that the ssh requirement stays pending in the middle of an ssh command.
+func slowSSHServer(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				time.Sleep(time.Second)
+				_ = conn.Close()
+			}()
+		}
+	}()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// TestRestartWhileRequirementsPending stops the routines of startQEMU and starts them again, as Restart does,
+// while the ssh requirement is still pending. Run with -race.
+func TestRestartWhileRequirementsPending(t *testing.T) {
+	instDir := t.TempDir()
+	var y, d, o limayaml.LimaYAML
+	limayaml.FillDefault(&y, &d, &o, filepath.Join(instDir, filenames.LimaYAML))
+	// qemu.Prepare does not need to look up the firmware of QEMU
+	y.Firmware.Code = pointer.String(filepath.Join(instDir, "code.fd"))
+	a := &HostAgent{
+		instDir:      instDir,
+		y:            &y,
+		sshLocalPort: slowSSHServer(t),
+		sshConfig:    &ssh.SSHConfig{AdditionalArgs: []string{"-F", "/dev/null", "-o", "BatchMode=yes"}},
+		qmp:          &qmpConn{sockPath: filepath.Join(instDir, filenames.QMPSock)},
+		qExe:         "sleep", // stands in for QEMU
+		qArgs:        []string{"60"},
+		eventEnc:     json.NewEncoder(io.Discard),
+	}
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		qCmd, qWaitCh, cancelHA, err := a.startQEMU(ctx, &tailBuffer{max: 10})
+		assert.NilError(t, err)
+		time.Sleep(200 * time.Millisecond)
+		a.stopRoutines(cancelHA)
+		// no routine of this boot is left running
+		done := make(chan struct{})
+		go func() {
+			a.routinesWG.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(100 * time.Millisecond):
+			t.Fatal("stopRoutines returned before the routines")
+		}
+		// no closer of this boot is left for the next boot
+		a.onCloseMu.Lock()
+		assert.Equal(t, 0, len(a.onClose))
+		a.onCloseMu.Unlock()
+		_ = a.killQEMU(ctx, time.Second, qCmd, qWaitCh)
+	}
+}
+
+func TestShutdownWithoutRun(t *testing.T) {
+	instDir := t.TempDir()
+	lockFile, err := os.Create(filepath.Join(instDir, filenames.HostAgentLock))
+	assert.NilError(t, err)
+	a := &HostAgent{
+		instDir:    instDir,
+		lockFile:   lockFile,
+		shutdownCh: make(chan struct{}),
+		restartCh:  make(chan chan error),
+		runDoneCh:  make(chan struct{}),
+		eventEnc:   json.NewEncoder(io.Discard),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	assert.NilError(t, a.Shutdown(ctx))
+	// Run is called after Shutdown, and returns without starting QEMU
+	assert.NilError(t, a.Run(ctx))
+	assert.NilError(t, a.Shutdown(ctx))
+}
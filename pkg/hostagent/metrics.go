@@ -0,0 +1,41 @@
+package hostagent
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+)
+
+// WriteMetrics writes the durations of the boot phases in the Prometheus text format.
+// Nothing is written until Running becomes true for the first time after starting QEMU.
+// The durations of downloading the image and creating the disk are measured by `limactl start`, not by the host agent.
+func (a *HostAgent) WriteMetrics(w io.Writer) error {
+	a.eventEncMu.Lock()
+	timings := a.lastStatus.Timings
+	a.eventEncMu.Unlock()
+	return writeMetrics(w, a.instName, timings)
+}
+
+func writeMetrics(w io.Writer, instName string, timings *events.Timings) error {
+	if timings == nil {
+		return nil
+	}
+	const name = "lima_boot_phase_duration_seconds"
+	if _, err := fmt.Fprintf(w, "# HELP %s Duration of the boot phase of the instance.\n# TYPE %s gauge\n", name, name); err != nil {
+		return err
+	}
+	for _, m := range []struct {
+		phase string
+		value float64
+	}{
+		{"qemu_to_ssh", timings.QEMUToSSH.Seconds()},
+		{"requirements", timings.Requirements.Seconds()},
+		{"ready", timings.Ready.Seconds()},
+	} {
+		if _, err := fmt.Fprintf(w, "%s{instance=%q,phase=%q} %g\n", name, instName, m.phase, m.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package hostagent
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"gotest.tools/v3/assert"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	var b bytes.Buffer
+	assert.NilError(t, writeMetrics(&b, "default", nil))
+	assert.Equal(t, "", b.String())
+
+	timings := &events.Timings{
+		QEMUToSSH:    12 * time.Second,
+		Requirements: 3500 * time.Millisecond,
+		Ready:        15500 * time.Millisecond,
+	}
+	assert.NilError(t, writeMetrics(&b, "default", timings))
+	assert.Equal(t, `# HELP lima_boot_phase_duration_seconds Duration of the boot phase of the instance.
+# TYPE lima_boot_phase_duration_seconds gauge
+lima_boot_phase_duration_seconds{instance="default",phase="qemu_to_ssh"} 12
+lima_boot_phase_duration_seconds{instance="default",phase="requirements"} 3.5
+lima_boot_phase_duration_seconds{instance="default",phase="ready"} 15.5
+`, b.String())
+}
@@ -2,32 +2,56 @@ package hostagent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/alessio/shellescape"
 	"github.com/hashicorp/go-multierror"
+	"github.com/lima-vm/lima/pkg/hostagent/events"
 	"github.com/lima-vm/lima/pkg/limayaml"
 	"github.com/lima-vm/lima/pkg/localpathutil"
 	"github.com/lima-vm/sshocker/pkg/reversesshfs"
+	"github.com/lima-vm/sshocker/pkg/ssh"
 	"github.com/sirupsen/logrus"
 )
 
 type mount struct {
-	close func() error
+	location  string // expanded
+	writable  bool
+	mountType limayaml.MountType
+	sshfsArgs []string // the additional arguments of sshfs, except "allow_other"
+
+	mu     sync.Mutex
+	stop   func() error // set by startMount
+	closed bool
 }
 
-func (a *HostAgent) setupMounts(ctx context.Context) ([]*mount, error) {
+// setupMounts sets up the mounts, appending the status of each mount to st.Mounts,
+// and emitting an event after each mount.
+func (a *HostAgent) setupMounts(ctx context.Context, st *events.Status, mounts []limayaml.Mount) ([]*mount, error) {
 	var (
 		res  []*mount
 		mErr error
 	)
-	for _, f := range a.y.Mounts {
+	for _, f := range mounts {
 		m, err := a.setupMount(ctx, f)
+		mountStatus := events.MountStatus{MountPoint: f.Location}
+		if expanded, expandErr := localpathutil.Expand(f.Location); expandErr == nil {
+			mountStatus.MountPoint = expanded
+		}
 		if err != nil {
+			mountStatus.Error = err.Error()
 			mErr = multierror.Append(mErr, err)
-			continue
+		} else {
+			mountStatus.Mounted = true
+			res = append(res, m)
 		}
-		res = append(res, m)
+		st.Mounts = append(st.Mounts, mountStatus)
+		a.emitEvent(ctx, events.Event{Status: *st})
 	}
 	return res, mErr
 }
@@ -41,36 +65,241 @@ func (a *HostAgent) setupMount(ctx context.Context, m limayaml.Mount) (*mount, e
 		return nil, err
 	}
 	logrus.Infof("Mounting %q", expanded)
+	res := &mount{
+		location:  expanded,
+		writable:  m.Writable,
+		mountType: *a.limaYAML().MountType,
+		sshfsArgs: sshfsArgs(m.SSHFS),
+	}
+	if err := a.startMount(res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// startMount mounts m in the guest. m.mu must be held, unless m is not shared yet.
+func (a *HostAgent) startMount(m *mount) error {
+	if m.mountType == limayaml.NFS {
+		return a.startNFSMount(m)
+	}
+	return a.startReverseSSHFSMount(m)
+}
+
+// sshfsArgs returns the `-o` options of sshfs for `sshfs` of a mount.
+// The defaults of sshfs are not passed, so that the command line is unchanged for the default configuration.
+func sshfsArgs(o limayaml.SSHFS) []string {
+	var args []string
+	if o.Cache != nil && !*o.Cache {
+		args = append(args, "-o", "cache=no")
+	}
+	if o.FollowSymlinks != nil && *o.FollowSymlinks {
+		args = append(args, "-o", "follow_symlinks")
+	}
+	for _, opt := range o.Options {
+		args = append(args, "-o", opt)
+	}
+	return args
+}
+
+func (a *HostAgent) startReverseSSHFSMount(m *mount) error {
 	rsf := &reversesshfs.ReverseSSHFS{
 		SSHConfig:  a.sshConfig,
-		LocalPath:  expanded,
+		LocalPath:  m.location,
 		Host:       "127.0.0.1",
 		Port:       a.sshLocalPort,
-		RemotePath: expanded,
-		Readonly:   !m.Writable,
+		RemotePath: m.location,
+		Readonly:   !m.writable,
 		// NOTE: allow_other requires "user_allow_other" in /etc/fuse.conf
-		SSHFSAdditionalArgs: []string{"-o", "allow_other"},
+		SSHFSAdditionalArgs: append([]string{"-o", "allow_other"}, m.sshfsArgs...),
 	}
 	if err := rsf.Prepare(); err != nil {
-		return nil, fmt.Errorf("failed to prepare reverse sshfs for %q: %w", expanded, err)
+		return fmt.Errorf("failed to prepare reverse sshfs for %q: %w", m.location, err)
 	}
 	if err := rsf.Start(); err != nil {
-		logrus.WithError(err).Warnf("failed to mount reverse sshfs for %q, retrying with `-o nonempty`", expanded)
+		logrus.WithError(err).Warnf("failed to mount reverse sshfs for %q, retrying with `-o nonempty`", m.location)
 		// NOTE: nonempty is not supported for libfuse3: https://github.com/canonical/multipass/issues/1381
-		rsf.SSHFSAdditionalArgs = []string{"-o", "nonempty"}
+		rsf.SSHFSAdditionalArgs = append([]string{"-o", "nonempty"}, m.sshfsArgs...)
 		if err := rsf.Start(); err != nil {
-			return nil, fmt.Errorf("failed to mount reverse sshfs for %q: %w", expanded, err)
+			return fmt.Errorf("failed to mount reverse sshfs for %q: %w", m.location, err)
 		}
 	}
+	m.stop = func() error {
+		// The process may have already exited, e.g., when the SSH connection was dropped
+		if err := rsf.Close(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			return fmt.Errorf("failed to unmount reverse sshfs for %q: %w", m.location, err)
+		}
+		return nil
+	}
+	return nil
+}
 
-	res := &mount{
-		close: func() error {
-			logrus.Infof("Unmounting %q", expanded)
-			if closeErr := rsf.Close(); closeErr != nil {
-				return fmt.Errorf("failed to unmount reverse sshfs for %q: %w", expanded, err)
+// stopMount unmounts m, if it is still mounted. m.mu must be held.
+func (m *mount) stopMount() error {
+	if m.stop == nil {
+		return nil
+	}
+	stop := m.stop
+	m.stop = nil
+	return stop()
+}
+
+func (m *mount) close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	logrus.Infof("Unmounting %q", m.location)
+	m.closed = true
+	return m.stopMount()
+}
+
+const (
+	mountStatusOK      = "ok"
+	mountStatusMissing = "missing"
+	mountStatusStale   = "stale"
+)
+
+// checkMount checks whether m is still mounted in the guest and responsive.
+// A stale mount is force-unmounted in the guest, so that it can be mounted again.
+func (a *HostAgent) checkMount(m *mount) (string, error) {
+	script := fmt.Sprintf(`#!/bin/sh
+dir=%s
+if ! mount | grep "on ${dir} " | grep -qw "fuse.sshfs"; then
+  echo %s
+  exit 0
+fi
+if ! timeout 5 stat "${dir}" >/dev/null 2>&1; then
+  fusermount -u -z "${dir}" >/dev/null 2>&1 || sudo umount -l "${dir}"
+  echo %s
+  exit 0
+fi
+echo %s
+`, shellescape.Quote(m.location), mountStatusMissing, mountStatusStale, mountStatusOK)
+	stdout, stderr, err := ssh.ExecuteScript("127.0.0.1", a.sshLocalPort, a.sshConfig, script, "check mount "+m.location)
+	if err != nil {
+		return "", fmt.Errorf("stdout=%q, stderr=%q: %w", stdout, stderr, err)
+	}
+	return strings.TrimSpace(stdout), nil
+}
+
+// activeMounts returns a copy of a.mounts.
+func (a *HostAgent) activeMounts() []*mount {
+	a.mountsMu.Lock()
+	defer a.mountsMu.Unlock()
+	return append([]*mount(nil), a.mounts...)
+}
+
+// reloadMounts unmounts the active mounts that are not in mounts, and mounts the new ones.
+// A mount whose `writable` or `sshfs` was changed is mounted again.
+// The status of each mount is returned in the order of mounts.
+//
+// mountsMu is not held while unmounting and mounting over SSH, so that activeMounts is not blocked;
+// Reload is serialized by configMu, so a.mounts is only replaced by the closer of the mounts meanwhile.
+func (a *HostAgent) reloadMounts(ctx context.Context, mounts []limayaml.Mount) ([]events.MountStatus, error) {
+	kept := make(map[string]*mount)
+	var removed []*mount
+	a.mountsMu.Lock()
+	for _, m := range a.mounts {
+		keep := false
+		for _, f := range mounts {
+			if expanded, err := localpathutil.Expand(f.Location); err == nil && expanded == m.location && f.Writable == m.writable &&
+				strings.Join(sshfsArgs(f.SSHFS), " ") == strings.Join(m.sshfsArgs, " ") {
+				keep = true
+				break
 			}
-			return nil
-		},
+		}
+		if keep {
+			kept[m.location] = m
+		} else {
+			removed = append(removed, m)
+		}
+	}
+	a.mountsMu.Unlock()
+
+	var mErr error
+	for _, m := range removed {
+		if err := m.close(); err != nil {
+			mErr = multierror.Append(mErr, err)
+		}
+	}
+	var (
+		res      []*mount
+		statuses []events.MountStatus
+	)
+	for _, f := range mounts {
+		mountStatus := events.MountStatus{MountPoint: f.Location, Mounted: true}
+		expanded, err := localpathutil.Expand(f.Location)
+		if err == nil {
+			mountStatus.MountPoint = expanded
+			if m, ok := kept[expanded]; ok {
+				res = append(res, m)
+				statuses = append(statuses, mountStatus)
+				continue
+			}
+		}
+		m, err := a.setupMount(ctx, f)
+		if err != nil {
+			mountStatus.Mounted = false
+			mountStatus.Error = err.Error()
+			mErr = multierror.Append(mErr, err)
+		} else {
+			res = append(res, m)
+		}
+		statuses = append(statuses, mountStatus)
+	}
+
+	a.mountsMu.Lock()
+	closed := a.mountsClosed
+	if !closed {
+		a.mounts = res
+	}
+	a.mountsMu.Unlock()
+	if closed {
+		// The mounts were closed during the reload, before the new ones were stored
+		for _, m := range res {
+			if err := m.close(); err != nil {
+				mErr = multierror.Append(mErr, err)
+			}
+		}
+	}
+	return statuses, mErr
+}
+
+// watchMounts re-establishes the reverse sshfs mounts that became stale, e.g., after the SSH connection was dropped.
+// An SSH failure is not considered to be a mount failure, as the mount is checked again on the next iteration.
+// NFS mounts are not watched, as the NFS client reconnects by itself.
+func (a *HostAgent) watchMounts(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(10 * time.Second):
+		}
+		for _, m := range a.activeMounts() {
+			if ctx.Err() != nil {
+				return
+			}
+			if m.mountType != limayaml.ReverseSSHFS {
+				continue
+			}
+			// m.mu is not held during the check, so that a hanging SSH connection does not block m.close()
+			status, err := a.checkMount(m)
+			if err != nil {
+				logrus.WithError(err).Debugf("failed to check the mount %q", m.location)
+				continue
+			}
+			if status == mountStatusOK {
+				continue
+			}
+			m.mu.Lock()
+			if !m.closed {
+				logrus.Warnf("The mount %q is %s, mounting again", m.location, status)
+				if err := m.stopMount(); err != nil {
+					logrus.WithError(err).Warn("failed to stop the broken mount")
+				}
+				if err := a.startMount(m); err != nil {
+					logrus.WithError(err).Warnf("failed to mount %q again", m.location)
+				}
+			}
+			m.mu.Unlock()
+		}
 	}
-	return res, nil
 }
@@ -0,0 +1,109 @@
+package hostagent
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/alessio/shellescape"
+	qemuconst "github.com/lima-vm/lima/pkg/qemu/const"
+	"github.com/lima-vm/sshocker/pkg/ssh"
+	"github.com/sirupsen/logrus"
+)
+
+// nfsClient is the address of the guest as seen from the NFS server of the host.
+// The connections from the user-mode network are originated from the loopback address of the host.
+const nfsClient = "127.0.0.1"
+
+// exportNFS exports the location from the NFS server of the host.
+//
+// On Linux, the location is exported with `sudo -n exportfs`, so exportfs has to be allowed in sudoers.
+// On macOS, the location has to be exported in /etc/exports by the user, as exports cannot be added at runtime.
+func exportNFS(location string, writable bool) (unexport func() error, err error) {
+	switch runtime.GOOS {
+	case "linux":
+		opts := []string{"ro", "insecure", "no_subtree_check", "all_squash",
+			"anonuid=" + strconv.Itoa(os.Getuid()), "anongid=" + strconv.Itoa(os.Getgid())}
+		if writable {
+			opts[0] = "rw"
+		}
+		export := nfsClient + ":" + location
+		cmd := exec.Command("sudo", "-n", "exportfs", "-o", strings.Join(opts, ","), export)
+		logrus.Debugf("executing %v", cmd.Args)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("failed to run %v: %q: %w (Hint: exportfs has to be allowed in sudoers)", cmd.Args, string(out), err)
+		}
+		unexport := func() error {
+			cmd := exec.Command("sudo", "-n", "exportfs", "-u", export)
+			logrus.Debugf("executing %v", cmd.Args)
+			if out, err := cmd.CombinedOutput(); err != nil {
+				return fmt.Errorf("failed to run %v: %q: %w", cmd.Args, string(out), err)
+			}
+			return nil
+		}
+		return unexport, nil
+	case "darwin":
+		logrus.Debugf("assuming %q to be exported in /etc/exports", location)
+		return func() error { return nil }, nil
+	default:
+		return nil, fmt.Errorf("NFS mounts are not supported on %s hosts", runtime.GOOS)
+	}
+}
+
+// nfsMountOptions returns the options of `mount -t nfs` in the guest.
+// The guest connects to the NFS server of the host via the gateway address of the user-mode network.
+func nfsMountOptions(writable bool) string {
+	opts := []string{"ro"}
+	if writable {
+		opts[0] = "rw"
+	}
+	if runtime.GOOS == "darwin" {
+		// nfsd of macOS only supports NFSv3
+		opts = append(opts, "vers=3", "proto=tcp", "mountproto=tcp", "nolock")
+	} else {
+		opts = append(opts, "vers=4", "proto=tcp", "port=2049")
+	}
+	return strings.Join(opts, ",")
+}
+
+func (a *HostAgent) startNFSMount(m *mount) error {
+	unexport, err := exportNFS(m.location, m.writable)
+	if err != nil {
+		return err
+	}
+	dir := shellescape.Quote(m.location)
+	script := fmt.Sprintf(`#!/bin/sh
+set -eu
+dir=%s
+sudo mkdir -p "${dir}"
+if mount | grep -qF "on ${dir} type nfs"; then
+  sudo umount -l "${dir}"
+fi
+sudo mount -t nfs -o %s %s "${dir}"
+`, dir, nfsMountOptions(m.writable), shellescape.Quote(qemuconst.SlirpGateway+":"+m.location))
+	stdout, stderr, err := ssh.ExecuteScript("127.0.0.1", a.sshLocalPort, a.sshConfig, script, "mount nfs "+m.location)
+	if err != nil {
+		if unexportErr := unexport(); unexportErr != nil {
+			logrus.WithError(unexportErr).Warnf("failed to unexport %q", m.location)
+		}
+		errStr := fmt.Sprintf("failed to mount %q with NFS: stdout=%q, stderr=%q: %v", m.location, stdout, stderr, err)
+		if runtime.GOOS == "darwin" {
+			errStr += fmt.Sprintf(" (Hint: add `%s -alldirs -mapall=%d:%d localhost` to /etc/exports, and run `sudo nfsd update`)",
+				m.location, os.Getuid(), os.Getgid())
+		}
+		return errors.New(errStr)
+	}
+	m.stop = func() error {
+		umountScript := fmt.Sprintf("#!/bin/sh\nsudo umount -l %s\n", dir)
+		// The guest may have already been shut down
+		if _, stderr, err := ssh.ExecuteScript("127.0.0.1", a.sshLocalPort, a.sshConfig, umountScript, "umount nfs "+m.location); err != nil {
+			logrus.WithError(err).Debugf("failed to unmount %q in the guest: stderr=%q", m.location, stderr)
+		}
+		return unexport()
+	}
+	return nil
+}
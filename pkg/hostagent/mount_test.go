@@ -0,0 +1,25 @@
+package hostagent
+
+import (
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/xorcare/pointer"
+	"gotest.tools/v3/assert"
+)
+
+func TestSSHFSArgs(t *testing.T) {
+	// The defaults of sshfs are not passed
+	assert.Assert(t, sshfsArgs(limayaml.SSHFS{Cache: pointer.Bool(true), FollowSymlinks: pointer.Bool(false)}) == nil)
+
+	// Absolute symlinks to the outside of the mount are only resolved on the host with followSymlinks
+	assert.DeepEqual(t, sshfsArgs(limayaml.SSHFS{FollowSymlinks: pointer.Bool(true)}), []string{"-o", "follow_symlinks"})
+
+	assert.DeepEqual(t,
+		sshfsArgs(limayaml.SSHFS{
+			Cache:          pointer.Bool(false),
+			FollowSymlinks: pointer.Bool(true),
+			Options:        []string{"reconnect", "ServerAliveInterval=15"},
+		}),
+		[]string{"-o", "cache=no", "-o", "follow_symlinks", "-o", "reconnect", "-o", "ServerAliveInterval=15"})
+}
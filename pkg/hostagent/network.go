@@ -0,0 +1,55 @@
+package hostagent
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	qemuconst "github.com/lima-vm/lima/pkg/qemu/const"
+	"github.com/lima-vm/sshocker/pkg/ssh"
+)
+
+// addrScript prints the global addresses of the interfaces of the guest, one address per line.
+// e.g. "2: eth0    inet 192.168.5.15/24 brd 192.168.5.255 scope global dynamic eth0\       valid_lft 86313sec preferred_lft 86313sec"
+const addrScript = `#!/bin/sh
+ip -o addr show scope global
+`
+
+// parseAddrs parses the output of addrScript into the addresses (with the prefix length) keyed by the interface name.
+func parseAddrs(s string) map[string][]string {
+	res := make(map[string][]string)
+	scanner := bufio.NewScanner(strings.NewReader(s))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || (fields[2] != "inet" && fields[2] != "inet6") {
+			continue
+		}
+		res[fields[1]] = append(res[fields[1]], fields[3])
+	}
+	return res
+}
+
+// networkStatus returns the addresses assigned to the slirp interface and to the interfaces of `networks`,
+// in the order of the interfaces in the guest (eth0 first).
+func (a *HostAgent) networkStatus() ([]events.NetworkStatus, error) {
+	stdout, stderr, err := ssh.ExecuteScript("127.0.0.1", a.sshLocalPort, a.sshConfig, addrScript, "list addresses")
+	if err != nil {
+		return nil, fmt.Errorf("stdout=%q, stderr=%q: %w", stdout, stderr, err)
+	}
+	addrs := parseAddrs(stdout)
+	y := a.limaYAML()
+	res := []events.NetworkStatus{{
+		Interface:  qemuconst.SlirpNICName,
+		MACAddress: y.Network.MACAddress,
+		Addresses:  addrs[qemuconst.SlirpNICName],
+	}}
+	for _, nw := range y.Networks {
+		res = append(res, events.NetworkStatus{
+			Interface:  nw.Interface,
+			MACAddress: nw.MACAddress,
+			Addresses:  addrs[nw.Interface],
+		})
+	}
+	return res, nil
+}
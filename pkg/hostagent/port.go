@@ -2,9 +2,16 @@ package hostagent
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
 
 	"github.com/lima-vm/lima/pkg/guestagent/api"
+	"github.com/lima-vm/lima/pkg/hostagent/events"
 	"github.com/lima-vm/lima/pkg/limayaml"
 	"github.com/lima-vm/sshocker/pkg/ssh"
 	"github.com/sirupsen/logrus"
@@ -13,16 +20,47 @@ import (
 type portForwarder struct {
 	sshConfig   *ssh.SSHConfig
 	sshHostPort int
-	rules       []limayaml.PortForward
+	onConflict  limayaml.PortForwardOnConflict
+	// forwardTCP is replaced in the tests
+	forwardTCP func(ctx context.Context, local, remote, verb string) error
+
+	mu        sync.Mutex
+	rules     []limayaml.PortForward
+	forwarded map[string]tcpForward   // keyed by the guest address
+	conflicts map[string]portConflict // keyed by the guest address
+}
+
+// tcpForward is an active forward of a TCP port of the guest.
+type tcpForward struct {
+	guest api.IPPort
+	local string
+	// requested is the host address chosen by the rules, which differs from local when the host port was remapped
+	requested string
+}
+
+// portConflict is a TCP port of the guest that is not forwarded, as the host address was already in use.
+type portConflict struct {
+	guest api.IPPort
+	err   error
 }
 
 const sshGuestPort = 22
 
-func newPortForwarder(sshConfig *ssh.SSHConfig, sshHostPort int, rules []limayaml.PortForward) *portForwarder {
+// maxForwardAttempts is the number of the host ports tried with PortForwardOnConflictRemap,
+// when the port chosen by remapHostAddress is taken by another process before ssh binds it.
+const maxForwardAttempts = 3
+
+func newPortForwarder(sshConfig *ssh.SSHConfig, sshHostPort int, rules []limayaml.PortForward, onConflict limayaml.PortForwardOnConflict) *portForwarder {
 	return &portForwarder{
 		sshConfig:   sshConfig,
 		sshHostPort: sshHostPort,
-		rules:       rules,
+		onConflict:  onConflict,
+		forwardTCP: func(ctx context.Context, local, remote, verb string) error {
+			return forwardTCP(ctx, sshConfig, sshHostPort, local, remote, verb)
+		},
+		rules:     rules,
+		forwarded: make(map[string]tcpForward),
+		conflicts: make(map[string]portConflict),
 	}
 }
 
@@ -40,9 +78,23 @@ func hostAddress(rule limayaml.PortForward, guest api.IPPort) string {
 	return host.String()
 }
 
+// staticForwardingAddresses returns the host and guest addresses of a rule that is
+// set up once when the guest agent is started instead of on guest agent events,
+// i.e. a socket forward or a reverse forward.
+func staticForwardingAddresses(rule limayaml.PortForward) (string, string, bool) {
+	switch {
+	case rule.Reverse && rule.GuestSocket == "":
+		guest := api.IPPort{IP: rule.GuestIP, Port: rule.GuestPortRange[0]}
+		return hostAddress(rule, guest), guest.String(), true
+	case rule.GuestSocket != "":
+		return hostAddress(rule, api.IPPort{}), rule.GuestSocket, true
+	}
+	return "", "", false
+}
+
 func (pf *portForwarder) forwardingAddresses(guest api.IPPort) (string, string) {
 	for _, rule := range pf.rules {
-		if rule.GuestSocket != "" {
+		if rule.GuestSocket != "" || rule.Reverse || rule.Proto != limayaml.TCP {
 			continue
 		}
 		if guest.Port < rule.GuestPortRange[0] || guest.Port > rule.GuestPortRange[1] {
@@ -68,25 +120,159 @@ func (pf *portForwarder) forwardingAddresses(guest api.IPPort) (string, string)
 }
 
 func (pf *portForwarder) OnEvent(ctx context.Context, ev api.Event) {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
 	for _, f := range ev.LocalPortsRemoved {
-		local, remote := pf.forwardingAddresses(f)
-		if local == "" {
+		delete(pf.conflicts, f.String())
+		// The forward is looked up instead of matching the rules, as the rules may have been replaced by SetRules
+		fwd, ok := pf.forwarded[f.String()]
+		if !ok {
 			continue
 		}
-		logrus.Infof("Stopping forwarding TCP from %s to %s", remote, local)
-		if err := forwardTCP(ctx, pf.sshConfig, pf.sshHostPort, local, remote, verbCancel); err != nil {
-			logrus.WithError(err).Warnf("failed to stop forwarding tcp port %d", f.Port)
-		}
+		pf.cancel(ctx, fwd)
 	}
 	for _, f := range ev.LocalPortsAdded {
-		local, remote := pf.forwardingAddresses(f)
-		if local == "" {
-			logrus.Infof("Not forwarding TCP %s", remote)
+		pf.forward(ctx, f)
+	}
+}
+
+// SetRules replaces the rules, e.g., after reloading lima.yaml.
+// The active forwards that are no longer allowed, or are forwarded to another host address, are updated.
+// The ports that were not forwarded due to a conflict are retried.
+func (pf *portForwarder) SetRules(ctx context.Context, rules []limayaml.PortForward) {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	pf.rules = rules
+	for _, fwd := range pf.forwarded {
+		if local, _ := pf.forwardingAddresses(fwd.guest); local == fwd.requested {
 			continue
 		}
+		pf.cancel(ctx, fwd)
+		pf.forward(ctx, fwd.guest)
+	}
+	for _, c := range pf.conflicts {
+		pf.forward(ctx, c.guest)
+	}
+}
+
+// Status returns the status of the forwards set up on the events of the guest agent, sorted by the guest address.
+func (pf *portForwarder) Status() []events.PortForwardStatus {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	res := make([]events.PortForwardStatus, 0, len(pf.forwarded)+len(pf.conflicts))
+	for remote, fwd := range pf.forwarded {
+		res = append(res, events.PortForwardStatus{GuestAddress: remote, HostAddress: fwd.local})
+	}
+	for remote, c := range pf.conflicts {
+		res = append(res, events.PortForwardStatus{GuestAddress: remote, Error: c.err.Error()})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].GuestAddress < res[j].GuestAddress
+	})
+	return res
+}
+
+// checkHostAddress returns an error if the TCP address local is already in use on the host.
+// The other errors, e.g., lacking the privilege to listen on a port below 1024, are left to forwardTCP.
+func checkHostAddress(local string) error {
+	if strings.HasPrefix(local, "/") {
+		return nil
+	}
+	l, err := net.Listen("tcp", local)
+	if err != nil {
+		if errors.Is(err, syscall.EADDRINUSE) {
+			return fmt.Errorf("the host address %s is already in use", local)
+		}
+		return nil
+	}
+	return l.Close()
+}
+
+// remapHostAddress returns the address with a free port chosen on the IP address of local.
+func remapHostAddress(local string) (string, error) {
+	host, _, err := net.SplitHostPort(local)
+	if err != nil {
+		return "", err
+	}
+	l, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+	return l.Addr().String(), nil
+}
+
+// resolveConflict checks whether the host address local is in use, and returns the host address to be used.
+// pf.mu must be held.
+func (pf *portForwarder) resolveConflict(local string) (string, error) {
+	for _, fwd := range pf.forwarded {
+		// e.g., a port listened on both 127.0.0.1 and 0.0.0.0 of the guest
+		if fwd.requested == local {
+			return fwd.local, nil
+		}
+	}
+	err := checkHostAddress(local)
+	if err == nil || pf.onConflict != limayaml.PortForwardOnConflictRemap {
+		return local, err
+	}
+	remapped, remapErr := remapHostAddress(local)
+	if remapErr != nil {
+		return "", fmt.Errorf("%v, and no other port could be chosen: %w", err, remapErr)
+	}
+	logrus.Warnf("%v, using %s instead", err, remapped)
+	return remapped, nil
+}
+
+// forward forwards the guest port according to the rules. pf.mu must be held.
+func (pf *portForwarder) forward(ctx context.Context, guest api.IPPort) {
+	local, remote := pf.forwardingAddresses(guest)
+	delete(pf.conflicts, remote)
+	if local == "" {
+		logrus.Infof("Not forwarding TCP %s", remote)
+		return
+	}
+	requested := local
+	for attempt := 1; ; attempt++ {
+		local, err := pf.resolveConflict(requested)
+		if err != nil {
+			logrus.WithError(err).Warnf("Not forwarding TCP %s", remote)
+			pf.conflicts[remote] = portConflict{guest: guest, err: err}
+			return
+		}
 		logrus.Infof("Forwarding TCP from %s to %s", remote, local)
-		if err := forwardTCP(ctx, pf.sshConfig, pf.sshHostPort, local, remote, verbForward); err != nil {
-			logrus.WithError(err).Warnf("failed to set up forwarding tcp port %d (negligible if already forwarded)", f.Port)
+		if err := pf.forwardTCP(ctx, local, remote, verbForward); err != nil {
+			// The host address may have been taken by another process after resolveConflict checked it
+			if inUseErr := checkHostAddress(local); inUseErr != nil && !pf.isForwarded(local) {
+				if pf.onConflict == limayaml.PortForwardOnConflictRemap && attempt < maxForwardAttempts {
+					continue
+				}
+				logrus.WithError(inUseErr).Warnf("Not forwarding TCP %s", remote)
+				pf.conflicts[remote] = portConflict{guest: guest, err: inUseErr}
+				return
+			}
+			logrus.WithError(err).Warnf("failed to set up forwarding tcp port %d (negligible if already forwarded)", guest.Port)
 		}
+		pf.forwarded[remote] = tcpForward{guest: guest, local: local, requested: requested}
+		return
+	}
+}
+
+// isForwarded returns whether the host address local is used by an active forward. pf.mu must be held.
+func (pf *portForwarder) isForwarded(local string) bool {
+	for _, fwd := range pf.forwarded {
+		if fwd.local == local {
+			return true
+		}
+	}
+	return false
+}
+
+// cancel stops the active forward. pf.mu must be held.
+func (pf *portForwarder) cancel(ctx context.Context, fwd tcpForward) {
+	remote := fwd.guest.String()
+	logrus.Infof("Stopping forwarding TCP from %s to %s", remote, fwd.local)
+	if err := pf.forwardTCP(ctx, fwd.local, remote, verbCancel); err != nil {
+		logrus.WithError(err).Warnf("failed to stop forwarding tcp port %d", fwd.guest.Port)
 	}
+	delete(pf.forwarded, remote)
 }
@@ -0,0 +1,136 @@
+package hostagent
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/guestagent/api"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"gotest.tools/v3/assert"
+)
+
+// testPortForwarder returns a portForwarder that forwards all the TCP ports of the guest to the same ports of 127.0.0.1,
+// without running ssh. forwardTCP is called for verbForward, when it is not nil.
+func testPortForwarder(onConflict limayaml.PortForwardOnConflict, forwardTCP func(local string) error) *portForwarder {
+	rules := []limayaml.PortForward{{
+		GuestIP:        net.IPv4zero,
+		GuestPortRange: [2]int{1, 65535},
+		HostIP:         api.IPv4loopback1,
+		HostPortRange:  [2]int{1, 65535},
+		Proto:          limayaml.TCP,
+	}}
+	pf := newPortForwarder(nil, 0, rules, onConflict)
+	pf.forwardTCP = func(_ context.Context, local, _, verb string) error {
+		if verb == verbForward && forwardTCP != nil {
+			return forwardTCP(local)
+		}
+		return nil
+	}
+	return pf
+}
+
+// listenLocal listens on a free port of 127.0.0.1, and returns the port.
+func listenLocal(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// freeLocalPort returns a port of 127.0.0.1 that was free when checked.
+func freeLocalPort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func localAddr(port int) string {
+	return net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+}
+
+func TestPortForwarderSkip(t *testing.T) {
+	port := listenLocal(t)
+	pf := testPortForwarder(limayaml.PortForwardOnConflictSkip, nil)
+	pf.OnEvent(context.Background(), api.Event{LocalPortsAdded: []api.IPPort{{IP: api.IPv4loopback1, Port: port}}})
+	st := pf.Status()
+	assert.Equal(t, 1, len(st))
+	assert.Equal(t, "", st[0].HostAddress)
+	assert.Assert(t, strings.Contains(st[0].Error, "already in use"), st[0].Error)
+}
+
+func TestPortForwarderRemap(t *testing.T) {
+	port := listenLocal(t)
+	pf := testPortForwarder(limayaml.PortForwardOnConflictRemap, nil)
+	pf.OnEvent(context.Background(), api.Event{LocalPortsAdded: []api.IPPort{{IP: api.IPv4loopback1, Port: port}}})
+	st := pf.Status()
+	assert.Equal(t, 1, len(st))
+	assert.Equal(t, "", st[0].Error)
+	host, remappedPort, err := net.SplitHostPort(st[0].HostAddress)
+	assert.NilError(t, err)
+	assert.Equal(t, "127.0.0.1", host)
+	assert.Assert(t, remappedPort != strconv.Itoa(port))
+}
+
+func TestPortForwarderReuse(t *testing.T) {
+	port := listenLocal(t)
+	pf := testPortForwarder(limayaml.PortForwardOnConflictRemap, nil)
+	// both are forwarded to 127.0.0.1:port of the host, which is remapped once
+	pf.OnEvent(context.Background(), api.Event{LocalPortsAdded: []api.IPPort{
+		{IP: api.IPv4loopback1, Port: port},
+		{IP: net.IPv4zero, Port: port},
+	}})
+	st := pf.Status()
+	assert.Equal(t, 2, len(st))
+	assert.Assert(t, st[0].HostAddress != localAddr(port))
+	assert.Equal(t, st[0].HostAddress, st[1].HostAddress)
+}
+
+func TestRemapHostAddress(t *testing.T) {
+	remapped, err := remapHostAddress(localAddr(listenLocal(t)))
+	assert.NilError(t, err)
+	host, _, err := net.SplitHostPort(remapped)
+	assert.NilError(t, err)
+	assert.Equal(t, "127.0.0.1", host)
+	assert.NilError(t, checkHostAddress(remapped))
+
+	_, err = remapHostAddress("/tmp/sock")
+	assert.Assert(t, err != nil)
+}
+
+// takenAfterCheck simulates another process that binds the host address between resolveConflict and ssh.
+func takenAfterCheck(t *testing.T) func(local string) error {
+	taken := false
+	return func(local string) error {
+		if taken {
+			return nil
+		}
+		taken = true
+		l, err := net.Listen("tcp", local)
+		assert.NilError(t, err)
+		t.Cleanup(func() { _ = l.Close() })
+		return errors.New("Port forwarding failed")
+	}
+}
+
+func TestPortForwarderTakenAfterCheck(t *testing.T) {
+	port := freeLocalPort(t)
+	pf := testPortForwarder(limayaml.PortForwardOnConflictSkip, takenAfterCheck(t))
+	pf.OnEvent(context.Background(), api.Event{LocalPortsAdded: []api.IPPort{{IP: api.IPv4loopback1, Port: port}}})
+	st := pf.Status()
+	assert.Equal(t, 1, len(st))
+	assert.Equal(t, "", st[0].HostAddress)
+	assert.Assert(t, strings.Contains(st[0].Error, "already in use"), st[0].Error)
+
+	port = freeLocalPort(t)
+	pf = testPortForwarder(limayaml.PortForwardOnConflictRemap, takenAfterCheck(t))
+	pf.OnEvent(context.Background(), api.Event{LocalPortsAdded: []api.IPPort{{IP: api.IPv4loopback1, Port: port}}})
+	st = pf.Status()
+	assert.Equal(t, 1, len(st))
+	assert.Equal(t, "", st[0].Error)
+	assert.Assert(t, st[0].HostAddress != localAddr(port))
+}
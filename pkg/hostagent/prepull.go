@@ -0,0 +1,67 @@
+package hostagent
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/alessio/shellescape"
+	"github.com/hashicorp/go-multierror"
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/lima-vm/sshocker/pkg/ssh"
+	"github.com/sirupsen/logrus"
+)
+
+// prePullImages pulls the images listed in `containerd.prePull`, emitting an event before and after each image.
+// Failing to pull an image is not fatal; the errors are returned after attempting all the images.
+func (a *HostAgent) prePullImages(ctx context.Context, st events.Status) error {
+	y := a.limaYAML()
+	images := y.Containerd.PrePull
+	if len(images) == 0 {
+		return nil
+	}
+	nerdctl := "nerdctl"
+	if !*y.Containerd.User {
+		nerdctl = "sudo nerdctl"
+	}
+	if err := a.waitForRequirement(ctx, requirement{
+		description: "nerdctl to be available for pre-pulling images",
+		script: `#!/bin/bash
+set -eux -o pipefail
+command -v nerdctl
+`,
+	}); err != nil {
+		return fmt.Errorf("not pre-pulling %d images, as nerdctl is not available: %w", len(images), err)
+	}
+	var mErr error
+	for i, image := range images {
+		if ctx.Err() != nil {
+			return multierror.Append(mErr, ctx.Err())
+		}
+		progress := events.PrePull{
+			Image: image,
+			Index: i + 1,
+			Total: len(images),
+		}
+		st.PrePull = &progress
+		a.emitEvent(ctx, events.Event{Status: st})
+
+		logrus.Infof("Pre-pulling image %d of %d: %q", i+1, len(images), image)
+		script := fmt.Sprintf(`#!/bin/bash
+set -eux -o pipefail
+%s pull --quiet %s
+`, nerdctl, shellescape.Quote(image))
+		stdout, stderr, err := ssh.ExecuteScript("127.0.0.1", a.sshLocalPort, a.sshConfig, script, "pre-pull "+image)
+		logrus.Debugf("stdout=%q, stderr=%q, err=%v", stdout, stderr, err)
+		progress.Done = true
+		if err != nil {
+			err = fmt.Errorf("failed to pre-pull image %q: stderr=%q: %w", image, stderr, err)
+			logrus.WithError(err).Warn("Failed to pre-pull an image")
+			progress.Error = err.Error()
+			mErr = multierror.Append(mErr, err)
+		} else {
+			logrus.Infof("Pre-pulled image %d of %d: %q", i+1, len(images), image)
+		}
+		a.emitEvent(ctx, events.Event{Status: st})
+	}
+	return mErr
+}
@@ -0,0 +1,156 @@
+package hostagent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/digitalocean/go-qemu/qmp"
+	"github.com/digitalocean/go-qemu/qmp/raw"
+	"github.com/lima-vm/lima/pkg/qemu"
+	"github.com/sirupsen/logrus"
+)
+
+// qmpConn is the QMP connection of the host agent, shared by CPU hotplug, the disk stats, the snapshots,
+// the balloon, the shutdown, etc. QEMU only serves a single QMP client at a time, so the other processes
+// (e.g., limactl) access QMP via the host agent API instead of connecting to the QMP socket.
+// It is connected on the first use, and connected again on the next use after the connection was dropped,
+// e.g., when QEMU was restarted.
+type qmpConn struct {
+	sockPath string
+
+	mu  sync.Mutex
+	mon *qmp.SocketMonitor // nil when not connected; protected by mu
+}
+
+// qmpConnectTimeout is the timeout for receiving the QMP greeting.
+// QEMU does not send the greeting while another client is connected.
+const qmpConnectTimeout = 10 * time.Second
+
+// connectWithTimeout runs mon.Connect, which waits for the greeting without a deadline.
+// mon is disconnected on failure.
+func connectWithTimeout(mon *qmp.SocketMonitor, timeout time.Duration) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- mon.Connect()
+	}()
+	select {
+	case err := <-errCh:
+		if err != nil {
+			_ = mon.Disconnect()
+		}
+		return err
+	case <-time.After(timeout):
+		// unblocks Connect
+		_ = mon.Disconnect()
+		<-errCh
+		return fmt.Errorf("no QMP greeting was received in %v (is another QMP client connected?)", timeout)
+	}
+}
+
+// monitor returns the current connection, connecting to the QMP socket if needed.
+// The monitor is safe for concurrent use.
+func (q *qmpConn) monitor() (*qmp.SocketMonitor, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.mon != nil {
+		return q.mon, nil
+	}
+	mon, err := qmp.NewSocketMonitor("unix", q.sockPath, 5*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the QMP socket %q: %w", q.sockPath, err)
+	}
+	if err := connectWithTimeout(mon, qmpConnectTimeout); err != nil {
+		return nil, fmt.Errorf("failed to connect to the QMP socket %q: %w", q.sockPath, err)
+	}
+	// The events must be received, as the monitor blocks until they are; the channel is closed when the connection is dropped
+	evCh, err := mon.Events(context.Background())
+	if err != nil {
+		_ = mon.Disconnect()
+		return nil, err
+	}
+	go func() {
+		for ev := range evCh {
+			logrus.Debugf("received a QMP event %q", ev.Event)
+		}
+		logrus.Debug("the QMP connection was dropped")
+		q.mu.Lock()
+		if q.mon == mon {
+			q.mon = nil
+		}
+		q.mu.Unlock()
+	}()
+	q.mon = mon
+	return mon, nil
+}
+
+// close disconnects the current connection. The next call of monitor connects again.
+func (q *qmpConn) close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.mon == nil {
+		return nil
+	}
+	err := q.mon.Disconnect()
+	q.mon = nil
+	return err
+}
+
+// withQMP runs f with the QMP connection of the instance.
+func (a *HostAgent) withQMP(f func(qmp.Monitor, *raw.Monitor) error) error {
+	mon, err := a.qmp.monitor()
+	if err != nil {
+		return err
+	}
+	return f(mon, raw.NewMonitor(mon))
+}
+
+// connectQMP connects to the QMP socket as soon as QEMU creates it, so that the connection is ready
+// for the other routines of the host agent.
+func (a *HostAgent) connectQMP(ctx context.Context) {
+	for {
+		_, err := a.qmp.monitor()
+		if err == nil {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			logrus.WithError(err).Debug("failed to connect to QMP")
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// Snapshot saves the state of the instance as the internal snapshot named name. See qemu.Snapshot.
+func (a *HostAgent) Snapshot(ctx context.Context, name string) error {
+	return a.withQMP(func(qmpClient qmp.Monitor, _ *raw.Monitor) error {
+		return qemu.Snapshot(qmpClient, name)
+	})
+}
+
+// RestoreSnapshot restores the instance to the internal snapshot named name. See qemu.RestoreSnapshot.
+func (a *HostAgent) RestoreSnapshot(ctx context.Context, name string) error {
+	return a.withQMP(func(qmpClient qmp.Monitor, _ *raw.Monitor) error {
+		return qemu.RestoreSnapshot(qmpClient, name)
+	})
+}
+
+// SetBalloon sets the target memory size of the guest. See qemu.SetBalloon.
+func (a *HostAgent) SetBalloon(ctx context.Context, sizeBytes int64) error {
+	return a.withQMP(func(qmpClient qmp.Monitor, _ *raw.Monitor) error {
+		return qemu.SetBalloon(qmpClient, sizeBytes)
+	})
+}
+
+// Balloon returns the current memory size of the guest. See qemu.GetBalloon.
+func (a *HostAgent) Balloon(ctx context.Context) (int64, error) {
+	var size int64
+	err := a.withQMP(func(qmpClient qmp.Monitor, _ *raw.Monitor) error {
+		var err error
+		size, err = qemu.GetBalloon(qmpClient)
+		return err
+	})
+	return size, err
+}
@@ -0,0 +1,101 @@
+package hostagent
+
+import (
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/go-qemu/qmp"
+	"gotest.tools/v3/assert"
+)
+
+// serveFakeQMP accepts the QMP connections on sockPath, and replies to each command with an empty result.
+// The connections are sent to connCh, so that the test can drop them.
+func serveFakeQMP(t *testing.T, sockPath string, connCh chan<- net.Conn) {
+	l, err := net.Listen("unix", sockPath)
+	assert.NilError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			connCh <- c
+			go func() {
+				_, _ = c.Write([]byte(`{"QMP":{"version":{"qemu":{"major":6,"minor":2,"micro":0}},"capabilities":[]}}` + "\n"))
+				// the commands are not terminated by a newline
+				dec := json.NewDecoder(c)
+				for {
+					var cmd map[string]interface{}
+					if err := dec.Decode(&cmd); err != nil {
+						return
+					}
+					_, _ = c.Write([]byte(`{"return":{}}` + "\n"))
+				}
+			}()
+		}
+	}()
+}
+
+func TestQMPConnReconnect(t *testing.T) {
+	sockPath := filepath.Join(t.TempDir(), "qmp.sock")
+	q := &qmpConn{sockPath: sockPath}
+	_, err := q.monitor()
+	assert.ErrorContains(t, err, "failed to open the QMP socket")
+
+	connCh := make(chan net.Conn, 2)
+	serveFakeQMP(t, sockPath, connCh)
+	mon, err := q.monitor()
+	assert.NilError(t, err)
+	_, err = mon.Run([]byte(`{"execute":"query-status"}`))
+	assert.NilError(t, err)
+	same, err := q.monitor()
+	assert.NilError(t, err)
+	assert.Equal(t, mon, same)
+
+	// the connection is dropped by the server, e.g., when QEMU exits
+	_ = (<-connCh).Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		q.mu.Lock()
+		dropped := q.mon == nil
+		q.mu.Unlock()
+		if dropped {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the dropped connection was not detected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mon2, err := q.monitor()
+	assert.NilError(t, err)
+	assert.Assert(t, mon2 != mon)
+	_, err = mon2.Run([]byte(`{"execute":"query-status"}`))
+	assert.NilError(t, err)
+	assert.NilError(t, q.close())
+}
+
+func TestConnectWithTimeout(t *testing.T) {
+	sockPath := filepath.Join(t.TempDir(), "qmp.sock")
+	// QEMU does not send the greeting to the second client
+	l, err := net.Listen("unix", sockPath)
+	assert.NilError(t, err)
+	defer l.Close()
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			defer c.Close()
+			time.Sleep(5 * time.Second)
+		}
+	}()
+	mon, err := qmp.NewSocketMonitor("unix", sockPath, time.Second)
+	assert.NilError(t, err)
+	begin := time.Now()
+	err = connectWithTimeout(mon, 100*time.Millisecond)
+	assert.ErrorContains(t, err, "no QMP greeting")
+	assert.Assert(t, time.Since(begin) < 2*time.Second)
+}
@@ -0,0 +1,119 @@
+package hostagent
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/sirupsen/logrus"
+)
+
+// Reload reloads lima.yaml, and applies the changes of `portForwards` and `mounts` without restarting QEMU.
+// The other changed fields are reported in Status.PendingRestart, and are applied by Restart.
+func (a *HostAgent) Reload(ctx context.Context) error {
+	a.configMu.Lock()
+	defer a.configMu.Unlock()
+	a.eventEncMu.Lock()
+	running := a.lastStatus.Running
+	a.eventEncMu.Unlock()
+	if !running {
+		return errors.New("the guest is not running yet")
+	}
+	y, err := store.LoadYAMLByFilePath(filepath.Join(a.instDir, filenames.LimaYAML))
+	if err != nil {
+		return err
+	}
+	// a.y and a.portForwarder are only replaced under configMu, so they can be read without yMu here
+	cur := *a.y
+	cur.PortForwards = y.PortForwards
+	cur.Mounts = y.Mounts
+
+	var mErr error
+	a.reloadStaticForwards(ctx, a.y.PortForwards, y.PortForwards)
+	a.portForwarder.SetRules(ctx, portForwardRules(&cur, a.instDir, a.sshLocalPort))
+	mountStatuses, err := a.reloadMounts(ctx, y.Mounts)
+	if err != nil {
+		mErr = multierror.Append(mErr, events.WithCode(events.ErrorCodeMount, err))
+	}
+	a.yMu.Lock()
+	a.y = &cur
+	a.yMu.Unlock()
+
+	pending := pendingRestartFields(&cur, y)
+	if len(pending) > 0 {
+		logrus.Infof("The changes of %v are applied after restarting the instance", pending)
+	}
+	portForwards := a.portForwarder.Status()
+	a.updateStatus(ctx, func(st *events.Status) bool {
+		a.pendingRestart = pending
+		a.portForwards = portForwards
+		st.Mounts = mountStatuses
+		return true
+	})
+	return mErr
+}
+
+type staticForward struct {
+	local, remote string
+	reverse       bool
+}
+
+func staticForwards(rules []limayaml.PortForward) []staticForward {
+	var res []staticForward
+	for _, rule := range rules {
+		if local, remote, ok := staticForwardingAddresses(rule); ok {
+			res = append(res, staticForward{local: local, remote: remote, reverse: rule.Reverse})
+		}
+	}
+	return res
+}
+
+// reloadStaticForwards cancels the socket forwards and the reverse forwards that are only in oldRules,
+// and sets up the ones that are only in newRules.
+func (a *HostAgent) reloadStaticForwards(ctx context.Context, oldRules, newRules []limayaml.PortForward) {
+	oldForwards, newForwards := staticForwards(oldRules), staticForwards(newRules)
+	contains := func(forwards []staticForward, f staticForward) bool {
+		for _, x := range forwards {
+			if x == f {
+				return true
+			}
+		}
+		return false
+	}
+	for _, f := range oldForwards {
+		if !contains(newForwards, f) {
+			if err := forwardSSH(ctx, a.sshConfig, a.sshLocalPort, f.local, f.remote, verbCancel, f.reverse); err != nil {
+				logrus.WithError(err).Warnf("failed to stop forwarding %q", f.remote)
+			}
+		}
+	}
+	for _, f := range newForwards {
+		if !contains(oldForwards, f) {
+			_ = forwardSSH(ctx, a.sshConfig, a.sshLocalPort, f.local, f.remote, verbForward, f.reverse)
+		}
+	}
+}
+
+// pendingRestartFields returns the yaml names of the top-level fields that differ between cur and y.
+func pendingRestartFields(cur, y *limayaml.LimaYAML) []string {
+	var res []string
+	curV, yV := reflect.ValueOf(*cur), reflect.ValueOf(*y)
+	for i := 0; i < curV.NumField(); i++ {
+		if reflect.DeepEqual(curV.Field(i).Interface(), yV.Field(i).Interface()) {
+			continue
+		}
+		name := strings.Split(curV.Type().Field(i).Tag.Get("yaml"), ",")[0]
+		if name == "" {
+			name = curV.Type().Field(i).Name
+		}
+		res = append(res, name)
+	}
+	return res
+}
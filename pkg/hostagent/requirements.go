@@ -21,6 +21,9 @@ func (a *HostAgent) waitForRequirements(ctx context.Context, label string, requi
 	for i, req := range requirements {
 	retryLoop:
 		for j := 0; j < retries; j++ {
+			if ctx.Err() != nil {
+				return multierror.Append(mErr, ctx.Err())
+			}
 			logrus.Infof("Waiting for the %s requirement %d of %d: %q", label, i+1, len(requirements), req.description)
 			err := a.waitForRequirement(ctx, req)
 			if err == nil {
@@ -35,7 +38,11 @@ func (a *HostAgent) waitForRequirements(ctx context.Context, label string, requi
 				mErr = multierror.Append(mErr, fmt.Errorf("failed to satisfy the %s requirement %d of %d %q: %s: %w", label, i+1, len(requirements), req.description, req.debugHint, err))
 				break retryLoop
 			}
-			time.Sleep(10 * time.Second)
+			select {
+			case <-ctx.Done():
+				return multierror.Append(mErr, ctx.Err())
+			case <-time.After(sleepDuration):
+			}
 		}
 	}
 	return mErr
@@ -58,7 +65,8 @@ type requirement struct {
 	fatal       bool
 }
 
-func (a *HostAgent) essentialRequirements() []requirement {
+// sshRequirements is satisfied when the guest accepts SSH connections on the forwarded port.
+func (a *HostAgent) sshRequirements() []requirement {
 	req := make([]requirement, 0)
 	req = append(req,
 		requirement{
@@ -70,7 +78,13 @@ true
 Make sure that the YAML field "ssh.localPort" is not used by other processes on the host.
 If any private key under ~/.ssh is protected with a passphrase, you need to have ssh-agent to be running.
 `,
-		},
+		})
+	return req
+}
+
+func (a *HostAgent) essentialRequirements() []requirement {
+	req := make([]requirement, 0)
+	req = append(req,
 		requirement{
 			description: "user session is ready for ssh",
 			script: `#!/bin/bash
@@ -87,7 +101,7 @@ it must not be created until the session reset is done.
 `,
 		})
 
-	if len(a.y.Mounts) > 0 {
+	if len(a.limaYAML().Mounts) > 0 {
 		req = append(req, requirement{
 			description: "sshfs binary to be installed",
 			script: `#!/bin/bash
@@ -136,8 +150,9 @@ A possible workaround is to run "lima-guestagent install-systemd" in the guest.
 }
 
 func (a *HostAgent) optionalRequirements() []requirement {
+	y := a.limaYAML()
 	req := make([]requirement, 0)
-	if *a.y.Containerd.System || *a.y.Containerd.User {
+	if *y.Containerd.System || *y.Containerd.User {
 		req = append(req,
 			requirement{
 				description: "systemd must be available",
@@ -170,7 +185,7 @@ Also see "/var/log/cloud-init-output.log" in the guest.
 `,
 			})
 	}
-	for _, probe := range a.y.Probes {
+	for _, probe := range y.Probes {
 		if probe.Mode == limayaml.ProbeModeReadiness {
 			req = append(req, requirement{
 				description: probe.Description,
@@ -0,0 +1,194 @@
+package hostagent
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/digitalocean/go-qemu/qmp"
+	"github.com/digitalocean/go-qemu/qmp/raw"
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/lima-vm/lima/pkg/qemu"
+	"github.com/lima-vm/sshocker/pkg/ssh"
+	"github.com/sirupsen/logrus"
+)
+
+// usageScript prints the aggregated CPU times and the memory statistics of the guest.
+// Reading procfs over the existing SSH master connection is cheap enough to be done periodically.
+const usageScript = `#!/bin/sh
+head -n 1 /proc/stat
+grep -E '^(MemTotal|MemAvailable):' /proc/meminfo
+`
+
+type cpuTimes struct {
+	idle  uint64
+	total uint64
+}
+
+type resourceUsage struct {
+	cpu      cpuTimes
+	memTotal int64 // bytes
+	memAvail int64 // bytes
+	memFound bool  // true if both MemTotal and MemAvailable were found
+}
+
+// parseResourceUsage parses the output of usageScript.
+func parseResourceUsage(s string) (*resourceUsage, error) {
+	var res resourceUsage
+	var cpuFound, totalFound, availFound bool
+	scanner := bufio.NewScanner(strings.NewReader(s))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "cpu":
+			// user nice system idle iowait irq softirq steal ...
+			for i, f := range fields[1:] {
+				v, err := strconv.ParseUint(f, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("failed to parse %q: %w", scanner.Text(), err)
+				}
+				// guest and guest_nice (i >= 8) are already included in user and nice
+				if i >= 8 {
+					break
+				}
+				res.cpu.total += v
+				// idle and iowait
+				if i == 3 || i == 4 {
+					res.cpu.idle += v
+				}
+			}
+			cpuFound = true
+		case "MemTotal:", "MemAvailable:":
+			kib, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %q: %w", scanner.Text(), err)
+			}
+			if fields[0] == "MemTotal:" {
+				res.memTotal = kib * 1024
+				totalFound = true
+			} else {
+				res.memAvail = kib * 1024
+				availFound = true
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !cpuFound {
+		return nil, fmt.Errorf("no cpu line in %q", s)
+	}
+	res.memFound = totalFound && availFound
+	return &res, nil
+}
+
+// cpuUsagePercent returns the CPU usage between two samples, as the percentage of all the vCPUs.
+func cpuUsagePercent(prev, cur cpuTimes) float64 {
+	if cur.total <= prev.total || cur.idle < prev.idle {
+		return 0
+	}
+	total := cur.total - prev.total
+	idle := cur.idle - prev.idle
+	if idle > total {
+		return 0
+	}
+	return float64(total-idle) / float64(total) * 100
+}
+
+func (a *HostAgent) sampleResourceUsage() (*resourceUsage, error) {
+	stdout, stderr, err := ssh.ExecuteScript("127.0.0.1", a.sshLocalPort, a.sshConfig, usageScript, "sample resource usage")
+	if err != nil {
+		return nil, fmt.Errorf("stdout=%q, stderr=%q: %w", stdout, stderr, err)
+	}
+	return parseResourceUsage(stdout)
+}
+
+// diskIOPS returns the read and write operations per second between two samples taken interval apart.
+func diskIOPS(prev, cur *qemu.DiskIOCounters, interval time.Duration) (float64, float64) {
+	// the counters are reset when QEMU is restarted
+	if cur.ReadOperations < prev.ReadOperations || cur.WriteOperations < prev.WriteOperations {
+		return 0, 0
+	}
+	sec := interval.Seconds()
+	return float64(cur.ReadOperations-prev.ReadOperations) / sec, float64(cur.WriteOperations-prev.WriteOperations) / sec
+}
+
+func (a *HostAgent) diskStats() (*qemu.DiskIOCounters, error) {
+	var res *qemu.DiskIOCounters
+	err := a.withQMP(func(qmpClient qmp.Monitor, _ *raw.Monitor) error {
+		var err error
+		res, err = qemu.QueryDiskStats(qmpClient, a.instDir)
+		return err
+	})
+	return res, err
+}
+
+// watchResourceUsage samples the CPU and memory usage of the guest, and the I/O of the disk via QMP,
+// every `resourceUsage.interval` seconds, and emits the last status with the updated usage.
+func (a *HostAgent) watchResourceUsage(ctx context.Context) {
+	interval := time.Duration(*a.limaYAML().ResourceUsage.Interval) * time.Second
+	if interval == 0 {
+		return
+	}
+	// the first sample is only used as the baseline of the CPU usage and the IOPS
+	prev, err := a.sampleResourceUsage()
+	if err != nil {
+		logrus.WithError(err).Debug("failed to sample the resource usage of the guest")
+	}
+	prevDisk, err := a.diskStats()
+	if err != nil {
+		logrus.WithError(err).Debug("failed to sample the disk stats")
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		var (
+			disk            *events.DiskStatus
+			usage, prevUsed *resourceUsage
+		)
+		curDisk, err := a.diskStats()
+		if err != nil {
+			logrus.WithError(err).Debug("failed to sample the disk stats")
+		} else if prevDisk != nil {
+			readIOPS, writeIOPS := diskIOPS(prevDisk, curDisk, interval)
+			disk = &events.DiskStatus{
+				ReadBytes:  curDisk.ReadBytes,
+				WriteBytes: curDisk.WriteBytes,
+				ReadIOPS:   readIOPS,
+				WriteIOPS:  writeIOPS,
+			}
+		}
+		prevDisk = curDisk
+		cur, err := a.sampleResourceUsage()
+		if err != nil {
+			logrus.WithError(err).Debug("failed to sample the resource usage of the guest")
+		} else if prev != nil {
+			usage, prevUsed = cur, prev
+		}
+		if cur != nil {
+			prev = cur
+		}
+		// merged into the last status under the lock, so that the fields updated by the other routines are kept
+		a.updateStatus(ctx, func(st *events.Status) bool {
+			if disk != nil {
+				st.Disk = disk
+			}
+			if usage != nil {
+				st.CPUUsagePercent = cpuUsagePercent(prevUsed.cpu, usage.cpu)
+				if usage.memFound {
+					st.MemoryUsedBytes = usage.memTotal - usage.memAvail
+				}
+			}
+			return disk != nil || usage != nil
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package hostagent
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParseResourceUsage(t *testing.T) {
+	u, err := parseResourceUsage(`cpu  100 10 50 800 40 0 5 0 20 0
+MemTotal:        4000000 kB
+MemAvailable:    1000000 kB
+`)
+	assert.NilError(t, err)
+	// guest and guest_nice are not counted twice
+	assert.Equal(t, uint64(1005), u.cpu.total)
+	assert.Equal(t, uint64(840), u.cpu.idle)
+	assert.Equal(t, true, u.memFound)
+	assert.Equal(t, int64(4000000*1024), u.memTotal)
+	assert.Equal(t, int64(1000000*1024), u.memAvail)
+
+	u, err = parseResourceUsage("cpu  1 2 3 4\nMemTotal: 4000000 kB\n")
+	assert.NilError(t, err)
+	assert.Equal(t, uint64(10), u.cpu.total)
+	assert.Equal(t, false, u.memFound)
+
+	_, err = parseResourceUsage("MemTotal: 4000000 kB\n")
+	assert.ErrorContains(t, err, "no cpu line")
+
+	_, err = parseResourceUsage("cpu  1 foo 3 4\n")
+	assert.ErrorContains(t, err, "failed to parse")
+}
+
+func TestCPUUsagePercent(t *testing.T) {
+	assert.Equal(t, 25.0, cpuUsagePercent(cpuTimes{idle: 100, total: 200}, cpuTimes{idle: 175, total: 300}))
+	assert.Equal(t, 0.0, cpuUsagePercent(cpuTimes{idle: 100, total: 200}, cpuTimes{idle: 200, total: 300}))
+	// no time elapsed
+	assert.Equal(t, 0.0, cpuUsagePercent(cpuTimes{idle: 100, total: 200}, cpuTimes{idle: 100, total: 200}))
+	// the counters were reset, e.g., the guest was rebooted
+	assert.Equal(t, 0.0, cpuUsagePercent(cpuTimes{idle: 100, total: 200}, cpuTimes{idle: 10, total: 20}))
+}
@@ -9,9 +9,12 @@ import (
 	osuser "os/user"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
+	"strings"
 	"text/template"
 
+	"github.com/docker/go-units"
 	"github.com/lima-vm/lima/pkg/guestagent/api"
 	"github.com/lima-vm/lima/pkg/osutil"
 	"github.com/lima-vm/lima/pkg/store/dirnames"
@@ -39,6 +42,48 @@ func defaultContainerdArchives() []File {
 	}
 }
 
+func defaultMachine(arch Arch) string {
+	switch arch {
+	case AARCH64:
+		return "virt"
+	default:
+		return "q35"
+	}
+}
+
+// defaultBootProgressMarkers matches the messages of the kernel, the init system, and cloud-init.
+func defaultBootProgressMarkers() []BootProgressMarker {
+	return []BootProgressMarker{
+		{Pattern: `Linux version `, Progress: 5},
+		{Pattern: `Run /\S*init as init process`, Progress: 10},
+		{Pattern: `Welcome to |OpenRC .* is starting up`, Progress: 20},
+		{Pattern: `Cloud-init v\. \S+ running 'init-local'`, Progress: 30},
+		{Pattern: `Cloud-init v\. \S+ running 'init'`, Progress: 40},
+		{Pattern: `Cloud-init v\. \S+ running 'modules:config'`, Progress: 60},
+		{Pattern: `Cloud-init v\. \S+ running 'modules:final'`, Progress: 70},
+		{Pattern: `Cloud-init v\. \S+ finished`, Progress: 90},
+	}
+}
+
+// DefaultHostname returns "lima-<instName>", sanitized to be a valid DNS label.
+// e.g., "foo_bar.1" is converted to "lima-foo-bar-1".
+func DefaultHostname(instName string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower("lima-" + instName) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('-')
+		}
+	}
+	s := b.String()
+	if len(s) > 63 {
+		s = s[:63]
+	}
+	return strings.TrimRight(s, "-")
+}
+
 func MACAddress(uniqueID string) string {
 	sha := sha256.Sum256([]byte(osutil.MachineID() + uniqueID))
 	// "5" is the magic number in the Lima ecosystem.
@@ -52,6 +97,35 @@ func MACAddress(uniqueID string) string {
 	return hw.String()
 }
 
+const (
+	// DefaultCPUs is the default of `cpus`, unless the host has fewer CPUs.
+	DefaultCPUs = 4
+	// DefaultMemory is the default of `memory`, unless it exceeds the half of the memory of the host.
+	DefaultMemory = "4GiB"
+	// DefaultDisk is the default of `disk`.
+	DefaultDisk = "100GiB"
+)
+
+func defaultCPUs() int {
+	if n := runtime.NumCPU(); n < DefaultCPUs {
+		return n
+	}
+	return DefaultCPUs
+}
+
+func defaultMemory() string {
+	total, err := osutil.TotalMemory()
+	if err != nil {
+		logrus.WithError(err).Debug("failed to get the memory of the host")
+		return DefaultMemory
+	}
+	defaultBytes, _ := units.RAMInBytes(DefaultMemory)
+	if half := int64(total / 2); half < defaultBytes {
+		return fmt.Sprintf("%dMiB", half>>20)
+	}
+	return DefaultMemory
+}
+
 // FillDefault updates undefined fields in y with defaults from d (or built-in default), and overwrites with values from o.
 // Both d and o may be empty.
 //
@@ -64,6 +138,11 @@ func MACAddress(uniqueID string) string {
 // - Mounts are appended in d, y, o order, but "merged" when the Location matches a previous entry;
 //   the highest priority Writable setting wins.
 // - DNS are picked from the highest priority where DNS is not empty.
+// - NUMA nodes are picked from the highest priority where NUMA is not empty.
+// - CPU pinning is picked from the highest priority where CPU.Pinning is not empty.
+// - SSHFS options are picked from the highest priority where SSHFS.Options is not empty,
+//   and then the options of each mount that are not included yet are appended to them.
+// - BootProgressMarkers are picked from the highest priority where BootProgressMarkers is not empty.
 func FillDefault(y, d, o *LimaYAML, filePath string) {
 	if y.Arch == nil {
 		y.Arch = d.Arch
@@ -73,6 +152,16 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 	}
 	y.Arch = pointer.String(ResolveArch(y.Arch))
 
+	if y.RequireAcceleration == nil {
+		y.RequireAcceleration = d.RequireAcceleration
+	}
+	if o.RequireAcceleration != nil {
+		y.RequireAcceleration = o.RequireAcceleration
+	}
+	if y.RequireAcceleration == nil {
+		y.RequireAcceleration = pointer.Bool(false)
+	}
+
 	y.Images = append(append(o.Images, y.Images...), d.Images...)
 	for i := range y.Images {
 		img := &y.Images[i]
@@ -81,6 +170,26 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 		}
 	}
 
+	if y.Downloader.Proxy == nil {
+		y.Downloader.Proxy = d.Downloader.Proxy
+	}
+	if o.Downloader.Proxy != nil {
+		y.Downloader.Proxy = o.Downloader.Proxy
+	}
+	if y.Downloader.Proxy == nil {
+		y.Downloader.Proxy = pointer.String("")
+	}
+
+	if y.Downloader.CACert == nil {
+		y.Downloader.CACert = d.Downloader.CACert
+	}
+	if o.Downloader.CACert != nil {
+		y.Downloader.CACert = o.Downloader.CACert
+	}
+	if y.Downloader.CACert == nil {
+		y.Downloader.CACert = pointer.String("")
+	}
+
 	if y.CPUs == nil {
 		y.CPUs = d.CPUs
 	}
@@ -88,7 +197,45 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 		y.CPUs = o.CPUs
 	}
 	if y.CPUs == nil || *y.CPUs == 0 {
-		y.CPUs = pointer.Int(4)
+		y.CPUs = pointer.Int(defaultCPUs())
+	}
+
+	if y.MaxCPUs == nil {
+		y.MaxCPUs = d.MaxCPUs
+	}
+	if o.MaxCPUs != nil {
+		y.MaxCPUs = o.MaxCPUs
+	}
+	if y.MaxCPUs == nil || *y.MaxCPUs == 0 {
+		y.MaxCPUs = pointer.Int(*y.CPUs)
+	}
+
+	if y.CPU.Sockets == nil {
+		y.CPU.Sockets = d.CPU.Sockets
+	}
+	if o.CPU.Sockets != nil {
+		y.CPU.Sockets = o.CPU.Sockets
+	}
+	if y.CPU.Sockets == nil || *y.CPU.Sockets == 0 {
+		y.CPU.Sockets = pointer.Int(1)
+	}
+
+	if y.CPU.Threads == nil {
+		y.CPU.Threads = d.CPU.Threads
+	}
+	if o.CPU.Threads != nil {
+		y.CPU.Threads = o.CPU.Threads
+	}
+	if y.CPU.Threads == nil || *y.CPU.Threads == 0 {
+		y.CPU.Threads = pointer.Int(1)
+	}
+
+	// Note: CPU pinning is not combined, as it describes a single plan; highest priority setting is picked
+	if len(y.CPU.Pinning) == 0 {
+		y.CPU.Pinning = d.CPU.Pinning
+	}
+	if len(o.CPU.Pinning) > 0 {
+		y.CPU.Pinning = o.CPU.Pinning
 	}
 
 	if y.Memory == nil {
@@ -98,7 +245,35 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 		y.Memory = o.Memory
 	}
 	if y.Memory == nil || *y.Memory == "" {
-		y.Memory = pointer.String("4GiB")
+		y.Memory = pointer.String(defaultMemory())
+	}
+
+	if y.MemoryBalloon == nil {
+		y.MemoryBalloon = d.MemoryBalloon
+	}
+	if o.MemoryBalloon != nil {
+		y.MemoryBalloon = o.MemoryBalloon
+	}
+	if y.MemoryBalloon == nil {
+		y.MemoryBalloon = pointer.Bool(false)
+	}
+
+	if y.MemoryBackend == nil {
+		y.MemoryBackend = d.MemoryBackend
+	}
+	if o.MemoryBackend != nil {
+		y.MemoryBackend = o.MemoryBackend
+	}
+	if y.MemoryBackend == nil || *y.MemoryBackend == "" {
+		y.MemoryBackend = pointer.String(MemoryBackendRAM)
+	}
+
+	// Note: NUMA nodes are not combined, as they describe a single topology; highest priority setting is picked
+	if len(y.NUMA) == 0 {
+		y.NUMA = d.NUMA
+	}
+	if len(o.NUMA) > 0 {
+		y.NUMA = o.NUMA
 	}
 
 	if y.Disk == nil {
@@ -108,7 +283,47 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 		y.Disk = o.Disk
 	}
 	if y.Disk == nil || *y.Disk == "" {
-		y.Disk = pointer.String("100GiB")
+		y.Disk = pointer.String(DefaultDisk)
+	}
+
+	if y.DiskCache == nil {
+		y.DiskCache = d.DiskCache
+	}
+	if o.DiskCache != nil {
+		y.DiskCache = o.DiskCache
+	}
+	if y.DiskCache == nil || *y.DiskCache == "" {
+		y.DiskCache = pointer.String(DiskCacheWriteback)
+	}
+
+	if y.DiskFormat == nil {
+		y.DiskFormat = d.DiskFormat
+	}
+	if o.DiskFormat != nil {
+		y.DiskFormat = o.DiskFormat
+	}
+	if y.DiskFormat == nil || *y.DiskFormat == "" {
+		y.DiskFormat = pointer.String(DiskFormatQCOW2)
+	}
+
+	if y.DiskAIO == nil {
+		y.DiskAIO = d.DiskAIO
+	}
+	if o.DiskAIO != nil {
+		y.DiskAIO = o.DiskAIO
+	}
+	if y.DiskAIO == nil || *y.DiskAIO == "" {
+		y.DiskAIO = pointer.String(DiskAIOThreads)
+	}
+
+	if y.DiskDiscard == nil {
+		y.DiskDiscard = d.DiskDiscard
+	}
+	if o.DiskDiscard != nil {
+		y.DiskDiscard = o.DiskDiscard
+	}
+	if y.DiskDiscard == nil || *y.DiskDiscard == "" {
+		y.DiskDiscard = pointer.String(DiskDiscardIgnore)
 	}
 
 	if y.Video.Display == nil {
@@ -118,7 +333,148 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 		y.Video.Display = o.Video.Display
 	}
 	if y.Video.Display == nil || *y.Video.Display == "" {
-		y.Video.Display = pointer.String("none")
+		y.Video.Display = pointer.String(DisplayNone)
+	}
+
+	if y.Video.VNC.Enabled == nil {
+		y.Video.VNC.Enabled = d.Video.VNC.Enabled
+	}
+	if o.Video.VNC.Enabled != nil {
+		y.Video.VNC.Enabled = o.Video.VNC.Enabled
+	}
+	if y.Video.VNC.Enabled == nil {
+		y.Video.VNC.Enabled = pointer.Bool(false)
+	}
+
+	if y.Video.VNC.Address == nil {
+		y.Video.VNC.Address = d.Video.VNC.Address
+	}
+	if o.Video.VNC.Address != nil {
+		y.Video.VNC.Address = o.Video.VNC.Address
+	}
+	if y.Video.VNC.Address == nil || *y.Video.VNC.Address == "" {
+		y.Video.VNC.Address = pointer.String("127.0.0.1")
+	}
+
+	if y.Video.VNC.Display == nil {
+		y.Video.VNC.Display = d.Video.VNC.Display
+	}
+	if o.Video.VNC.Display != nil {
+		y.Video.VNC.Display = o.Video.VNC.Display
+	}
+	if y.Video.VNC.Display == nil {
+		y.Video.VNC.Display = pointer.Int(0)
+	}
+
+	if y.Video.SPICE.Enabled == nil {
+		y.Video.SPICE.Enabled = d.Video.SPICE.Enabled
+	}
+	if o.Video.SPICE.Enabled != nil {
+		y.Video.SPICE.Enabled = o.Video.SPICE.Enabled
+	}
+	if y.Video.SPICE.Enabled == nil {
+		y.Video.SPICE.Enabled = pointer.Bool(false)
+	}
+
+	if y.Video.Resolution == nil {
+		y.Video.Resolution = d.Video.Resolution
+	}
+	if o.Video.Resolution != nil {
+		y.Video.Resolution = o.Video.Resolution
+	}
+	if y.Video.Resolution == nil {
+		y.Video.Resolution = pointer.String("")
+	}
+
+	if y.Video.VRAM == nil {
+		y.Video.VRAM = d.Video.VRAM
+	}
+	if o.Video.VRAM != nil {
+		y.Video.VRAM = o.Video.VRAM
+	}
+	if y.Video.VRAM == nil {
+		y.Video.VRAM = pointer.Int(0)
+	}
+
+	if y.Audio.Device == nil {
+		y.Audio.Device = d.Audio.Device
+	}
+	if o.Audio.Device != nil {
+		y.Audio.Device = o.Audio.Device
+	}
+	if y.Audio.Device == nil || *y.Audio.Device == "" {
+		y.Audio.Device = pointer.String(AudioDeviceNone)
+	}
+
+	if y.Audio.Backend == nil {
+		y.Audio.Backend = d.Audio.Backend
+	}
+	if o.Audio.Backend != nil {
+		y.Audio.Backend = o.Audio.Backend
+	}
+	if y.Audio.Backend == nil {
+		y.Audio.Backend = pointer.String("")
+	}
+
+	if y.SerialCount == nil {
+		y.SerialCount = d.SerialCount
+	}
+	if o.SerialCount != nil {
+		y.SerialCount = o.SerialCount
+	}
+	if y.SerialCount == nil || *y.SerialCount == 0 {
+		y.SerialCount = pointer.Int(1)
+	}
+
+	// Note: the markers are not combined, as they describe the boot sequence of a single image; highest priority setting is picked
+	if len(y.BootProgressMarkers) == 0 {
+		y.BootProgressMarkers = d.BootProgressMarkers
+	}
+	if len(o.BootProgressMarkers) > 0 {
+		y.BootProgressMarkers = o.BootProgressMarkers
+	}
+	if len(y.BootProgressMarkers) == 0 {
+		y.BootProgressMarkers = defaultBootProgressMarkers()
+	}
+
+	if y.ResourceUsage.Interval == nil {
+		y.ResourceUsage.Interval = d.ResourceUsage.Interval
+	}
+	if o.ResourceUsage.Interval != nil {
+		y.ResourceUsage.Interval = o.ResourceUsage.Interval
+	}
+	if y.ResourceUsage.Interval == nil {
+		y.ResourceUsage.Interval = pointer.Int(60)
+	}
+
+	if y.GuestAgent.ReconnectInterval == nil {
+		y.GuestAgent.ReconnectInterval = d.GuestAgent.ReconnectInterval
+	}
+	if o.GuestAgent.ReconnectInterval != nil {
+		y.GuestAgent.ReconnectInterval = o.GuestAgent.ReconnectInterval
+	}
+	if y.GuestAgent.ReconnectInterval == nil {
+		y.GuestAgent.ReconnectInterval = pointer.Int(10)
+	}
+
+	if y.Heartbeat.Interval == nil {
+		y.Heartbeat.Interval = d.Heartbeat.Interval
+	}
+	if o.Heartbeat.Interval != nil {
+		y.Heartbeat.Interval = o.Heartbeat.Interval
+	}
+	if y.Heartbeat.Interval == nil {
+		y.Heartbeat.Interval = pointer.Int(0)
+	}
+
+	if y.AutoStop.IdleTimeout == nil {
+		y.AutoStop.IdleTimeout = d.AutoStop.IdleTimeout
+	}
+	if o.AutoStop.IdleTimeout != nil {
+		y.AutoStop.IdleTimeout = o.AutoStop.IdleTimeout
+	}
+	if y.AutoStop.IdleTimeout == nil {
+		y.AutoStop.IdleTimeout = pointer.Int(0)
 	}
 
 	if y.Firmware.LegacyBIOS == nil {
@@ -131,6 +487,96 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 		y.Firmware.LegacyBIOS = pointer.Bool(false)
 	}
 
+	if y.Firmware.Code == nil {
+		y.Firmware.Code = d.Firmware.Code
+	}
+	if o.Firmware.Code != nil {
+		y.Firmware.Code = o.Firmware.Code
+	}
+	if y.Firmware.Code == nil {
+		y.Firmware.Code = pointer.String("")
+	}
+
+	if y.Firmware.Vars == nil {
+		y.Firmware.Vars = d.Firmware.Vars
+	}
+	if o.Firmware.Vars != nil {
+		y.Firmware.Vars = o.Firmware.Vars
+	}
+	if y.Firmware.Vars == nil {
+		y.Firmware.Vars = pointer.String("")
+	}
+
+	if y.Firmware.SecureBoot == nil {
+		y.Firmware.SecureBoot = d.Firmware.SecureBoot
+	}
+	if o.Firmware.SecureBoot != nil {
+		y.Firmware.SecureBoot = o.Firmware.SecureBoot
+	}
+	if y.Firmware.SecureBoot == nil {
+		y.Firmware.SecureBoot = pointer.Bool(false)
+	}
+
+	if y.Boot.Order == nil {
+		y.Boot.Order = d.Boot.Order
+	}
+	if o.Boot.Order != nil {
+		y.Boot.Order = o.Boot.Order
+	}
+	if y.Boot.Order == nil {
+		y.Boot.Order = pointer.String("")
+	}
+
+	if y.Boot.Menu == nil {
+		y.Boot.Menu = d.Boot.Menu
+	}
+	if o.Boot.Menu != nil {
+		y.Boot.Menu = o.Boot.Menu
+	}
+	if y.Boot.Menu == nil {
+		y.Boot.Menu = pointer.Bool(true)
+	}
+
+	if y.Boot.SplashTime == nil {
+		y.Boot.SplashTime = d.Boot.SplashTime
+	}
+	if o.Boot.SplashTime != nil {
+		y.Boot.SplashTime = o.Boot.SplashTime
+	}
+	if y.Boot.SplashTime == nil {
+		y.Boot.SplashTime = pointer.Int(0)
+	}
+
+	if y.Kernel == nil {
+		y.Kernel = d.Kernel
+	}
+	if o.Kernel != nil {
+		y.Kernel = o.Kernel
+	}
+	if y.Kernel == nil {
+		y.Kernel = pointer.String("")
+	}
+
+	if y.Initrd == nil {
+		y.Initrd = d.Initrd
+	}
+	if o.Initrd != nil {
+		y.Initrd = o.Initrd
+	}
+	if y.Initrd == nil {
+		y.Initrd = pointer.String("")
+	}
+
+	if y.Cmdline == nil {
+		y.Cmdline = d.Cmdline
+	}
+	if o.Cmdline != nil {
+		y.Cmdline = o.Cmdline
+	}
+	if y.Cmdline == nil {
+		y.Cmdline = pointer.String("")
+	}
+
 	if y.SSH.LocalPort == nil {
 		y.SSH.LocalPort = d.SSH.LocalPort
 	}
@@ -161,6 +607,36 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 		y.SSH.ForwardAgent = pointer.Bool(false)
 	}
 
+	if y.SSH.StrictHostKeyChecking == nil {
+		y.SSH.StrictHostKeyChecking = d.SSH.StrictHostKeyChecking
+	}
+	if o.SSH.StrictHostKeyChecking != nil {
+		y.SSH.StrictHostKeyChecking = o.SSH.StrictHostKeyChecking
+	}
+	if y.SSH.StrictHostKeyChecking == nil {
+		y.SSH.StrictHostKeyChecking = pointer.Bool(false)
+	}
+
+	if y.SSH.Address == nil {
+		y.SSH.Address = d.SSH.Address
+	}
+	if o.SSH.Address != nil {
+		y.SSH.Address = o.SSH.Address
+	}
+	if y.SSH.Address == nil {
+		y.SSH.Address = pointer.String("127.0.0.1")
+	}
+
+	if y.SSH.ProxyJump == nil {
+		y.SSH.ProxyJump = d.SSH.ProxyJump
+	}
+	if o.SSH.ProxyJump != nil {
+		y.SSH.ProxyJump = o.SSH.ProxyJump
+	}
+	if y.SSH.ProxyJump == nil {
+		y.SSH.ProxyJump = pointer.String("")
+	}
+
 	y.Provision = append(append(o.Provision, y.Provision...), d.Provision...)
 	for i := range y.Provision {
 		provision := &y.Provision[i]
@@ -188,6 +664,16 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 		y.Containerd.User = pointer.Bool(true)
 	}
 
+	if y.CloudInit.UserData == nil {
+		y.CloudInit.UserData = d.CloudInit.UserData
+	}
+	if o.CloudInit.UserData != nil {
+		y.CloudInit.UserData = o.CloudInit.UserData
+	}
+	if y.CloudInit.UserData == nil {
+		y.CloudInit.UserData = pointer.String("")
+	}
+
 	y.Containerd.Archives = append(append(o.Containerd.Archives, y.Containerd.Archives...), d.Containerd.Archives...)
 	if len(y.Containerd.Archives) == 0 {
 		y.Containerd.Archives = defaultContainerdArchives()
@@ -199,6 +685,34 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 		}
 	}
 
+	y.Containerd.PrePull = append(append(o.Containerd.PrePull, y.Containerd.PrePull...), d.Containerd.PrePull...)
+
+	if y.QEMU.Machine == nil {
+		y.QEMU.Machine = d.QEMU.Machine
+	}
+	if o.QEMU.Machine != nil {
+		y.QEMU.Machine = o.QEMU.Machine
+	}
+	if y.QEMU.Machine == nil || *y.QEMU.Machine == "" {
+		y.QEMU.Machine = pointer.String(defaultMachine(*y.Arch))
+	}
+
+	if y.QEMU.Accel == nil {
+		y.QEMU.Accel = d.QEMU.Accel
+	}
+	if o.QEMU.Accel != nil {
+		y.QEMU.Accel = o.QEMU.Accel
+	}
+	if y.QEMU.Accel == nil {
+		y.QEMU.Accel = pointer.String("")
+	}
+
+	y.QEMU.ExtraArgs = append(append(o.QEMU.ExtraArgs, y.QEMU.ExtraArgs...), d.QEMU.ExtraArgs...)
+
+	y.USB = append(append(o.USB, y.USB...), d.USB...)
+	y.PCIPassthrough = append(append(o.PCIPassthrough, y.PCIPassthrough...), d.PCIPassthrough...)
+	y.ISOs = append(append(o.ISOs, y.ISOs...), d.ISOs...)
+
 	y.Probes = append(append(o.Probes, y.Probes...), d.Probes...)
 	for i := range y.Probes {
 		probe := &y.Probes[i]
@@ -210,9 +724,40 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 		}
 	}
 
+	if y.Network.HostBind == nil {
+		y.Network.HostBind = d.Network.HostBind
+	}
+	if o.Network.HostBind != nil {
+		y.Network.HostBind = o.Network.HostBind
+	}
+	if y.Network.HostBind == nil {
+		y.Network.HostBind = api.IPv4loopback1
+	}
+
 	y.PortForwards = append(append(o.PortForwards, y.PortForwards...), d.PortForwards...)
+	if y.PortForwardPolicy == nil {
+		y.PortForwardPolicy = d.PortForwardPolicy
+	}
+	if o.PortForwardPolicy != nil {
+		y.PortForwardPolicy = o.PortForwardPolicy
+	}
+	if y.PortForwardPolicy == nil || *y.PortForwardPolicy == "" {
+		y.PortForwardPolicy = pointer.String(PortForwardPolicyAllow)
+	}
+	if y.PortForwardOnConflict == nil {
+		y.PortForwardOnConflict = d.PortForwardOnConflict
+	}
+	if o.PortForwardOnConflict != nil {
+		y.PortForwardOnConflict = o.PortForwardOnConflict
+	}
+	if y.PortForwardOnConflict == nil || *y.PortForwardOnConflict == "" {
+		y.PortForwardOnConflict = pointer.String(PortForwardOnConflictSkip)
+	}
 	instDir := filepath.Dir(filePath)
 	for i := range y.PortForwards {
+		if y.PortForwards[i].HostIP == nil {
+			y.PortForwards[i].HostIP = y.Network.HostBind
+		}
 		FillPortForwardDefaults(&y.PortForwards[i], instDir)
 		// After defaults processing the singular HostPort and GuestPort values should not be used again.
 	}
@@ -258,6 +803,7 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 				networks[i].VNL = nw.VNL
 				networks[i].SwitchPort = nw.SwitchPort
 				networks[i].Lima = ""
+				networks[i].Bridge = ""
 			}
 			if nw.Lima != "" {
 				if nw.VNL != "" {
@@ -268,6 +814,18 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 				networks[i].Lima = nw.Lima
 				networks[i].VNL = ""
 				networks[i].SwitchPort = 0
+				networks[i].Bridge = ""
+			}
+			if nw.Bridge != "" {
+				if nw.VNL != "" || nw.Lima != "" {
+					logrus.Errorf("Network %q has both bridge=%q and vnl=%q or lima=%q fields; ignoring bridge",
+						nw.Interface, nw.Bridge, nw.VNL, nw.Lima)
+				} else {
+					networks[i].Bridge = nw.Bridge
+					networks[i].VNL = ""
+					networks[i].SwitchPort = 0
+					networks[i].Lima = ""
+				}
 			}
 			if nw.MACAddress != "" {
 				networks[i].MACAddress = nw.MACAddress
@@ -281,6 +839,48 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 		}
 	}
 	y.Networks = networks
+	// Not taken from d or o, as every instance must get its own unique MAC address
+	if y.Network.MACAddress == "" {
+		y.Network.MACAddress = MACAddress(filepath.Dir(filePath))
+	}
+	if y.Network.IPv6 == nil {
+		y.Network.IPv6 = d.Network.IPv6
+	}
+	if o.Network.IPv6 != nil {
+		y.Network.IPv6 = o.Network.IPv6
+	}
+	if y.Network.IPv6 == nil {
+		y.Network.IPv6 = pointer.Bool(false)
+	}
+	// Not taken from d or o either, as the hostname is specific to the instance
+	if y.Hostname == nil || *y.Hostname == "" {
+		instName := filepath.Base(filepath.Dir(filePath))
+		y.Hostname = pointer.String(DefaultHostname(instName))
+		// Keep the hostname of the existing instances, which was "lima-<INSTANCE>" as-is
+		if legacy := "lima-" + instName; *y.Hostname != legacy && instanceExists(filepath.Dir(filePath)) {
+			y.Hostname = pointer.String(legacy)
+			y.legacyHostname = true
+		}
+	}
+	if y.Timezone == nil {
+		y.Timezone = d.Timezone
+	}
+	if o.Timezone != nil {
+		y.Timezone = o.Timezone
+	}
+	if y.Timezone == nil {
+		y.Timezone = pointer.String(osutil.TimeZone())
+	}
+
+	if y.RTC == nil {
+		y.RTC = d.RTC
+	}
+	if o.RTC != nil {
+		y.RTC = o.RTC
+	}
+	if y.RTC == nil {
+		y.RTC = pointer.String(RTCUTC)
+	}
 	for i := range y.Networks {
 		nw := &y.Networks[i]
 		if nw.MACAddress == "" {
@@ -292,18 +892,73 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 		}
 	}
 
-	// Combine all mounts; highest priority entry determines writable status.
+	if y.MountType == nil {
+		y.MountType = d.MountType
+	}
+	if o.MountType != nil {
+		y.MountType = o.MountType
+	}
+	if y.MountType == nil || *y.MountType == "" {
+		y.MountType = pointer.String(ReverseSSHFS)
+	}
+
+	if y.SSHFS.Cache == nil {
+		y.SSHFS.Cache = d.SSHFS.Cache
+	}
+	if o.SSHFS.Cache != nil {
+		y.SSHFS.Cache = o.SSHFS.Cache
+	}
+	if y.SSHFS.Cache == nil {
+		y.SSHFS.Cache = pointer.Bool(true)
+	}
+	if y.SSHFS.FollowSymlinks == nil {
+		y.SSHFS.FollowSymlinks = d.SSHFS.FollowSymlinks
+	}
+	if o.SSHFS.FollowSymlinks != nil {
+		y.SSHFS.FollowSymlinks = o.SSHFS.FollowSymlinks
+	}
+	if y.SSHFS.FollowSymlinks == nil {
+		y.SSHFS.FollowSymlinks = pointer.Bool(false)
+	}
+	if len(y.SSHFS.Options) == 0 {
+		y.SSHFS.Options = d.SSHFS.Options
+	}
+	if len(o.SSHFS.Options) > 0 {
+		y.SSHFS.Options = o.SSHFS.Options
+	}
+
+	// Combine all mounts; highest priority entry determines writable status and the sshfs options.
 	// Only works for exact matches; does not normalize case or resolve symlinks.
 	mounts := make([]Mount, 0, len(d.Mounts)+len(y.Mounts)+len(o.Mounts))
 	location := make(map[string]int)
 	for _, mount := range append(append(d.Mounts, y.Mounts...), o.Mounts...) {
+		mount.Location = executeMountLocationTemplate(mount.Location, instDir, *y.Arch)
 		if i, ok := location[mount.Location]; ok {
 			mounts[i].Writable = mount.Writable
+			if mount.SSHFS.Cache != nil {
+				mounts[i].SSHFS.Cache = mount.SSHFS.Cache
+			}
+			if mount.SSHFS.FollowSymlinks != nil {
+				mounts[i].SSHFS.FollowSymlinks = mount.SSHFS.FollowSymlinks
+			}
+			if len(mount.SSHFS.Options) > 0 {
+				mounts[i].SSHFS.Options = mount.SSHFS.Options
+			}
 		} else {
 			location[mount.Location] = len(mounts)
 			mounts = append(mounts, mount)
 		}
 	}
+	for i := range mounts {
+		if mounts[i].SSHFS.Cache == nil {
+			mounts[i].SSHFS.Cache = y.SSHFS.Cache
+		}
+		if mounts[i].SSHFS.FollowSymlinks == nil {
+			mounts[i].SSHFS.FollowSymlinks = y.SSHFS.FollowSymlinks
+		}
+		// The options already filled in by a previous FillDefault are not appended again
+		mounts[i].SSHFS.Options = appendMissing(append([]string(nil), y.SSHFS.Options...), mounts[i].SSHFS.Options)
+	}
 	y.Mounts = mounts
 
 	// Note: DNS lists are not combined; highest priority setting is picked
@@ -324,9 +979,77 @@ func FillDefault(y, d, o *LimaYAML, filePath string) {
 	for k, v := range o.Env {
 		env[k] = v
 	}
+	// The existing instances keep starting with the values that were accepted before; see skippedEnv
+	if instanceExists(filepath.Dir(filePath)) {
+		for k, v := range env {
+			if isLegacyEnv(k, v) {
+				delete(env, k)
+				y.skippedEnv = append(y.skippedEnv, k)
+			}
+		}
+		sort.Strings(y.skippedEnv)
+	}
 	y.Env = env
 }
 
+// instanceExists returns true when the disk of the instance has already been created,
+// i.e., the instance is not being created from lima.yaml for the first time.
+func instanceExists(instDir string) bool {
+	_, err := os.Stat(filepath.Join(instDir, filenames.DiffDisk))
+	return err == nil
+}
+
+// hostTemplateData returns the template variables for the paths on the host, e.g. `mounts[*].location`.
+// appendMissing appends the elements of b that are not in a.
+func appendMissing(a, b []string) []string {
+	for _, s := range b {
+		found := false
+		for _, t := range a {
+			if s == t {
+				found = true
+				break
+			}
+		}
+		if !found {
+			a = append(a, s)
+		}
+	}
+	return a
+}
+
+func hostTemplateData(instDir string) map[string]string {
+	user, _ := osuser.Current()
+	home, _ := os.UserHomeDir()
+	return map[string]string{
+		"Dir":  instDir,
+		"Home": home,
+		"Name": filepath.Base(instDir),
+		"UID":  user.Uid,
+		"User": user.Username,
+	}
+}
+
+// executeMountLocationTemplate expands the template variables of hostTemplateData, and {{.Arch}}, in a mount location.
+// The location is returned as is when it is not a valid template, so that it is reported by Validate.
+func executeMountLocationTemplate(location, instDir string, arch Arch) string {
+	if !strings.Contains(location, "{{") {
+		return location
+	}
+	tmpl, err := template.New("").Option("missingkey=error").Parse(location)
+	if err != nil {
+		logrus.WithError(err).Warnf("Couldn't process mount location %q as a template", location)
+		return location
+	}
+	data := hostTemplateData(instDir)
+	data["Arch"] = arch
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		logrus.WithError(err).Warnf("Couldn't process mount location %q as a template", location)
+		return location
+	}
+	return out.String()
+}
+
 func FillPortForwardDefaults(rule *PortForward, instDir string) {
 	if rule.Proto == "" {
 		rule.Proto = TCP
@@ -374,19 +1097,10 @@ func FillPortForwardDefaults(rule *PortForward, instDir string) {
 	if rule.HostSocket != "" {
 		tmpl, err := template.New("").Parse(rule.HostSocket)
 		if err == nil {
-			user, _ := osuser.Current()
-			home, _ := os.UserHomeDir()
 			limaHome, _ := dirnames.LimaDir()
-			data := map[string]string{
-				"Dir":  instDir,
-				"Home": home,
-				"Name": filepath.Base(instDir),
-				"UID":  user.Uid,
-				"User": user.Username,
-
-				"Instance": filepath.Base(instDir), // DEPRECATED, use `{{.Name}}`
-				"LimaHome": limaHome,               // DEPRECATED, (use `Dir` instead of `{{.LimaHome}}/{{.Instance}}`
-			}
+			data := hostTemplateData(instDir)
+			data["Instance"] = filepath.Base(instDir) // DEPRECATED, use `{{.Name}}`
+			data["LimaHome"] = limaHome               // DEPRECATED, (use `Dir` instead of `{{.LimaHome}}/{{.Instance}}`
 			var out bytes.Buffer
 			if err := tmpl.Execute(&out, data); err == nil {
 				rule.HostSocket = out.String()
@@ -412,9 +1126,30 @@ func NewArch(arch string) Arch {
 	}
 }
 
+// HostAccel returns the hardware accelerator of QEMU on the host OS.
+func HostAccel() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "hvf"
+	case "linux":
+		return "kvm"
+	case "netbsd":
+		return "nvmm" // untested
+	case "windows":
+		return "whpx" // untested
+	}
+	return AccelTCG
+}
+
+// ResolveArch returns the arch of the host for an empty arch and "default".
+// The Go names of the archs ("amd64", "arm64") are accepted as aliases.
 func ResolveArch(s *string) Arch {
 	if s == nil || *s == "" || *s == "default" {
 		return NewArch(runtime.GOARCH)
 	}
+	switch *s {
+	case "amd64", "arm64":
+		return NewArch(*s)
+	}
 	return *s
 }
@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"net"
 	"os"
+	osuser "os/user"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -18,12 +20,100 @@ import (
 	"gotest.tools/v3/assert"
 )
 
+func TestDefaultHostname(t *testing.T) {
+	assert.Equal(t, DefaultHostname("default"), "lima-default")
+	assert.Equal(t, DefaultHostname("Foo_bar.1"), "lima-foo-bar-1")
+	assert.Equal(t, DefaultHostname(strings.Repeat("a", 70)), "lima-"+strings.Repeat("a", 58))
+	assert.NilError(t, validateHostname(DefaultHostname("foo_")))
+}
+
+func TestFillDefaultLegacyEnv(t *testing.T) {
+	instDir := filepath.Join(t.TempDir(), "foo")
+	assert.NilError(t, os.Mkdir(instDir, 0o700))
+	filePath := filepath.Join(instDir, filenames.LimaYAML)
+	env := map[string]string{"PATH_EXTRA": "$HOME/bin", "FOO": "foo bar", "NL": "a\nb"}
+
+	// a new instance is rejected by Validate
+	y := LimaYAML{Env: env}
+	FillDefault(&y, &LimaYAML{}, &LimaYAML{}, filePath)
+	assert.Equal(t, y.Env["PATH_EXTRA"], "$HOME/bin")
+	assert.Equal(t, 0, len(y.skippedEnv))
+
+	// an existing instance skips the values that were accepted before
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.DiffDisk), nil, 0o600))
+	y = LimaYAML{Env: env}
+	FillDefault(&y, &LimaYAML{}, &LimaYAML{}, filePath)
+	assert.DeepEqual(t, y.Env, map[string]string{"FOO": "foo bar", "NL": "a\nb"})
+	assert.DeepEqual(t, y.skippedEnv, []string{"PATH_EXTRA"})
+}
+
+func TestFillDefaultTwice(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "foo", filenames.LimaYAML)
+	y := LimaYAML{
+		SSHFS:  SSHFS{Options: []string{"reconnect"}},
+		Mounts: []Mount{{Location: "/tmp/foo", SSHFS: SSHFS{Options: []string{"ServerAliveInterval=15", "reconnect"}}}},
+	}
+	FillDefault(&y, &LimaYAML{}, &LimaYAML{}, filePath)
+	assert.DeepEqual(t, y.Mounts[0].SSHFS.Options, []string{"reconnect", "ServerAliveInterval=15"})
+
+	// the options are not duplicated when the filled-in config is filled in again
+	FillDefault(&y, &LimaYAML{}, &LimaYAML{}, filePath)
+	assert.DeepEqual(t, y.SSHFS.Options, []string{"reconnect"})
+	assert.DeepEqual(t, y.Mounts[0].SSHFS.Options, []string{"reconnect", "ServerAliveInterval=15"})
+}
+
+func TestFillDefaultLegacyHostname(t *testing.T) {
+	instDir := filepath.Join(t.TempDir(), "Foo_bar")
+	assert.NilError(t, os.Mkdir(instDir, 0o700))
+	filePath := filepath.Join(instDir, filenames.LimaYAML)
+
+	var y LimaYAML
+	FillDefault(&y, &LimaYAML{}, &LimaYAML{}, filePath)
+	assert.Equal(t, *y.Hostname, "lima-foo-bar")
+	assert.Assert(t, !y.legacyHostname)
+
+	// an existing instance keeps its hostname
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.DiffDisk), nil, 0o600))
+	y = LimaYAML{}
+	FillDefault(&y, &LimaYAML{}, &LimaYAML{}, filePath)
+	assert.Equal(t, *y.Hostname, "lima-Foo_bar")
+	assert.Assert(t, y.legacyHostname)
+
+	y = LimaYAML{Hostname: pointer.String("foo")}
+	FillDefault(&y, &LimaYAML{}, &LimaYAML{}, filePath)
+	assert.Equal(t, *y.Hostname, "foo")
+}
+
+func TestResolveArch(t *testing.T) {
+	host := NewArch(runtime.GOARCH)
+	assert.Equal(t, host, ResolveArch(nil))
+	assert.Equal(t, host, ResolveArch(pointer.String("")))
+	assert.Equal(t, host, ResolveArch(pointer.String("default")))
+	assert.Equal(t, X8664, ResolveArch(pointer.String("amd64")))
+	assert.Equal(t, AARCH64, ResolveArch(pointer.String("arm64")))
+	assert.Equal(t, AARCH64, ResolveArch(pointer.String(AARCH64)))
+}
+
+func TestExecuteMountLocationTemplate(t *testing.T) {
+	home, err := os.UserHomeDir()
+	assert.NilError(t, err)
+	user, err := osuser.Current()
+	assert.NilError(t, err)
+	instDir := "/lima/foo"
+	assert.Equal(t, home+"/work", executeMountLocationTemplate("{{.Home}}/work", instDir, X8664))
+	assert.Equal(t, "/tmp/"+user.Username+"/foo/x86_64", executeMountLocationTemplate("/tmp/{{.User}}/{{.Name}}/{{.Arch}}", instDir, X8664))
+	assert.Equal(t, "~/work", executeMountLocationTemplate("~/work", instDir, X8664))
+	// invalid templates are kept, and rejected by Validate
+	assert.Equal(t, "/tmp/{{.Foo}}", executeMountLocationTemplate("/tmp/{{.Foo}}", instDir, X8664))
+	assert.Equal(t, "/tmp/{{.Home", executeMountLocationTemplate("/tmp/{{.Home", instDir, X8664))
+}
+
 func TestFillDefault(t *testing.T) {
 	var d, y, o LimaYAML
 
 	opts := []cmp.Option{
-		// Ignore internal NetworkDeprecated.migrated field
-		cmpopts.IgnoreUnexported(NetworkDeprecated{}),
+		// Ignore internal NetworkDeprecated.migrated, LimaYAML.legacyHostname, and LimaYAML.skippedEnv fields
+		cmpopts.IgnoreUnexported(NetworkDeprecated{}, LimaYAML{}),
 		// Consider nil slices and empty slices to be identical
 		cmpopts.EquateEmpty(),
 	}
@@ -47,25 +137,82 @@ func TestFillDefault(t *testing.T) {
 
 	// Builtin default values
 	builtin := LimaYAML{
-		Arch:   pointer.String(arch),
-		CPUs:   pointer.Int(4),
-		Memory: pointer.String("4GiB"),
-		Disk:   pointer.String("100GiB"),
+		Arch:          pointer.String(arch),
+		CPUs:          pointer.Int(defaultCPUs()),
+		MaxCPUs:       pointer.Int(defaultCPUs()),
+		CPU:           CPU{Sockets: pointer.Int(1), Threads: pointer.Int(1)},
+		Memory:        pointer.String(defaultMemory()),
+		MemoryBackend: pointer.String(MemoryBackendRAM),
+		MemoryBalloon: pointer.Bool(false),
+		Disk:          pointer.String(DefaultDisk),
+		DiskCache:     pointer.String(DiskCacheWriteback),
+		DiskFormat:    pointer.String(DiskFormatQCOW2),
+		DiskAIO:       pointer.String(DiskAIOThreads),
+		DiskDiscard:   pointer.String(DiskDiscardIgnore),
 		Containerd: Containerd{
 			System:   pointer.Bool(false),
 			User:     pointer.Bool(true),
 			Archives: defaultContainerdArchives(),
 		},
 		SSH: SSH{
-			LocalPort:         pointer.Int(0),
-			LoadDotSSHPubKeys: pointer.Bool(true),
-			ForwardAgent:      pointer.Bool(false),
+			LocalPort:             pointer.Int(0),
+			LoadDotSSHPubKeys:     pointer.Bool(true),
+			ForwardAgent:          pointer.Bool(false),
+			StrictHostKeyChecking: pointer.Bool(false),
+			Address:               pointer.String("127.0.0.1"),
+			ProxyJump:             pointer.String(""),
 		},
 		Firmware: Firmware{
 			LegacyBIOS: pointer.Bool(false),
+			Code:       pointer.String(""),
+			Vars:       pointer.String(""),
+			SecureBoot: pointer.Bool(false),
+		},
+		Boot: Boot{
+			Order:      pointer.String(""),
+			Menu:       pointer.Bool(true),
+			SplashTime: pointer.Int(0),
 		},
 		Video: Video{
-			Display: pointer.String("none"),
+			Display:    pointer.String("none"),
+			VNC:        VNC{Enabled: pointer.Bool(false), Address: pointer.String("127.0.0.1"), Display: pointer.Int(0)},
+			SPICE:      SPICE{Enabled: pointer.Bool(false)},
+			Resolution: pointer.String(""),
+			VRAM:       pointer.Int(0),
+		},
+		Audio:                 Audio{Device: pointer.String(AudioDeviceNone), Backend: pointer.String("")},
+		SerialCount:           pointer.Int(1),
+		BootProgressMarkers:   defaultBootProgressMarkers(),
+		ResourceUsage:         ResourceUsage{Interval: pointer.Int(60)},
+		GuestAgent:            GuestAgent{ReconnectInterval: pointer.Int(10)},
+		Heartbeat:             Heartbeat{Interval: pointer.Int(0)},
+		AutoStop:              AutoStop{IdleTimeout: pointer.Int(0)},
+		PortForwardPolicy:     pointer.String(PortForwardPolicyAllow),
+		PortForwardOnConflict: pointer.String(PortForwardOnConflictSkip),
+		MountType:             pointer.String(ReverseSSHFS),
+		SSHFS:                 SSHFS{Cache: pointer.Bool(true), FollowSymlinks: pointer.Bool(false)},
+		CloudInit: CloudInit{
+			UserData: pointer.String(""),
+		},
+		RequireAcceleration: pointer.Bool(false),
+		Downloader: Downloader{
+			Proxy:  pointer.String(""),
+			CACert: pointer.String(""),
+		},
+		QEMU: QEMU{
+			Machine: pointer.String(defaultMachine(arch)),
+			Accel:   pointer.String(""),
+		},
+		Hostname: pointer.String("lima-" + instName),
+		Timezone: pointer.String(osutil.TimeZone()),
+		RTC:      pointer.String(RTCUTC),
+		Kernel:   pointer.String(""),
+		Initrd:   pointer.String(""),
+		Cmdline:  pointer.String(""),
+		Network: UserNetwork{
+			MACAddress: MACAddress(instDir),
+			IPv6:       pointer.Bool(false),
+			HostBind:   api.IPv4loopback1,
 		},
 		UseHostResolver:   pointer.Bool(true),
 		PropagateProxyEnv: pointer.Bool(true),
@@ -115,8 +262,13 @@ func TestFillDefault(t *testing.T) {
 	}
 
 	expect := builtin
-	expect.Mounts = y.Mounts
-	// Only missing Mounts field is Writable, and the default value is also the null value: false
+	expect.Mounts = []Mount{
+		{
+			Location: "/tmp",
+			SSHFS:    SSHFS{Cache: pointer.Bool(true), FollowSymlinks: pointer.Bool(false)},
+		},
+	}
+	// Writable is also missing, but the default value is also the null value: false
 
 	expect.Provision = y.Provision
 	expect.Provision[0].Mode = ProvisionModeSystem
@@ -162,27 +314,79 @@ func TestFillDefault(t *testing.T) {
 
 	// Choose values that are different from the "builtin" defaults
 	d = LimaYAML{
-		Arch:   pointer.String("unknown"),
-		CPUs:   pointer.Int(7),
-		Memory: pointer.String("5GiB"),
-		Disk:   pointer.String("105GiB"),
+		Arch:          pointer.String("unknown"),
+		CPUs:          pointer.Int(7),
+		MaxCPUs:       pointer.Int(8),
+		CPU:           CPU{Sockets: pointer.Int(2), Threads: pointer.Int(2), Pinning: map[int]int{0: 2, 1: 3}},
+		Memory:        pointer.String("5GiB"),
+		NUMA:          []NUMANode{{CPUs: 7, Memory: "5GiB"}},
+		MemoryBackend: pointer.String(MemoryBackendRAM),
+		MemoryBalloon: pointer.Bool(true),
+		Disk:          pointer.String("105GiB"),
+		DiskCache:     pointer.String(DiskCacheUnsafe),
+		DiskFormat:    pointer.String(DiskFormatRaw),
+		DiskAIO:       pointer.String(DiskAIOIOURing),
+		DiskDiscard:   pointer.String(DiskDiscardUnmap),
 		Containerd: Containerd{
 			System: pointer.Bool(true),
 			User:   pointer.Bool(false),
 			Archives: []File{
 				{Location: "/tmp/nerdctl.tgz"},
 			},
+			PrePull: []string{"alpine"},
 		},
 		SSH: SSH{
-			LocalPort:         pointer.Int(888),
-			LoadDotSSHPubKeys: pointer.Bool(false),
-			ForwardAgent:      pointer.Bool(true),
+			LocalPort:             pointer.Int(888),
+			LoadDotSSHPubKeys:     pointer.Bool(false),
+			ForwardAgent:          pointer.Bool(true),
+			StrictHostKeyChecking: pointer.Bool(true),
+			Address:               pointer.String("192.168.5.2"),
+			ProxyJump:             pointer.String("d-jump"),
 		},
 		Firmware: Firmware{
 			LegacyBIOS: pointer.Bool(true),
+			Code:       pointer.String("/d/OVMF_CODE.fd"),
+			Vars:       pointer.String("/d/OVMF_VARS.fd"),
+			SecureBoot: pointer.Bool(true),
+		},
+		Boot: Boot{
+			Order:      pointer.String("dc"),
+			Menu:       pointer.Bool(false),
+			SplashTime: pointer.Int(1000),
 		},
 		Video: Video{
-			Display: pointer.String("cocoa"),
+			Display:    pointer.String("cocoa"),
+			VNC:        VNC{Enabled: pointer.Bool(true), Address: pointer.String("127.0.0.2"), Display: pointer.Int(1)},
+			SPICE:      SPICE{Enabled: pointer.Bool(true)},
+			Resolution: pointer.String("1920x1080"),
+			VRAM:       pointer.Int(32),
+		},
+		Audio:                 Audio{Device: pointer.String(AudioDeviceHDA), Backend: pointer.String("coreaudio")},
+		SerialCount:           pointer.Int(2),
+		USB:                   []USBDevice{{VendorID: "0x0781", ProductID: "0x5567"}},
+		PCIPassthrough:        []string{"0000:01:00.0"},
+		ISOs:                  []string{"/d/tools.iso"},
+		BootProgressMarkers:   []BootProgressMarker{{Pattern: "d-marker", Progress: 50}},
+		ResourceUsage:         ResourceUsage{Interval: pointer.Int(30)},
+		GuestAgent:            GuestAgent{ReconnectInterval: pointer.Int(20)},
+		Heartbeat:             Heartbeat{Interval: pointer.Int(30)},
+		AutoStop:              AutoStop{IdleTimeout: pointer.Int(1800)},
+		PortForwardPolicy:     pointer.String(PortForwardPolicyDeny),
+		PortForwardOnConflict: pointer.String(PortForwardOnConflictRemap),
+		MountType:             pointer.String(NFS),
+		SSHFS:                 SSHFS{Cache: pointer.Bool(false), FollowSymlinks: pointer.Bool(true), Options: []string{"reconnect"}},
+		CloudInit: CloudInit{
+			UserData: pointer.String("/d/user-data"),
+		},
+		RequireAcceleration: pointer.Bool(true),
+		Downloader: Downloader{
+			Proxy:  pointer.String("socks5://127.0.0.1:1080"),
+			CACert: pointer.String("/etc/ssl/d.pem"),
+		},
+		QEMU: QEMU{
+			Machine:   pointer.String("pc"),
+			Accel:     pointer.String("kvm"),
+			ExtraArgs: []string{"-device", "virtio-rng-pci"},
 		},
 		UseHostResolver:   pointer.Bool(false),
 		PropagateProxyEnv: pointer.Bool(false),
@@ -206,6 +410,10 @@ func TestFillDefault(t *testing.T) {
 				Description: "User Probe",
 			},
 		},
+		Network: UserNetwork{
+			IPv6:     pointer.Bool(true),
+			HostBind: net.IPv4zero,
+		},
 		Networks: []Network{
 			{
 				VNL:        "/tmp/vde.ctl",
@@ -230,11 +438,28 @@ func TestFillDefault(t *testing.T) {
 			"ONE": "one",
 			"TWO": "two",
 		},
+		Hostname: pointer.String("d-hostname"),
+		Timezone: pointer.String("Asia/Tokyo"),
+		RTC:      pointer.String(RTCLocaltime),
+		Kernel:   pointer.String("/boot/d-vmlinuz"),
+		Initrd:   pointer.String("/boot/d-initrd.img"),
+		Cmdline:  pointer.String("d-cmdline"),
 	}
 
 	expect = d
+	// The MAC address of the user-mode network is never taken from d
+	expect.Network.MACAddress = MACAddress(instDir)
+	// The hostname is never taken from d
+	expect.Hostname = pointer.String("lima-" + instName)
 	// Also verify that archive arch is filled in
 	expect.Containerd.Archives[0].Arch = *d.Arch
+	// The sshfs options of d are applied to the mounts
+	expect.Mounts = []Mount{
+		{
+			Location: "/var/log",
+			SSHFS:    d.SSHFS,
+		},
+	}
 
 	y = LimaYAML{}
 	FillDefault(&y, &d, &LimaYAML{}, filePath)
@@ -252,9 +477,30 @@ func TestFillDefault(t *testing.T) {
 	expect.Probes = append(y.Probes, d.Probes...)
 	expect.PortForwards = append(y.PortForwards, d.PortForwards...)
 	expect.Containerd.Archives = append(y.Containerd.Archives, d.Containerd.Archives...)
+	expect.Containerd.PrePull = append(y.Containerd.PrePull, d.Containerd.PrePull...)
+	expect.QEMU.ExtraArgs = append(y.QEMU.ExtraArgs, d.QEMU.ExtraArgs...)
+	expect.USB = append(y.USB, d.USB...)
+	expect.PCIPassthrough = append(y.PCIPassthrough, d.PCIPassthrough...)
+	expect.ISOs = append(y.ISOs, d.ISOs...)
+	// NUMA nodes are picked from d, as y doesn't have any
+	expect.NUMA = d.NUMA
+	// CPU pinning is picked from d, as y doesn't have any
+	expect.CPU.Pinning = d.CPU.Pinning
+
+	// SSHFS options are picked from d, as y doesn't have any
+	expect.SSHFS.Options = d.SSHFS.Options
 
 	// Mounts and Networks start with lowest priority first, so higher priority entries can overwrite
-	expect.Mounts = append(d.Mounts, y.Mounts...)
+	expect.Mounts = []Mount{
+		{
+			Location: "/var/log",
+			SSHFS:    SSHFS{Cache: y.SSHFS.Cache, FollowSymlinks: y.SSHFS.FollowSymlinks, Options: d.SSHFS.Options},
+		},
+		{
+			Location: "/tmp",
+			SSHFS:    SSHFS{Cache: y.SSHFS.Cache, FollowSymlinks: y.SSHFS.FollowSymlinks, Options: d.SSHFS.Options},
+		},
+	}
 	expect.Networks = append(d.Networks, y.Networks...)
 
 	// d.DNS will be ignored, and not appended to y.DNS
@@ -269,10 +515,19 @@ func TestFillDefault(t *testing.T) {
 	// User-provided overrides should override user-provided config settings
 
 	o = LimaYAML{
-		Arch:   pointer.String(arch),
-		CPUs:   pointer.Int(12),
-		Memory: pointer.String("7GiB"),
-		Disk:   pointer.String("117GiB"),
+		Arch:          pointer.String(arch),
+		CPUs:          pointer.Int(12),
+		MaxCPUs:       pointer.Int(16),
+		CPU:           CPU{Sockets: pointer.Int(1), Threads: pointer.Int(2), Pinning: map[int]int{0: 4}},
+		Memory:        pointer.String("7GiB"),
+		NUMA:          []NUMANode{{CPUs: 12, Memory: "7GiB"}},
+		MemoryBackend: pointer.String(MemoryBackendRAM),
+		MemoryBalloon: pointer.Bool(false),
+		Disk:          pointer.String("117GiB"),
+		DiskCache:     pointer.String(DiskCacheNone),
+		DiskFormat:    pointer.String(DiskFormatQCOW2),
+		DiskAIO:       pointer.String(DiskAIONative),
+		DiskDiscard:   pointer.String(DiskDiscardIgnore),
 		Containerd: Containerd{
 			System: pointer.Bool(true),
 			User:   pointer.Bool(false),
@@ -283,17 +538,60 @@ func TestFillDefault(t *testing.T) {
 					Digest:   "$DIGEST",
 				},
 			},
+			PrePull: []string{"busybox"},
 		},
 		SSH: SSH{
-			LocalPort:         pointer.Int(4433),
-			LoadDotSSHPubKeys: pointer.Bool(true),
-			ForwardAgent:      pointer.Bool(true),
+			LocalPort:             pointer.Int(4433),
+			LoadDotSSHPubKeys:     pointer.Bool(true),
+			ForwardAgent:          pointer.Bool(true),
+			StrictHostKeyChecking: pointer.Bool(false),
+			Address:               pointer.String("192.168.5.3"),
+			ProxyJump:             pointer.String("o-jump"),
 		},
 		Firmware: Firmware{
 			LegacyBIOS: pointer.Bool(true),
+			Code:       pointer.String("/o/OVMF_CODE.fd"),
+			Vars:       pointer.String(""),
+			SecureBoot: pointer.Bool(false),
+		},
+		Boot: Boot{
+			Order:      pointer.String("n"),
+			Menu:       pointer.Bool(true),
+			SplashTime: pointer.Int(3000),
 		},
 		Video: Video{
-			Display: pointer.String("cocoa"),
+			Display:    pointer.String("cocoa"),
+			VNC:        VNC{Enabled: pointer.Bool(true), Address: pointer.String("::1"), Display: pointer.Int(2)},
+			SPICE:      SPICE{Enabled: pointer.Bool(false)},
+			Resolution: pointer.String("1280x800"),
+			VRAM:       pointer.Int(0),
+		},
+		Audio:                 Audio{Device: pointer.String(AudioDeviceAC97), Backend: pointer.String("alsa")},
+		SerialCount:           pointer.Int(3),
+		USB:                   []USBDevice{{HostBus: 1, HostAddr: 2}},
+		PCIPassthrough:        []string{"0000:02:00.0"},
+		ISOs:                  []string{"/o/drivers.iso"},
+		BootProgressMarkers:   []BootProgressMarker{{Pattern: "o-marker", Progress: 60}},
+		ResourceUsage:         ResourceUsage{Interval: pointer.Int(10)},
+		GuestAgent:            GuestAgent{ReconnectInterval: pointer.Int(5)},
+		Heartbeat:             Heartbeat{Interval: pointer.Int(15)},
+		AutoStop:              AutoStop{IdleTimeout: pointer.Int(600)},
+		PortForwardPolicy:     pointer.String(PortForwardPolicyAllow),
+		PortForwardOnConflict: pointer.String(PortForwardOnConflictSkip),
+		MountType:             pointer.String(ReverseSSHFS),
+		SSHFS:                 SSHFS{Cache: pointer.Bool(true), FollowSymlinks: pointer.Bool(false), Options: []string{"ServerAliveInterval=15"}},
+		CloudInit: CloudInit{
+			UserData: pointer.String("/o/user-data"),
+		},
+		RequireAcceleration: pointer.Bool(false),
+		Downloader: Downloader{
+			Proxy:  pointer.String("http://proxy.example.com:3128"),
+			CACert: pointer.String("/etc/ssl/o.pem"),
+		},
+		QEMU: QEMU{
+			Machine:   pointer.String("pc-q35-6.2"),
+			Accel:     pointer.String("tcg"),
+			ExtraArgs: []string{"-device", "virtio-balloon"},
 		},
 		UseHostResolver:   pointer.Bool(false),
 		PropagateProxyEnv: pointer.Bool(false),
@@ -302,6 +600,7 @@ func TestFillDefault(t *testing.T) {
 			{
 				Location: "/var/log",
 				Writable: true,
+				SSHFS:    SSHFS{FollowSymlinks: pointer.Bool(true), Options: []string{"reconnect"}},
 			},
 		},
 		Provision: []Provision{
@@ -317,6 +616,10 @@ func TestFillDefault(t *testing.T) {
 				Description: "Another Probe",
 			},
 		},
+		Network: UserNetwork{
+			IPv6:     pointer.Bool(false),
+			HostBind: net.ParseIP("192.168.1.10"),
+		},
 		Networks: []Network{
 			{
 				Lima:       "shared",
@@ -344,20 +647,44 @@ func TestFillDefault(t *testing.T) {
 			"TWO":   "deux",
 			"THREE": "trois",
 		},
+		Hostname: pointer.String("o-hostname"),
+		Timezone: pointer.String("Europe/Berlin"),
+		RTC:      pointer.String("2020-01-01T00:00:00"),
+		Kernel:   pointer.String("/boot/o-vmlinuz"),
+		Initrd:   pointer.String("/boot/o-initrd.img"),
+		Cmdline:  pointer.String("o-cmdline"),
 	}
 
 	y = filledDefaults
 
 	expect = o
+	// The MAC address of the user-mode network is never taken from o
+	expect.Network.MACAddress = y.Network.MACAddress
+	// The hostname is never taken from o
+	expect.Hostname = y.Hostname
 
 	expect.Provision = append(append(o.Provision, y.Provision...), d.Provision...)
 	expect.Probes = append(append(o.Probes, y.Probes...), d.Probes...)
 	expect.PortForwards = append(append(o.PortForwards, y.PortForwards...), d.PortForwards...)
 	expect.Containerd.Archives = append(append(o.Containerd.Archives, y.Containerd.Archives...), d.Containerd.Archives...)
-
-	// o.Mounts just makes d.Mounts[0] writable because the Location matches
-	expect.Mounts = append(d.Mounts, y.Mounts...)
-	expect.Mounts[0].Writable = true
+	expect.Containerd.PrePull = append(append(o.Containerd.PrePull, y.Containerd.PrePull...), d.Containerd.PrePull...)
+	expect.QEMU.ExtraArgs = append(append(o.QEMU.ExtraArgs, y.QEMU.ExtraArgs...), d.QEMU.ExtraArgs...)
+	expect.USB = append(append(o.USB, y.USB...), d.USB...)
+	expect.PCIPassthrough = append(append(o.PCIPassthrough, y.PCIPassthrough...), d.PCIPassthrough...)
+	expect.ISOs = append(append(o.ISOs, y.ISOs...), d.ISOs...)
+
+	// o.Mounts just makes d.Mounts[0] writable, and adds an sshfs option, because the Location matches
+	expect.Mounts = []Mount{
+		{
+			Location: "/var/log",
+			Writable: true,
+			SSHFS:    SSHFS{Cache: o.SSHFS.Cache, FollowSymlinks: pointer.Bool(true), Options: []string{"ServerAliveInterval=15", "reconnect"}},
+		},
+		{
+			Location: "/tmp",
+			SSHFS:    o.SSHFS,
+		},
+	}
 
 	// o.Networks[1] is overriding the d.Networks[0].Lima entry for the "def0" interface
 	expect.Networks = append(append(d.Networks, y.Networks...), o.Networks[0])
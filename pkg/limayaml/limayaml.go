@@ -7,26 +7,66 @@ import (
 )
 
 type LimaYAML struct {
-	Arch              *Arch             `yaml:"arch,omitempty" json:"arch,omitempty"`
-	Images            []File            `yaml:"images" json:"images"` // REQUIRED
-	CPUs              *int              `yaml:"cpus,omitempty" json:"cpus,omitempty"`
-	Memory            *string           `yaml:"memory,omitempty" json:"memory,omitempty"` // go-units.RAMInBytes
-	Disk              *string           `yaml:"disk,omitempty" json:"disk,omitempty"`     // go-units.RAMInBytes
-	Mounts            []Mount           `yaml:"mounts,omitempty" json:"mounts,omitempty"`
-	SSH               SSH               `yaml:"ssh,omitempty" json:"ssh,omitempty"` // REQUIRED (FIXME)
-	Firmware          Firmware          `yaml:"firmware,omitempty" json:"firmware,omitempty"`
-	Video             Video             `yaml:"video,omitempty" json:"video,omitempty"`
-	Provision         []Provision       `yaml:"provision,omitempty" json:"provision,omitempty"`
-	Containerd        Containerd        `yaml:"containerd,omitempty" json:"containerd,omitempty"`
-	Probes            []Probe           `yaml:"probes,omitempty" json:"probes,omitempty"`
-	PortForwards      []PortForward     `yaml:"portForwards,omitempty" json:"portForwards,omitempty"`
-	Message           string            `yaml:"message,omitempty" json:"message,omitempty"`
-	Networks          []Network         `yaml:"networks,omitempty" json:"networks,omitempty"`
-	Network           NetworkDeprecated `yaml:"network,omitempty" json:"network,omitempty"` // DEPRECATED, use `networks` instead
-	Env               map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
-	DNS               []net.IP          `yaml:"dns,omitempty" json:"dns,omitempty"`
-	UseHostResolver   *bool             `yaml:"useHostResolver,omitempty" json:"useHostResolver,omitempty"`
-	PropagateProxyEnv *bool             `yaml:"propagateProxyEnv,omitempty" json:"propagateProxyEnv,omitempty"`
+	Arch                  *Arch                  `yaml:"arch,omitempty" json:"arch,omitempty"`
+	RequireAcceleration   *bool                  `yaml:"requireAcceleration,omitempty" json:"requireAcceleration,omitempty"`
+	Images                []File                 `yaml:"images" json:"images"` // REQUIRED
+	Downloader            Downloader             `yaml:"downloader,omitempty" json:"downloader,omitempty"`
+	CPUs                  *int                   `yaml:"cpus,omitempty" json:"cpus,omitempty"`
+	MaxCPUs               *int                   `yaml:"maxCPUs,omitempty" json:"maxCPUs,omitempty"`
+	CPU                   CPU                    `yaml:"cpu,omitempty" json:"cpu,omitempty"`
+	Memory                *string                `yaml:"memory,omitempty" json:"memory,omitempty"` // go-units.RAMInBytes
+	MemoryBalloon         *bool                  `yaml:"memoryBalloon,omitempty" json:"memoryBalloon,omitempty"`
+	NUMA                  []NUMANode             `yaml:"numa,omitempty" json:"numa,omitempty"`
+	USB                   []USBDevice            `yaml:"usb,omitempty" json:"usb,omitempty"`
+	PCIPassthrough        []string               `yaml:"pciPassthrough,omitempty" json:"pciPassthrough,omitempty"`
+	MemoryBackend         *MemoryBackend         `yaml:"memoryBackend,omitempty" json:"memoryBackend,omitempty"`
+	Disk                  *string                `yaml:"disk,omitempty" json:"disk,omitempty"` // go-units.RAMInBytes
+	DiskCache             *DiskCache             `yaml:"diskCache,omitempty" json:"diskCache,omitempty"`
+	DiskFormat            *DiskFormat            `yaml:"diskFormat,omitempty" json:"diskFormat,omitempty"`
+	DiskAIO               *DiskAIO               `yaml:"diskAIO,omitempty" json:"diskAIO,omitempty"`
+	DiskDiscard           *DiskDiscard           `yaml:"diskDiscard,omitempty" json:"diskDiscard,omitempty"`
+	Mounts                []Mount                `yaml:"mounts,omitempty" json:"mounts,omitempty"`
+	MountType             *MountType             `yaml:"mountType,omitempty" json:"mountType,omitempty"`
+	SSHFS                 SSHFS                  `yaml:"sshfs,omitempty" json:"sshfs,omitempty"`
+	SSH                   SSH                    `yaml:"ssh,omitempty" json:"ssh,omitempty"` // REQUIRED (FIXME)
+	Firmware              Firmware               `yaml:"firmware,omitempty" json:"firmware,omitempty"`
+	Boot                  Boot                   `yaml:"boot,omitempty" json:"boot,omitempty"`
+	Kernel                *string                `yaml:"kernel,omitempty" json:"kernel,omitempty"`
+	Initrd                *string                `yaml:"initrd,omitempty" json:"initrd,omitempty"`
+	Cmdline               *string                `yaml:"cmdline,omitempty" json:"cmdline,omitempty"`
+	ISOs                  []string               `yaml:"isos,omitempty" json:"isos,omitempty"`
+	Video                 Video                  `yaml:"video,omitempty" json:"video,omitempty"`
+	Audio                 Audio                  `yaml:"audio,omitempty" json:"audio,omitempty"`
+	SerialCount           *int                   `yaml:"serialCount,omitempty" json:"serialCount,omitempty"`
+	BootProgressMarkers   []BootProgressMarker   `yaml:"bootProgressMarkers,omitempty" json:"bootProgressMarkers,omitempty"`
+	QEMU                  QEMU                   `yaml:"qemu,omitempty" json:"qemu,omitempty"`
+	Provision             []Provision            `yaml:"provision,omitempty" json:"provision,omitempty"`
+	CloudInit             CloudInit              `yaml:"cloudInit,omitempty" json:"cloudInit,omitempty"`
+	Containerd            Containerd             `yaml:"containerd,omitempty" json:"containerd,omitempty"`
+	Probes                []Probe                `yaml:"probes,omitempty" json:"probes,omitempty"`
+	PortForwards          []PortForward          `yaml:"portForwards,omitempty" json:"portForwards,omitempty"`
+	PortForwardPolicy     *PortForwardPolicy     `yaml:"portForwardPolicy,omitempty" json:"portForwardPolicy,omitempty"`
+	PortForwardOnConflict *PortForwardOnConflict `yaml:"portForwardOnConflict,omitempty" json:"portForwardOnConflict,omitempty"`
+	Message               string                 `yaml:"message,omitempty" json:"message,omitempty"`
+	Hostname              *string                `yaml:"hostname,omitempty" json:"hostname,omitempty"`
+	Timezone              *string                `yaml:"timezone,omitempty" json:"timezone,omitempty"`
+	RTC                   *string                `yaml:"rtc,omitempty" json:"rtc,omitempty"`
+	Networks              []Network              `yaml:"networks,omitempty" json:"networks,omitempty"`
+	Network               UserNetwork            `yaml:"network,omitempty" json:"network,omitempty"`
+	Env                   map[string]string      `yaml:"env,omitempty" json:"env,omitempty"`
+	DNS                   []net.IP               `yaml:"dns,omitempty" json:"dns,omitempty"`
+	UseHostResolver       *bool                  `yaml:"useHostResolver,omitempty" json:"useHostResolver,omitempty"`
+	PropagateProxyEnv     *bool                  `yaml:"propagateProxyEnv,omitempty" json:"propagateProxyEnv,omitempty"`
+	ResourceUsage         ResourceUsage          `yaml:"resourceUsage,omitempty" json:"resourceUsage,omitempty"`
+	GuestAgent            GuestAgent             `yaml:"guestAgent,omitempty" json:"guestAgent,omitempty"`
+	Heartbeat             Heartbeat              `yaml:"heartbeat,omitempty" json:"heartbeat,omitempty"`
+	AutoStop              AutoStop               `yaml:"autoStop,omitempty" json:"autoStop,omitempty"`
+	// legacyHostname will be true when `hostname` has been set to the unsanitized "lima-<INSTANCE>" by FillDefault(),
+	// for an instance that was created before the default hostname was sanitized
+	legacyHostname bool
+	// skippedEnv contains the keys of `env` that have been removed by FillDefault() for an existing instance,
+	// as their values contain the characters that were accepted before ValidateEnv rejected them
+	skippedEnv []string
 }
 
 type Arch = string
@@ -37,14 +77,77 @@ const (
 )
 
 type File struct {
-	Location string        `yaml:"location" json:"location"` // REQUIRED
-	Arch     Arch          `yaml:"arch,omitempty" json:"arch,omitempty"`
-	Digest   digest.Digest `yaml:"digest,omitempty" json:"digest,omitempty"`
+	Location string `yaml:"location,omitempty" json:"location,omitempty"` // REQUIRED, unless Locations is set
+	// Locations are the mirrors of Location, tried in order after Location.
+	// All the mirrors must serve the same content, matching Digest.
+	Locations []string      `yaml:"locations,omitempty" json:"locations,omitempty"`
+	Arch      Arch          `yaml:"arch,omitempty" json:"arch,omitempty"`
+	Digest    digest.Digest `yaml:"digest,omitempty" json:"digest,omitempty"`
+}
+
+// Mirrors returns Location followed by Locations.
+func (f *File) Mirrors() []string {
+	var res []string
+	if f.Location != "" {
+		res = append(res, f.Location)
+	}
+	return append(res, f.Locations...)
+}
+
+type Downloader struct {
+	// Proxy is the proxy URL for downloading images and archives.
+	// Takes precedence over $HTTPS_PROXY and $HTTP_PROXY; $NO_PROXY is still honored.
+	Proxy *string `yaml:"proxy,omitempty" json:"proxy,omitempty"`
+	// CACert is the path of a PEM bundle of the CA certificates to be trusted in addition to the system ones
+	CACert *string `yaml:"caCert,omitempty" json:"caCert,omitempty"`
+}
+
+// BootProgressMarker is a line of the serial console log that indicates the progress of the boot.
+type BootProgressMarker struct {
+	Pattern  string `yaml:"pattern" json:"pattern"`   // regular expression, matched against each line
+	Progress int    `yaml:"progress" json:"progress"` // 1-100
+}
+
+type ResourceUsage struct {
+	// Interval is the interval in seconds for sampling the CPU and memory usage of the guest.
+	// 0 disables sampling.
+	Interval *int `yaml:"interval,omitempty" json:"interval,omitempty"`
+}
+
+type GuestAgent struct {
+	// ReconnectInterval is the interval in seconds for (re)connecting to the guest agent.
+	ReconnectInterval *int `yaml:"reconnectInterval,omitempty" json:"reconnectInterval,omitempty"`
+}
+
+type AutoStop struct {
+	// IdleTimeout is the duration in seconds without interactive sessions and forwarded connections,
+	// after which the instance is stopped. 0 disables stopping.
+	IdleTimeout *int `yaml:"idleTimeout,omitempty" json:"idleTimeout,omitempty"`
+}
+
+type Heartbeat struct {
+	// Interval is the interval in seconds for re-emitting the last status of the host agent.
+	// 0 disables the heartbeat.
+	Interval *int `yaml:"interval,omitempty" json:"interval,omitempty"`
 }
 
 type Mount struct {
 	Location string `yaml:"location" json:"location"` // REQUIRED
 	Writable bool   `yaml:"writable,omitempty" json:"writable,omitempty"`
+	// SSHFS overrides the top-level `sshfs` for this mount
+	SSHFS SSHFS `yaml:"sshfs,omitempty" json:"sshfs,omitempty"`
+}
+
+// SSHFS is the options of sshfs for the "reverse-sshfs" mounts.
+type SSHFS struct {
+	// Cache enables the cache of sshfs; disable it to see the changes made on the host without delay
+	Cache *bool `yaml:"cache,omitempty" json:"cache,omitempty"`
+	// FollowSymlinks resolves the symlinks on the host, so that the guest sees the targets instead of the symlinks,
+	// including the targets outside the mount
+	FollowSymlinks *bool `yaml:"followSymlinks,omitempty" json:"followSymlinks,omitempty"`
+	// Options are the extra `-o` options of sshfs, e.g. "reconnect" or "ServerAliveInterval=15".
+	// The options of a mount are appended to the top-level ones.
+	Options []string `yaml:"options,omitempty" json:"options,omitempty"`
 }
 
 type SSH struct {
@@ -53,19 +156,122 @@ type SSH struct {
 	// LoadDotSSHPubKeys loads ~/.ssh/*.pub in addition to $LIMA_HOME/_config/user.pub .
 	LoadDotSSHPubKeys *bool `yaml:"loadDotSSHPubKeys,omitempty" json:"loadDotSSHPubKeys,omitempty"` // default: true
 	ForwardAgent      *bool `yaml:"forwardAgent,omitempty" json:"forwardAgent,omitempty"`           // default: false
+	// StrictHostKeyChecking pins the host key of the guest on the first connection.
+	StrictHostKeyChecking *bool `yaml:"strictHostKeyChecking,omitempty" json:"strictHostKeyChecking,omitempty"` // default: false
+	// Address is the IP address of the host that LocalPort is bound to, and that the SSH clients connect to.
+	Address *string `yaml:"address,omitempty" json:"address,omitempty"` // default: "127.0.0.1"
+	// ProxyJump is the jump host(s) to connect to Address through, in the format of `ssh -J`,
+	// i.e., "[user@]host[:port]", separated by commas.
+	ProxyJump *string `yaml:"proxyJump,omitempty" json:"proxyJump,omitempty"` // default: ""
 }
 
 type Firmware struct {
 	// LegacyBIOS disables UEFI if set.
 	// LegacyBIOS is ignored for aarch64.
 	LegacyBIOS *bool `yaml:"legacyBIOS,omitempty" json:"legacyBIOS,omitempty"`
+	// Code is the path of the UEFI firmware code. Empty means searching the firmware installed with QEMU.
+	Code *string `yaml:"code,omitempty" json:"code,omitempty"`
+	// Vars is the path of the template of the UEFI variable store, copied to the instance directory on the first boot.
+	// Empty means the template installed with the firmware, when Code is empty too.
+	Vars *string `yaml:"vars,omitempty" json:"vars,omitempty"`
+	// SecureBoot selects the firmware with Secure Boot, and the variable store with the Microsoft keys enrolled.
+	// On x86_64, SMM is enabled too.
+	SecureBoot *bool `yaml:"secureBoot,omitempty" json:"secureBoot,omitempty"`
+}
+
+type Boot struct {
+	// Order is the QEMU boot order, e.g. "cd". Empty means "d" for an ISO image, "c" otherwise.
+	Order      *string `yaml:"order,omitempty" json:"order,omitempty"`
+	Menu       *bool   `yaml:"menu,omitempty" json:"menu,omitempty"`
+	SplashTime *int    `yaml:"splashTime,omitempty" json:"splashTime,omitempty"` // milliseconds
+}
+
+// USBDevice is a USB device of the host to be passed through to the guest.
+// Either VendorID and ProductID, or HostBus and HostAddr have to be set.
+type USBDevice struct {
+	VendorID  string `yaml:"vendorID,omitempty" json:"vendorID,omitempty"`   // hex, e.g. "0x0781"
+	ProductID string `yaml:"productID,omitempty" json:"productID,omitempty"` // hex, e.g. "0x5567"
+	HostBus   int    `yaml:"hostBus,omitempty" json:"hostBus,omitempty"`
+	HostAddr  int    `yaml:"hostAddr,omitempty" json:"hostAddr,omitempty"`
+}
+
+// CPU is the topology of the CPUs of the guest.
+// The number of the cores per socket is MaxCPUs / (Sockets * Threads).
+type CPU struct {
+	Sockets *int `yaml:"sockets,omitempty" json:"sockets,omitempty"`
+	// Threads is the number of the threads per core (SMT)
+	Threads *int `yaml:"threads,omitempty" json:"threads,omitempty"`
+	// Pinning maps the vCPU indexes to the host CPUs that the vCPU threads are pinned to (Linux hosts only)
+	Pinning map[int]int `yaml:"pinning,omitempty" json:"pinning,omitempty"`
+}
+
+// NUMANode is a NUMA node of the guest. The CPUs are assigned to the nodes in order.
+type NUMANode struct {
+	CPUs   int    `yaml:"cpus" json:"cpus"`
+	Memory string `yaml:"memory" json:"memory"` // go-units.RAMInBytes
+}
+
+type QEMU struct {
+	// Machine is the QEMU machine type, e.g. "q35", "pc", or "pc-q35-6.2".
+	// Lima appends the accelerator (and "highmem=off" for aarch64) as machine options.
+	Machine *string `yaml:"machine,omitempty" json:"machine,omitempty"`
+	// Accel overrides the accelerator, e.g. "tcg". Empty means the hardware accelerator of the host
+	// ("kvm", "hvf", ...) for the native arch, and "tcg" otherwise.
+	Accel *string `yaml:"accel,omitempty" json:"accel,omitempty"`
+	// ExtraArgs are appended verbatim to the QEMU command line, without any validation
+	ExtraArgs []string `yaml:"extraArgs,omitempty" json:"extraArgs,omitempty"`
 }
 
 type Video struct {
-	// Display is a QEMU display string
+	// Display is a QEMU display string. DisplayNone runs the guest without a display window.
 	Display *string `yaml:"display,omitempty" json:"display,omitempty"`
+	VNC     VNC     `yaml:"vnc,omitempty" json:"vnc,omitempty"`
+	SPICE   SPICE   `yaml:"spice,omitempty" json:"spice,omitempty"`
+	// Resolution is the resolution of the video device, e.g., "1920x1080". Empty means the QEMU default.
+	Resolution *string `yaml:"resolution,omitempty" json:"resolution,omitempty"`
+	// VRAM is the video memory in MiB. 0 means the QEMU default (16 MiB).
+	VRAM *int `yaml:"vram,omitempty" json:"vram,omitempty"`
+}
+
+// AccelTCG is the accelerator of QEMU that emulates the guest without hardware acceleration.
+const AccelTCG = "tcg"
+
+// DisplayNone is the QEMU display that does not open any window on the host.
+// The video device is still attached, so VNC and SPICE can be used in addition.
+const DisplayNone = "none"
+
+// VNCBasePort is the TCP port of the VNC display 0.
+const VNCBasePort = 5900
+
+type SPICE struct {
+	// Enabled exposes the guest display on "spice.sock" in the instance directory
+	Enabled *bool `yaml:"enabled,omitempty" json:"enabled,omitempty"`
 }
 
+type VNC struct {
+	Enabled *bool `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+	// Address is the listen address (loopback IP)
+	Address *string `yaml:"address,omitempty" json:"address,omitempty"`
+	// Display is the VNC display number; the TCP port is VNCBasePort + Display
+	Display *int `yaml:"display,omitempty" json:"display,omitempty"`
+}
+
+type Audio struct {
+	// Device is the audio device of the guest: "none", "hda", or "ac97"
+	Device *AudioDevice `yaml:"device,omitempty" json:"device,omitempty"`
+	// Backend is the QEMU audiodev driver of the host, e.g. "coreaudio", "pa", "alsa".
+	// Empty means the default of the host OS.
+	Backend *string `yaml:"backend,omitempty" json:"backend,omitempty"`
+}
+
+type AudioDevice = string
+
+const (
+	AudioDeviceNone AudioDevice = "none"
+	AudioDeviceHDA  AudioDevice = "hda"
+	AudioDeviceAC97 AudioDevice = "ac97"
+)
+
 type ProvisionMode = string
 
 const (
@@ -78,10 +284,17 @@ type Provision struct {
 	Script string        `yaml:"script" json:"script"`
 }
 
+type CloudInit struct {
+	// UserData is the path of a cloud-config file to be merged into the user-data generated by Lima
+	UserData *string `yaml:"userData,omitempty" json:"userData,omitempty"`
+}
+
 type Containerd struct {
 	System   *bool  `yaml:"system,omitempty" json:"system,omitempty"`     // default: false
 	User     *bool  `yaml:"user,omitempty" json:"user,omitempty"`         // default: true
 	Archives []File `yaml:"archives,omitempty" json:"archives,omitempty"` // default: see defaultContainerdArchives
+	// PrePull lists the images to be pulled with nerdctl after the boot has completed
+	PrePull []string `yaml:"prePull,omitempty" json:"prePull,omitempty"`
 }
 
 type ProbeMode = string
@@ -97,12 +310,110 @@ type Probe struct {
 	Hint        string
 }
 
+// MemoryBackend is the backing of the guest memory
+type MemoryBackend = string
+
+const (
+	MemoryBackendRAM MemoryBackend = "ram"
+	// MemoryBackendHugepages backs the guest memory with the hugetlbfs mounted on /dev/hugepages (Linux only)
+	MemoryBackendHugepages MemoryBackend = "hugepages"
+)
+
+const (
+	// RTCUTC sets the real-time clock of the guest to UTC
+	RTCUTC = "utc"
+	// RTCLocaltime sets the real-time clock of the guest to the local time of the host
+	RTCLocaltime = "localtime"
+	// RTCTimeFormat is the format of a fixed base time of the real-time clock, e.g. "2020-01-01T00:00:00"
+	RTCTimeFormat = "2006-01-02T15:04:05"
+)
+
+// MountType is the file sharing mechanism used for Mounts
+type MountType = string
+
+const (
+	ReverseSSHFS MountType = "reverse-sshfs"
+	// NFS exports the mounts from the NFS server of the host (Linux and macOS hosts only)
+	NFS MountType = "nfs"
+)
+
+// DiskAIO is the QEMU asynchronous I/O mode of the root disk
+type DiskAIO = string
+
+const (
+	DiskAIOThreads DiskAIO = "threads"
+	// DiskAIONative requires the host page cache to be bypassed (`diskCache: none` or `directsync`)
+	DiskAIONative DiskAIO = "native"
+	// DiskAIOIOURing is only supported on Linux hosts
+	DiskAIOIOURing DiskAIO = "io_uring"
+)
+
+// DiskDiscard is the QEMU handling of the discard (TRIM) requests of the guest for the root disk
+type DiskDiscard = string
+
+const (
+	DiskDiscardIgnore DiskDiscard = "ignore"
+	DiskDiscardUnmap  DiskDiscard = "unmap"
+)
+
+// DiskFormat is the image format of the disk of the instance ("diffdisk")
+type DiskFormat = string
+
+const (
+	// DiskFormatQCOW2 is a copy-on-write image backed by the base image, growing on demand
+	DiskFormatQCOW2 DiskFormat = "qcow2"
+	// DiskFormatRaw is a preallocated full-size copy of the base image, for the maximum I/O performance
+	DiskFormatRaw DiskFormat = "raw"
+)
+
+// DiskCache is the QEMU cache mode of the root disk
+type DiskCache = string
+
+const (
+	DiskCacheNone         DiskCache = "none"
+	DiskCacheWriteback    DiskCache = "writeback"
+	DiskCacheWritethrough DiskCache = "writethrough"
+	DiskCacheUnsafe       DiskCache = "unsafe"
+	DiskCacheDirectsync   DiskCache = "directsync"
+)
+
 type Proto = string
 
 const (
 	TCP Proto = "tcp"
+	// UDP ports are forwarded statically by the QEMU user-mode network stack,
+	// not by the guest agent.
+	UDP Proto = "udp"
+)
+
+// MaxSerialCount is the maximum number of serial ports on x86_64.
+// aarch64 ("virt" machine) only supports a single serial port.
+const MaxSerialCount = 4
+
+// PortForwardPolicy decides whether the guest ports that do not match any of `portForwards` are forwarded
+type PortForwardPolicy = string
+
+const (
+	// PortForwardPolicyAllow forwards the ports on 127.0.0.1 of the guest that do not match any rule
+	PortForwardPolicyAllow PortForwardPolicy = "allow"
+	// PortForwardPolicyDeny only forwards the ports that match a rule without `ignore`
+	PortForwardPolicyDeny PortForwardPolicy = "deny"
+)
+
+// PortForwardOnConflict decides what to do when the host address of a forwarded TCP port is already in use
+type PortForwardOnConflict = string
+
+const (
+	// PortForwardOnConflictSkip does not forward the port, and reports the conflict in the status of the host agent
+	PortForwardOnConflictSkip PortForwardOnConflict = "skip"
+	// PortForwardOnConflictRemap forwards the port to a free port on the same host IP
+	PortForwardOnConflictRemap PortForwardOnConflict = "remap"
 )
 
+// MaxUDPPortRange is the maximum number of ports that a single UDP port forwarding rule can cover,
+// as each port is a separate QEMU hostfwd rule.
+const MaxUDPPortRange = 100
+
 type PortForward struct {
 	GuestIP        net.IP `yaml:"guestIP,omitempty" json:"guestIP,omitempty"`
 	GuestPort      int    `yaml:"guestPort,omitempty" json:"guestPort,omitempty"`
@@ -114,11 +425,15 @@ type PortForward struct {
 	HostSocket     string `yaml:"hostSocket,omitempty" json:"hostSocket,omitempty"`
 	Proto          Proto  `yaml:"proto,omitempty" json:"proto,omitempty"`
 	Ignore         bool   `yaml:"ignore,omitempty" json:"ignore,omitempty"`
+	// Reverse forwards from the host to the guest (`ssh -R`) instead of from the guest to the host.
+	Reverse bool `yaml:"reverse,omitempty" json:"reverse,omitempty"`
 }
 
 type Network struct {
-	// `Lima` and `VNL` are mutually exclusive; exactly one is required
+	// `Lima`, `VNL`, and `Bridge` are mutually exclusive; exactly one is required
 	Lima string `yaml:"lima,omitempty" json:"lima,omitempty"`
+	// Bridge is the name of a host bridge interface (Linux only), connected via qemu-bridge-helper.
+	Bridge string `yaml:"bridge,omitempty" json:"bridge,omitempty"`
 	// VNL is a Virtual Network Locator (https://github.com/rd235/vdeplug4/commit/089984200f447abb0e825eb45548b781ba1ebccd).
 	// On macOS, only VDE2-compatible form (optionally with vde:// prefix) is supported.
 	VNL        string `yaml:"vnl,omitempty" json:"vnl,omitempty"`
@@ -127,6 +442,17 @@ type Network struct {
 	Interface  string `yaml:"interface,omitempty" json:"interface,omitempty"`
 }
 
+// UserNetwork is the user-mode network interface, which is used for SSH and port forwarding.
+type UserNetwork struct {
+	MACAddress string `yaml:"macAddress,omitempty" json:"macAddress,omitempty"`
+	// IPv6 enables IPv6 on the user-mode network interface
+	IPv6 *bool `yaml:"ipv6,omitempty" json:"ipv6,omitempty"`
+	// HostBind is the default `hostIP` of `portForwards`, i.e., the host address that the forwarded ports are bound to
+	HostBind net.IP `yaml:"hostBind,omitempty" json:"hostBind,omitempty"`
+	// NetworkDeprecated is `network.vde`, DEPRECATED, use `networks` instead
+	NetworkDeprecated `yaml:",inline"`
+}
+
 // DEPRECATED types below
 
 // Types have been renamed to turn all references to the old names into compiler errors,
@@ -3,10 +3,14 @@ package limayaml
 import (
 	"fmt"
 	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
+	"time"
 
 	"errors"
 
@@ -25,15 +29,45 @@ func Validate(y LimaYAML, warn bool) error {
 		return fmt.Errorf("field `arch` must be %q or %q , got %q", X8664, AARCH64, *y.Arch)
 	}
 
+	if *y.RequireAcceleration && *y.Arch != NewArch(runtime.GOARCH) {
+		return fmt.Errorf("field `requireAcceleration` is set, but the arch %q cannot be accelerated on the host (%q)",
+			*y.Arch, NewArch(runtime.GOARCH))
+	}
+
+	switch accel := *y.QEMU.Accel; accel {
+	case "":
+	case AccelTCG:
+		if *y.RequireAcceleration {
+			return errors.New("field `qemu.accel` must not be \"tcg\" when field `requireAcceleration` is set")
+		}
+		if warn && *y.Arch == NewArch(runtime.GOARCH) {
+			logrus.Warnf("field `qemu.accel` is set to %q, the guest will be emulated without hardware acceleration and will be very slow", accel)
+		}
+	default:
+		hostAccel := HostAccel()
+		if accel != hostAccel {
+			return fmt.Errorf("field `qemu.accel` must be %q or %q on %s hosts, got %q", hostAccel, AccelTCG, runtime.GOOS, accel)
+		}
+		if *y.Arch != NewArch(runtime.GOARCH) {
+			return fmt.Errorf("field `qemu.accel` is set to %q, but the arch %q cannot be accelerated on the host (%q)",
+				accel, *y.Arch, NewArch(runtime.GOARCH))
+		}
+	}
+
 	if len(y.Images) == 0 {
 		return errors.New("field `images` must be set")
 	}
 	for i, f := range y.Images {
-		if !strings.Contains(f.Location, "://") {
-			if _, err := localpathutil.Expand(f.Location); err != nil {
-				return fmt.Errorf("field `images[%d].location` refers to an invalid local file path: %q: %w", i, f.Location, err)
+		if len(f.Mirrors()) == 0 {
+			return fmt.Errorf("field `images[%d].location` or `images[%d].locations` must be set", i, i)
+		}
+		for _, loc := range f.Mirrors() {
+			if !strings.Contains(loc, "://") {
+				if _, err := localpathutil.Expand(loc); err != nil {
+					return fmt.Errorf("field `images[%d].location` refers to an invalid local file path: %q: %w", i, loc, err)
+				}
+				// loc does NOT need to be accessible, so we do NOT check os.Stat(loc)
 			}
-			// f.Location does NOT need to be accessible, so we do NOT check os.Stat(f.Location)
 		}
 		switch f.Arch {
 		case X8664, AARCH64:
@@ -50,17 +84,146 @@ func Validate(y LimaYAML, warn bool) error {
 		}
 	}
 
-	if *y.CPUs == 0 {
-		return errors.New("field `cpus` must be set")
+	if *y.Downloader.Proxy != "" {
+		u, err := url.Parse(*y.Downloader.Proxy)
+		if err != nil {
+			return fmt.Errorf("field `downloader.proxy` has an invalid value: %w", err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return fmt.Errorf("field `downloader.proxy` must have the scheme \"http\", \"https\", or \"socks5\", got %q", *y.Downloader.Proxy)
+		}
+	}
+	if *y.Downloader.CACert != "" {
+		if _, err := localpathutil.Expand(*y.Downloader.CACert); err != nil {
+			return fmt.Errorf("field `downloader.caCert` refers to an invalid local file path: %q: %w", *y.Downloader.CACert, err)
+		}
 	}
 
-	if _, err := units.RAMInBytes(*y.Memory); err != nil {
-		return fmt.Errorf("field `memory` has an invalid value: %w", err)
+	if err := validateBootOrder(*y.Boot.Order); err != nil {
+		return fmt.Errorf("field `boot.order` is invalid: %w", err)
+	}
+	if *y.Boot.SplashTime < 0 || *y.Boot.SplashTime > 0xffff {
+		return fmt.Errorf("field `boot.splashTime` must be between 0 and 65535 (milliseconds), got %d", *y.Boot.SplashTime)
+	}
+
+	if err := validateKernel(y); err != nil {
+		return err
+	}
+
+	for i, iso := range y.ISOs {
+		if err := validateReadableFile(fmt.Sprintf("isos[%d]", i), iso); err != nil {
+			return err
+		}
+	}
+
+	if *y.CPUs <= 0 {
+		return fmt.Errorf("field `cpus` must be positive, got %d", *y.CPUs)
+	}
+	if *y.MaxCPUs < *y.CPUs {
+		return fmt.Errorf("field `maxCPUs` must be greater than or equal to field `cpus` (%d), got %d", *y.CPUs, *y.MaxCPUs)
+	}
+	if *y.CPU.Sockets < 1 {
+		return fmt.Errorf("field `cpu.sockets` must be positive, got %d", *y.CPU.Sockets)
+	}
+	if *y.CPU.Threads < 1 {
+		return fmt.Errorf("field `cpu.threads` must be positive, got %d", *y.CPU.Threads)
+	}
+	if len(y.CPU.Pinning) > 0 && runtime.GOOS != "linux" {
+		return errors.New("field `cpu.pinning` is only supported on Linux")
+	}
+	for vcpu, hostCPU := range y.CPU.Pinning {
+		if vcpu < 0 || vcpu >= *y.MaxCPUs {
+			return fmt.Errorf("field `cpu.pinning` must only contain vCPUs between 0 and %d, got %d", *y.MaxCPUs-1, vcpu)
+		}
+		if hostCPU < 0 {
+			return fmt.Errorf("field `cpu.pinning[%d]` must not be negative, got %d", vcpu, hostCPU)
+		}
+	}
+	// sockets * cores * threads must be equal to maxCPUs
+	if perCore := *y.CPU.Sockets * *y.CPU.Threads; *y.MaxCPUs%perCore != 0 {
+		return fmt.Errorf("field `maxCPUs` (%d) must be a multiple of field `cpu.sockets` (%d) times field `cpu.threads` (%d)",
+			*y.MaxCPUs, *y.CPU.Sockets, *y.CPU.Threads)
 	}
 
-	if _, err := units.RAMInBytes(*y.Disk); err != nil {
+	memBytes, err := units.RAMInBytes(*y.Memory)
+	if err != nil {
 		return fmt.Errorf("field `memory` has an invalid value: %w", err)
 	}
+	if memBytes <= 0 {
+		return fmt.Errorf("field `memory` must be positive, got %q", *y.Memory)
+	}
+
+	switch *y.MemoryBackend {
+	case MemoryBackendRAM:
+	case MemoryBackendHugepages:
+		if runtime.GOOS != "linux" {
+			return fmt.Errorf("field `memoryBackend` can only be %q on Linux", MemoryBackendHugepages)
+		}
+	default:
+		return fmt.Errorf("field `memoryBackend` must be %q or %q, got %q", MemoryBackendRAM, MemoryBackendHugepages, *y.MemoryBackend)
+	}
+
+	if err := validateNUMA(y.NUMA, *y.CPUs, *y.MaxCPUs, memBytes); err != nil {
+		return err
+	}
+
+	// The machine options are appended by Lima
+	if strings.Contains(*y.QEMU.Machine, ",") {
+		return fmt.Errorf("field `qemu.machine` must be a machine type without options, got %q", *y.QEMU.Machine)
+	}
+
+	switch *y.DiskCache {
+	case DiskCacheNone, DiskCacheWriteback, DiskCacheWritethrough, DiskCacheUnsafe, DiskCacheDirectsync:
+	default:
+		return fmt.Errorf("field `diskCache` must be one of %q, %q, %q, %q, or %q; got %q",
+			DiskCacheNone, DiskCacheWriteback, DiskCacheWritethrough, DiskCacheUnsafe, DiskCacheDirectsync, *y.DiskCache)
+	}
+
+	switch *y.DiskFormat {
+	case DiskFormatQCOW2, DiskFormatRaw:
+	default:
+		return fmt.Errorf("field `diskFormat` must be %q or %q, got %q", DiskFormatQCOW2, DiskFormatRaw, *y.DiskFormat)
+	}
+
+	switch *y.DiskAIO {
+	case DiskAIOThreads:
+	case DiskAIONative:
+		if !DiskAIOIsSupported(y) && warn {
+			logrus.Warnf("field `diskAIO` %q requires `diskCache` to be %q or %q, got %q; falling back to %q",
+				DiskAIONative, DiskCacheNone, DiskCacheDirectsync, *y.DiskCache, DiskAIOThreads)
+		}
+	case DiskAIOIOURing:
+		if runtime.GOOS != "linux" {
+			return fmt.Errorf("field `diskAIO` %q is only supported on Linux", DiskAIOIOURing)
+		}
+	default:
+		return fmt.Errorf("field `diskAIO` must be %q, %q, or %q, got %q", DiskAIOThreads, DiskAIONative, DiskAIOIOURing, *y.DiskAIO)
+	}
+
+	switch *y.DiskDiscard {
+	case DiskDiscardIgnore, DiskDiscardUnmap:
+	default:
+		return fmt.Errorf("field `diskDiscard` must be %q or %q, got %q", DiskDiscardIgnore, DiskDiscardUnmap, *y.DiskDiscard)
+	}
+
+	// 0 is allowed; the base disk is then used without a diffdisk
+	if diskBytes, err := units.RAMInBytes(*y.Disk); err != nil {
+		return fmt.Errorf("field `disk` has an invalid value: %w", err)
+	} else if diskBytes < 0 {
+		return fmt.Errorf("field `disk` must not be negative, got %q", *y.Disk)
+	}
+
+	switch *y.MountType {
+	case ReverseSSHFS:
+	case NFS:
+		if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+			return fmt.Errorf("field `mountType` %q is only supported on Linux and macOS hosts", NFS)
+		}
+	default:
+		return fmt.Errorf("field `mountType` must be %q or %q, got %q", ReverseSSHFS, NFS, *y.MountType)
+	}
 
 	u, err := osutil.LimaUser(false)
 	if err != nil {
@@ -69,7 +232,17 @@ func Validate(y LimaYAML, warn bool) error {
 	// reservedHome is the home directory defined in "cidata.iso:/user-data"
 	reservedHome := fmt.Sprintf("/home/%s.linux", u.Username)
 
+	if err := validateSSHFSOptions("sshfs.options", y.SSHFS.Options); err != nil {
+		return err
+	}
 	for i, f := range y.Mounts {
+		if err := validateSSHFSOptions(fmt.Sprintf("mounts[%d].sshfs.options", i), f.SSHFS.Options); err != nil {
+			return err
+		}
+		// the templates are expanded by FillDefault, unless they are invalid
+		if strings.Contains(f.Location, "{{") {
+			return fmt.Errorf("field `mounts[%d].location` has an invalid template (see the warnings), got %q", i, f.Location)
+		}
 		if !filepath.IsAbs(f.Location) && !strings.HasPrefix(f.Location, "~") {
 			return fmt.Errorf("field `mounts[%d].location` must be an absolute path, got %q",
 				i, f.Location)
@@ -100,8 +273,84 @@ func Validate(y LimaYAML, warn bool) error {
 			return err
 		}
 	}
+	if err := validateSSHAddress(*y.SSH.Address, *y.SSH.ProxyJump, warn); err != nil {
+		return err
+	}
+
+	if *y.Video.VNC.Enabled {
+		ip := net.ParseIP(*y.Video.VNC.Address)
+		if ip == nil {
+			return fmt.Errorf("field `video.vnc.address` must be an IP address, got %q", *y.Video.VNC.Address)
+		}
+		// The VNC server has no password, so anyone who can reach it can control the guest
+		if !ip.IsLoopback() {
+			return fmt.Errorf("field `video.vnc.address` must be a loopback address, as the VNC server is not protected by a password, got %q", *y.Video.VNC.Address)
+		}
+		if d := *y.Video.VNC.Display; d < 0 || VNCBasePort+d > 65535 {
+			return fmt.Errorf("field `video.vnc.display` must be between 0 and %d, got %d", 65535-VNCBasePort, d)
+		}
+	}
+
+	if err := validateAudio(y.Audio); err != nil {
+		return err
+	}
+
+	for i, dev := range y.USB {
+		if err := validateUSBDevice(dev); err != nil {
+			return fmt.Errorf("field `usb[%d]` is invalid: %w", i, err)
+		}
+	}
+
+	if len(y.PCIPassthrough) > 0 && runtime.GOOS != "linux" {
+		return errors.New("field `pciPassthrough` is only supported on Linux")
+	}
+	for i, addr := range y.PCIPassthrough {
+		if !PCIAddressRegexp.MatchString(addr) {
+			return fmt.Errorf("field `pciPassthrough[%d]` must be a PCI address like \"0000:01:00.0\" or \"01:00.0\", got %q", i, addr)
+		}
+	}
+
+	if err := validateVideoMode(y); err != nil {
+		return err
+	}
 
 	// y.Firmware.LegacyBIOS is ignored for aarch64, but not a fatal error.
+	if err := validateFirmware(y); err != nil {
+		return err
+	}
+
+	maxSerialCount := MaxSerialCount
+	if *y.Arch == AARCH64 {
+		maxSerialCount = 1
+	}
+	if *y.SerialCount < 1 || *y.SerialCount > maxSerialCount {
+		return fmt.Errorf("field `serialCount` must be between 1 and %d for arch %q, got %d", maxSerialCount, *y.Arch, *y.SerialCount)
+	}
+
+	for i, m := range y.BootProgressMarkers {
+		if _, err := regexp.Compile(m.Pattern); err != nil {
+			return fmt.Errorf("field `bootProgressMarkers[%d].pattern` must be a valid regular expression: %w", i, err)
+		}
+		if m.Progress < 1 || m.Progress > 100 {
+			return fmt.Errorf("field `bootProgressMarkers[%d].progress` must be between 1 and 100, got %d", i, m.Progress)
+		}
+	}
+
+	if *y.ResourceUsage.Interval < 0 {
+		return fmt.Errorf("field `resourceUsage.interval` must be 0 or positive, got %d", *y.ResourceUsage.Interval)
+	}
+
+	if *y.GuestAgent.ReconnectInterval < 1 {
+		return fmt.Errorf("field `guestAgent.reconnectInterval` must be positive, got %d", *y.GuestAgent.ReconnectInterval)
+	}
+
+	if *y.Heartbeat.Interval < 0 {
+		return fmt.Errorf("field `heartbeat.interval` must be 0 or positive, got %d", *y.Heartbeat.Interval)
+	}
+
+	if *y.AutoStop.IdleTimeout < 0 {
+		return fmt.Errorf("field `autoStop.idleTimeout` must be 0 or positive, got %d", *y.AutoStop.IdleTimeout)
+	}
 
 	for i, p := range y.Provision {
 		switch p.Mode {
@@ -111,10 +360,32 @@ func Validate(y LimaYAML, warn bool) error {
 				i, ProvisionModeSystem, ProvisionModeUser)
 		}
 	}
+	if f := *y.CloudInit.UserData; f != "" {
+		if !filepath.IsAbs(f) && !strings.HasPrefix(f, "~") {
+			return fmt.Errorf("field `cloudInit.userData` must be an absolute path, got %q", f)
+		}
+		if _, err := localpathutil.Expand(f); err != nil {
+			return fmt.Errorf("field `cloudInit.userData` refers to an unexpandable path: %q: %w", f, err)
+		}
+	}
+
 	needsContainerdArchives := (y.Containerd.User != nil && *y.Containerd.User) || (y.Containerd.System != nil && *y.Containerd.System)
 	if needsContainerdArchives && len(y.Containerd.Archives) == 0 {
 		return fmt.Errorf("field `containerd.archives` must be provided")
 	}
+	for i, f := range y.Containerd.Archives {
+		if len(f.Mirrors()) == 0 {
+			return fmt.Errorf("field `containerd.archives[%d].location` or `containerd.archives[%d].locations` must be set", i, i)
+		}
+	}
+	if !needsContainerdArchives && len(y.Containerd.PrePull) > 0 {
+		return fmt.Errorf("field `containerd.prePull` requires either field `containerd.user` or field `containerd.system` to be true")
+	}
+	for i, image := range y.Containerd.PrePull {
+		if strings.TrimSpace(image) == "" {
+			return fmt.Errorf("field `containerd.prePull[%d]` must not be empty", i)
+		}
+	}
 	for i, p := range y.Probes {
 		switch p.Mode {
 		case ProbeModeReadiness:
@@ -123,6 +394,17 @@ func Validate(y LimaYAML, warn bool) error {
 				i, ProbeModeReadiness)
 		}
 	}
+	switch *y.PortForwardPolicy {
+	case PortForwardPolicyAllow, PortForwardPolicyDeny:
+	default:
+		return fmt.Errorf("field `portForwardPolicy` must be %q or %q, got %q", PortForwardPolicyAllow, PortForwardPolicyDeny, *y.PortForwardPolicy)
+	}
+	switch *y.PortForwardOnConflict {
+	case PortForwardOnConflictSkip, PortForwardOnConflictRemap:
+	default:
+		return fmt.Errorf("field `portForwardOnConflict` must be %q or %q, got %q",
+			PortForwardOnConflictSkip, PortForwardOnConflictRemap, *y.PortForwardOnConflict)
+	}
 	for i, rule := range y.PortForwards {
 		field := fmt.Sprintf("portForwards[%d]", i)
 		if rule.GuestPort != 0 {
@@ -187,8 +469,32 @@ func Validate(y LimaYAML, warn bool) error {
 			return fmt.Errorf("field `%s.hostSocket` must be less than UNIX_PATH_MAX=%d characers, but is %d",
 				field, osutil.UnixPathMax, len(rule.HostSocket))
 		}
-		if rule.Proto != TCP {
-			return fmt.Errorf("field `%s.proto` must be %q", field, TCP)
+		switch rule.Proto {
+		case TCP:
+		case UDP:
+			if rule.GuestSocket != "" || rule.HostSocket != "" {
+				return fmt.Errorf("field `%s.proto` must be %q when forwarding sockets", field, TCP)
+			}
+			if rule.Reverse {
+				return fmt.Errorf("field `%s.proto` must be %q when field `%s.reverse` is true", field, TCP, field)
+			}
+			if rule.HostIP.To4() == nil {
+				return fmt.Errorf("field `%s.hostIP` must be an IPv4 address when field `%s.proto` is %q", field, field, UDP)
+			}
+			if n := rule.GuestPortRange[1] - rule.GuestPortRange[0] + 1; n > MaxUDPPortRange {
+				return fmt.Errorf("field `%s.guestPortRange` must not cover more than %d ports when field `%s.proto` is %q, got %d",
+					field, MaxUDPPortRange, field, UDP, n)
+			}
+		default:
+			return fmt.Errorf("field `%s.proto` must be %q or %q", field, TCP, UDP)
+		}
+		if rule.Reverse {
+			if rule.Ignore {
+				return fmt.Errorf("field `%s.ignore` must be false when field `%s.reverse` is true", field, field)
+			}
+			if rule.GuestSocket == "" && rule.GuestPortRange[1]-rule.GuestPortRange[0] > 0 {
+				return fmt.Errorf("field `%s.reverse` can only be used with a single guest port or socket. not a range", field)
+			}
 		}
 		// Not validating that the various GuestPortRanges and HostPortRanges are not overlapping. Rules will be
 		// processed sequentially and the first matching rule for a guest port determines forwarding behavior.
@@ -197,6 +503,45 @@ func Validate(y LimaYAML, warn bool) error {
 	if y.UseHostResolver != nil && *y.UseHostResolver && len(y.DNS) > 0 {
 		return fmt.Errorf("field `dns` must be empty when field `useHostResolver` is true")
 	}
+	for i, ip := range y.DNS {
+		// net.IP unmarshals an empty string into nil without an error
+		if ip == nil || ip.IsUnspecified() {
+			return fmt.Errorf("field `dns[%d]` must be a valid IP address", i)
+		}
+	}
+
+	if err := validateHostname(*y.Hostname); err != nil {
+		if !y.legacyHostname {
+			return fmt.Errorf("field `hostname` is invalid: %w", err)
+		}
+		if warn {
+			logrus.Warnf("the hostname %q of the existing instance is invalid (%v); set field `hostname` to change it", *y.Hostname, err)
+		}
+	}
+
+	if err := validateTimezone(*y.Timezone); err != nil {
+		return fmt.Errorf("field `timezone` is invalid: %w", err)
+	}
+
+	switch *y.RTC {
+	case RTCUTC, RTCLocaltime:
+	default:
+		if _, err := time.Parse(RTCTimeFormat, *y.RTC); err != nil {
+			return fmt.Errorf("field `rtc` must be %q, %q, or a time in the format %q, got %q", RTCUTC, RTCLocaltime, RTCTimeFormat, *y.RTC)
+		}
+	}
+
+	for k, v := range y.Env {
+		if err := ValidateEnv(k, v); err != nil {
+			return fmt.Errorf("field `env`: %w", err)
+		}
+	}
+	if warn {
+		for _, k := range y.skippedEnv {
+			logrus.Warnf("field `env.%s` is not set in the guest, as the value contains double quotes, backslashes, dollar signs, or backticks,"+
+				" which cannot be written to /etc/environment; remove them from the value", k)
+		}
+	}
 
 	if err := validateNetwork(y, warn); err != nil {
 		return err
@@ -204,6 +549,299 @@ func Validate(y LimaYAML, warn bool) error {
 	return nil
 }
 
+// validateBootOrder validates the drive letters of the QEMU boot order:
+// "a" and "b" for floppies, "c" for the first hard disk, "d" for the first CD-ROM, and "n" to "p" for network adapters.
+func validateBootOrder(order string) error {
+	for i, c := range order {
+		if !strings.ContainsRune("abcdnop", c) {
+			return fmt.Errorf("invalid drive letter %q in %q (expected one of \"abcdnop\")", c, order)
+		}
+		if strings.ContainsRune(order[:i], c) {
+			return fmt.Errorf("duplicate drive letter %q in %q", c, order)
+		}
+	}
+	return nil
+}
+
+// validateKernel validates `kernel`, `initrd`, and `cmdline`.
+// The kernel and the initrd have to be readable when the instance is validated, as QEMU fails with a less obvious error.
+func validateKernel(y LimaYAML) error {
+	if *y.Kernel == "" {
+		if *y.Initrd != "" || *y.Cmdline != "" {
+			return errors.New("field `initrd` and field `cmdline` require field `kernel` to be set")
+		}
+		return nil
+	}
+	if err := validateReadableFile("kernel", *y.Kernel); err != nil {
+		return err
+	}
+	if *y.Initrd != "" {
+		if err := validateReadableFile("initrd", *y.Initrd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateFirmware(y LimaYAML) error {
+	if *y.Firmware.SecureBoot {
+		if *y.Firmware.LegacyBIOS && *y.Arch == X8664 {
+			return errors.New("field `firmware.secureBoot` cannot be used with field `firmware.legacyBIOS`")
+		}
+		// SMM, which protects the variable store of the Secure Boot firmware on x86_64, is only emulated for q35
+		if *y.Arch == X8664 && !strings.HasPrefix(*y.QEMU.Machine, "q35") && !strings.HasPrefix(*y.QEMU.Machine, "pc-q35-") {
+			return fmt.Errorf("field `firmware.secureBoot` requires field `qemu.machine` to be a q35 machine type, got %q", *y.QEMU.Machine)
+		}
+		// The keys are enrolled in the template of the variable store
+		if *y.Firmware.Code != "" && *y.Firmware.Vars == "" {
+			return errors.New("field `firmware.secureBoot` requires field `firmware.vars` to be set when field `firmware.code` is set")
+		}
+	}
+	if *y.Firmware.Code == "" {
+		if *y.Firmware.Vars != "" {
+			return errors.New("field `firmware.vars` requires field `firmware.code` to be set")
+		}
+		return nil
+	}
+	if *y.Firmware.LegacyBIOS && *y.Arch == X8664 {
+		return errors.New("field `firmware.code` cannot be used with field `firmware.legacyBIOS`")
+	}
+	if err := validateReadableFile("firmware.code", *y.Firmware.Code); err != nil {
+		return err
+	}
+	if *y.Firmware.Vars != "" {
+		if err := validateReadableFile("firmware.vars", *y.Firmware.Vars); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateReadableFile checks that the local file path of the field can be opened for reading.
+func validateReadableFile(field, path string) error {
+	expanded, err := localpathutil.Expand(path)
+	if err != nil {
+		return fmt.Errorf("field `%s` refers to an invalid local file path: %q: %w", field, path, err)
+	}
+	r, err := os.Open(expanded)
+	if err != nil {
+		return fmt.Errorf("field `%s` must be a readable file: %w", field, err)
+	}
+	st, err := r.Stat()
+	r.Close()
+	if err != nil {
+		return fmt.Errorf("field `%s` must be a readable file: %w", field, err)
+	}
+	if st.IsDir() {
+		return fmt.Errorf("field `%s` must be a file, got a directory %q", field, expanded)
+	}
+	return nil
+}
+
+var hostnameLabelRegexp = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?$`)
+
+// validateTimezone validates the timezone name against the tz database of the host.
+// An empty string means that the timezone of the guest is left unchanged.
+func validateTimezone(tz string) error {
+	if tz == "" {
+		return nil
+	}
+	if tz == "Local" || strings.HasPrefix(tz, "/") {
+		return fmt.Errorf("expected a name in the tz database (e.g., \"Asia/Tokyo\"), got %q", tz)
+	}
+	if _, err := time.LoadLocation(tz); err != nil {
+		return fmt.Errorf("unknown timezone %q: %w", tz, err)
+	}
+	return nil
+}
+
+// validateHostname validates the hostname according to RFC 1123.
+func validateHostname(hostname string) error {
+	if len(hostname) > 253 {
+		return fmt.Errorf("%q is longer than 253 characters", hostname)
+	}
+	for _, label := range strings.Split(hostname, ".") {
+		if len(label) > 63 {
+			return fmt.Errorf("label %q of %q is longer than 63 characters", label, hostname)
+		}
+		if !hostnameLabelRegexp.MatchString(label) {
+			return fmt.Errorf("label %q of %q must consist of alphanumeric characters and '-', and must not begin or end with '-'", label, hostname)
+		}
+	}
+	return nil
+}
+
+// proxyJumpHopRegexp matches "[user@]host[:port]", where host may be an IPv6 address in brackets.
+// The user and the host must not begin with '-', so that they are not taken as options by ssh.
+var proxyJumpHopRegexp = regexp.MustCompile(`^([^-@\s,][^@\s,]*@)?([A-Za-z0-9_][A-Za-z0-9._-]*|\[[0-9A-Fa-f:.]+\])(:[0-9]{1,5})?$`)
+
+// validateSSHAddress validates `ssh.address` and `ssh.proxyJump`.
+// The SSH clients connect to address from the last jump host, so address must not be a loopback address
+// when proxyJump is set; "127.0.0.1" would be the jump host itself.
+func validateSSHAddress(address, proxyJump string, warn bool) error {
+	ip := net.ParseIP(address)
+	if ip == nil || ip.IsUnspecified() {
+		return fmt.Errorf("field `ssh.address` must be an IP address of the host, got %q", address)
+	}
+	if proxyJump == "" {
+		if warn && !ip.IsLoopback() {
+			logrus.Warnf("field `ssh.address` is set to the non-loopback address %q: the SSH port of the guest is exposed to the other hosts on the network",
+				address)
+		}
+		return nil
+	}
+	for _, hop := range strings.Split(proxyJump, ",") {
+		if !proxyJumpHopRegexp.MatchString(hop) {
+			return fmt.Errorf("field `ssh.proxyJump` must be in the format of \"[user@]host[:port]\", separated by commas, got %q", proxyJump)
+		}
+	}
+	if ip.IsLoopback() {
+		return fmt.Errorf("field `ssh.address` must be an address of the host that is reachable from the jump host when field `ssh.proxyJump` is set, got %q"+
+			" (a loopback address would refer to the jump host itself)", address)
+	}
+	return nil
+}
+
+var envNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// envInvalidChars cannot be written to /etc/environment, as pam_env(8) has no escape sequences for them,
+// and the shells that source /etc/environment would expand them.
+const envInvalidChars = "\"\\$`\r\n\x00"
+
+// isLegacyEnv returns true when the variable is rejected by ValidateEnv only for the characters in envInvalidChars
+// that were accepted by the earlier versions, i.e., everything except for the newlines and the NUL characters.
+func isLegacyEnv(name, value string) bool {
+	return ValidateEnv(name, value) != nil && envNameRegexp.MatchString(name) && !strings.ContainsAny(value, "\r\n\x00")
+}
+
+// ValidateEnv validates the name and the value of an environment variable to be written to /etc/environment.
+func ValidateEnv(name, value string) error {
+	if !envNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid variable name %q", name)
+	}
+	if strings.ContainsAny(value, envInvalidChars) {
+		return fmt.Errorf("the value of %q must not contain double quotes, backslashes, dollar signs, backticks, newlines, or NUL characters, got %q",
+			name, value)
+	}
+	return nil
+}
+
+// PCIAddressRegexp matches a PCI address, with an optional domain ("0000:01:00.0" or "01:00.0").
+var PCIAddressRegexp = regexp.MustCompile(`^([0-9A-Fa-f]{4}:)?[0-9A-Fa-f]{2}:[0-9A-Fa-f]{2}\.[0-7]$`)
+
+var usbIDRegexp = regexp.MustCompile(`^(0x)?[0-9A-Fa-f]{4}$`)
+
+func validateUSBDevice(dev USBDevice) error {
+	byID := dev.VendorID != "" || dev.ProductID != ""
+	byAddr := dev.HostBus != 0 || dev.HostAddr != 0
+	switch {
+	case byID && byAddr:
+		return errors.New("either `vendorID` and `productID`, or `hostBus` and `hostAddr` can be set, not both")
+	case byID:
+		if !usbIDRegexp.MatchString(dev.VendorID) || !usbIDRegexp.MatchString(dev.ProductID) {
+			return fmt.Errorf("`vendorID` and `productID` must be 4 hex digits (e.g. \"0x0781\"), got %q and %q", dev.VendorID, dev.ProductID)
+		}
+	case byAddr:
+		if dev.HostBus < 1 || dev.HostAddr < 1 || dev.HostAddr > 127 {
+			return fmt.Errorf("`hostBus` must be positive, and `hostAddr` must be between 1 and 127, got %d and %d", dev.HostBus, dev.HostAddr)
+		}
+	default:
+		return errors.New("either `vendorID` and `productID`, or `hostBus` and `hostAddr` must be set")
+	}
+	return nil
+}
+
+// DefaultVRAM is the video memory of the QEMU VGA devices in MiB, when `video.vram` is 0.
+const DefaultVRAM = 16
+
+// ParseResolution parses a resolution like "1920x1080".
+func ParseResolution(s string) (width, height int, err error) {
+	m := resolutionRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return 0, 0, fmt.Errorf("expected \"<WIDTH>x<HEIGHT>\", got %q", s)
+	}
+	width, _ = strconv.Atoi(m[1])
+	height, _ = strconv.Atoi(m[2])
+	return width, height, nil
+}
+
+// DiskAIOIsSupported returns whether `diskAIO` can be used with `diskCache`.
+// QEMU refuses to start with `aio=native`, unless the host page cache is bypassed.
+func DiskAIOIsSupported(y LimaYAML) bool {
+	if *y.DiskAIO != DiskAIONative {
+		return true
+	}
+	return *y.DiskCache == DiskCacheNone || *y.DiskCache == DiskCacheDirectsync
+}
+
+// audioBackends are the QEMU audiodev drivers supported on each host OS. The first one is the default.
+var audioBackends = map[string][]string{
+	"darwin": {"coreaudio"},
+	"linux":  {"pa", "alsa"},
+}
+
+// DefaultAudioBackend returns the QEMU audiodev driver used when `audio.backend` is empty.
+func DefaultAudioBackend() string {
+	if backends := audioBackends[runtime.GOOS]; len(backends) > 0 {
+		return backends[0]
+	}
+	return ""
+}
+
+func validateAudio(audio Audio) error {
+	switch *audio.Device {
+	case AudioDeviceNone:
+		return nil
+	case AudioDeviceHDA, AudioDeviceAC97:
+	default:
+		return fmt.Errorf("field `audio.device` must be %q, %q, or %q, got %q", AudioDeviceNone, AudioDeviceHDA, AudioDeviceAC97, *audio.Device)
+	}
+	backends := audioBackends[runtime.GOOS]
+	if len(backends) == 0 {
+		return fmt.Errorf("field `audio.device` is not supported on %s hosts", runtime.GOOS)
+	}
+	if *audio.Backend == "" {
+		return nil
+	}
+	for _, backend := range backends {
+		if *audio.Backend == backend {
+			return nil
+		}
+	}
+	return fmt.Errorf("field `audio.backend` must be one of %v on %s hosts, got %q", backends, runtime.GOOS, *audio.Backend)
+}
+
+var resolutionRegexp = regexp.MustCompile(`^([0-9]{1,5})x([0-9]{1,5})$`)
+
+func validateVideoMode(y LimaYAML) error {
+	vram := *y.Video.VRAM
+	if vram < 0 || vram > 512 {
+		return fmt.Errorf("field `video.vram` must be between 1 and 512 (MiB), or 0 for the default, got %d", vram)
+	}
+	if vram == 0 {
+		vram = DefaultVRAM
+	}
+	if *y.Video.Resolution != "" {
+		width, height, err := ParseResolution(*y.Video.Resolution)
+		if err != nil {
+			return fmt.Errorf("field `video.resolution` is invalid: %w", err)
+		}
+		if width < 640 || width > 7680 || height < 480 || height > 4320 {
+			return fmt.Errorf("field `video.resolution` must be between 640x480 and 7680x4320, got %q", *y.Video.Resolution)
+		}
+		// 32 bits per pixel
+		if required := width * height * 4; required > vram*1024*1024 {
+			return fmt.Errorf("field `video.resolution` %q requires `video.vram` to be at least %d (MiB)",
+				*y.Video.Resolution, (required+1024*1024-1)/(1024*1024))
+		}
+	}
+	// ramfb has no properties for the resolution and the video memory
+	if *y.Arch == AARCH64 && (*y.Video.Resolution != "" || *y.Video.VRAM != 0) {
+		return errors.New("fields `video.resolution` and `video.vram` are not supported for aarch64, as the resolution of ramfb is chosen by the guest")
+	}
+	return nil
+}
+
 func validateNetwork(y LimaYAML, warn bool) error {
 	if len(y.Network.VDEDeprecated) > 0 {
 		if y.Network.migrated {
@@ -214,10 +852,36 @@ func validateNetwork(y LimaYAML, warn bool) error {
 			return fmt.Errorf("you cannot use deprecated field `network.VDE` together with replacement field `networks`")
 		}
 	}
+	if err := validateMACAddress("network.macAddress", y.Network.MACAddress); err != nil {
+		return err
+	}
+	if y.Network.HostBind.To4() == nil && y.Network.HostBind.To16() == nil {
+		return fmt.Errorf("field `network.hostBind` must be an IP address, got %q", y.Network.HostBind)
+	}
+	if warn && !y.Network.HostBind.IsLoopback() {
+		logrus.Warnf("field `network.hostBind` is set to the non-loopback address %q: the forwarded ports of the guest are exposed to the other hosts on the network",
+			y.Network.HostBind)
+	}
+	// The SSH port is forwarded through the user-mode network (netdev "net0"), so it must not be taken by `qemu.extraArgs`
+	if err := validateNetdevIDs(y.QEMU.ExtraArgs, len(y.Networks)); err != nil {
+		return err
+	}
+	// A MAC address shared by two interfaces would make the guest confuse them, including the one of the SSH forward
+	macAddress := map[string]string{normalizeMACAddress(y.Network.MACAddress): "network.macAddress"}
 	interfaceName := make(map[string]int)
 	for i, nw := range y.Networks {
 		field := fmt.Sprintf("networks[%d]", i)
-		if nw.Lima != "" {
+		if nw.Bridge != "" {
+			if runtime.GOOS != "linux" {
+				return fmt.Errorf("field `%s.bridge` is only supported on Linux", field)
+			}
+			if nw.Lima != "" || nw.VNL != "" {
+				return fmt.Errorf("field `%s.bridge` cannot be used with field `%s.lima` or field `%s.vnl`", field, field, field)
+			}
+			if nw.SwitchPort != 0 {
+				return fmt.Errorf("field `%s.switchPort` cannot be used with field `%s.bridge`", field, field)
+			}
+		} else if nw.Lima != "" {
 			if runtime.GOOS != "darwin" {
 				return fmt.Errorf("field `%s.lima` is only supported on macOS right now", field)
 			}
@@ -236,7 +900,7 @@ func validateNetwork(y LimaYAML, warn bool) error {
 			}
 		} else {
 			if nw.VNL == "" {
-				return fmt.Errorf("field `%s.lima` or field `%s.vnl` must be set", field, field)
+				return fmt.Errorf("field `%s.lima`, field `%s.vnl`, or field `%s.bridge` must be set", field, field, field)
 			}
 			// The field is called VDE.VNL in anticipation of QEMU upgrading VDE2 to VDEplug4,
 			// but right now the only valid value on macOS is a path to the vde_switch socket directory,
@@ -278,13 +942,14 @@ func validateNetwork(y LimaYAML, warn bool) error {
 			}
 		}
 		if nw.MACAddress != "" {
-			hw, err := net.ParseMAC(nw.MACAddress)
-			if err != nil {
-				return fmt.Errorf("field `vmnet.mac` invalid: %w", err)
+			if err := validateMACAddress(field+".macAddress", nw.MACAddress); err != nil {
+				return err
 			}
-			if len(hw) != 6 {
-				return fmt.Errorf("field `%s.macAddress` must be a 48 bit (6 bytes) MAC address; actual length of %q is %d bytes", field, nw.MACAddress, len(hw))
+			mac := normalizeMACAddress(nw.MACAddress)
+			if prev, ok := macAddress[mac]; ok {
+				return fmt.Errorf("field `%s.macAddress` value %q has already been used by field `%s`", field, nw.MACAddress, prev)
 			}
+			macAddress[mac] = field + ".macAddress"
 		}
 		// FillDefault() will make sure that nw.Interface is not the empty string
 		if len(nw.Interface) >= 16 {
@@ -317,3 +982,102 @@ func validatePort(field string, port int) error {
 	}
 	return nil
 }
+
+// normalizeMACAddress returns the MAC address in the lowercase colon-separated form, so that the same address can be compared
+// regardless of the notation. An invalid address is returned as-is.
+func normalizeMACAddress(macAddress string) string {
+	hw, err := net.ParseMAC(macAddress)
+	if err != nil {
+		return macAddress
+	}
+	return hw.String()
+}
+
+// validateNetdevIDs rejects `-netdev` and `-nic` options in extraArgs with the ids "net0" to "net<n>",
+// which are used by the user-mode network and `networks`.
+func validateNetdevIDs(extraArgs []string, n int) error {
+	for i := 0; i+1 < len(extraArgs); i++ {
+		switch extraArgs[i] {
+		case "-netdev", "-nic":
+		default:
+			continue
+		}
+		for _, opt := range strings.Split(extraArgs[i+1], ",") {
+			id := strings.TrimPrefix(opt, "id=")
+			if id == opt || !strings.HasPrefix(id, "net") {
+				continue
+			}
+			if k, err := strconv.Atoi(strings.TrimPrefix(id, "net")); err == nil && k >= 0 && k <= n {
+				return fmt.Errorf("field `qemu.extraArgs` must not use the netdev id %q, which is used by Lima (\"net0\" is the user-mode network for SSH)", id)
+			}
+		}
+	}
+	return nil
+}
+
+func validateMACAddress(field, macAddress string) error {
+	hw, err := net.ParseMAC(macAddress)
+	if err != nil {
+		return fmt.Errorf("field `%s` invalid: %w", field, err)
+	}
+	if len(hw) != 6 {
+		return fmt.Errorf("field `%s` must be a 48 bit (6 bytes) MAC address; actual length of %q is %d bytes", field, macAddress, len(hw))
+	}
+	if hw[0]&1 != 0 {
+		return fmt.Errorf("field `%s` must be a unicast MAC address, got %q", field, macAddress)
+	}
+	return nil
+}
+
+// sshfsOptionRegexp matches a single `-o` option of sshfs, with an optional value.
+// The options are passed to sshfs via the shell of the guest, so the shell metacharacters are not allowed.
+var sshfsOptionRegexp = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*(=[A-Za-z0-9_.:/@+-]*)?$`)
+
+func validateSSHFSOptions(field string, options []string) error {
+	for i, opt := range options {
+		if !sshfsOptionRegexp.MatchString(opt) {
+			return fmt.Errorf("field `%s[%d]` must be a single option such as \"reconnect\" or \"ServerAliveInterval=15\", got %q", field, i, opt)
+		}
+		switch name := strings.SplitN(opt, "=", 2)[0]; name {
+		case "slave", "passive", "ro", "rw":
+			return fmt.Errorf("field `%s[%d]` must not be %q, as it is set by Lima", field, i, name)
+		}
+	}
+	return nil
+}
+
+// validateNUMA validates that the NUMA nodes cover exactly the vCPUs and the memory of the instance.
+func validateNUMA(numa []NUMANode, cpus, maxCPUs int, memBytes int64) error {
+	if len(numa) == 0 {
+		return nil
+	}
+	// The hotplugged vCPUs would not belong to any node
+	if maxCPUs > cpus {
+		return fmt.Errorf("field `numa` cannot be used with field `maxCPUs` (%d) greater than field `cpus` (%d)", maxCPUs, cpus)
+	}
+	var numaCPUs int
+	var numaMemBytes int64
+	for i, node := range numa {
+		field := fmt.Sprintf("numa[%d]", i)
+		if node.CPUs <= 0 {
+			return fmt.Errorf("field `%s.cpus` must be positive, got %d", field, node.CPUs)
+		}
+		nodeMemBytes, err := units.RAMInBytes(node.Memory)
+		if err != nil {
+			return fmt.Errorf("field `%s.memory` has an invalid value: %w", field, err)
+		}
+		if nodeMemBytes <= 0 || nodeMemBytes%(1<<20) != 0 {
+			return fmt.Errorf("field `%s.memory` must be a positive multiple of 1MiB, got %q", field, node.Memory)
+		}
+		numaCPUs += node.CPUs
+		numaMemBytes += nodeMemBytes
+	}
+	if numaCPUs != cpus {
+		return fmt.Errorf("the sum of field `numa[*].cpus` (%d) must be equal to field `cpus` (%d)", numaCPUs, cpus)
+	}
+	if numaMemBytes != memBytes {
+		return fmt.Errorf("the sum of field `numa[*].memory` (%s) must be equal to field `memory` (%s)",
+			units.BytesSize(float64(numaMemBytes)), units.BytesSize(float64(memBytes)))
+	}
+	return nil
+}
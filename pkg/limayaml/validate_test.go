@@ -0,0 +1,80 @@
+package limayaml
+
+import (
+	"net"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestValidateNUMA(t *testing.T) {
+	const gib = int64(1) << 30
+	nodes := []NUMANode{{CPUs: 2, Memory: "2GiB"}, {CPUs: 2, Memory: "2GiB"}}
+	assert.NilError(t, validateNUMA(nil, 4, 8, 4*gib))
+	assert.NilError(t, validateNUMA(nodes, 4, 4, 4*gib))
+	assert.ErrorContains(t, validateNUMA(nodes, 4, 8, 4*gib), "field `maxCPUs` (8) greater than field `cpus` (4)")
+	assert.ErrorContains(t, validateNUMA(nodes, 6, 6, 4*gib), "numa[*].cpus")
+	assert.ErrorContains(t, validateNUMA(nodes, 4, 4, 6*gib), "numa[*].memory")
+	assert.ErrorContains(t, validateNUMA([]NUMANode{{CPUs: 0, Memory: "4GiB"}}, 0, 0, 4*gib), "numa[0].cpus")
+	assert.ErrorContains(t, validateNUMA([]NUMANode{{CPUs: 4, Memory: "4095KiB"}}, 4, 4, 4095<<10), "numa[0].memory")
+}
+
+func TestValidateVideoMode(t *testing.T) {
+	video := func(arch Arch, resolution string, vram int) LimaYAML {
+		var y LimaYAML
+		y.Arch = &arch
+		y.Video.Resolution = &resolution
+		y.Video.VRAM = &vram
+		return y
+	}
+	assert.NilError(t, validateVideoMode(video(X8664, "", 0)))
+	assert.NilError(t, validateVideoMode(video(X8664, "1920x1080", 0)))
+	assert.NilError(t, validateVideoMode(video(AARCH64, "", 0)))
+	assert.ErrorContains(t, validateVideoMode(video(X8664, "1920", 0)), "field `video.resolution` is invalid")
+	assert.ErrorContains(t, validateVideoMode(video(X8664, "3840x2160", 0)), "requires `video.vram` to be at least 32 (MiB)")
+	assert.ErrorContains(t, validateVideoMode(video(X8664, "", 1024)), "field `video.vram` must be between 1 and 512")
+	assert.ErrorContains(t, validateVideoMode(video(AARCH64, "1920x1080", 0)), "not supported for aarch64")
+	assert.ErrorContains(t, validateVideoMode(video(AARCH64, "", 32)), "not supported for aarch64")
+}
+
+func TestValidateNetworkMACAddress(t *testing.T) {
+	var y LimaYAML
+	y.Network.MACAddress = "52:55:55:00:00:01"
+	y.Network.HostBind = net.IPv4(127, 0, 0, 1)
+	y.Networks = []Network{
+		{VNL: "/nonexistent/vde", Interface: "lima0", MACAddress: "52:55:55:00:00:02"},
+		{VNL: "/nonexistent/vde", Interface: "lima1", MACAddress: "52:55:55:00:00:03"},
+	}
+	assert.NilError(t, validateNetwork(y, false))
+
+	y.Networks[1].MACAddress = "52-55-55-00-00-01"
+	assert.ErrorContains(t, validateNetwork(y, false), "field `networks[1].macAddress` value \"52-55-55-00-00-01\" has already been used by field `network.macAddress`")
+
+	y.Networks[1].MACAddress = "52:55:55:00:00:02"
+	assert.ErrorContains(t, validateNetwork(y, false), "has already been used by field `networks[0].macAddress`")
+
+	y.Networks[1].MACAddress = "52:55:55:00:00:03"
+	y.QEMU.ExtraArgs = []string{"-netdev", "user,id=net0"}
+	assert.ErrorContains(t, validateNetwork(y, false), "field `qemu.extraArgs` must not use the netdev id \"net0\"")
+}
+
+func TestValidateNetdevIDs(t *testing.T) {
+	assert.NilError(t, validateNetdevIDs(nil, 0))
+	assert.NilError(t, validateNetdevIDs([]string{"-netdev", "user,id=net2"}, 1))
+	assert.NilError(t, validateNetdevIDs([]string{"-netdev", "user,id=mynet"}, 1))
+	assert.NilError(t, validateNetdevIDs([]string{"-device", "virtio-net-pci,id=net0"}, 1))
+	assert.ErrorContains(t, validateNetdevIDs([]string{"-netdev", "user,id=net0"}, 0), "net0")
+	assert.ErrorContains(t, validateNetdevIDs([]string{"-nic", "tap,id=net1"}, 1), "net1")
+}
+
+func TestValidateSSHAddress(t *testing.T) {
+	assert.NilError(t, validateSSHAddress("127.0.0.1", "", false))
+	assert.NilError(t, validateSSHAddress("192.168.1.2", "", false))
+	assert.NilError(t, validateSSHAddress("192.168.1.2", "bastion", false))
+	assert.NilError(t, validateSSHAddress("192.168.1.2", "user@bastion:2222,[fd00::1]:22", false))
+	assert.ErrorContains(t, validateSSHAddress("localhost", "", false), "field `ssh.address` must be an IP address")
+	assert.ErrorContains(t, validateSSHAddress("0.0.0.0", "", false), "field `ssh.address` must be an IP address")
+	assert.ErrorContains(t, validateSSHAddress("127.0.0.1", "bastion", false), "would refer to the jump host itself")
+	assert.ErrorContains(t, validateSSHAddress("192.168.1.2", "bastion,", false), "field `ssh.proxyJump` must be in the format")
+	assert.ErrorContains(t, validateSSHAddress("192.168.1.2", "-oProxyCommand", false), "field `ssh.proxyJump` must be in the format")
+}
@@ -18,6 +18,7 @@
 package lockutil
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
@@ -42,6 +43,26 @@ func WithDirLock(dir string, fn func() error) error {
 	return fn()
 }
 
+// ErrLocked is returned by TryLockFile when the file is locked by another process.
+var ErrLocked = errors.New("locked by another process")
+
+// TryLockFile creates the file if it does not exist, and locks it exclusively without blocking.
+// The lock is released by closing the returned file, or when the process exits.
+func TryLockFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := Flock(f, unix.LOCK_EX|unix.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, unix.EWOULDBLOCK) {
+			return nil, ErrLocked
+		}
+		return nil, fmt.Errorf("failed to lock %q: %w", path, err)
+	}
+	return f, nil
+}
+
 func Flock(f *os.File, flags int) error {
 	fd := int(f.Fd())
 	for {
@@ -0,0 +1,23 @@
+package lockutil
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestTryLockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lock")
+	f, err := TryLockFile(path)
+	assert.NilError(t, err)
+
+	_, err = TryLockFile(path)
+	assert.Assert(t, errors.Is(err, ErrLocked))
+
+	assert.NilError(t, f.Close())
+	f, err = TryLockFile(path)
+	assert.NilError(t, err)
+	assert.NilError(t, f.Close())
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package osutil
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// FreeDiskSpace returns the space available to the user on the filesystem of path, in bytes.
+func FreeDiskSpace(path string) (uint64, error) {
+	return 0, fmt.Errorf("getting the free disk space is not supported on %s", runtime.GOOS)
+}
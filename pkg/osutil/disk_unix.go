@@ -0,0 +1,15 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package osutil
+
+import "golang.org/x/sys/unix"
+
+// FreeDiskSpace returns the space available to the user on the filesystem of path, in bytes.
+func FreeDiskSpace(path string) (uint64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
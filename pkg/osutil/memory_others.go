@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package osutil
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// TotalMemory returns the physical memory of the host in bytes.
+func TotalMemory() (uint64, error) {
+	return 0, fmt.Errorf("getting the memory of the host is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,44 @@
+package osutil
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// TimeZone returns the name of the timezone of the host in the tz database, e.g., "Asia/Tokyo".
+// An empty string is returned when the timezone cannot be detected.
+func TimeZone() string {
+	if tz := tzEnv(os.Getenv("TZ")); tz != "" {
+		return tz
+	}
+	// /etc/localtime is a symlink to e.g. "/usr/share/zoneinfo/Asia/Tokyo" on Linux,
+	// and to "/var/db/timezone/zoneinfo/Asia/Tokyo" on macOS
+	target, err := os.Readlink("/etc/localtime")
+	if err != nil {
+		return ""
+	}
+	return zoneInfoName(target)
+}
+
+// tzEnv returns the timezone name in the value of $TZ, or an empty string when the value is not
+// the name of a timezone in the tz database, e.g., a path or a POSIX TZ string like "JST-9".
+func tzEnv(tz string) string {
+	tz = strings.TrimPrefix(tz, ":")
+	if tz == "" || filepath.IsAbs(tz) {
+		return ""
+	}
+	if _, err := time.LoadLocation(tz); err != nil {
+		return ""
+	}
+	return tz
+}
+
+func zoneInfoName(path string) string {
+	const sep = "zoneinfo/"
+	if i := strings.LastIndex(path, sep); i >= 0 {
+		return path[i+len(sep):]
+	}
+	return ""
+}
@@ -0,0 +1,23 @@
+package osutil
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestZoneInfoName(t *testing.T) {
+	assert.Equal(t, zoneInfoName("/usr/share/zoneinfo/Asia/Tokyo"), "Asia/Tokyo")
+	assert.Equal(t, zoneInfoName("/var/db/timezone/zoneinfo/America/New_York"), "America/New_York")
+	assert.Equal(t, zoneInfoName("../usr/share/zoneinfo/UTC"), "UTC")
+	assert.Equal(t, zoneInfoName("/etc/localtime.orig"), "")
+}
+
+func TestTZEnv(t *testing.T) {
+	assert.Equal(t, tzEnv("UTC"), "UTC")
+	assert.Equal(t, tzEnv(":UTC"), "UTC")
+	assert.Equal(t, tzEnv(""), "")
+	assert.Equal(t, tzEnv("/usr/share/zoneinfo/UTC"), "")
+	assert.Equal(t, tzEnv("JST-9"), "")
+	assert.Equal(t, tzEnv("No/Such_Zone"), "")
+}
@@ -0,0 +1,53 @@
+package qemu
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/digitalocean/go-qemu/qmp"
+	"github.com/digitalocean/go-qemu/qmp/raw"
+	"github.com/docker/go-units"
+	"github.com/sirupsen/logrus"
+)
+
+// SetBalloon asks the guest of the running instance to shrink (or grow) its memory to sizeBytes,
+// using the QMP `balloon` command via the QMP connection of the host agent. Requires `memoryBalloon: true`.
+//
+// sizeBytes must not exceed the memory of the instance. The guest releases the memory asynchronously;
+// see GetBalloon for the actual size.
+func SetBalloon(qmpClient qmp.Monitor, sizeBytes int64) error {
+	if sizeBytes <= 0 {
+		return fmt.Errorf("balloon size must be positive, got %d", sizeBytes)
+	}
+	rawClient := raw.NewMonitor(qmpClient)
+	mem, err := rawClient.QueryMemorySizeSummary()
+	if err != nil {
+		return fmt.Errorf("failed to query the memory size: %w", err)
+	}
+	if uint64(sizeBytes) > mem.BaseMemory {
+		return fmt.Errorf("balloon size %s exceeds the memory of the instance (%s)",
+			units.BytesSize(float64(sizeBytes)), units.BytesSize(float64(mem.BaseMemory)))
+	}
+	logrus.Infof("Setting the balloon size to %s via QMP", units.BytesSize(float64(sizeBytes)))
+	if err := rawClient.Balloon(sizeBytes); err != nil {
+		return balloonError(err)
+	}
+	return nil
+}
+
+// GetBalloon returns the current memory size of the guest of the running instance, as reported by the balloon device.
+func GetBalloon(qmpClient qmp.Monitor) (int64, error) {
+	info, err := raw.NewMonitor(qmpClient).QueryBalloon()
+	if err != nil {
+		return 0, balloonError(err)
+	}
+	return info.Actual, nil
+}
+
+func balloonError(err error) error {
+	// QMP errors only carry the description, e.g. "No balloon device has been activated"
+	if strings.Contains(err.Error(), "No balloon device") {
+		return fmt.Errorf("the balloon device is not available (Hint: set `memoryBalloon: true` and restart the instance): %w", err)
+	}
+	return err
+}
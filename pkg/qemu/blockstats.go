@@ -0,0 +1,66 @@
+package qemu
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/digitalocean/go-qemu/qmp"
+	"github.com/digitalocean/go-qemu/qmp/raw"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+)
+
+// DiskIOCounters is the cumulative I/O of the disk of the instance since QEMU was started.
+type DiskIOCounters struct {
+	ReadBytes       int64
+	WriteBytes      int64
+	ReadOperations  int64
+	WriteOperations int64
+}
+
+// QueryDiskStats returns the I/O counters of the diffdisk (or the basedisk, when the diffdisk is not created)
+// of the running instance, using the QMP `query-blockstats` command via the QMP connection of the host agent.
+func QueryDiskStats(qmpClient qmp.Monitor, instDir string) (*DiskIOCounters, error) {
+	disk := filepath.Join(instDir, filenames.DiffDisk)
+	if _, err := os.Stat(disk); errors.Is(err, os.ErrNotExist) {
+		disk = filepath.Join(instDir, filenames.BaseDisk)
+	}
+	rawClient := raw.NewMonitor(qmpClient)
+	blocks, err := rawClient.QueryBlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query the block devices: %w", err)
+	}
+	stats, err := rawClient.QueryBlockstats(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query the block device stats: %w", err)
+	}
+	return findDiskStats(blocks, stats, disk)
+}
+
+// findDiskStats returns the counters of the block device whose image is file.
+// The stats are only associated with the device name, so the name is looked up from the result of `query-block`.
+func findDiskStats(blocks []raw.BlockInfo, stats []raw.BlockStats, file string) (*DiskIOCounters, error) {
+	var device string
+	for _, b := range blocks {
+		if b.Inserted != nil && b.Inserted.File == file {
+			device = b.Device
+			break
+		}
+	}
+	if device == "" {
+		return nil, fmt.Errorf("no block device is backed by %q", file)
+	}
+	for _, s := range stats {
+		if s.Device == nil || *s.Device != device {
+			continue
+		}
+		return &DiskIOCounters{
+			ReadBytes:       s.Stats.RdBytes,
+			WriteBytes:      s.Stats.WrBytes,
+			ReadOperations:  s.Stats.RdOperations,
+			WriteOperations: s.Stats.WrOperations,
+		}, nil
+	}
+	return nil, fmt.Errorf("no stats were reported for the block device %q", device)
+}
@@ -0,0 +1,30 @@
+package qemu
+
+import (
+	"testing"
+
+	"github.com/digitalocean/go-qemu/qmp/raw"
+	"github.com/xorcare/pointer"
+	"gotest.tools/v3/assert"
+)
+
+func TestFindDiskStats(t *testing.T) {
+	blocks := []raw.BlockInfo{
+		{Device: "ide2-cd0", Inserted: &raw.BlockDeviceInfo{File: "/lima/default/cidata.iso"}},
+		{Device: "virtio0", Inserted: &raw.BlockDeviceInfo{File: "/lima/default/diffdisk"}},
+		{Device: "floppy0"},
+	}
+	stats := []raw.BlockStats{
+		{Device: pointer.String("ide2-cd0"), Stats: raw.BlockDeviceStats{RdBytes: 1}},
+		{Device: pointer.String("virtio0"), Stats: raw.BlockDeviceStats{RdBytes: 100, WrBytes: 200, RdOperations: 3, WrOperations: 4}},
+	}
+	res, err := findDiskStats(blocks, stats, "/lima/default/diffdisk")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, &DiskIOCounters{ReadBytes: 100, WriteBytes: 200, ReadOperations: 3, WriteOperations: 4}, res)
+
+	_, err = findDiskStats(blocks, stats, "/lima/default/basedisk")
+	assert.ErrorContains(t, err, "no block device")
+
+	_, err = findDiskStats(blocks, stats[:1], "/lima/default/diffdisk")
+	assert.ErrorContains(t, err, "no stats")
+}
@@ -0,0 +1,118 @@
+package qemu
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+)
+
+// BridgeConf is the ACL file of qemu-bridge-helper.
+const BridgeConf = "/etc/qemu/bridge.conf"
+
+// bridgeHelper returns the path of qemu-bridge-helper, or "" when it is not found.
+func bridgeHelper(exe string) string {
+	var candidates []string
+	if exePath, err := exec.LookPath(exe); err == nil {
+		if exePath, err = filepath.EvalSymlinks(exePath); err == nil {
+			candidates = append(candidates, filepath.Join(filepath.Dir(exePath), "../libexec/qemu-bridge-helper"))
+		}
+	}
+	candidates = append(candidates,
+		"/usr/lib/qemu/qemu-bridge-helper", // Debian, Ubuntu
+		"/usr/libexec/qemu-bridge-helper",  // Fedora
+		"/usr/local/libexec/qemu-bridge-helper",
+	)
+	for _, f := range candidates {
+		if _, err := os.Stat(f); err == nil {
+			return filepath.Clean(f)
+		}
+	}
+	return ""
+}
+
+// CheckBridgeNetworks checks that the bridges of `networks` exist, and that qemu-bridge-helper
+// has the privileges to attach tap devices to them.
+// The errors contain hints for fixing them, unlike the errors printed by QEMU.
+func CheckBridgeNetworks(exe string, y *limayaml.LimaYAML) error {
+	for _, nw := range y.Networks {
+		if nw.Bridge == "" {
+			continue
+		}
+		if err := checkBridge(exe, nw.Bridge); err != nil {
+			return fmt.Errorf("cannot use bridge %q: %w", nw.Bridge, err)
+		}
+	}
+	return nil
+}
+
+func checkBridge(exe, bridge string) error {
+	if _, err := net.InterfaceByName(bridge); err != nil {
+		return fmt.Errorf("the bridge interface does not exist on the host ( Hint: `sudo ip link add name %s type bridge` ): %w", bridge, err)
+	}
+	helper := bridgeHelper(exe)
+	if helper == "" {
+		return errors.New("qemu-bridge-helper is not found ( Hint: install the package that provides qemu-bridge-helper, e.g., `qemu-system-common` )")
+	}
+	st, err := os.Stat(helper)
+	if err != nil {
+		return err
+	}
+	if os.Geteuid() != 0 {
+		sys, ok := st.Sys().(*syscall.Stat_t)
+		if st.Mode()&os.ModeSetuid == 0 || !ok || sys.Uid != 0 {
+			return fmt.Errorf("%q needs to be setuid root to create tap devices ( Hint: `sudo chown root %s && sudo chmod u+s %s` )",
+				helper, helper, helper)
+		}
+	}
+	allowed, err := bridgeAllowed(BridgeConf, bridge)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return fmt.Errorf("%q does not allow the bridge ( Hint: `echo allow %s | sudo tee -a %s` )", BridgeConf, bridge, BridgeConf)
+	}
+	return nil
+}
+
+// bridgeAllowed checks the ACL of qemu-bridge-helper.
+// The ACL is assumed to be allowed when it can't be read (e.g., mode 0640 owned by another group),
+// or when it includes other files.
+func bridgeAllowed(conf, bridge string) (bool, error) {
+	f, err := os.Open(conf)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return true, nil
+	}
+	defer f.Close()
+	var allowed bool
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		switch fields[0] {
+		case "include":
+			return true, nil
+		case "allow":
+			if fields[1] == bridge || fields[1] == "all" {
+				allowed = true
+			}
+		case "deny":
+			if fields[1] == bridge || fields[1] == "all" {
+				allowed = false
+			}
+		}
+	}
+	return allowed, scanner.Err()
+}
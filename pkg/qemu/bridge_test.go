@@ -0,0 +1,33 @@
+package qemu
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestBridgeAllowed(t *testing.T) {
+	conf := filepath.Join(t.TempDir(), "bridge.conf")
+
+	allowed, err := bridgeAllowed(conf, "br0")
+	assert.NilError(t, err)
+	assert.Assert(t, !allowed, "missing bridge.conf must not allow anything")
+
+	for _, tc := range []struct {
+		content string
+		allowed bool
+	}{
+		{"allow br0\n", true},
+		{"allow br1\n", false},
+		{"# comment\nallow all\n", true},
+		{"allow all\ndeny br0\n", false},
+		{"include /etc/qemu/other.conf\n", true},
+	} {
+		assert.NilError(t, os.WriteFile(conf, []byte(tc.content), 0644))
+		allowed, err := bridgeAllowed(conf, "br0")
+		assert.NilError(t, err)
+		assert.Equal(t, allowed, tc.allowed, tc.content)
+	}
+}
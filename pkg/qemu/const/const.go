@@ -7,4 +7,6 @@ const (
 	SlirpGateway   = "192.168.5.2"
 	SlirpDNS       = "192.168.5.3"
 	SlirpIPAddress = "192.168.5.15"
+	// SlirpIPv6Network is only used when `network.ipv6` is true; the guest gets its address with SLAAC.
+	SlirpIPv6Network = "fd00:5::/64"
 )
@@ -0,0 +1,179 @@
+package qemu
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/containerd/continuity/fs"
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/localpathutil"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/sirupsen/logrus"
+)
+
+// firmwareArgs returns the pflash drives of the UEFI firmware: the read-only code, and the writable variable store
+// of the instance.
+//
+// The variable store is omitted when no template is known (see resolveFirmware), unless it was already created.
+// It is created from the template by Prepare, so that firmwareArgs does not modify the instance directory.
+//
+// With `firmware.secureBoot`, the variable store is only writable via SMM on x86_64; SMM is enabled by Cmdline.
+func firmwareArgs(cfg Config, exe string) ([]string, error) {
+	y := cfg.LimaYAML
+	code, varsTemplate, err := resolveFirmware(y, exe)
+	if err != nil {
+		return nil, err
+	}
+	var args []string
+	if *y.Firmware.SecureBoot && *y.Arch == limayaml.X8664 {
+		args = append(args, "-global", "driver=cfi.pflash01,property=secure,value=on")
+	}
+	args = append(args, "-drive", fmt.Sprintf("if=pflash,format=raw,readonly=on,file=%s", code))
+	efiVars := filepath.Join(cfg.InstanceDir, filenames.EFIVars)
+	if _, err := os.Stat(efiVars); err == nil || varsTemplate != "" {
+		args = append(args, "-drive", fmt.Sprintf("if=pflash,format=raw,file=%s", efiVars))
+	} else {
+		logrus.Debugf("no UEFI variable store template was found for %q, the UEFI variables will not persist", code)
+	}
+	return args, nil
+}
+
+// resolveFirmware returns the code of the UEFI firmware, and the template of the variable store.
+// They are `firmware.code` and `firmware.vars`, or found by getFirmware when `firmware.code` is empty.
+// exe is only used for getFirmware.
+func resolveFirmware(y *limayaml.LimaYAML, exe string) (string, string, error) {
+	code, varsTemplate := *y.Firmware.Code, *y.Firmware.Vars
+	if code == "" {
+		return getFirmware(exe, *y.Arch, *y.Firmware.SecureBoot)
+	}
+	code, err := localpathutil.Expand(code)
+	if err != nil {
+		return "", "", err
+	}
+	if varsTemplate != "" {
+		varsTemplate, err = localpathutil.Expand(varsTemplate)
+		if err != nil {
+			return "", "", err
+		}
+	}
+	return code, varsTemplate, nil
+}
+
+// ensureEFIVars copies the template of the UEFI variable store to efiVars, unless efiVars already exists.
+// The variables written by the guest are kept across restarts.
+// An empty template is ignored.
+func ensureEFIVars(efiVars, template string) error {
+	if _, err := os.Stat(efiVars); err == nil || !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if template == "" {
+		return nil
+	}
+	// Copied via a temporary file, so that an interrupted copy is not mistaken for a variable store
+	tmp := efiVars + ".tmp"
+	if err := fs.CopyFile(tmp, template); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to copy the UEFI variable store template %q: %w", template, err)
+	}
+	return os.Rename(tmp, efiVars)
+}
+
+// firmwareCandidate is a UEFI firmware code, and the template of the variable store built with it.
+// The vars are empty when the firmware is not shipped with a template.
+type firmwareCandidate struct {
+	code string
+	vars string
+}
+
+func firmwareCandidates(qemuExe string, arch limayaml.Arch, secureBoot bool) []firmwareCandidate {
+	if secureBoot {
+		return secureBootFirmwareCandidates(arch)
+	}
+	binDir := filepath.Dir(qemuExe)  // "/usr/local/bin"
+	localDir := filepath.Dir(binDir) // "/usr/local"
+
+	// macOS (homebrew)
+	varsArch := "i386"
+	if arch == limayaml.AARCH64 {
+		varsArch = "arm"
+	}
+	candidates := []firmwareCandidate{{
+		code: filepath.Join(localDir, fmt.Sprintf("share/qemu/edk2-%s-code.fd", arch)),
+		vars: filepath.Join(localDir, fmt.Sprintf("share/qemu/edk2-%s-vars.fd", varsArch)),
+	}}
+
+	switch arch {
+	case limayaml.X8664:
+		// Debian package "ovmf"
+		candidates = append(candidates, firmwareCandidate{code: "/usr/share/OVMF/OVMF_CODE.fd", vars: "/usr/share/OVMF/OVMF_VARS.fd"})
+		// openSUSE package "qemu-ovmf-x86_64"
+		candidates = append(candidates, firmwareCandidate{code: "/usr/share/qemu/ovmf-x86_64-code.bin", vars: "/usr/share/qemu/ovmf-x86_64-vars.bin"})
+	case limayaml.AARCH64:
+		// Debian package "qemu-efi-aarch64"
+		candidates = append(candidates, firmwareCandidate{code: "/usr/share/AAVMF/AAVMF_CODE.fd", vars: "/usr/share/AAVMF/AAVMF_VARS.fd"})
+		// Debian package "qemu-efi-aarch64" (unpadded, backwards compatibility)
+		candidates = append(candidates, firmwareCandidate{code: "/usr/share/qemu-efi-aarch64/QEMU_EFI.fd"})
+	}
+	return candidates
+}
+
+// secureBootFirmwareCandidates returns the firmware with Secure Boot, and the templates of the variable store
+// with the Microsoft keys enrolled, so that the distro kernels signed with the shim are accepted.
+// Homebrew does not ship a template with the keys enrolled.
+func secureBootFirmwareCandidates(arch limayaml.Arch) []firmwareCandidate {
+	switch arch {
+	case limayaml.X8664:
+		return []firmwareCandidate{
+			// Debian package "ovmf" (since bookworm)
+			{code: "/usr/share/OVMF/OVMF_CODE_4M.secboot.fd", vars: "/usr/share/OVMF/OVMF_VARS_4M.ms.fd"},
+			// Debian package "ovmf"
+			{code: "/usr/share/OVMF/OVMF_CODE.secboot.fd", vars: "/usr/share/OVMF/OVMF_VARS.ms.fd"},
+			// Fedora package "edk2-ovmf"
+			{code: "/usr/share/edk2/ovmf/OVMF_CODE.secboot.fd", vars: "/usr/share/edk2/ovmf/OVMF_VARS.secboot.fd"},
+			// openSUSE package "qemu-ovmf-x86_64"
+			{code: "/usr/share/qemu/ovmf-x86_64-smm-ms-code.bin", vars: "/usr/share/qemu/ovmf-x86_64-smm-ms-vars.bin"},
+		}
+	case limayaml.AARCH64:
+		return []firmwareCandidate{
+			// Debian package "qemu-efi-aarch64"
+			{code: "/usr/share/AAVMF/AAVMF_CODE.ms.fd", vars: "/usr/share/AAVMF/AAVMF_VARS.ms.fd"},
+		}
+	}
+	return nil
+}
+
+// getFirmware returns the UEFI firmware code, and the template of the variable store.
+// The template is empty when it is not found, except for secureBoot, which requires the template with the keys.
+func getFirmware(qemuExe string, arch limayaml.Arch, secureBoot bool) (string, string, error) {
+	candidates := firmwareCandidates(qemuExe, arch, secureBoot)
+	logrus.Debugf("firmware candidates = %v", candidates)
+
+	for _, f := range candidates {
+		if _, err := os.Stat(f.code); err != nil {
+			continue
+		}
+		vars := f.vars
+		if vars != "" {
+			if _, err := os.Stat(vars); err != nil {
+				logrus.Debugf("the UEFI variable store template %q is not found", vars)
+				vars = ""
+			}
+		}
+		if secureBoot && vars == "" {
+			continue
+		}
+		return f.code, vars, nil
+	}
+
+	if secureBoot {
+		return "", "", fmt.Errorf("could not find a Secure Boot firmware with the Microsoft keys enrolled for arch %q"+
+			" (hint: install the OVMF (x86_64) or AAVMF (aarch64) package of the distro, or set `firmware.code` and `firmware.vars`)", arch)
+	}
+
+	if arch == limayaml.X8664 {
+		return "", "", fmt.Errorf("could not find firmware for %q (hint: try setting `firmware.legacyBIOS` to `true`)", qemuExe)
+	}
+	return "", "", fmt.Errorf("could not find firmware for %q", qemuExe)
+}
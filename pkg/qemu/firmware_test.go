@@ -0,0 +1,86 @@
+package qemu
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/xorcare/pointer"
+	"gotest.tools/v3/assert"
+)
+
+func TestFirmwareArgs(t *testing.T) {
+	dir := t.TempDir()
+	code := filepath.Join(dir, "OVMF_CODE.fd")
+	vars := filepath.Join(dir, "OVMF_VARS.fd")
+	assert.NilError(t, os.WriteFile(vars, []byte("template"), 0o644))
+	instDir := t.TempDir()
+	y := &limayaml.LimaYAML{
+		Arch:        pointer.String(limayaml.X8664),
+		Firmware:    limayaml.Firmware{LegacyBIOS: pointer.Bool(false), Code: pointer.String(code), Vars: pointer.String(""), SecureBoot: pointer.Bool(false)},
+		SerialCount: pointer.Int(1),
+	}
+	args, err := firmwareArgs(Config{InstanceDir: instDir, LimaYAML: y}, "qemu-system-x86_64")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, args, []string{"-drive", "if=pflash,format=raw,readonly=on,file=" + code})
+
+	y.Firmware.Vars = pointer.String(vars)
+	efiVars := filepath.Join(instDir, "efivars.fd")
+	args, err = firmwareArgs(Config{InstanceDir: instDir, LimaYAML: y}, "qemu-system-x86_64")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, args, []string{
+		"-drive", "if=pflash,format=raw,readonly=on,file=" + code,
+		"-drive", "if=pflash,format=raw,file=" + efiVars,
+	})
+	// the variable store is created by Prepare, not by firmwareArgs
+	_, err = os.Stat(efiVars)
+	assert.Assert(t, errors.Is(err, os.ErrNotExist))
+	assert.NilError(t, Prepare(Config{InstanceDir: instDir, LimaYAML: y}))
+	b, err := os.ReadFile(efiVars)
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), "template")
+
+	// the variables written by the guest are not overwritten by the template
+	assert.NilError(t, os.WriteFile(efiVars, []byte("modified"), 0o644))
+	assert.NilError(t, Prepare(Config{InstanceDir: instDir, LimaYAML: y}))
+	b, err = os.ReadFile(efiVars)
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), "modified")
+}
+
+func TestGetFirmware(t *testing.T) {
+	prefix := t.TempDir()
+	exe := filepath.Join(prefix, "bin", "qemu-system-x86_64")
+	code := filepath.Join(prefix, "share", "qemu", "edk2-x86_64-code.fd")
+	vars := filepath.Join(prefix, "share", "qemu", "edk2-i386-vars.fd")
+	assert.NilError(t, os.MkdirAll(filepath.Dir(code), 0o755))
+	assert.NilError(t, os.WriteFile(code, []byte("code"), 0o644))
+
+	gotCode, gotVars, err := getFirmware(exe, limayaml.X8664, false)
+	assert.NilError(t, err)
+	assert.Equal(t, gotCode, code)
+	assert.Equal(t, gotVars, "")
+
+	assert.NilError(t, os.WriteFile(vars, []byte("vars"), 0o644))
+	gotCode, gotVars, err = getFirmware(exe, limayaml.X8664, false)
+	assert.NilError(t, err)
+	assert.Equal(t, gotCode, code)
+	assert.Equal(t, gotVars, vars)
+}
+
+func TestGetFirmwareSecureBoot(t *testing.T) {
+	// Homebrew does not ship a template with the keys enrolled, so the firmware is not used for Secure Boot
+	prefix := t.TempDir()
+	exe := filepath.Join(prefix, "bin", "qemu-system-aarch64")
+	assert.NilError(t, os.MkdirAll(filepath.Join(prefix, "share", "qemu"), 0o755))
+	for _, f := range []string{"edk2-aarch64-code.fd", "edk2-arm-vars.fd"} {
+		assert.NilError(t, os.WriteFile(filepath.Join(prefix, "share", "qemu", f), nil, 0o644))
+	}
+	if _, err := os.Stat("/usr/share/AAVMF/AAVMF_VARS.ms.fd"); err == nil {
+		t.Skip("the Secure Boot firmware is installed on the host")
+	}
+	_, _, err := getFirmware(exe, limayaml.AARCH64, true)
+	assert.ErrorContains(t, err, "could not find a Secure Boot firmware")
+}
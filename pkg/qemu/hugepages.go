@@ -0,0 +1,97 @@
+package qemu
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/docker/go-units"
+	"github.com/lima-vm/lima/pkg/limayaml"
+)
+
+// HugepagesPath is the mount point of hugetlbfs used for `memoryBackend: hugepages`.
+const HugepagesPath = "/dev/hugepages"
+
+// CheckHugepages checks that hugetlbfs is mounted on HugepagesPath, and that enough hugepages are free
+// for the memory of the instance, when `memoryBackend` is "hugepages".
+// The errors contain hints for fixing them, unlike the errors printed by QEMU.
+func CheckHugepages(y *limayaml.LimaYAML) error {
+	if *y.MemoryBackend != limayaml.MemoryBackendHugepages {
+		return nil
+	}
+	mounts, err := os.Open("/proc/mounts")
+	if err != nil {
+		return err
+	}
+	defer mounts.Close()
+	mounted, err := isHugetlbfsMounted(mounts, HugepagesPath)
+	if err != nil {
+		return err
+	}
+	if !mounted {
+		return fmt.Errorf("hugetlbfs is not mounted on %q ( Hint: `sudo mount -t hugetlbfs hugetlbfs %s` )", HugepagesPath, HugepagesPath)
+	}
+
+	memBytes, err := units.RAMInBytes(*y.Memory)
+	if err != nil {
+		return err
+	}
+	meminfo, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return err
+	}
+	defer meminfo.Close()
+	free, pageSize, err := freeHugepages(meminfo)
+	if err != nil {
+		return err
+	}
+	if pageSize == 0 {
+		return fmt.Errorf("the kernel does not support hugepages")
+	}
+	if free*pageSize < memBytes {
+		needed := (memBytes + pageSize - 1) / pageSize
+		return fmt.Errorf("not enough hugepages are free: %d pages (%s) are needed for the memory of the instance, but only %d pages are free "+
+			"( Hint: `echo %d | sudo tee /proc/sys/vm/nr_hugepages`, or reserve them on the kernel command line )",
+			needed, units.BytesSize(float64(memBytes)), free, needed)
+	}
+	return nil
+}
+
+// isHugetlbfsMounted parses /proc/mounts.
+func isHugetlbfsMounted(r io.Reader, mountPoint string) (bool, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 3 && fields[1] == mountPoint && fields[2] == "hugetlbfs" {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// freeHugepages parses /proc/meminfo, and returns the number of the free hugepages and the size of a hugepage in bytes.
+func freeHugepages(r io.Reader) (int64, int64, error) {
+	var free, pageSize int64
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		v, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "HugePages_Free:":
+			free = v
+		case "Hugepagesize:":
+			// always in kB
+			pageSize = v << 10
+		}
+	}
+	return free, pageSize, scanner.Err()
+}
@@ -0,0 +1,34 @@
+package qemu
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestIsHugetlbfsMounted(t *testing.T) {
+	const mounts = `sysfs /sys sysfs rw,nosuid,nodev,noexec,relatime 0 0
+hugetlbfs /dev/hugepages hugetlbfs rw,relatime,pagesize=2M 0 0
+`
+	mounted, err := isHugetlbfsMounted(strings.NewReader(mounts), "/dev/hugepages")
+	assert.NilError(t, err)
+	assert.Assert(t, mounted)
+
+	mounted, err = isHugetlbfsMounted(strings.NewReader(mounts), "/mnt/huge")
+	assert.NilError(t, err)
+	assert.Assert(t, !mounted)
+}
+
+func TestFreeHugepages(t *testing.T) {
+	const meminfo = `MemTotal:       16283280 kB
+HugePages_Total:    2048
+HugePages_Free:     1024
+HugePages_Rsvd:        0
+Hugepagesize:       2048 kB
+`
+	free, pageSize, err := freeHugepages(strings.NewReader(meminfo))
+	assert.NilError(t, err)
+	assert.Equal(t, free, int64(1024))
+	assert.Equal(t, pageSize, int64(2<<20))
+}
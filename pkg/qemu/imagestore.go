@@ -0,0 +1,129 @@
+package qemu
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/containerd/continuity/fs"
+	"github.com/lima-vm/lima/pkg/downloader"
+	"github.com/lima-vm/lima/pkg/lockutil"
+	"github.com/lima-vm/lima/pkg/store/dirnames"
+	"github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
+)
+
+// sharedImagePath returns the path of the image with the digest d in the image store dir,
+// i.e., `<dir>/<ALGO>/<ENCODED>`.
+func sharedImagePath(dir string, d digest.Digest) (string, error) {
+	if err := d.Validate(); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, d.Algorithm().String(), d.Encoded()), nil
+}
+
+// ensureSharedImage downloads the image with the digest d from the mirrors into the image store dir,
+// unless it is already stored, and links baseDisk to the stored image with linkOrCopy.
+// It returns the path of the stored image.
+//
+// The image store is locked during the download and the link, so that the instances created concurrently
+// from the same image download it only once, and PruneImageStore does not remove the image before it is linked.
+// The stored image is read-only, as it is shared by the base disks of the instances.
+func ensureSharedImage(dir, baseDisk string, d digest.Digest, mirrors []string, opts ...downloader.Opt) (string, error) {
+	shared, err := sharedImagePath(dir, d)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(shared), 0755); err != nil {
+		return "", err
+	}
+	err = lockutil.WithDirLock(dir, func() error {
+		if _, err := os.Stat(shared); errors.Is(err, os.ErrNotExist) {
+			if err := downloadSharedImage(shared, d, mirrors, opts...); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+		return linkOrCopy(baseDisk, shared)
+	})
+	if err != nil {
+		return "", err
+	}
+	return shared, nil
+}
+
+// downloadSharedImage downloads the image with the digest d from the mirrors to shared.
+// It must be called with the lock of the image store held.
+func downloadSharedImage(shared string, d digest.Digest, mirrors []string, opts ...downloader.Opt) error {
+	// Downloaded via a temporary file, so that an interrupted download is not mistaken for an image
+	tmp := shared + ".tmp"
+	if err := os.RemoveAll(tmp); err != nil {
+		return err
+	}
+	res, err := downloader.DownloadMirrors(tmp, mirrors, append(opts, downloader.WithExpectedDigest(d))...)
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	switch res.Status {
+	case downloader.StatusDownloaded:
+		logrus.WithField("mirror", res.Remote).Infof("Downloaded image from %q", res.Remote)
+	case downloader.StatusUsedCache:
+		logrus.Infof("Using cache %q", res.CachePath)
+	default:
+		logrus.Warnf("Unexpected result from downloader.Download(): %+v", res)
+	}
+	if err := os.Chmod(tmp, 0444); err != nil {
+		return err
+	}
+	return os.Rename(tmp, shared)
+}
+
+// linkOrCopy hard-links src to dst, or copies src to dst when src cannot be linked,
+// e.g., when dst is on another filesystem.
+func linkOrCopy(dst, src string) error {
+	err := os.Link(src, dst)
+	if err == nil {
+		return nil
+	}
+	logrus.WithError(err).Debugf("failed to link %q to %q, copying", src, dst)
+	if err := fs.CopyFile(dst, src); err != nil {
+		_ = os.Remove(dst)
+		return err
+	}
+	return nil
+}
+
+// PruneImageStore removes the images in the image store (`${LIMA_HOME}/_images`)
+// that are no longer linked from the base disk of any instance.
+func PruneImageStore() error {
+	dir, err := dirnames.LimaImagesDir()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return lockutil.WithDirLock(dir, func() error {
+		return filepath.WalkDir(dir, func(path string, e os.DirEntry, err error) error {
+			if err != nil || e.IsDir() {
+				return err
+			}
+			if strings.HasSuffix(path, ".tmp") {
+				return os.Remove(path)
+			}
+			fi, err := e.Info()
+			if err != nil {
+				return err
+			}
+			if st, ok := fi.Sys().(*syscall.Stat_t); ok && st.Nlink > 1 {
+				return nil
+			}
+			logrus.Infof("Removing the unused image %q", path)
+			return os.Remove(path)
+		})
+	})
+}
@@ -0,0 +1,53 @@
+package qemu
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/opencontainers/go-digest"
+	"gotest.tools/v3/assert"
+)
+
+func TestEnsureSharedImage(t *testing.T) {
+	limaHome := t.TempDir()
+	t.Setenv("LIMA_HOME", limaHome)
+	imagesDir := filepath.Join(limaHome, filenames.ImagesDir)
+
+	content := []byte("image")
+	image := filepath.Join(t.TempDir(), "image.img")
+	assert.NilError(t, os.WriteFile(image, content, 0644))
+	d := digest.FromBytes(content)
+
+	baseDisk := filepath.Join(t.TempDir(), filenames.BaseDisk)
+	shared, err := ensureSharedImage(imagesDir, baseDisk, d, []string{image})
+	assert.NilError(t, err)
+	assert.Equal(t, filepath.Join(imagesDir, "sha256", d.Encoded()), shared)
+	fi, err := os.Stat(shared)
+	assert.NilError(t, err)
+	assert.Equal(t, os.FileMode(0444), fi.Mode().Perm())
+	b, err := os.ReadFile(baseDisk)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, content, b)
+
+	// the stored image is used without accessing the mirrors
+	otherBaseDisk := filepath.Join(t.TempDir(), filenames.BaseDisk)
+	again, err := ensureSharedImage(imagesDir, otherBaseDisk, d, []string{filepath.Join(t.TempDir(), "missing.img")})
+	assert.NilError(t, err)
+	assert.Equal(t, shared, again)
+	assert.NilError(t, os.Remove(otherBaseDisk))
+
+	_, err = ensureSharedImage(imagesDir, filepath.Join(t.TempDir(), filenames.BaseDisk), digest.FromString("other"), []string{image})
+	assert.ErrorContains(t, err, "expected digest")
+
+	// the image is kept while it is linked from the base disk
+	assert.NilError(t, PruneImageStore())
+	_, err = os.Stat(shared)
+	assert.NilError(t, err)
+
+	assert.NilError(t, os.Remove(baseDisk))
+	assert.NilError(t, PruneImageStore())
+	_, err = os.Stat(shared)
+	assert.Assert(t, os.IsNotExist(err))
+}
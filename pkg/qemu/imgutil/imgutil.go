@@ -11,7 +11,9 @@ import (
 
 // Info corresponds to the output of `qemu-img info --output=json FILE`
 type Info struct {
-	Format string `json:"format,omitempty"` // since QEMU 1.3
+	Format                string `json:"format,omitempty"`                  // since QEMU 1.3
+	BackingFilename       string `json:"backing-filename,omitempty"`        // since QEMU 1.3
+	BackingFilenameFormat string `json:"backing-filename-format,omitempty"` // since QEMU 1.3
 }
 
 func GetInfo(f string) (*Info, error) {
@@ -30,6 +32,8 @@ func GetInfo(f string) (*Info, error) {
 	return &imgInfo, nil
 }
 
+// DetectFormat detects the format of the image f from its extension, or with `qemu-img info`.
+// The format is passed as the backing format (`-F`) when the image is used as a backing file.
 func DetectFormat(f string) (string, error) {
 	switch ext := strings.ToLower(filepath.Ext(f)); ext {
 	case ".qcow2":
@@ -0,0 +1,35 @@
+package imgutil
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestDetectFormat(t *testing.T) {
+	// detected from the extension, without running qemu-img
+	format, err := DetectFormat("/nonexistent/image.QCOW2")
+	assert.NilError(t, err)
+	assert.Equal(t, "qcow2", format)
+	format, err = DetectFormat("/nonexistent/image.raw")
+	assert.NilError(t, err)
+	assert.Equal(t, "raw", format)
+
+	if _, err := exec.LookPath("qemu-img"); err != nil {
+		t.Skip("qemu-img is not installed")
+	}
+	dir := t.TempDir()
+	for _, f := range []string{"raw", "qcow2"} {
+		// the base disk has no extension
+		img := filepath.Join(dir, "basedisk-"+f)
+		out, err := exec.Command("qemu-img", "create", "-f", f, img, "1M").CombinedOutput()
+		assert.NilError(t, err, string(out))
+		format, err := DetectFormat(img)
+		assert.NilError(t, err)
+		assert.Equal(t, f, format)
+	}
+	_, err = DetectFormat(filepath.Join(dir, "missing"))
+	assert.Assert(t, err != nil)
+}
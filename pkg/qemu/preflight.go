@@ -0,0 +1,59 @@
+package qemu
+
+import (
+	"fmt"
+	"os/exec"
+
+	"github.com/docker/go-units"
+	"github.com/hashicorp/go-multierror"
+)
+
+// Preflight checks the prerequisites of starting the instance on the host, without starting it:
+// qemu-system-<ARCH> and qemu-img, the QEMU version, the accelerator, the firmware, and the sizes.
+// The host-specific checks of the host agent (bridges, hugepages, PCI passthrough) are run too.
+//
+// Unlike Cmdline, Preflight does not stop at the first problem, so that all of them can be fixed at once.
+// cfg.LimaYAML must be filled with the defaults.
+func Preflight(cfg Config) error {
+	y := cfg.LimaYAML
+	var mErr error
+	if _, err := units.RAMInBytes(*y.Memory); err != nil {
+		mErr = multierror.Append(mErr, fmt.Errorf("field `memory` has an invalid value: %w", err))
+	}
+	if _, err := units.RAMInBytes(*y.Disk); err != nil {
+		mErr = multierror.Append(mErr, fmt.Errorf("field `disk` has an invalid value: %w", err))
+	}
+	if _, err := exec.LookPath("qemu-img"); err != nil {
+		mErr = multierror.Append(mErr, err)
+	}
+	if err := CheckHugepages(y); err != nil {
+		mErr = multierror.Append(mErr, err)
+	}
+	if err := CheckPCIPassthrough(y); err != nil {
+		mErr = multierror.Append(mErr, err)
+	}
+
+	exe, _, err := getExe(*y.Arch)
+	if err != nil {
+		// the remaining checks depend on the QEMU binary
+		return multierror.Append(mErr, err).ErrorOrNil()
+	}
+	if err := checkVersion(exe); err != nil {
+		mErr = multierror.Append(mErr, err)
+	}
+	if features, err := inspectFeatures(exe); err != nil {
+		mErr = multierror.Append(mErr, err)
+	} else if _, err := checkAccel(y, exe, features); err != nil {
+		mErr = multierror.Append(mErr, err)
+	}
+	// `firmware.code` is validated by limayaml.Validate
+	if usesUEFI(y) && *y.Firmware.Code == "" {
+		if _, _, err := getFirmware(exe, *y.Arch, *y.Firmware.SecureBoot); err != nil {
+			mErr = multierror.Append(mErr, err)
+		}
+	}
+	if err := CheckBridgeNetworks(exe, y); err != nil {
+		mErr = multierror.Append(mErr, err)
+	}
+	return mErr
+}
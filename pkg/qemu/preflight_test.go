@@ -0,0 +1,25 @@
+package qemu
+
+import (
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/xorcare/pointer"
+	"gotest.tools/v3/assert"
+)
+
+func TestPreflight(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	t.Setenv("QEMU_SYSTEM_X86_64", "")
+	y := &limayaml.LimaYAML{
+		Arch:          pointer.String(limayaml.X8664),
+		Memory:        pointer.String("4 apples"),
+		Disk:          pointer.String("100GiB"),
+		MemoryBackend: pointer.String(limayaml.MemoryBackendRAM),
+	}
+	err := Preflight(Config{LimaYAML: y})
+	assert.ErrorContains(t, err, "3 errors occurred")
+	assert.ErrorContains(t, err, "field `memory`")
+	assert.ErrorContains(t, err, "\"qemu-img\"")
+	assert.ErrorContains(t, err, "\"qemu-system-x86_64\"")
+}
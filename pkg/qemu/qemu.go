@@ -2,9 +2,14 @@ package qemu
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io/fs"
+	"math"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -12,14 +17,19 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/alessio/shellescape"
 	"github.com/docker/go-units"
 	"github.com/lima-vm/lima/pkg/downloader"
 	"github.com/lima-vm/lima/pkg/iso9660util"
 	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/localpathutil"
 	"github.com/lima-vm/lima/pkg/networks"
+	"github.com/lima-vm/lima/pkg/osutil"
 	qemu "github.com/lima-vm/lima/pkg/qemu/const"
 	"github.com/lima-vm/lima/pkg/qemu/imgutil"
+	"github.com/lima-vm/lima/pkg/store/dirnames"
 	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/vsock"
 	"github.com/mattn/go-shellwords"
 	"github.com/sirupsen/logrus"
 )
@@ -29,37 +39,86 @@ type Config struct {
 	InstanceDir  string
 	LimaYAML     *limayaml.LimaYAML
 	SSHLocalPort int
+	// VSockCID is the CID of the guest for `-device vhost-vsock-pci`; 0 disables vsock
+	VSockCID uint32
 }
 
-func EnsureDisk(cfg Config) error {
-	diffDisk := filepath.Join(cfg.InstanceDir, filenames.DiffDisk)
-	if _, err := os.Stat(diffDisk); err == nil || !errors.Is(err, os.ErrNotExist) {
-		// disk is already ensured
-		return err
+// imagesForArch returns the images for arch, in the order of `images`.
+// An image without an arch is for any arch.
+func imagesForArch(images []limayaml.File, arch limayaml.Arch) []limayaml.File {
+	var res []limayaml.File
+	for _, f := range images {
+		if f.Arch == "" || f.Arch == arch {
+			res = append(res, f)
+		}
 	}
+	return res
+}
 
+// EnsureBaseDisk downloads the image as the base disk, unless the base disk already exists.
+//
+// An image with a digest is downloaded into the image store (`${LIMA_HOME}/_images`) shared by the instances,
+// and the base disk is hard-linked to the stored image, so that the instances created from the same image
+// do not hold a copy of it each.
+// The image is not shared when `disk` is 0, as the base disk is then written by the guest.
+// Canceling ctx stops the download, including the retries.
+func EnsureBaseDisk(ctx context.Context, cfg Config) error {
 	baseDisk := filepath.Join(cfg.InstanceDir, filenames.BaseDisk)
 	if _, err := os.Stat(baseDisk); errors.Is(err, os.ErrNotExist) {
 		var ensuredBaseDisk bool
-		errs := make([]error, len(cfg.LimaYAML.Images))
-		for i, f := range cfg.LimaYAML.Images {
-			if f.Arch != *cfg.LimaYAML.Arch {
-				errs[i] = fmt.Errorf("unsupported arch: %q", f.Arch)
-				continue
+		images := imagesForArch(cfg.LimaYAML.Images, *cfg.LimaYAML.Arch)
+		if len(images) == 0 {
+			var archs []string
+			for _, f := range cfg.LimaYAML.Images {
+				archs = append(archs, f.Arch)
+			}
+			return fmt.Errorf("no image is available for the arch %q, the images are only available for %v (hint: set `arch`, or add an image to `images`)",
+				*cfg.LimaYAML.Arch, archs)
+		}
+		imagesDir, err := dirnames.LimaImagesDir()
+		if err != nil {
+			return err
+		}
+		diskSize, _ := units.RAMInBytes(*cfg.LimaYAML.Disk)
+		// The size of the image is not known yet, so only the space required for the diffdisk is checked here,
+		// to fail before downloading the image. EnsureDisk checks the space again after the download.
+		if diskSize != 0 {
+			if err := checkInstanceDiskSpace(cfg.InstanceDir, *cfg.LimaYAML.DiskFormat, diskSize, false); err != nil {
+				return err
+			}
+		}
+		opts := []downloader.Opt{
+			downloader.WithContext(ctx),
+			downloader.WithCache(),
+			downloader.WithProxy(*cfg.LimaYAML.Downloader.Proxy),
+			downloader.WithCACert(*cfg.LimaYAML.Downloader.CACert),
+		}
+		errs := make([]error, len(images))
+		for i, f := range images {
+			if err := ctx.Err(); err != nil {
+				return err
 			}
-			logrus.WithField("digest", f.Digest).Infof("Attempting to download the image from %q", f.Location)
-			res, err := downloader.Download(baseDisk, f.Location,
-				downloader.WithCache(),
-				downloader.WithExpectedDigest(f.Digest),
-			)
+			mirrors := f.Mirrors()
+			logrus.WithField("digest", f.Digest).Infof("Attempting to download the image from %q", mirrors[0])
+			if f.Digest != "" && diskSize != 0 {
+				shared, err := ensureSharedImage(imagesDir, baseDisk, f.Digest, mirrors, opts...)
+				if err != nil {
+					errs[i] = err
+					continue
+				}
+				logrus.Debugf("the base disk is linked to the shared image %q", shared)
+				ensuredBaseDisk = true
+				break
+			}
+			res, err := downloader.DownloadMirrors(baseDisk, mirrors, append(opts, downloader.WithExpectedDigest(f.Digest))...)
 			if err != nil {
-				errs[i] = fmt.Errorf("failed to download %q: %w", f.Location, err)
+				errs[i] = err
 				continue
 			}
 			logrus.Debugf("res.ValidatedDigest=%v", res.ValidatedDigest)
 			switch res.Status {
 			case downloader.StatusDownloaded:
-				logrus.Infof("Downloaded image from %q", f.Location)
+				logrus.WithField("mirror", res.Remote).Infof("Downloaded image from %q", res.Remote)
 			case downloader.StatusUsedCache:
 				logrus.Infof("Using cache %q", res.CachePath)
 			default:
@@ -69,10 +128,28 @@ func EnsureDisk(cfg Config) error {
 			break
 		}
 		if !ensuredBaseDisk {
-			return fmt.Errorf("failed to download the image, attempted %d candidates, errors=%v",
-				len(cfg.LimaYAML.Images), errs)
+			return fmt.Errorf("failed to download the image for the arch %q, attempted %d candidates, errors=%v",
+				*cfg.LimaYAML.Arch, len(images), errs)
 		}
 	}
+	return nil
+}
+
+// EnsureDisk ensures the base disk (see EnsureBaseDisk) and creates the diff disk on top of it.
+// The backing file of an existing diff disk is fixed up with RebaseDisk.
+func EnsureDisk(ctx context.Context, cfg Config) error {
+	diffDisk := filepath.Join(cfg.InstanceDir, filenames.DiffDisk)
+	if _, err := os.Stat(diffDisk); err == nil {
+		// disk is already ensured
+		return RebaseDisk(cfg.InstanceDir)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if err := EnsureBaseDisk(ctx, cfg); err != nil {
+		return err
+	}
+	baseDisk := filepath.Join(cfg.InstanceDir, filenames.BaseDisk)
 	diskSize, _ := units.RAMInBytes(*cfg.LimaYAML.Disk)
 	if diskSize == 0 {
 		return nil
@@ -81,16 +158,120 @@ func EnsureDisk(cfg Config) error {
 	if err != nil {
 		return err
 	}
-	args := []string{"create", "-f", "qcow2"}
+	var baseDiskFormat string
 	if !isBaseDiskISO {
-		baseDiskFormat, err := imgutil.DetectFormat(baseDisk)
+		baseDiskFormat, err = imgutil.DetectFormat(baseDisk)
+		if err != nil {
+			return err
+		}
+	}
+	if err := checkInstanceDiskSpace(cfg.InstanceDir, *cfg.LimaYAML.DiskFormat, diskSize, true); err != nil {
+		return err
+	}
+	for _, args := range diffDiskCommands(baseDisk, baseDiskFormat, diffDisk, *cfg.LimaYAML.DiskFormat, diskSize) {
+		cmd := exec.Command("qemu-img", args...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			// A partially created disk must not be considered as ensured on the next start
+			_ = os.Remove(diffDisk)
+			return fmt.Errorf("failed to run %v: %q: %w", cmd.Args, string(out), err)
+		}
+	}
+	return nil
+}
+
+// minDiskSpace is the free space required for creating a qcow2 diffdisk, which only grows on demand.
+// The first boot of the guest writes hundreds of megabytes.
+const minDiskSpace = 1 << 30
+
+// checkInstanceDiskSpace runs checkDiskSpace for the filesystem of instDir.
+// The check is skipped when the free space cannot be determined.
+func checkInstanceDiskSpace(instDir string, format limayaml.DiskFormat, diskSize int64, warn bool) error {
+	free, err := osutil.FreeDiskSpace(instDir)
+	if err != nil {
+		logrus.WithError(err).Debugf("failed to get the free disk space of %q", instDir)
+		return nil
+	}
+	return checkDiskSpace(format, diskSize, free, warn)
+}
+
+// checkDiskSpace checks the free space of the host before creating the diffdisk.
+// A raw diffdisk is preallocated to diskSize, so the whole diskSize is required.
+// A qcow2 diffdisk only requires minDiskSpace, but a warning is logged when the disk cannot grow to diskSize
+// and warn is true.
+func checkDiskSpace(format limayaml.DiskFormat, diskSize int64, free uint64, warn bool) error {
+	required := int64(minDiskSpace)
+	if format == limayaml.DiskFormatRaw {
+		required = diskSize
+	}
+	if int64(free) < required {
+		return fmt.Errorf("not enough free disk space for creating the disk of the instance: %s is required for a %s disk of %s, but only %s is available"+
+			" (hint: free up the disk space of the host, or reduce `disk`)",
+			units.BytesSize(float64(required)), format, units.BytesSize(float64(diskSize)), units.BytesSize(float64(free)))
+	}
+	if warn && int64(free) < diskSize {
+		logrus.Warnf("Only %s of free disk space is available, the disk of the instance (%s) will not be able to grow to its full size",
+			units.BytesSize(float64(free)), units.BytesSize(float64(diskSize)))
+	}
+	return nil
+}
+
+// diffDiskCommands returns the qemu-img commands for creating the diffdisk.
+// An empty baseDiskFormat means the base disk is an ISO image, which is not copied into the diffdisk.
+//
+// A qcow2 diffdisk is backed by the base disk, and only stores the changes.
+// The backing file is specified relative to the diffdisk, so that the instance directory can be moved.
+// A raw diffdisk is a full copy of the base disk, preallocated to diskSize.
+func diffDiskCommands(baseDisk, baseDiskFormat, diffDisk string, format limayaml.DiskFormat, diskSize int64) [][]string {
+	size := strconv.FormatInt(diskSize, 10)
+	if format == limayaml.DiskFormatRaw {
+		if baseDiskFormat == "" {
+			return [][]string{{"create", "-f", "raw", "-o", "preallocation=falloc", diffDisk, size}}
+		}
+		return [][]string{
+			{"convert", "-f", baseDiskFormat, "-O", "raw", baseDisk, diffDisk},
+			{"resize", "-f", "raw", "--preallocation=falloc", diffDisk, size},
+		}
+	}
+	args := []string{"create", "-f", "qcow2"}
+	if baseDiskFormat != "" {
+		args = append(args, "-F", baseDiskFormat, "-b", backingFile(baseDisk, diffDisk))
+	}
+	return [][]string{append(args, diffDisk, size)}
+}
+
+// backingFile returns the path of baseDisk to be recorded as the backing file of diffDisk.
+// The path is relative when both disks are in the same directory, as qemu-img resolves it relative to diffDisk.
+func backingFile(baseDisk, diffDisk string) string {
+	if filepath.Dir(baseDisk) == filepath.Dir(diffDisk) {
+		return filepath.Base(baseDisk)
+	}
+	return baseDisk
+}
+
+// RebaseDisk fixes up the backing file of the qcow2 diffdisk of the instance to the relative path of the base disk,
+// e.g., when the diffdisk was created with the absolute path of the base disk, and the instance directory was moved.
+// Only the header of the diffdisk is updated (`qemu-img rebase -u`), as the content of the base disk is unchanged.
+// The diffdisk must not be in use.
+func RebaseDisk(instDir string) error {
+	diffDisk := filepath.Join(instDir, filenames.DiffDisk)
+	info, err := imgutil.GetInfo(diffDisk)
+	if err != nil {
+		return err
+	}
+	baseDisk := filepath.Join(instDir, filenames.BaseDisk)
+	backing := backingFile(baseDisk, diffDisk)
+	if info.Format != "qcow2" || info.BackingFilename == "" || info.BackingFilename == backing {
+		return nil
+	}
+	backingFormat := info.BackingFilenameFormat
+	if backingFormat == "" {
+		backingFormat, err = imgutil.DetectFormat(baseDisk)
 		if err != nil {
 			return err
 		}
-		args = append(args, "-F", baseDiskFormat, "-b", baseDisk)
 	}
-	args = append(args, diffDisk, strconv.Itoa(int(diskSize)))
-	cmd := exec.Command("qemu-img", args...)
+	logrus.Infof("Rebasing %q from %q to %q", diffDisk, info.BackingFilename, backing)
+	cmd := exec.Command("qemu-img", "rebase", "-u", "-F", backingFormat, "-b", backing, diffDisk)
 	if out, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("failed to run %v: %q: %w", cmd.Args, string(out), err)
 	}
@@ -191,41 +372,49 @@ func Cmdline(cfg Config) (string, []string, error) {
 		return "", nil, err
 	}
 
+	if err := checkVersion(exe); err != nil {
+		return "", nil, err
+	}
+
 	features, err := inspectFeatures(exe)
 	if err != nil {
 		return "", nil, err
 	}
 
 	// Architecture
-	accel := getAccel(*y.Arch)
-	if !strings.Contains(string(features.AccelHelp), accel) {
-		errStr := fmt.Sprintf("accelerator %q is not supported by %s", accel, exe)
-		if accel == "hvf" && *y.Arch == limayaml.AARCH64 {
-			errStr += " ( Hint: as of August 2021, qemu-system-aarch64 on ARM Mac needs to be patched for enabling hvf accelerator,"
-			errStr += " see https://gist.github.com/nrjdalal/e70249bb5d2e9d844cc203fd11f74c55 )"
-		}
-		return "", nil, errors.New(errStr)
+	accel, err := checkAccel(y, exe, features)
+	if err != nil {
+		return "", nil, err
+	}
+	if accel == limayaml.AccelTCG {
+		logrus.Warn(TCGWarning(y))
 	}
 	switch *y.Arch {
 	case limayaml.X8664:
 		cpu := "Haswell-v4"
-		if isNativeArch(*y.Arch) {
+		// "host" requires hardware acceleration
+		if accel != limayaml.AccelTCG {
 			cpu = "host"
 		}
 		args = appendArgsIfNoConflict(args, "-cpu", cpu)
-		args = appendArgsIfNoConflict(args, "-machine", "q35,accel="+accel)
+		machine := *y.QEMU.Machine + ",accel=" + accel
+		if *y.Firmware.SecureBoot {
+			// The variable store of the Secure Boot firmware is protected by SMM
+			machine += ",smm=on"
+		}
+		args = appendArgsIfNoConflict(args, "-machine", machine)
 	case limayaml.AARCH64:
 		cpu := "cortex-a72"
-		if isNativeArch(*y.Arch) {
+		// "host" requires hardware acceleration
+		if accel != limayaml.AccelTCG {
 			cpu = "host"
 		}
 		args = appendArgsIfNoConflict(args, "-cpu", cpu)
-		args = appendArgsIfNoConflict(args, "-machine", "virt,accel="+accel+",highmem=off")
+		args = appendArgsIfNoConflict(args, "-machine", *y.QEMU.Machine+",accel="+accel+",highmem=off")
 	}
 
 	// SMP
-	args = appendArgsIfNoConflict(args, "-smp",
-		fmt.Sprintf("%d,sockets=1,cores=%d,threads=1", *y.CPUs, *y.CPUs))
+	args = appendArgsIfNoConflict(args, "-smp", smpArg(y))
 
 	// Memory
 	memBytes, err := units.RAMInBytes(*y.Memory)
@@ -234,48 +423,142 @@ func Cmdline(cfg Config) (string, []string, error) {
 	}
 	args = appendArgsIfNoConflict(args, "-m", strconv.Itoa(int(memBytes>>20)))
 
+	// NUMA (the sums of the nodes are validated to be equal to -smp and -m, without hotplug)
+	numa := y.NUMA
+	if len(numa) == 0 && *y.MemoryBackend == limayaml.MemoryBackendHugepages {
+		// hugepages need an explicit memory backend, which is attached to a single node,
+		// including the vCPUs that may be hotplugged up to maxCPUs
+		numa = []limayaml.NUMANode{{CPUs: *y.MaxCPUs, Memory: *y.Memory}}
+	}
+	var numaCPU int
+	for i, node := range numa {
+		nodeMemBytes, err := units.RAMInBytes(node.Memory)
+		if err != nil {
+			return "", nil, err
+		}
+		memBackend := fmt.Sprintf("memory-backend-ram,id=mem%d,size=%dM", i, nodeMemBytes>>20)
+		if *y.MemoryBackend == limayaml.MemoryBackendHugepages {
+			// The availability of the hugepages is checked by CheckHugepages, so that the host agent can report it
+			memBackend = fmt.Sprintf("memory-backend-file,id=mem%d,size=%dM,mem-path=%s,share=on,prealloc=on",
+				i, nodeMemBytes>>20, HugepagesPath)
+		}
+		args = append(args, "-object", memBackend)
+		cpus := strconv.Itoa(numaCPU)
+		if node.CPUs > 1 {
+			cpus += "-" + strconv.Itoa(numaCPU+node.CPUs-1)
+		}
+		args = append(args, "-numa", fmt.Sprintf("node,nodeid=%d,cpus=%s,memdev=mem%d", i, cpus, i))
+		numaCPU += node.CPUs
+	}
+
+	// RTC
+	args = appendArgsIfNoConflict(args, "-rtc", "base="+*y.RTC)
+
 	// Firmware
-	legacyBIOS := *y.Firmware.LegacyBIOS
-	if legacyBIOS && *y.Arch != limayaml.X8664 {
+	if *y.Firmware.LegacyBIOS && *y.Arch != limayaml.X8664 {
 		logrus.Warnf("field `firmware.legacyBIOS` is not supported for architecture %q, ignoring", *y.Arch)
-		legacyBIOS = false
 	}
-	if !legacyBIOS {
-		firmware, err := getFirmware(exe, *y.Arch)
+	if usesUEFI(y) {
+		firmware, err := firmwareArgs(cfg, exe)
 		if err != nil {
 			return "", nil, err
 		}
-		args = append(args, "-drive", fmt.Sprintf("if=pflash,format=raw,readonly=on,file=%s", firmware))
+		args = append(args, firmware...)
 	}
 
 	baseDisk := filepath.Join(cfg.InstanceDir, filenames.BaseDisk)
 	diffDisk := filepath.Join(cfg.InstanceDir, filenames.DiffDisk)
 	isBaseDiskCDROM, err := iso9660util.IsISO9660(baseDisk)
+	if errors.Is(err, os.ErrNotExist) {
+		// DryRun before the first start; the image is assumed not to be an ISO
+		isBaseDiskCDROM, err = false, nil
+	}
 	if err != nil {
 		return "", nil, err
 	}
+	if *y.Kernel != "" {
+		// The firmware loads the kernel from fw_cfg, bypassing the boot loader on the disk
+		kernel, err := localpathutil.Expand(*y.Kernel)
+		if err != nil {
+			return "", nil, err
+		}
+		args = append(args, "-kernel", kernel)
+		if *y.Initrd != "" {
+			initrd, err := localpathutil.Expand(*y.Initrd)
+			if err != nil {
+				return "", nil, err
+			}
+			args = append(args, "-initrd", initrd)
+		}
+		cmdline := *y.Cmdline
+		if cmdline == "" {
+			// The diffdisk (or the basedisk) is the first virtio disk
+			cmdline = "root=/dev/vda1 console=" + kernelConsole(*y.Arch)
+		}
+		args = append(args, "-append", cmdline)
+	}
+	bootOrder := *y.Boot.Order
+	if bootOrder == "" {
+		bootOrder = "c"
+		if isBaseDiskCDROM {
+			bootOrder = "d"
+		}
+	}
+	bootMenu := "off"
+	if *y.Boot.Menu {
+		bootMenu = "on"
+	}
+	args = appendArgsIfNoConflict(args, "-boot", fmt.Sprintf("order=%s,splash-time=%d,menu=%s", bootOrder, *y.Boot.SplashTime, bootMenu))
 	if isBaseDiskCDROM {
-		args = appendArgsIfNoConflict(args, "-boot", "order=d,splash-time=0,menu=on")
 		args = append(args, "-drive", fmt.Sprintf("file=%s,media=cdrom,readonly=on", baseDisk))
-	} else {
-		args = appendArgsIfNoConflict(args, "-boot", "order=c,splash-time=0,menu=on")
 	}
 	if diskSize, _ := units.RAMInBytes(*cfg.LimaYAML.Disk); diskSize > 0 {
-		args = append(args, "-drive", fmt.Sprintf("file=%s,if=virtio", diffDisk))
+		// The format cannot be changed after creating the diffdisk, as the diffdisk is not converted.
+		// The diffdisk does not exist yet in DryRun before the first start.
+		if _, err := os.Stat(diffDisk); err == nil {
+			diffDiskFormat, err := imgutil.DetectFormat(diffDisk)
+			if err != nil {
+				return "", nil, err
+			}
+			if diffDiskFormat != *y.DiskFormat {
+				return "", nil, fmt.Errorf("field `diskFormat` is %q, but the disk of the instance was created as %q; the format cannot be changed after creating the instance",
+					*y.DiskFormat, diffDiskFormat)
+			}
+		}
+		args = append(args, "-drive", fmt.Sprintf("file=%s,if=virtio,format=%s,%s", diffDisk, *y.DiskFormat, rootDiskOptions(y)))
 	} else if !isBaseDiskCDROM {
-		args = append(args, "-drive", fmt.Sprintf("file=%s,if=virtio", baseDisk))
+		args = append(args, "-drive", fmt.Sprintf("file=%s,if=virtio,%s", baseDisk, rootDiskOptions(y)))
 	}
 	// cloud-init
 	args = append(args, "-cdrom", filepath.Join(cfg.InstanceDir, filenames.CIDataISO))
+	// Only one -cdrom is allowed, so the extra ISOs are attached with -drive
+	for _, iso := range y.ISOs {
+		isoPath, err := localpathutil.Expand(iso)
+		if err != nil {
+			return "", nil, err
+		}
+		args = append(args, "-drive", fmt.Sprintf("file=%s,format=raw,media=cdrom,readonly=on", isoPath))
+	}
 
 	// Network
-	args = append(args, "-netdev", fmt.Sprintf("user,id=net0,net=%s,dhcpstart=%s,hostfwd=tcp:127.0.0.1:%d-:22",
-		qemu.SlirpNetwork, qemu.SlirpIPAddress, cfg.SSHLocalPort))
-	args = append(args, "-device", "virtio-net-pci,netdev=net0,mac="+limayaml.MACAddress(cfg.InstanceDir))
-	if len(y.Networks) > 0 && !strings.Contains(string(features.NetdevHelp), "vde") {
-		return "", nil, fmt.Errorf("netdev \"vde\" is not supported by %s ( Hint: recompile QEMU with `configure --enable-vde` )", exe)
+	args = append(args, "-netdev", slirpNetdev(y, cfg.SSHLocalPort))
+	args = append(args, "-device", "virtio-net-pci,netdev=net0,mac="+y.Network.MACAddress)
+	for _, nw := range y.Networks {
+		if nw.Bridge == "" && !strings.Contains(string(features.NetdevHelp), "vde") {
+			return "", nil, fmt.Errorf("netdev \"vde\" is not supported by %s ( Hint: recompile QEMU with `configure --enable-vde` )", exe)
+		}
 	}
 	for i, nw := range y.Networks {
+		if nw.Bridge != "" {
+			// The privileges are checked by CheckBridgeNetworks, so that the host agent can report them
+			netdev := fmt.Sprintf("bridge,id=net%d,br=%s", i+1, nw.Bridge)
+			if helper := bridgeHelper(exe); helper != "" {
+				netdev += ",helper=" + helper
+			}
+			args = append(args, "-netdev", netdev)
+			args = append(args, "-device", fmt.Sprintf("virtio-net-pci,netdev=net%d,mac=%s", i+1, nw.MACAddress))
+			continue
+		}
 		var vdeSock string
 		if nw.Lima != "" {
 			vdeSock, err = networks.VDESock(nw.Lima)
@@ -309,16 +592,38 @@ func Cmdline(cfg Config) (string, []string, error) {
 		args = append(args, "-device", fmt.Sprintf("virtio-net-pci,netdev=net%d,mac=%s", i+1, nw.MACAddress))
 	}
 
+	if *y.MemoryBalloon {
+		// The balloon can be inflated with SetBalloon
+		args = append(args, "-device", "virtio-balloon-pci")
+	}
+
+	if cfg.VSockCID != 0 {
+		args = append(args, "-device", fmt.Sprintf("vhost-vsock-pci,guest-cid=%d", cfg.VSockCID))
+	}
+
 	// virtio-rng-pci accelerates starting up the OS, according to https://wiki.gentoo.org/wiki/QEMU/Options
 	args = append(args, "-device", "virtio-rng-pci")
 
 	// Graphics
-	if *y.Video.Display != "" {
-		args = appendArgsIfNoConflict(args, "-display", *y.Video.Display)
-	}
+	args = displayArgs(args, y)
+	// The VNC server is an additional display, so it coexists with `-display` and the video device below
+	if VNCEndpoint(y) != "" {
+		args = append(args, "-vnc", fmt.Sprintf("%s:%d", vncHost(*y.Video.VNC.Address), *y.Video.VNC.Display))
+	}
+	if *y.Video.SPICE.Enabled {
+		// The stale socket is removed by the host agent before starting QEMU
+		spiceSock := filepath.Join(cfg.InstanceDir, filenames.SPICESock)
+		args = append(args, "-spice", fmt.Sprintf("unix=on,addr=%s,disable-ticketing=on", spiceSock))
+		// The SPICE agent channel, for clipboard sharing and resizing the display with the client window
+		args = append(args, "-device", "virtio-serial-pci")
+		args = append(args, "-chardev", "spicevmc,id=char-spicevmc,name=vdagent")
+		args = append(args, "-device", "virtserialport,chardev=char-spicevmc,name=com.redhat.spice.0")
+	}
+	// The video device is attached even with `-display none`, so that the guest sees the same hardware
+	// regardless of the display, and the console on the serial port is not affected.
 	switch *y.Arch {
 	case limayaml.X8664:
-		args = append(args, "-device", "virtio-vga")
+		args = append(args, "-device", virtioVGADevice(y))
 		args = append(args, "-device", "virtio-keyboard-pci")
 		args = append(args, "-device", "virtio-mouse-pci")
 	default:
@@ -329,29 +634,33 @@ func Cmdline(cfg Config) (string, []string, error) {
 		args = append(args, "-device", "usb-mouse")
 	}
 
+	// Audio
+	args = append(args, audioArgs(y)...)
+
+	// USB passthrough
+	usb, err := usbArgs(y)
+	if err != nil {
+		return "", nil, err
+	}
+	args = append(args, usb...)
+
+	// PCI passthrough (VFIO); the host is checked by CheckPCIPassthrough
+	args = append(args, pciPassthroughArgs(y)...)
+
 	// Parallel
 	args = append(args, "-parallel", "none")
 
 	// Serial
-	serialSock := filepath.Join(cfg.InstanceDir, filenames.SerialSock)
-	if err := os.RemoveAll(serialSock); err != nil {
-		return "", nil, err
+	for i := 0; i < *y.SerialCount; i++ {
+		serialSock, serialLog, serialChardev := serialPort(cfg.InstanceDir, i)
+		args = append(args, "-chardev", fmt.Sprintf("socket,id=%s,path=%s,server=on,wait=off,logfile=%s", serialChardev, serialSock, serialLog))
+		args = append(args, "-serial", "chardev:"+serialChardev)
 	}
-	serialLog := filepath.Join(cfg.InstanceDir, filenames.SerialLog)
-	if err := os.RemoveAll(serialLog); err != nil {
-		return "", nil, err
-	}
-	const serialChardev = "char-serial"
-	args = append(args, "-chardev", fmt.Sprintf("socket,id=%s,path=%s,server=on,wait=off,logfile=%s", serialChardev, serialSock, serialLog))
-	args = append(args, "-serial", "chardev:"+serialChardev)
 
 	// We also want to enable vsock and virtfs here, but QEMU does not support vsock and virtfs for macOS hosts
 
 	// QMP
 	qmpSock := filepath.Join(cfg.InstanceDir, filenames.QMPSock)
-	if err := os.RemoveAll(qmpSock); err != nil {
-		return "", nil, err
-	}
 	const qmpChardev = "char-qmp"
 	args = append(args, "-chardev", fmt.Sprintf("socket,id=%s,path=%s,server=on,wait=off", qmpChardev, qmpSock))
 	args = append(args, "-qmp", "chardev:"+qmpChardev)
@@ -360,9 +669,70 @@ func Cmdline(cfg Config) (string, []string, error) {
 	args = append(args, "-name", "lima-"+cfg.Name)
 	args = append(args, "-pidfile", filepath.Join(cfg.InstanceDir, filenames.QemuPID))
 
+	// Extra args are appended verbatim, and may conflict with the args above
+	if len(y.QEMU.ExtraArgs) > 0 {
+		args = append(args, y.QEMU.ExtraArgs...)
+		logrus.Infof("Using extra QEMU arguments %v, the full QEMU command line is %v", y.QEMU.ExtraArgs, append([]string{exe}, args...))
+	}
+
 	return exe, args, nil
 }
 
+// Prepare prepares the instance directory for the command line returned by Cmdline, right before starting QEMU:
+// the sockets and the serial logs of the previous QEMU are removed, and the UEFI variable store is created
+// from its template on the first boot.
+// Cmdline itself does not modify the instance directory, so that it can be used by DryRun.
+func Prepare(cfg Config) error {
+	y := cfg.LimaYAML
+	for i := 0; i < *y.SerialCount; i++ {
+		serialSock, serialLog, _ := serialPort(cfg.InstanceDir, i)
+		if err := os.RemoveAll(serialSock); err != nil {
+			return err
+		}
+		if err := os.RemoveAll(serialLog); err != nil {
+			return err
+		}
+	}
+	if err := os.RemoveAll(filepath.Join(cfg.InstanceDir, filenames.QMPSock)); err != nil {
+		return err
+	}
+	if !usesUEFI(y) {
+		return nil
+	}
+	var exe string
+	if *y.Firmware.Code == "" {
+		var err error
+		exe, _, err = getExe(*y.Arch)
+		if err != nil {
+			return err
+		}
+	}
+	_, varsTemplate, err := resolveFirmware(y, exe)
+	if err != nil {
+		return err
+	}
+	return ensureEFIVars(filepath.Join(cfg.InstanceDir, filenames.EFIVars), varsTemplate)
+}
+
+// serialPort returns the socket, the log, and the chardev id of the i-th serial port.
+// The first serial port keeps the historical names, the extra ones are suffixed with the index (serial1.sock, ...)
+func serialPort(instDir string, i int) (sock, log, chardev string) {
+	if i == 0 {
+		return filepath.Join(instDir, filenames.SerialSock), filepath.Join(instDir, filenames.SerialLog), "char-serial"
+	}
+	return filepath.Join(instDir, fmt.Sprintf("serial%d.sock", i)), filepath.Join(instDir, fmt.Sprintf("serial%d.log", i)), fmt.Sprintf("char-serial%d", i)
+}
+
+// usesUEFI returns whether the guest boots with the UEFI firmware; `firmware.legacyBIOS` is only supported on x86_64.
+func usesUEFI(y *limayaml.LimaYAML) bool {
+	return !*y.Firmware.LegacyBIOS || *y.Arch != limayaml.X8664
+}
+
+// ShellCommand returns exe and args returned by Cmdline as a string that can be copied to a shell.
+func ShellCommand(exe string, args []string) string {
+	return shellescape.QuoteCommand(append([]string{exe}, args...))
+}
+
 func getExe(arch limayaml.Arch) (string, []string, error) {
 	exeBase := "qemu-system-" + arch
 	var args []string
@@ -384,59 +754,197 @@ func getExe(arch limayaml.Arch) (string, []string, error) {
 	return exe, args, nil
 }
 
-func isNativeArch(arch limayaml.Arch) bool {
-	nativeX8664 := arch == limayaml.X8664 && runtime.GOARCH == "amd64"
-	nativeAARCH64 := arch == limayaml.AARCH64 && runtime.GOARCH == "arm64"
-	return nativeX8664 || nativeAARCH64
+// virtioVGADevice returns the `-device` value of virtio-vga with `video.resolution` and `video.vram`.
+func virtioVGADevice(y *limayaml.LimaYAML) string {
+	dev := "virtio-vga"
+	if *y.Video.Resolution != "" {
+		// already validated
+		width, height, _ := limayaml.ParseResolution(*y.Video.Resolution)
+		dev += fmt.Sprintf(",xres=%d,yres=%d", width, height)
+	}
+	if *y.Video.VRAM != 0 {
+		dev += fmt.Sprintf(",vgamem_mb=%d", *y.Video.VRAM)
+	}
+	return dev
+}
+
+// VNCEndpoint returns the "host:port" of the VNC server of the guest, or an empty string if VNC is disabled.
+func VNCEndpoint(y *limayaml.LimaYAML) string {
+	if !*y.Video.VNC.Enabled {
+		return ""
+	}
+	return net.JoinHostPort(*y.Video.VNC.Address, strconv.Itoa(limayaml.VNCBasePort+*y.Video.VNC.Display))
+}
+
+// CheckVNC checks that the VNC endpoint is not in use, as QEMU fails with a less obvious error message.
+func CheckVNC(y *limayaml.LimaYAML) error {
+	endpoint := VNCEndpoint(y)
+	if endpoint == "" {
+		return nil
+	}
+	l, err := net.Listen("tcp", endpoint)
+	if err != nil {
+		return fmt.Errorf("cannot listen on the VNC endpoint %q (hint: set `video.vnc.display` to another number): %w", endpoint, err)
+	}
+	return l.Close()
+}
+
+// vncHost returns the host part of the `-vnc` argument, which needs brackets for IPv6 addresses.
+func vncHost(address string) string {
+	if ip := net.ParseIP(address); ip != nil && ip.To4() == nil {
+		return "[" + address + "]"
+	}
+	return address
 }
 
-func getAccel(arch limayaml.Arch) string {
-	if isNativeArch(arch) {
-		switch runtime.GOOS {
-		case "darwin":
-			return "hvf"
-		case "linux":
-			return "kvm"
-		case "netbsd":
-			return "nvmm" // untested
-		case "windows":
-			return "whpx" // untested
+// vsockCIDAttempts is the number of the CIDs probed by VSockCID.
+const vsockCIDAttempts = 64
+
+// VSockCID returns the CID of the guest for vsock, derived from the instance directory.
+// CIDs 0-2 are reserved. The CID has to be unique on the host, otherwise QEMU fails to start,
+// so the next CIDs are probed when the derived one is already used by another guest.
+func VSockCID(instDir string) (uint32, error) {
+	sha := sha256.Sum256([]byte(instDir))
+	first := binary.BigEndian.Uint32(sha[0:4]) % (math.MaxInt32 - 3)
+	for i := uint32(0); i < vsockCIDAttempts; i++ {
+		cid := 3 + (first+i)%(math.MaxInt32-3)
+		ok, err := vsock.CIDAvailable(cid)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			return cid, nil
 		}
+		logrus.Debugf("vsock CID %d is already used by another guest", cid)
 	}
-	return "tcg"
+	return 0, fmt.Errorf("failed to find a free vsock CID for %q after %d attempts", instDir, vsockCIDAttempts)
 }
 
-func getFirmware(qemuExe string, arch limayaml.Arch) (string, error) {
-	binDir := filepath.Dir(qemuExe)  // "/usr/local/bin"
-	localDir := filepath.Dir(binDir) // "/usr/local"
+// slirpNetdev returns the `-netdev` option of the user-mode network (net0).
+// The SSH port and the UDP ports are forwarded by QEMU; the TCP ports are forwarded by the host agent,
+// according to the events from the guest agent.
+func slirpNetdev(y *limayaml.LimaYAML, sshLocalPort int) string {
+	netdev := fmt.Sprintf("user,id=net0,net=%s,dhcpstart=%s,hostfwd=tcp:%s:%d-:22",
+		qemu.SlirpNetwork, qemu.SlirpIPAddress, *y.SSH.Address, sshLocalPort)
+	if y.Network.IPv6 != nil && *y.Network.IPv6 {
+		netdev += ",ipv6=on,ipv6-net=" + qemu.SlirpIPv6Network
+	}
+	for _, rule := range y.PortForwards {
+		if rule.Proto != limayaml.UDP || rule.Ignore {
+			continue
+		}
+		for guestPort := rule.GuestPortRange[0]; guestPort <= rule.GuestPortRange[1]; guestPort++ {
+			hostPort := guestPort + rule.HostPortRange[0] - rule.GuestPortRange[0]
+			netdev += fmt.Sprintf(",hostfwd=udp:%s:%d-:%d", rule.HostIP, hostPort, guestPort)
+		}
+	}
+	return netdev
+}
 
-	candidates := []string{
-		filepath.Join(localDir, fmt.Sprintf("share/qemu/edk2-%s-code.fd", arch)), // macOS (homebrew)
+// smpArg returns the -smp value of `cpus`, `maxCPUs`, and `cpu`.
+// The cores per socket are derived from maxCPUs, as validated by limayaml.Validate.
+func smpArg(y *limayaml.LimaYAML) string {
+	sockets, threads := *y.CPU.Sockets, *y.CPU.Threads
+	cores := *y.MaxCPUs / (sockets * threads)
+	return fmt.Sprintf("%d,sockets=%d,cores=%d,threads=%d,maxcpus=%d", *y.CPUs, sockets, cores, threads, *y.MaxCPUs)
+}
+
+// rootDiskOptions returns the cache, aio, and discard options of the -drive of the root disk.
+// `diskAIO: native` falls back to "threads" when it cannot be used with `diskCache`, as warned by limayaml.Validate.
+func rootDiskOptions(y *limayaml.LimaYAML) string {
+	aio := *y.DiskAIO
+	if !limayaml.DiskAIOIsSupported(*y) {
+		aio = limayaml.DiskAIOThreads
 	}
+	return fmt.Sprintf("cache=%s,aio=%s,discard=%s", *y.DiskCache, aio, *y.DiskDiscard)
+}
 
-	switch arch {
-	case limayaml.X8664:
-		// Debian package "ovmf"
-		candidates = append(candidates, "/usr/share/OVMF/OVMF_CODE.fd")
-		// openSUSE package "qemu-ovmf-x86_64"
-		candidates = append(candidates, "/usr/share/qemu/ovmf-x86_64-code.bin")
-	case limayaml.AARCH64:
-		// Debian package "qemu-efi-aarch64"
-		candidates = append(candidates, "/usr/share/AAVMF/AAVMF_CODE.fd")
-		// Debian package "qemu-efi-aarch64" (unpadded, backwards compatibility)
-		candidates = append(candidates, "/usr/share/qemu-efi-aarch64/QEMU_EFI.fd")
+// displayArgs appends the -display option of `video.display` to args, unless args already has one.
+// An empty display is "none" too, as the default display of QEMU depends on how QEMU was built.
+// The display is left to `-nographic` in args or `qemu.extraArgs`, as QEMU rejects `-nographic` with `-display`.
+func displayArgs(args []string, y *limayaml.LimaYAML) []string {
+	for _, a := range [][]string{args, y.QEMU.ExtraArgs} {
+		if _, ok := argValue(a, "-nographic"); ok {
+			logrus.Infof("Not adding QEMU argument \"-display\", as `-nographic` is set")
+			return args
+		}
 	}
+	display := limayaml.DisplayNone
+	if y.Video.Display != nil && *y.Video.Display != "" {
+		display = *y.Video.Display
+	}
+	return appendArgsIfNoConflict(args, "-display", display)
+}
+
+// audioArgs returns the -audiodev and -device options of `audio`.
+func audioArgs(y *limayaml.LimaYAML) []string {
+	backend := *y.Audio.Backend
+	if backend == "" {
+		backend = limayaml.DefaultAudioBackend()
+	}
+	audiodev := backend + ",id=audio0"
+	switch *y.Audio.Device {
+	case limayaml.AudioDeviceHDA:
+		return []string{"-audiodev", audiodev, "-device", "intel-hda", "-device", "hda-duplex,audiodev=audio0"}
+	case limayaml.AudioDeviceAC97:
+		return []string{"-audiodev", audiodev, "-device", "AC97,audiodev=audio0"}
+	default:
+		return nil
+	}
+}
 
-	logrus.Debugf("firmware candidates = %v", candidates)
+// kernelConsole returns the name of the first serial port in the guest.
+func kernelConsole(arch limayaml.Arch) string {
+	if arch == limayaml.AARCH64 {
+		return "ttyAMA0"
+	}
+	return "ttyS0"
+}
 
-	for _, f := range candidates {
-		if _, err := os.Stat(f); err == nil {
-			return f, nil
+func isNativeArch(arch limayaml.Arch) bool {
+	nativeX8664 := arch == limayaml.X8664 && runtime.GOARCH == "amd64"
+	nativeAARCH64 := arch == limayaml.AARCH64 && runtime.GOARCH == "arm64"
+	return nativeX8664 || nativeAARCH64
+}
+
+// TCGWarning returns a warning message if the guest is going to be emulated by TCG,
+// i.e., without hardware acceleration. Otherwise it returns an empty string.
+func TCGWarning(y *limayaml.LimaYAML) string {
+	if getAccel(y) != limayaml.AccelTCG {
+		return ""
+	}
+	if isNativeArch(*y.Arch) {
+		return fmt.Sprintf("field `qemu.accel` is set to %q, the guest is emulated without hardware acceleration and will be very slow", limayaml.AccelTCG)
+	}
+	return fmt.Sprintf("the arch %q is not accelerated on this host (%s/%s), the guest is emulated by QEMU TCG and will be very slow"+
+		" (hint: set `requireAcceleration: true` to refuse starting an emulated guest)", *y.Arch, runtime.GOOS, runtime.GOARCH)
+}
+
+// checkAccel returns the accelerator (see getAccel), after checking that it is supported by exe,
+// and that `requireAcceleration` is satisfied.
+func checkAccel(y *limayaml.LimaYAML, exe string, features *features) (string, error) {
+	accel := getAccel(y)
+	if !strings.Contains(string(features.AccelHelp), accel) {
+		errStr := fmt.Sprintf("accelerator %q is not supported by %s", accel, exe)
+		if accel == "hvf" && *y.Arch == limayaml.AARCH64 {
+			errStr += " ( Hint: as of August 2021, qemu-system-aarch64 on ARM Mac needs to be patched for enabling hvf accelerator,"
+			errStr += " see https://gist.github.com/nrjdalal/e70249bb5d2e9d844cc203fd11f74c55 )"
 		}
+		return "", errors.New(errStr)
 	}
+	if accel == limayaml.AccelTCG && *y.RequireAcceleration {
+		return "", fmt.Errorf("the arch %q cannot be accelerated on this host, and `requireAcceleration` is set", *y.Arch)
+	}
+	return accel, nil
+}
 
-	if arch == limayaml.X8664 {
-		return "", fmt.Errorf("could not find firmware for %q (hint: try setting `firmware.legacyBIOS` to `true`)", qemuExe)
+// getAccel returns `qemu.accel`, or the accelerator of the host for the native arch, or "tcg".
+func getAccel(y *limayaml.LimaYAML) string {
+	if *y.QEMU.Accel != "" {
+		return *y.QEMU.Accel
+	}
+	if isNativeArch(*y.Arch) {
+		return limayaml.HostAccel()
 	}
-	return "", fmt.Errorf("could not find firmware for %q", qemuExe)
+	return limayaml.AccelTCG
 }
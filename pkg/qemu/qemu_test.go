@@ -1,8 +1,16 @@
 package qemu
 
 import (
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"testing"
 
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"github.com/lima-vm/lima/pkg/qemu/imgutil"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/xorcare/pointer"
 	"gotest.tools/v3/assert"
 )
 
@@ -47,3 +55,159 @@ func TestArgValue(t *testing.T) {
 		assert.Equal(t, tc.expectedOK, ok)
 	}
 }
+
+func TestSlirpNetdev(t *testing.T) {
+	y := &limayaml.LimaYAML{
+		SSH: limayaml.SSH{Address: pointer.String("127.0.0.1")},
+		PortForwards: []limayaml.PortForward{
+			{Proto: limayaml.TCP, GuestPortRange: [2]int{80, 80}, HostPortRange: [2]int{8080, 8080}, HostIP: net.IPv4(127, 0, 0, 1)},
+			{Proto: limayaml.UDP, GuestPortRange: [2]int{53, 54}, HostPortRange: [2]int{5353, 5354}, HostIP: net.IPv4(127, 0, 0, 1)},
+		},
+	}
+	assert.Equal(t, slirpNetdev(y, 60022),
+		"user,id=net0,net=192.168.5.0/24,dhcpstart=192.168.5.15,hostfwd=tcp:127.0.0.1:60022-:22"+
+			",hostfwd=udp:127.0.0.1:5353-:53,hostfwd=udp:127.0.0.1:5354-:54")
+
+	y = &limayaml.LimaYAML{SSH: limayaml.SSH{Address: pointer.String("192.168.1.2")}, Network: limayaml.UserNetwork{IPv6: pointer.Bool(true)}}
+	assert.Equal(t, slirpNetdev(y, 60022),
+		"user,id=net0,net=192.168.5.0/24,dhcpstart=192.168.5.15,hostfwd=tcp:192.168.1.2:60022-:22,ipv6=on,ipv6-net=fd00:5::/64")
+}
+
+func TestAudioArgs(t *testing.T) {
+	y := &limayaml.LimaYAML{Audio: limayaml.Audio{Device: pointer.String(limayaml.AudioDeviceNone), Backend: pointer.String("")}}
+	assert.Assert(t, len(audioArgs(y)) == 0)
+
+	y.Audio = limayaml.Audio{Device: pointer.String(limayaml.AudioDeviceHDA), Backend: pointer.String("alsa")}
+	assert.DeepEqual(t, audioArgs(y),
+		[]string{"-audiodev", "alsa,id=audio0", "-device", "intel-hda", "-device", "hda-duplex,audiodev=audio0"})
+
+	y.Audio = limayaml.Audio{Device: pointer.String(limayaml.AudioDeviceAC97), Backend: pointer.String("coreaudio")}
+	assert.DeepEqual(t, audioArgs(y), []string{"-audiodev", "coreaudio,id=audio0", "-device", "AC97,audiodev=audio0"})
+}
+
+func TestDisplayArgs(t *testing.T) {
+	y := &limayaml.LimaYAML{}
+	assert.DeepEqual(t, displayArgs(nil, y), []string{"-display", "none"})
+
+	y.Video.Display = pointer.String("cocoa")
+	assert.DeepEqual(t, displayArgs([]string{"-m", "4096"}, y), []string{"-m", "4096", "-display", "cocoa"})
+
+	// e.g., set in $QEMU_SYSTEM_X86_64
+	assert.DeepEqual(t, displayArgs([]string{"-display", "gtk"}, y), []string{"-display", "gtk"})
+	assert.DeepEqual(t, displayArgs([]string{"-nographic"}, y), []string{"-nographic"})
+
+	y.QEMU.ExtraArgs = []string{"-nographic"}
+	assert.Assert(t, len(displayArgs(nil, y)) == 0)
+}
+
+func TestDiffDiskCommands(t *testing.T) {
+	const size = 100 * 1024 * 1024 * 1024
+	assert.DeepEqual(t, diffDiskCommands("basedisk", "qcow2", "diffdisk", limayaml.DiskFormatQCOW2, size),
+		[][]string{{"create", "-f", "qcow2", "-F", "qcow2", "-b", "basedisk", "diffdisk", "107374182400"}})
+	assert.DeepEqual(t, diffDiskCommands("/lima/default/basedisk", "raw", "/lima/default/diffdisk", limayaml.DiskFormatQCOW2, size),
+		[][]string{{"create", "-f", "qcow2", "-F", "raw", "-b", "basedisk", "/lima/default/diffdisk", "107374182400"}})
+	assert.DeepEqual(t, diffDiskCommands("basedisk", "", "diffdisk", limayaml.DiskFormatQCOW2, size),
+		[][]string{{"create", "-f", "qcow2", "diffdisk", "107374182400"}})
+	assert.DeepEqual(t, diffDiskCommands("basedisk", "qcow2", "diffdisk", limayaml.DiskFormatRaw, size),
+		[][]string{
+			{"convert", "-f", "qcow2", "-O", "raw", "basedisk", "diffdisk"},
+			{"resize", "-f", "raw", "--preallocation=falloc", "diffdisk", "107374182400"},
+		})
+	assert.DeepEqual(t, diffDiskCommands("basedisk", "", "diffdisk", limayaml.DiskFormatRaw, size),
+		[][]string{{"create", "-f", "raw", "-o", "preallocation=falloc", "diffdisk", "107374182400"}})
+}
+
+func TestRebaseDisk(t *testing.T) {
+	if _, err := exec.LookPath("qemu-img"); err != nil {
+		t.Skip("qemu-img is not installed")
+	}
+	qemuImg := func(args ...string) string {
+		out, err := exec.Command("qemu-img", args...).CombinedOutput()
+		assert.NilError(t, err, string(out))
+		return string(out)
+	}
+	parent := t.TempDir()
+	instDir := filepath.Join(parent, "old")
+	assert.NilError(t, os.Mkdir(instDir, 0755))
+	baseDisk := filepath.Join(instDir, filenames.BaseDisk)
+	diffDisk := filepath.Join(instDir, filenames.DiffDisk)
+	qemuImg("create", "-f", "qcow2", baseDisk, "1M")
+	// created with the absolute path, as in the previous releases
+	qemuImg("create", "-f", "qcow2", "-F", "qcow2", "-b", baseDisk, diffDisk, "2M")
+
+	movedDir := filepath.Join(parent, "new")
+	assert.NilError(t, os.Rename(instDir, movedDir))
+	movedDiffDisk := filepath.Join(movedDir, filenames.DiffDisk)
+	_, err := exec.Command("qemu-img", "info", "--backing-chain", movedDiffDisk).CombinedOutput()
+	assert.Assert(t, err != nil, "the backing chain should be broken")
+
+	assert.NilError(t, RebaseDisk(movedDir))
+	qemuImg("info", "--backing-chain", movedDiffDisk)
+	info, err := imgutil.GetInfo(movedDiffDisk)
+	assert.NilError(t, err)
+	assert.Equal(t, filenames.BaseDisk, info.BackingFilename)
+	assert.Equal(t, "qcow2", info.BackingFilenameFormat)
+
+	// the disk created by diffDiskCommands survives moving the directory without rebasing
+	assert.NilError(t, os.Remove(movedDiffDisk))
+	for _, args := range diffDiskCommands(filepath.Join(movedDir, filenames.BaseDisk), "qcow2", movedDiffDisk, limayaml.DiskFormatQCOW2, 2<<20) {
+		qemuImg(args...)
+	}
+	assert.NilError(t, os.Rename(movedDir, instDir))
+	qemuImg("info", "--backing-chain", diffDisk)
+	assert.NilError(t, RebaseDisk(instDir))
+}
+
+func TestRootDiskOptions(t *testing.T) {
+	y := &limayaml.LimaYAML{
+		DiskCache:   pointer.String(limayaml.DiskCacheNone),
+		DiskAIO:     pointer.String(limayaml.DiskAIONative),
+		DiskDiscard: pointer.String(limayaml.DiskDiscardUnmap),
+	}
+	assert.Equal(t, rootDiskOptions(y), "cache=none,aio=native,discard=unmap")
+
+	y.DiskCache = pointer.String(limayaml.DiskCacheWriteback)
+	assert.Equal(t, rootDiskOptions(y), "cache=writeback,aio=threads,discard=unmap")
+}
+
+func TestShellCommand(t *testing.T) {
+	assert.Equal(t, ShellCommand("/usr/bin/qemu-system-x86_64", []string{"-m", "4096", "-name", "lima-default", "-append", "root=/dev/vda1 console=ttyS0"}),
+		"/usr/bin/qemu-system-x86_64 -m 4096 -name lima-default -append 'root=/dev/vda1 console=ttyS0'")
+}
+
+func TestSMPArg(t *testing.T) {
+	y := &limayaml.LimaYAML{
+		CPUs:    pointer.Int(4),
+		MaxCPUs: pointer.Int(4),
+		CPU:     limayaml.CPU{Sockets: pointer.Int(1), Threads: pointer.Int(1)},
+	}
+	assert.Equal(t, smpArg(y), "4,sockets=1,cores=4,threads=1,maxcpus=4")
+
+	y.MaxCPUs = pointer.Int(16)
+	y.CPU = limayaml.CPU{Sockets: pointer.Int(2), Threads: pointer.Int(2)}
+	assert.Equal(t, smpArg(y), "4,sockets=2,cores=4,threads=2,maxcpus=16")
+}
+
+func TestImagesForArch(t *testing.T) {
+	images := []limayaml.File{
+		{Location: "x86_64-local", Arch: limayaml.X8664},
+		{Location: "aarch64-local", Arch: limayaml.AARCH64},
+		{Location: "any"},
+		{Location: "x86_64-remote", Arch: limayaml.X8664},
+	}
+	var locations []string
+	for _, f := range imagesForArch(images, limayaml.X8664) {
+		locations = append(locations, f.Location)
+	}
+	assert.DeepEqual(t, []string{"x86_64-local", "any", "x86_64-remote"}, locations)
+	assert.Equal(t, 0, len(imagesForArch(images[:2], "riscv64")))
+}
+
+func TestCheckDiskSpace(t *testing.T) {
+	const gib = 1 << 30
+	assert.NilError(t, checkDiskSpace(limayaml.DiskFormatQCOW2, 100*gib, 2*gib, true))
+	assert.ErrorContains(t, checkDiskSpace(limayaml.DiskFormatQCOW2, 100*gib, gib/2, true), "not enough free disk space")
+	assert.NilError(t, checkDiskSpace(limayaml.DiskFormatRaw, 10*gib, 20*gib, true))
+	assert.ErrorContains(t, checkDiskSpace(limayaml.DiskFormatRaw, 10*gib, 5*gib, true), "not enough free disk space")
+	assert.ErrorContains(t, checkDiskSpace(limayaml.DiskFormatRaw, 10*gib, 5*gib, false), "not enough free disk space")
+}
@@ -0,0 +1,97 @@
+package qemu
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/digitalocean/go-qemu/qmp"
+	"github.com/digitalocean/go-qemu/qmp/raw"
+	"github.com/sirupsen/logrus"
+)
+
+// Snapshot saves the state of the running instance (including the RAM and the device state) as
+// an internal snapshot named name, using the `savevm` monitor command via the QMP connection of the host agent.
+// An existing snapshot with the same name is overwritten.
+func Snapshot(qmpClient qmp.Monitor, name string) error {
+	return runSnapshotCommand(qmpClient, "savevm", name)
+}
+
+// RestoreSnapshot restores the running instance to the internal snapshot named name,
+// using the `loadvm` monitor command via the QMP connection of the host agent.
+func RestoreSnapshot(qmpClient qmp.Monitor, name string) error {
+	return runSnapshotCommand(qmpClient, "loadvm", name)
+}
+
+func validateSnapshotName(name string) error {
+	if name == "" {
+		return errors.New("snapshot name must not be empty")
+	}
+	// the name is passed to the human monitor as-is
+	if strings.ContainsAny(name, " \t\r\n\"") {
+		return fmt.Errorf("snapshot name %q must not contain whitespaces or quotes", name)
+	}
+	return nil
+}
+
+func runSnapshotCommand(qmpClient qmp.Monitor, command, name string) error {
+	if err := validateSnapshotName(name); err != nil {
+		return err
+	}
+	if err := checkInternalSnapshotSupport(qmpClient); err != nil {
+		return err
+	}
+	rawClient := raw.NewMonitor(qmpClient)
+	commandLine := command + " " + name
+	logrus.Infof("Sending %q via QMP", commandLine)
+	out, err := rawClient.HumanMonitorCommand(commandLine, nil)
+	if err != nil {
+		return fmt.Errorf("failed to run %q: %w", commandLine, err)
+	}
+	// the human monitor reports errors as output, not as QMP errors
+	if out = strings.TrimSpace(out); out != "" {
+		return fmt.Errorf("failed to run %q: %s", commandLine, out)
+	}
+	return nil
+}
+
+// blockInfo is the subset of the `query-block` result that is needed for checking the disk format.
+type blockInfo struct {
+	Device   string `json:"device"`
+	Inserted *struct {
+		File string `json:"file"`
+		Ro   bool   `json:"ro"`
+		Drv  string `json:"drv"`
+	} `json:"inserted,omitempty"`
+}
+
+// checkInternalSnapshotSupport checks that all the writable disks are qcow2,
+// as internal snapshots are stored inside the disk images.
+func checkInternalSnapshotSupport(qmpClient qmp.Monitor) error {
+	out, err := qmpClient.Run([]byte(`{"execute":"query-block"}`))
+	if err != nil {
+		return fmt.Errorf("failed to query the block devices: %w", err)
+	}
+	var resp struct {
+		Return []blockInfo `json:"return"`
+	}
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return fmt.Errorf("failed to parse the block devices: %w", err)
+	}
+	var writable int
+	for _, b := range resp.Return {
+		if b.Inserted == nil || b.Inserted.Ro {
+			continue
+		}
+		if b.Inserted.Drv != "qcow2" {
+			return fmt.Errorf("snapshots require qcow2 disks, but %q (%s) is %q (Hint: snapshots are not supported with `diskFormat: raw`)",
+				b.Inserted.File, b.Device, b.Inserted.Drv)
+		}
+		writable++
+	}
+	if writable == 0 {
+		return errors.New("snapshots require a writable qcow2 disk, but the instance has no writable disk")
+	}
+	return nil
+}
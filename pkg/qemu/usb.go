@@ -0,0 +1,180 @@
+package qemu
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+)
+
+// usbControllerID is the id of the xHCI controller the passed-through USB devices are attached to.
+const usbControllerID = "usb-xhci"
+
+// hostUSBDevice is a USB device present on the host.
+// Bus and Addr are zero when they are not known, e.g., on macOS.
+type hostUSBDevice struct {
+	VendorID  uint16
+	ProductID uint16
+	Bus       int
+	Addr      int
+}
+
+var errUSBUnsupported = errors.New("listing the USB devices of the host is not supported on this OS")
+
+// parseUSBID parses a validated `vendorID` or `productID` ("0781" or "0x0781").
+func parseUSBID(s string) (uint16, error) {
+	id, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(s)), "0x"), 16, 16)
+	return uint16(id), err
+}
+
+// usbArgs returns the QEMU arguments for passing through the USB devices of y.
+func usbArgs(y *limayaml.LimaYAML) ([]string, error) {
+	if len(y.USB) == 0 {
+		return nil, nil
+	}
+	args := []string{"-device", "qemu-xhci,id=" + usbControllerID}
+	for _, dev := range y.USB {
+		opts := "usb-host,bus=" + usbControllerID + ".0"
+		if dev.VendorID != "" {
+			vendorID, err := parseUSBID(dev.VendorID)
+			if err != nil {
+				return nil, err
+			}
+			productID, err := parseUSBID(dev.ProductID)
+			if err != nil {
+				return nil, err
+			}
+			opts += fmt.Sprintf(",vendorid=0x%04x,productid=0x%04x", vendorID, productID)
+		} else {
+			opts += fmt.Sprintf(",hostbus=%d,hostaddr=%d", dev.HostBus, dev.HostAddr)
+		}
+		args = append(args, "-device", opts)
+	}
+	return args, nil
+}
+
+// USBWarnings returns a warning message for each USB device in `usb` that is not present on the host.
+// QEMU starts without such a device, and attaches it when it is plugged in.
+func USBWarnings(y *limayaml.LimaYAML) ([]string, error) {
+	if len(y.USB) == 0 {
+		return nil, nil
+	}
+	present, err := hostUSBDevices()
+	if err != nil {
+		return nil, err
+	}
+	var warnings []string
+	for _, dev := range y.USB {
+		if dev.VendorID != "" {
+			vendorID, err := parseUSBID(dev.VendorID)
+			if err != nil {
+				return nil, err
+			}
+			productID, err := parseUSBID(dev.ProductID)
+			if err != nil {
+				return nil, err
+			}
+			if !hasUSBDevice(present, func(d hostUSBDevice) bool { return d.VendorID == vendorID && d.ProductID == productID }) {
+				warnings = append(warnings, fmt.Sprintf("USB device %04x:%04x is not present on the host", vendorID, productID))
+			}
+			continue
+		}
+		if !hasUSBDevice(present, func(d hostUSBDevice) bool { return d.Bus != 0 }) {
+			// The bus and the address are not known on this OS
+			continue
+		}
+		if !hasUSBDevice(present, func(d hostUSBDevice) bool { return d.Bus == dev.HostBus && d.Addr == dev.HostAddr }) {
+			warnings = append(warnings, fmt.Sprintf("USB device at bus %d, address %d is not present on the host", dev.HostBus, dev.HostAddr))
+		}
+	}
+	return warnings, nil
+}
+
+func hasUSBDevice(devs []hostUSBDevice, f func(hostUSBDevice) bool) bool {
+	for _, d := range devs {
+		if f(d) {
+			return true
+		}
+	}
+	return false
+}
+
+// sysfsUSBDevices lists the USB devices in sysfsDir (/sys/bus/usb/devices on Linux).
+// The interfaces (e.g., "1-1:1.0") are skipped, as they do not have idVendor.
+func sysfsUSBDevices(sysfsDir string) ([]hostUSBDevice, error) {
+	entries, err := os.ReadDir(sysfsDir)
+	if err != nil {
+		return nil, err
+	}
+	read := func(dir, name string, base int) (uint64, error) {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return 0, err
+		}
+		return strconv.ParseUint(strings.TrimSpace(string(b)), base, 16)
+	}
+	var res []hostUSBDevice
+	for _, e := range entries {
+		dir := filepath.Join(sysfsDir, e.Name())
+		vendorID, err := read(dir, "idVendor", 16)
+		if err != nil {
+			continue
+		}
+		productID, err := read(dir, "idProduct", 16)
+		if err != nil {
+			continue
+		}
+		bus, err := read(dir, "busnum", 10)
+		if err != nil {
+			continue
+		}
+		addr, err := read(dir, "devnum", 10)
+		if err != nil {
+			continue
+		}
+		res = append(res, hostUSBDevice{VendorID: uint16(vendorID), ProductID: uint16(productID), Bus: int(bus), Addr: int(addr)})
+	}
+	return res, nil
+}
+
+// parseSPUSBDataType parses the output of `system_profiler SPUSBDataType -json` of macOS.
+// The devices are nested in "_items", and the ids look like "0x0781  (SanDisk Corporation)".
+func parseSPUSBDataType(b []byte) ([]hostUSBDevice, error) {
+	var data map[string][]map[string]interface{}
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, err
+	}
+	var (
+		res  []hostUSBDevice
+		walk func(items []map[string]interface{})
+	)
+	walk = func(items []map[string]interface{}) {
+		for _, item := range items {
+			vendor, _ := item["vendor_id"].(string)
+			product, _ := item["product_id"].(string)
+			if vendorFields, productFields := strings.Fields(vendor), strings.Fields(product); len(vendorFields) > 0 && len(productFields) > 0 {
+				vendorID, vendorErr := parseUSBID(vendorFields[0])
+				productID, productErr := parseUSBID(productFields[0])
+				if vendorErr == nil && productErr == nil {
+					res = append(res, hostUSBDevice{VendorID: vendorID, ProductID: productID})
+				}
+			}
+			if children, ok := item["_items"].([]interface{}); ok {
+				var childItems []map[string]interface{}
+				for _, c := range children {
+					if m, ok := c.(map[string]interface{}); ok {
+						childItems = append(childItems, m)
+					}
+				}
+				walk(childItems)
+			}
+		}
+	}
+	walk(data["SPUSBDataType"])
+	return res, nil
+}
@@ -0,0 +1,13 @@
+package qemu
+
+import (
+	"github.com/lima-vm/lima/pkg/sysprof"
+)
+
+func hostUSBDevices() ([]hostUSBDevice, error) {
+	b, err := sysprof.SystemProfiler("SPUSBDataType")
+	if err != nil {
+		return nil, err
+	}
+	return parseSPUSBDataType(b)
+}
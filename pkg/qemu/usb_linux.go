@@ -0,0 +1,5 @@
+package qemu
+
+func hostUSBDevices() ([]hostUSBDevice, error) {
+	return sysfsUSBDevices("/sys/bus/usb/devices")
+}
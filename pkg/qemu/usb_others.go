@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package qemu
+
+func hostUSBDevices() ([]hostUSBDevice, error) {
+	return nil, errUSBUnsupported
+}
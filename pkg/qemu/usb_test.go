@@ -0,0 +1,60 @@
+package qemu
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+	"gotest.tools/v3/assert"
+)
+
+func TestUSBArgs(t *testing.T) {
+	y := &limayaml.LimaYAML{
+		USB: []limayaml.USBDevice{
+			{VendorID: "0x0781", ProductID: "5567"},
+			{HostBus: 1, HostAddr: 4},
+		},
+	}
+	args, err := usbArgs(y)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, args, []string{
+		"-device", "qemu-xhci,id=usb-xhci",
+		"-device", "usb-host,bus=usb-xhci.0,vendorid=0x0781,productid=0x5567",
+		"-device", "usb-host,bus=usb-xhci.0,hostbus=1,hostaddr=4",
+	})
+
+	args, err = usbArgs(&limayaml.LimaYAML{})
+	assert.NilError(t, err)
+	assert.Equal(t, 0, len(args))
+}
+
+func TestSysfsUSBDevices(t *testing.T) {
+	sysfsDir := t.TempDir()
+	write := func(dev string, files map[string]string) {
+		dir := filepath.Join(sysfsDir, dev)
+		assert.NilError(t, os.MkdirAll(dir, 0755))
+		for k, v := range files {
+			assert.NilError(t, os.WriteFile(filepath.Join(dir, k), []byte(v+"\n"), 0644))
+		}
+	}
+	write("1-1", map[string]string{"idVendor": "0781", "idProduct": "5567", "busnum": "1", "devnum": "4"})
+	write("1-1:1.0", map[string]string{"bInterfaceClass": "08"})
+	devs, err := sysfsUSBDevices(sysfsDir)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, devs, []hostUSBDevice{{VendorID: 0x0781, ProductID: 0x5567, Bus: 1, Addr: 4}})
+}
+
+func TestParseSPUSBDataType(t *testing.T) {
+	b := []byte(`{"SPUSBDataType": [{"_name": "USB31Bus", "_items": [
+  {"_name": "Hub", "vendor_id": "0x05e3  (Genesys Logic, Inc.)", "product_id": "0x0610", "_items": [
+    {"_name": "Cruzer Blade", "vendor_id": "0x0781  (SanDisk Corporation)", "product_id": "0x5567"}
+  ]}
+]}]}`)
+	devs, err := parseSPUSBDataType(b)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, devs, []hostUSBDevice{
+		{VendorID: 0x05e3, ProductID: 0x0610},
+		{VendorID: 0x0781, ProductID: 0x5567},
+	})
+}
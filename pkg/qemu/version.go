@@ -0,0 +1,58 @@
+package qemu
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/sirupsen/logrus"
+)
+
+// MinimumVersion is the oldest QEMU version known to accept the arguments generated by Cmdline,
+// e.g., the `on`/`off` forms of the boolean options of `-chardev`, `-spice`, and `-drive`.
+var MinimumVersion = semver.New("6.0.0")
+
+var versionRegexp = regexp.MustCompile(`QEMU emulator version (\d+)\.(\d+)(?:\.(\d+))?`)
+
+// ParseVersion parses the output of `qemu-system-x86_64 --version`,
+// e.g. "QEMU emulator version 6.2.0 (Debian 1:6.2+dfsg-2ubuntu6)".
+func ParseVersion(b []byte) (*semver.Version, error) {
+	matches := versionRegexp.FindSubmatch(b)
+	if matches == nil {
+		return nil, fmt.Errorf("failed to parse the QEMU version from %q", string(b))
+	}
+	patch := matches[3]
+	if len(patch) == 0 {
+		patch = []byte("0")
+	}
+	return semver.NewVersion(fmt.Sprintf("%s.%s.%s", matches[1], matches[2], patch))
+}
+
+// Version returns the version of the QEMU executable.
+func Version(exe string) (*semver.Version, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(exe, "--version")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to run %v: stdout=%q, stderr=%q: %w", cmd.Args, stdout.String(), stderr.String(), err)
+	}
+	return ParseVersion(stdout.Bytes())
+}
+
+// checkVersion returns an error if the QEMU executable is older than MinimumVersion.
+// A version that cannot be detected is not an error, as QEMU may be a wrapper script.
+func checkVersion(exe string) error {
+	v, err := Version(exe)
+	if err != nil {
+		logrus.WithError(err).Warnf("failed to detect the version of %s, assuming it is %s or later", exe, MinimumVersion)
+		return nil
+	}
+	if v.LessThan(*MinimumVersion) {
+		return fmt.Errorf("QEMU %s (%s) is older than the minimum supported version %s ( Hint: upgrade QEMU )", v, exe, MinimumVersion)
+	}
+	logrus.Debugf("QEMU version: %s", v)
+	return nil
+}
@@ -0,0 +1,25 @@
+package qemu
+
+import (
+	"testing"
+
+	"github.com/coreos/go-semver/semver"
+	"gotest.tools/v3/assert"
+)
+
+func TestParseVersion(t *testing.T) {
+	v, err := ParseVersion([]byte("QEMU emulator version 6.2.0 (Debian 1:6.2+dfsg-2ubuntu6)\nCopyright (c) 2003-2021 Fabrice Bellard and the QEMU Project developers\n"))
+	assert.NilError(t, err)
+	assert.Equal(t, *v, *semver.New("6.2.0"))
+
+	v, err = ParseVersion([]byte("QEMU emulator version 4.2.1 (Debian 1:4.2-3ubuntu6.19)"))
+	assert.NilError(t, err)
+	assert.Assert(t, v.LessThan(*MinimumVersion))
+
+	v, err = ParseVersion([]byte("QEMU emulator version 7.0"))
+	assert.NilError(t, err)
+	assert.Equal(t, *v, *semver.New("7.0.0"))
+
+	_, err = ParseVersion([]byte("qemu-system-x86_64: command not found"))
+	assert.ErrorContains(t, err, "failed to parse")
+}
@@ -0,0 +1,77 @@
+package qemu
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lima-vm/lima/pkg/limayaml"
+)
+
+// pciDevicesDir is the sysfs directory of the PCI devices of the host.
+const pciDevicesDir = "/sys/bus/pci/devices"
+
+// fullPCIAddress prepends the default domain to a PCI address without a domain ("01:00.0" -> "0000:01:00.0").
+func fullPCIAddress(addr string) string {
+	addr = strings.ToLower(addr)
+	if strings.Count(addr, ":") == 1 {
+		return "0000:" + addr
+	}
+	return addr
+}
+
+// CheckPCIPassthrough checks that the IOMMU is enabled, and that the devices in `pciPassthrough` are bound to vfio-pci.
+// The errors contain hints for fixing them, unlike the errors printed by QEMU.
+func CheckPCIPassthrough(y *limayaml.LimaYAML) error {
+	if len(y.PCIPassthrough) == 0 {
+		return nil
+	}
+	if getAccel(y) != "kvm" {
+		return fmt.Errorf("field `pciPassthrough` requires KVM, but the accelerator is %q (arch %q)", getAccel(y), *y.Arch)
+	}
+	return checkPCIPassthrough("/", y.PCIPassthrough)
+}
+
+// checkPCIPassthrough is CheckPCIPassthrough with the root directory of /sys and /dev for testing.
+func checkPCIPassthrough(root string, addrs []string) error {
+	groups, err := os.ReadDir(filepath.Join(root, "sys", "kernel", "iommu_groups"))
+	if err != nil || len(groups) == 0 {
+		return fmt.Errorf("the IOMMU is not enabled on the host ( Hint: add `intel_iommu=on iommu=pt` or `amd_iommu=on iommu=pt` to the kernel command line )")
+	}
+	for _, addr := range addrs {
+		addr = fullPCIAddress(addr)
+		devDir := filepath.Join(root, pciDevicesDir, addr)
+		if _, err := os.Stat(devDir); err != nil {
+			return fmt.Errorf("PCI device %q is not present on the host ( Hint: `lspci -D` )", addr)
+		}
+		driver, err := os.Readlink(filepath.Join(devDir, "driver"))
+		if err != nil || filepath.Base(driver) != "vfio-pci" {
+			current := "no driver"
+			if err == nil {
+				current = fmt.Sprintf("driver %q", filepath.Base(driver))
+			}
+			return fmt.Errorf("PCI device %q is bound to %s, not to \"vfio-pci\" "+
+				"( Hint: `echo vfio-pci | sudo tee %s/%s/driver_override && echo %s | sudo tee /sys/bus/pci/drivers_probe`, after unbinding the current driver )",
+				addr, current, pciDevicesDir, addr, addr)
+		}
+		group, err := os.Readlink(filepath.Join(devDir, "iommu_group"))
+		if err != nil {
+			return fmt.Errorf("PCI device %q does not belong to an IOMMU group: %w", addr, err)
+		}
+		groupDev := filepath.Join("/dev/vfio", filepath.Base(group))
+		if _, err := os.Stat(filepath.Join(root, groupDev)); err != nil {
+			return fmt.Errorf("the VFIO group %q of PCI device %q is not available ( Hint: `sudo modprobe vfio-pci` ): %w", groupDev, addr, err)
+		}
+	}
+	return nil
+}
+
+// pciPassthroughArgs returns the QEMU arguments for passing through the PCI devices of y.
+func pciPassthroughArgs(y *limayaml.LimaYAML) []string {
+	var args []string
+	for _, addr := range y.PCIPassthrough {
+		args = append(args, "-device", "vfio-pci,host="+fullPCIAddress(addr))
+	}
+	return args
+}
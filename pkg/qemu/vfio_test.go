@@ -0,0 +1,36 @@
+package qemu
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestCheckPCIPassthrough(t *testing.T) {
+	root := t.TempDir()
+	const addr = "0000:01:00.0"
+	err := checkPCIPassthrough(root, []string{addr})
+	assert.ErrorContains(t, err, "IOMMU is not enabled")
+
+	assert.NilError(t, os.MkdirAll(filepath.Join(root, "sys/kernel/iommu_groups/12"), 0755))
+	err = checkPCIPassthrough(root, []string{addr})
+	assert.ErrorContains(t, err, "is not present on the host")
+
+	devDir := filepath.Join(root, pciDevicesDir, addr)
+	assert.NilError(t, os.MkdirAll(devDir, 0755))
+	assert.NilError(t, os.Symlink("../../../bus/pci/drivers/nvidia", filepath.Join(devDir, "driver")))
+	err = checkPCIPassthrough(root, []string{"01:00.0"})
+	assert.ErrorContains(t, err, `bound to driver "nvidia"`)
+
+	assert.NilError(t, os.Remove(filepath.Join(devDir, "driver")))
+	assert.NilError(t, os.Symlink("../../../bus/pci/drivers/vfio-pci", filepath.Join(devDir, "driver")))
+	assert.NilError(t, os.Symlink("../../../kernel/iommu_groups/12", filepath.Join(devDir, "iommu_group")))
+	err = checkPCIPassthrough(root, []string{addr})
+	assert.ErrorContains(t, err, "/dev/vfio/12")
+
+	assert.NilError(t, os.MkdirAll(filepath.Join(root, "dev/vfio"), 0755))
+	assert.NilError(t, os.WriteFile(filepath.Join(root, "dev/vfio/12"), nil, 0644))
+	assert.NilError(t, checkPCIPassthrough(root, []string{addr}))
+}
@@ -200,8 +200,12 @@ func CommonOpts(useDotSSH bool) ([]string, error) {
 	return opts, nil
 }
 
-// SSHOpts adds the following options to CommonOptions: User, ControlMaster, ControlPath, ControlPersist
-func SSHOpts(instDir string, useDotSSH, forwardAgent bool) ([]string, error) {
+// SSHOpts adds the following options to CommonOptions: User, ControlMaster, ControlPath, ControlPersist,
+// and ForwardAgent when forwardAgent is true and the SSH agent of the host is available.
+//
+// When strictHostKeyChecking is true, the host key of the guest is pinned in the known_hosts file
+// of the instance on the first connection, instead of being ignored.
+func SSHOpts(instDir string, useDotSSH, forwardAgent, strictHostKeyChecking bool) ([]string, error) {
 	controlSock := filepath.Join(instDir, filenames.SSHSock)
 	if len(controlSock) >= osutil.UnixPathMax {
 		return nil, fmt.Errorf("socket path %q is too long: >= UNIX_PATH_MAX=%d", controlSock, osutil.UnixPathMax)
@@ -214,6 +218,9 @@ func SSHOpts(instDir string, useDotSSH, forwardAgent bool) ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
+	if strictHostKeyChecking {
+		opts = pinHostKey(opts, instDir)
+	}
 	opts = append(opts,
 		fmt.Sprintf("User=%s", u.Username), // guest and host have the same username, but we should specify the username explicitly (#85)
 		"ControlMaster=auto",
@@ -221,11 +228,53 @@ func SSHOpts(instDir string, useDotSSH, forwardAgent bool) ([]string, error) {
 		"ControlPersist=5m",
 	)
 	if forwardAgent {
-		opts = append(opts, "ForwardAgent=yes")
+		if err := checkSSHAgent(); err != nil {
+			logrus.WithError(err).Warn("Not forwarding the SSH agent")
+		} else {
+			opts = append(opts, "ForwardAgent=yes")
+		}
 	}
 	return opts, nil
 }
 
+// pinHostKey replaces the options of CommonOpts that disable the host key checking,
+// as ssh uses the first value of each option.
+// The host key is recorded under the name of the instance, as the forwarded port may change.
+func pinHostKey(opts []string, instDir string) []string {
+	knownHosts := filepath.Join(instDir, filenames.SSHKnownHosts)
+	res := make([]string, 0, len(opts)+1)
+	for _, o := range opts {
+		switch o {
+		case "StrictHostKeyChecking=no":
+			// the instance directory is removed when the instance is deleted, so a recreated instance starts from scratch
+			res = append(res, "StrictHostKeyChecking=accept-new")
+		case "UserKnownHostsFile=/dev/null":
+			res = append(res, fmt.Sprintf("UserKnownHostsFile=\"%s\"", knownHosts))
+		case "NoHostAuthenticationForLocalhost=yes":
+			res = append(res, fmt.Sprintf("HostKeyAlias=lima-%s", filepath.Base(instDir)))
+		default:
+			res = append(res, o)
+		}
+	}
+	return res
+}
+
+// checkSSHAgent checks that $SSH_AUTH_SOCK points to a socket.
+func checkSSHAgent() error {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return errors.New("$SSH_AUTH_SOCK is not set (hint: start ssh-agent on the host)")
+	}
+	st, err := os.Stat(sock)
+	if err != nil {
+		return fmt.Errorf("$SSH_AUTH_SOCK is not accessible: %w", err)
+	}
+	if st.Mode()&fs.ModeSocket == 0 {
+		return fmt.Errorf("$SSH_AUTH_SOCK (%q) is not a socket", sock)
+	}
+	return nil
+}
+
 // SSHArgsFromOpts returns ssh args from opts.
 // The result always contains {"-F", "/dev/null} in additon to {"-o", "KEY=VALUE", ...}.
 func SSHArgsFromOpts(opts []string) []string {
@@ -236,6 +285,22 @@ func SSHArgsFromOpts(opts []string) []string {
 	return args
 }
 
+// SSHArgs returns ssh args from opts, for connecting to the SSH port of the guest bound to address
+// (`ssh.address`) through the jump hosts of proxyJump (`ssh.proxyJump`), if any.
+//
+// The callers connect to "127.0.0.1"; "Hostname" overrides it with address, which is resolved
+// on the last jump host, so that the target is still this host rather than the jump host.
+func SSHArgs(opts []string, address, proxyJump string) []string {
+	args := SSHArgsFromOpts(opts)
+	if address != "" && address != "127.0.0.1" {
+		args = append(args, "-o", "Hostname="+address)
+	}
+	if proxyJump != "" {
+		args = append(args, "-J", proxyJump)
+	}
+	return args
+}
+
 func ParseOpenSSHVersion(version []byte) *semver.Version {
 	regex := regexp.MustCompile(`^OpenSSH_(\d+\.\d+)(?:p(\d+))?\b`)
 	matches := regex.FindSubmatch(version)
@@ -40,3 +40,21 @@ func Test_detectValidPublicKey(t *testing.T) {
 	assert.Check(t, !detectValidPublicKey("arbitrary content"))
 	assert.Check(t, !detectValidPublicKey(""))
 }
+
+func TestPinHostKey(t *testing.T) {
+	opts := []string{"IdentityFile=\"/foo\"", "StrictHostKeyChecking=no", "UserKnownHostsFile=/dev/null", "NoHostAuthenticationForLocalhost=yes", "BatchMode=yes"}
+	assert.DeepEqual(t, pinHostKey(opts, "/lima/default"), []string{
+		"IdentityFile=\"/foo\"",
+		"StrictHostKeyChecking=accept-new",
+		"UserKnownHostsFile=\"/lima/default/ssh_known_hosts\"",
+		"HostKeyAlias=lima-default",
+		"BatchMode=yes",
+	})
+}
+
+func TestSSHArgs(t *testing.T) {
+	opts := []string{"User=foo"}
+	assert.DeepEqual(t, []string{"-F", "/dev/null", "-o", "User=foo"}, SSHArgs(opts, "127.0.0.1", ""))
+	assert.DeepEqual(t, []string{"-F", "/dev/null", "-o", "User=foo", "-o", "Hostname=192.168.1.2", "-J", "bastion,admin@bastion2:2222"},
+		SSHArgs(opts, "192.168.1.2", "bastion,admin@bastion2:2222"))
+}
@@ -12,24 +12,45 @@ import (
 	"text/template"
 	"time"
 
+	"github.com/docker/go-units"
 	"github.com/lima-vm/lima/pkg/downloader"
+	"github.com/lima-vm/lima/pkg/hostagent"
 	hostagentevents "github.com/lima-vm/lima/pkg/hostagent/events"
 	"github.com/lima-vm/lima/pkg/limayaml"
 	"github.com/lima-vm/lima/pkg/qemu"
 	"github.com/lima-vm/lima/pkg/store"
 	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/lima-vm/lima/pkg/vsock"
 	"github.com/sirupsen/logrus"
 )
 
-func ensureDisk(ctx context.Context, instName, instDir string, y *limayaml.LimaYAML) error {
+// timings contains the durations of the boot phases that take place before launching the host agent.
+// See also hostagentevents.Timings.
+type timings struct {
+	download time.Duration
+	disk     time.Duration
+}
+
+func ensureDisk(ctx context.Context, instName, instDir string, y *limayaml.LimaYAML, t *timings) error {
 	qCfg := qemu.Config{
 		Name:        instName,
 		InstanceDir: instDir,
 		LimaYAML:    y,
 	}
-	if err := qemu.EnsureDisk(qCfg); err != nil {
+	// The base disk is not downloaded again for an existing diff disk, even if the base disk was removed
+	if _, err := os.Stat(filepath.Join(instDir, filenames.DiffDisk)); errors.Is(err, os.ErrNotExist) {
+		begin := time.Now()
+		if err := qemu.EnsureBaseDisk(ctx, qCfg); err != nil {
+			return err
+		}
+		t.download += time.Since(begin)
+	}
+
+	begin := time.Now()
+	if err := qemu.EnsureDisk(ctx, qCfg); err != nil {
 		return err
 	}
+	t.disk += time.Since(begin)
 
 	return nil
 }
@@ -37,7 +58,7 @@ func ensureDisk(ctx context.Context, instName, instDir string, y *limayaml.LimaY
 // ensureNerdctlArchiveCache prefetches the nerdctl-full-VERSION-linux-GOARCH.tar.gz archive
 // into the cache before launching the hostagent process, so that we can show the progress in tty.
 // https://github.com/lima-vm/lima/issues/326
-func ensureNerdctlArchiveCache(y *limayaml.LimaYAML) (string, error) {
+func ensureNerdctlArchiveCache(ctx context.Context, y *limayaml.LimaYAML) (string, error) {
 	if !*y.Containerd.System && !*y.Containerd.User {
 		// nerdctl archive is not needed
 		return "", nil
@@ -45,30 +66,40 @@ func ensureNerdctlArchiveCache(y *limayaml.LimaYAML) (string, error) {
 
 	errs := make([]error, len(y.Containerd.Archives))
 	for i := range y.Containerd.Archives {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
 		f := &y.Containerd.Archives[i]
 		if f.Arch != *y.Arch {
 			errs[i] = fmt.Errorf("unsupported arch: %q", f.Arch)
 			continue
 		}
-		logrus.WithField("digest", f.Digest).Infof("Attempting to download the nerdctl archive from %q", f.Location)
-		res, err := downloader.Download("", f.Location, downloader.WithCache(), downloader.WithExpectedDigest(f.Digest))
+		mirrors := f.Mirrors()
+		logrus.WithField("digest", f.Digest).Infof("Attempting to download the nerdctl archive from %q", mirrors[0])
+		res, err := downloader.DownloadMirrors("", mirrors,
+			downloader.WithContext(ctx),
+			downloader.WithCache(),
+			downloader.WithExpectedDigest(f.Digest),
+			downloader.WithProxy(*y.Downloader.Proxy),
+			downloader.WithCACert(*y.Downloader.CACert),
+		)
 		if err != nil {
-			errs[i] = fmt.Errorf("failed to download %q: %w", f.Location, err)
+			errs[i] = err
 			continue
 		}
 		switch res.Status {
 		case downloader.StatusDownloaded:
-			logrus.Infof("Downloaded the nerdctl archive from %q", f.Location)
+			logrus.Infof("Downloaded the nerdctl archive from %q", res.Remote)
 		case downloader.StatusUsedCache:
 			logrus.Infof("Using cache %q", res.CachePath)
 		default:
 			logrus.Warnf("Unexpected result from downloader.Download(): %+v", res)
 		}
 		if res.CachePath == "" {
-			if downloader.IsLocal(f.Location) {
-				return f.Location, nil
+			if downloader.IsLocal(res.Remote) {
+				return res.Remote, nil
 			}
-			return "", fmt.Errorf("cache did not contain %q", f.Location)
+			return "", fmt.Errorf("cache did not contain %q", res.Remote)
 		}
 		return res.CachePath, nil
 	}
@@ -77,7 +108,51 @@ func ensureNerdctlArchiveCache(y *limayaml.LimaYAML) (string, error) {
 		len(y.Containerd.Archives), errs)
 }
 
-func Start(ctx context.Context, inst *store.Instance) error {
+type options struct {
+	hostAgentLogLevel  string
+	hostAgentLogFormat string
+}
+
+// Opt is an option for Start.
+type Opt func(*options) error
+
+// WithHostAgentLogLevel sets the log level of the host agent (`limactl hostagent --log-level`).
+// An empty level keeps the default of the host agent.
+func WithHostAgentLogLevel(level string) Opt {
+	return func(o *options) error {
+		if level != "" {
+			if _, err := logrus.ParseLevel(level); err != nil {
+				return err
+			}
+		}
+		o.hostAgentLogLevel = level
+		return nil
+	}
+}
+
+// WithHostAgentLogFormat sets the log format of the host agent (`limactl hostagent --log-format`),
+// hostagent.LogFormatJSON or hostagent.LogFormatText.
+// An empty format keeps the default of the host agent.
+func WithHostAgentLogFormat(format string) Opt {
+	return func(o *options) error {
+		switch format {
+		case "", hostagent.LogFormatJSON, hostagent.LogFormatText:
+		default:
+			return fmt.Errorf("log format must be %q or %q, got %q", hostagent.LogFormatJSON, hostagent.LogFormatText, format)
+		}
+		o.hostAgentLogFormat = format
+		return nil
+	}
+}
+
+func Start(ctx context.Context, inst *store.Instance, opts ...Opt) error {
+	var o options
+	for _, f := range opts {
+		if err := f(&o); err != nil {
+			return err
+		}
+	}
+
 	haPIDPath := filepath.Join(inst.Dir, filenames.HostAgentPID)
 	if _, err := os.Stat(haPIDPath); !errors.Is(err, os.ErrNotExist) {
 		return fmt.Errorf("instance %q seems running (hint: remove %q if the instance is not actually running)", inst.Name, haPIDPath)
@@ -90,13 +165,16 @@ func Start(ctx context.Context, inst *store.Instance) error {
 		return err
 	}
 
-	if err := ensureDisk(ctx, inst.Name, inst.Dir, y); err != nil {
+	var t timings
+	if err := ensureDisk(ctx, inst.Name, inst.Dir, y, &t); err != nil {
 		return err
 	}
-	nerdctlArchiveCache, err := ensureNerdctlArchiveCache(y)
+	downloadBegin := time.Now()
+	nerdctlArchiveCache, err := ensureNerdctlArchiveCache(ctx, y)
 	if err != nil {
 		return err
 	}
+	t.download += time.Since(downloadBegin)
 
 	self, err := os.Executable()
 	if err != nil {
@@ -132,6 +210,12 @@ func Start(ctx context.Context, inst *store.Instance) error {
 	if nerdctlArchiveCache != "" {
 		args = append(args, "--nerdctl-archive", nerdctlArchiveCache)
 	}
+	if o.hostAgentLogLevel != "" {
+		args = append(args, "--log-level", o.hostAgentLogLevel)
+	}
+	if o.hostAgentLogFormat != "" {
+		args = append(args, "--log-format", o.hostAgentLogFormat)
+	}
 	args = append(args, inst.Name)
 	haCmd := exec.CommandContext(ctx, self, args...)
 
@@ -150,7 +234,7 @@ func Start(ctx context.Context, inst *store.Instance) error {
 
 	watchErrCh := make(chan error)
 	go func() {
-		watchErrCh <- watchHostAgentEvents(ctx, inst, haStdoutPath, haStderrPath, begin)
+		watchErrCh <- watchHostAgentEvents(ctx, inst, haStdoutPath, haStderrPath, begin, t)
 		close(watchErrCh)
 	}()
 	waitErrCh := make(chan error)
@@ -170,6 +254,53 @@ func Start(ctx context.Context, inst *store.Instance) error {
 	}
 }
 
+// DryRun returns the QEMU command line that would be run by the host agent, as a string that can be copied
+// to a shell. Neither the host agent nor QEMU is started, and the instance directory is not modified.
+//
+// The problems of the host are checked with qemu.Preflight, and reported at once.
+// The disks are not created, and their paths are printed; the base disk is assumed not to be an ISO until
+// it is downloaded. The cidata ISO is generated by the host agent, so it only exists if the instance was started before.
+func DryRun(ctx context.Context, inst *store.Instance) (string, error) {
+	y, err := inst.LoadYAML()
+	if err != nil {
+		return "", err
+	}
+	qCfg := qemu.Config{
+		Name:        inst.Name,
+		InstanceDir: inst.Dir,
+		LimaYAML:    y,
+	}
+	if err := qemu.Preflight(qCfg); err != nil {
+		return "", err
+	}
+	disks := []string{filepath.Join(inst.Dir, filenames.BaseDisk)}
+	if diskSize, _ := units.RAMInBytes(*y.Disk); diskSize > 0 {
+		disks = append(disks, filepath.Join(inst.Dir, filenames.DiffDisk))
+	}
+	for _, disk := range disks {
+		if _, err := os.Stat(disk); err == nil {
+			logrus.Infof("Using the disk %q", disk)
+		} else {
+			logrus.Infof("The disk %q does not exist yet, it is created by `limactl start`", disk)
+		}
+	}
+	qCfg.SSHLocalPort, err = hostagent.DetermineSSHLocalPort(y, inst.Name)
+	if err != nil {
+		return "", err
+	}
+	if vsock.HostAvailable() {
+		qCfg.VSockCID, err = qemu.VSockCID(inst.Dir)
+		if err != nil {
+			return "", err
+		}
+	}
+	qExe, qArgs, err := qemu.Cmdline(qCfg)
+	if err != nil {
+		return "", err
+	}
+	return qemu.ShellCommand(qExe, qArgs), nil
+}
+
 func waitHostAgentStart(ctx context.Context, haPIDPath, haStderrPath string) error {
 	begin := time.Now()
 	deadlineDuration := 5 * time.Second
@@ -184,12 +315,18 @@ func waitHostAgentStart(ctx context.Context, haPIDPath, haStderrPath string) err
 	}
 }
 
-func watchHostAgentEvents(ctx context.Context, inst *store.Instance, haStdoutPath, haStderrPath string, begin time.Time) error {
+func watchHostAgentEvents(ctx context.Context, inst *store.Instance, haStdoutPath, haStderrPath string, begin time.Time, t timings) error {
 	ctx2, cancel := context.WithTimeout(ctx, 10*time.Minute)
 	defer cancel()
 
 	var (
 		printedSSHLocalPort  bool
+		printedSSHReady      bool
+		printedVNCEndpoint   bool
+		printedSPICESocket   bool
+		printedMounts        int
+		printedBootProgress  int
+		printedErrors        string
 		receivedRunningEvent bool
 		err                  error
 	)
@@ -198,15 +335,47 @@ func watchHostAgentEvents(ctx context.Context, inst *store.Instance, haStdoutPat
 			logrus.Infof("SSH Local Port: %d", ev.Status.SSHLocalPort)
 			printedSSHLocalPort = true
 		}
+		if !printedVNCEndpoint && ev.Status.VNCEndpoint != "" {
+			logrus.Infof("VNC: vnc://%s", ev.Status.VNCEndpoint)
+			printedVNCEndpoint = true
+		}
+		if !printedSPICESocket && ev.Status.SPICESocket != "" {
+			logrus.Infof("SPICE: spice+unix://%s", ev.Status.SPICESocket)
+			printedSPICESocket = true
+		}
+		if !printedSSHReady && ev.Status.SSHReady {
+			logrus.Info("SSH is ready")
+			printedSSHReady = true
+		}
+		if ev.Status.BootProgress > printedBootProgress && !ev.Status.Running {
+			logrus.Infof("Booting ... %d%%", ev.Status.BootProgress)
+			printedBootProgress = ev.Status.BootProgress
+		}
+		for ; printedMounts < len(ev.Status.Mounts); printedMounts++ {
+			m := ev.Status.Mounts[printedMounts]
+			if m.Mounted {
+				logrus.Infof("Mounting %q ... done", m.MountPoint)
+			} else {
+				logrus.Warnf("Mounting %q ... failed: %s", m.MountPoint, m.Error)
+			}
+		}
 
-		if len(ev.Status.Errors) > 0 {
-			logrus.Errorf("%+v", ev.Status.Errors)
+		// The same errors are repeated in the subsequent events
+		if errs := fmt.Sprintf("%+v", ev.Status.Errors); len(ev.Status.Errors) > 0 && errs != printedErrors {
+			logrus.Errorf("%s", errs)
+			printedErrors = errs
 		}
 		if ev.Status.Exiting {
 			err = fmt.Errorf("exiting, status=%+v (hint: see %q)", ev.Status, haStderrPath)
 			return true
 		} else if ev.Status.Running {
 			receivedRunningEvent = true
+			if ev.Status.Timings != nil {
+				logrus.Infof("Boot timings: download=%v, disk=%v, qemu-to-ssh=%v, requirements=%v, ready=%v",
+					t.download.Round(time.Millisecond), t.disk.Round(time.Millisecond),
+					ev.Status.Timings.QEMUToSSH.Round(time.Millisecond), ev.Status.Timings.Requirements.Round(time.Millisecond),
+					ev.Status.Timings.Ready.Round(time.Millisecond))
+			}
 			if ev.Status.Degraded {
 				logrus.Warnf("DEGRADED. The VM seems running, but file sharing and port forwarding may not work. (hint: see %q)", haStderrPath)
 				err = fmt.Errorf("degraded, status=%+v", ev.Status)
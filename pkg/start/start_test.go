@@ -0,0 +1,92 @@
+package start
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/store"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"gotest.tools/v3/assert"
+)
+
+// fakeQEMU stands in for qemu-system-x86_64 and qemu-img; it only answers `--version`, `-accel help`, and `-netdev help`.
+const fakeQEMU = `#!/bin/sh
+if [ "$1" = --version ]; then
+  echo "QEMU emulator version 8.2.0"
+  exit 0
+fi
+echo "Accelerators supported in QEMU binary:"
+echo tcg
+echo kvm
+echo hvf
+echo "Available netdev backend types:"
+echo user
+`
+
+// readDir returns the contents of the files in dir.
+func readDir(t *testing.T, dir string) map[string]string {
+	res := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		res[path] = string(b)
+		return nil
+	})
+	assert.NilError(t, err)
+	return res
+}
+
+func TestDryRunDoesNotModifyInstance(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake QEMU is a shell script")
+	}
+	binDir := t.TempDir()
+	for _, f := range []string{"qemu-system-x86_64", "qemu-img"} {
+		assert.NilError(t, os.WriteFile(filepath.Join(binDir, f), []byte(fakeQEMU), 0o755))
+	}
+	t.Setenv("PATH", binDir)
+	t.Setenv("QEMU_SYSTEM_X86_64", "")
+	limaHome := t.TempDir()
+	t.Setenv("LIMA_HOME", limaHome)
+
+	firmwareDir := t.TempDir()
+	code := filepath.Join(firmwareDir, "OVMF_CODE.fd")
+	vars := filepath.Join(firmwareDir, "OVMF_VARS.fd")
+	assert.NilError(t, os.WriteFile(code, []byte("code"), 0o644))
+	assert.NilError(t, os.WriteFile(vars, []byte("vars"), 0o644))
+
+	instDir := filepath.Join(limaHome, "test")
+	assert.NilError(t, os.MkdirAll(instDir, 0o700))
+	limaYAML := `arch: x86_64
+images:
+- location: https://example.com/image.img
+ssh:
+  localPort: 60906
+firmware:
+  code: ` + code + `
+  vars: ` + vars + `
+`
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.LimaYAML), []byte(limaYAML), 0o644))
+	// left behind by the previous QEMU
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.SerialLog), []byte("previous boot"), 0o644))
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.QMPSock), nil, 0o644))
+	before := readDir(t, instDir)
+
+	qCmd, err := DryRun(context.Background(), &store.Instance{Name: "test", Dir: instDir})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, readDir(t, instDir), before)
+	// the command line refers to the files created by Start and the host agent
+	for _, f := range []string{filenames.DiffDisk, filenames.EFIVars, filenames.CIDataISO} {
+		assert.Assert(t, strings.Contains(qCmd, filepath.Join(instDir, f)), "%q does not refer to %q", qCmd, f)
+	}
+}
@@ -0,0 +1,81 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/lima-vm/lima/pkg/store/filenames"
+)
+
+type deleteOptions struct {
+	baseDiskDest string
+}
+
+// DeleteOpt is an option of DeleteInstance.
+type DeleteOpt func(*deleteOptions) error
+
+// WithBaseDiskPreserved moves the base disk (the image downloaded for the instance) to dest instead of removing it,
+// so that it can be reused. dest has to be on the same filesystem as the instance directory.
+func WithBaseDiskPreserved(dest string) DeleteOpt {
+	return func(o *deleteOptions) error {
+		if dest == "" {
+			return errors.New("the destination of the base disk must not be empty")
+		}
+		o.baseDiskDest = dest
+		return nil
+	}
+}
+
+// DeleteInstance removes the instance directory, including the disks, cidata.iso, the sockets, and the logs.
+// DeleteInstance refuses to delete an instance whose QEMU or host agent is still running.
+// When some files cannot be removed, the returned error lists them, and the instance directory is left.
+func DeleteInstance(instName string, opts ...DeleteOpt) error {
+	var o deleteOptions
+	for _, f := range opts {
+		if err := f(&o); err != nil {
+			return err
+		}
+	}
+	instDir, err := InstanceDir(instName)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(instDir); err != nil {
+		return err
+	}
+	for _, pidFile := range []string{filenames.QemuPID, filenames.HostAgentPID} {
+		pid, err := ReadPIDFile(filepath.Join(instDir, pidFile))
+		if err != nil {
+			return err
+		}
+		if pid > 0 {
+			return fmt.Errorf("instance %q is running (%s: %d), stop it first", instName, pidFile, pid)
+		}
+	}
+	if o.baseDiskDest != "" {
+		if err := os.Rename(filepath.Join(instDir, filenames.BaseDisk), o.baseDiskDest); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to preserve the base disk: %w", err)
+		}
+	}
+	entries, err := os.ReadDir(instDir)
+	if err != nil {
+		return err
+	}
+	var (
+		failed []string
+		mErr   error
+	)
+	for _, e := range entries {
+		if err := os.RemoveAll(filepath.Join(instDir, e.Name())); err != nil {
+			failed = append(failed, e.Name())
+			mErr = multierror.Append(mErr, err)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to remove %v under %q: %w", failed, instDir, mErr)
+	}
+	return os.Remove(instDir)
+}
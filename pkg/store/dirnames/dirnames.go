@@ -53,3 +53,12 @@ func LimaNetworksDir() (string, error) {
 	}
 	return filepath.Join(limaDir, filenames.NetworksDir), nil
 }
+
+// LimaImagesDir returns the path of the image store shared by the instances, $LIMA_HOME/_images.
+func LimaImagesDir() (string, error) {
+	limaDir, err := LimaDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(limaDir, filenames.ImagesDir), nil
+}
@@ -10,6 +10,7 @@ const (
 	ConfigDir   = "_config"
 	CacheDir    = "_cache"    // not yet implemented
 	NetworksDir = "_networks" // network log files are stored here
+	ImagesDir   = "_images"   // images shared by the instances are stored here
 )
 
 // Filenames used inside the ConfigDir
@@ -29,16 +30,22 @@ const (
 	CIDataISO          = "cidata.iso"
 	BaseDisk           = "basedisk"
 	DiffDisk           = "diffdisk"
+	EFIVars            = "efivars.fd" // the UEFI variable store, copied from the template of the firmware
 	QemuPID            = "qemu.pid"
 	QMPSock            = "qmp.sock"
 	SerialLog          = "serial.log"
 	SerialSock         = "serial.sock"
+	SPICESock          = "spice.sock"
 	SSHSock            = "ssh.sock"
+	SSHKnownHosts      = "ssh_known_hosts" // used when ssh.strictHostKeyChecking is true
 	GuestAgentSock     = "ga.sock"
+	GuestAgentToken    = "ga.token" // presented by the host agent to the guest agent over vsock
 	HostAgentPID       = "ha.pid"
+	HostAgentLock      = "ha.lock" // locked by the running host agent
 	HostAgentSock      = "ha.sock"
 	HostAgentStdoutLog = "ha.stdout.log"
 	HostAgentStderrLog = "ha.stderr.log"
+	HostAgentEvent     = "ha.json" // the latest event
 
 	// SocketDir is the default location for forwarded sockets with a relative paths in HostSocket
 	SocketDir = "sock"
@@ -2,6 +2,7 @@ package store
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/docker/go-units"
 	hostagentclient "github.com/lima-vm/lima/pkg/hostagent/api/client"
+	"github.com/lima-vm/lima/pkg/hostagent/events"
 	"github.com/lima-vm/lima/pkg/limayaml"
 	"github.com/lima-vm/lima/pkg/store/dirnames"
 	"github.com/lima-vm/lima/pkg/store/filenames"
@@ -39,6 +41,7 @@ type Instance struct {
 	Message      string             `json:"message,omitempty"`
 	Networks     []limayaml.Network `json:"network,omitempty"`
 	SSHLocalPort int                `json:"sshLocalPort,omitempty"`
+	SSHAddress   string             `json:"sshAddress,omitempty"`
 	HostAgentPID int                `json:"hostAgentPID,omitempty"`
 	QemuPID      int                `json:"qemuPID,omitempty"`
 	Errors       []error            `json:"errors,omitempty"`
@@ -74,6 +77,10 @@ func Inspect(instName string) (*Instance, error) {
 		return inst, nil
 	}
 	inst.Dir = instDir
+	if err := CheckInstNameCollision(instName); err != nil {
+		inst.Status = StatusBroken
+		inst.Errors = append(inst.Errors, err)
+	}
 	inst.Arch = *y.Arch
 	inst.CPUs = *y.CPUs
 	memory, err := units.RAMInBytes(*y.Memory)
@@ -87,6 +94,7 @@ func Inspect(instName string) (*Instance, error) {
 	inst.Message = y.Message
 	inst.Networks = y.Networks
 	inst.SSHLocalPort = *y.SSH.LocalPort // maybe 0
+	inst.SSHAddress = *y.SSH.Address
 
 	inst.HostAgentPID, err = ReadPIDFile(filepath.Join(instDir, filenames.HostAgentPID))
 	if err != nil {
@@ -120,22 +128,51 @@ func Inspect(instName string) (*Instance, error) {
 	}
 
 	if inst.Status == StatusUnknown {
-		if inst.HostAgentPID > 0 && inst.QemuPID > 0 {
-			inst.Status = StatusRunning
-		} else if inst.HostAgentPID == 0 && inst.QemuPID == 0 {
-			inst.Status = StatusStopped
-		} else if inst.HostAgentPID > 0 && inst.QemuPID == 0 {
-			inst.Errors = append(inst.Errors, errors.New("host agent is running but qemu is not"))
-			inst.Status = StatusBroken
-		} else {
-			inst.Errors = append(inst.Errors, errors.New("qemu is running but host agent is not"))
-			inst.Status = StatusBroken
+		inst.Status, err = statusFromPIDs(inst.HostAgentPID, inst.QemuPID)
+		if err != nil {
+			inst.Errors = append(inst.Errors, err)
 		}
 	}
 
 	return inst, nil
 }
 
+// InstanceStatus returns the status of the instance, by checking whether the host agent and QEMU are running.
+// Unlike Inspect, InstanceStatus neither loads lima.yaml nor connects to the host agent, so it is cheap enough
+// for polling many instances.
+// The returned error is os.ErrNotExist when the instance does not exist; other errors come with StatusBroken.
+func InstanceStatus(instName string) (Status, error) {
+	instDir, err := InstanceDir(instName)
+	if err != nil {
+		return StatusUnknown, err
+	}
+	if _, err := os.Stat(filepath.Join(instDir, filenames.LimaYAML)); err != nil {
+		return StatusUnknown, err
+	}
+	haPID, err := ReadPIDFile(filepath.Join(instDir, filenames.HostAgentPID))
+	if err != nil {
+		return StatusBroken, err
+	}
+	qemuPID, err := ReadPIDFile(filepath.Join(instDir, filenames.QemuPID))
+	if err != nil {
+		return StatusBroken, err
+	}
+	return statusFromPIDs(haPID, qemuPID)
+}
+
+func statusFromPIDs(haPID, qemuPID int) (Status, error) {
+	switch {
+	case haPID > 0 && qemuPID > 0:
+		return StatusRunning, nil
+	case haPID == 0 && qemuPID == 0:
+		return StatusStopped, nil
+	case haPID > 0:
+		return StatusBroken, errors.New("host agent is running but qemu is not")
+	default:
+		return StatusBroken, errors.New("qemu is running but host agent is not")
+	}
+}
+
 // ReadPIDFile returns 0 if the PID file does not exist or the process has already terminated
 // (in which case the PID file will be removed).
 func ReadPIDFile(path string) (int, error) {
@@ -197,3 +234,22 @@ func AddGlobalFields(inst *Instance) (FormatData, error) {
 	}
 	return data, nil
 }
+
+// ReadHostAgentEvent returns the latest event emitted by the host agent of the instance.
+// The event may be stale when the host agent was killed.
+// The returned error is os.ErrNotExist when the host agent has never emitted an event.
+func ReadHostAgentEvent(instName string) (*events.Event, error) {
+	instDir, err := InstanceDir(instName)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(filepath.Join(instDir, filenames.HostAgentEvent))
+	if err != nil {
+		return nil, err
+	}
+	var ev events.Event
+	if err := json.Unmarshal(b, &ev); err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %w", filenames.HostAgentEvent, err)
+	}
+	return &ev, nil
+}
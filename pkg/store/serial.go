@@ -0,0 +1,56 @@
+package store
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"github.com/nxadm/tail"
+)
+
+// TailSerialLog calls onLine for each line of serial.log of the instance, until ctx is cancelled.
+//
+// With fromStart, the existing content is read from the beginning; otherwise only the lines written
+// after the call are read.
+// With follow, TailSerialLog keeps waiting for new lines, and the file is reopened when it was
+// truncated or recreated, e.g., on restart of the instance; otherwise it returns at the end of the file.
+func TailSerialLog(ctx context.Context, instName string, fromStart, follow bool, onLine func(string)) error {
+	instDir, err := InstanceDir(instName)
+	if err != nil {
+		return err
+	}
+	cfg := tail.Config{
+		Follow:    follow,
+		ReOpen:    follow,
+		MustExist: !follow,
+		// inotify does not notice the removal of serial.log while it is open, so the file is polled
+		Poll:   true,
+		Logger: tail.DiscardingLogger,
+	}
+	if !fromStart {
+		cfg.Location = &tail.SeekInfo{Whence: io.SeekEnd}
+	}
+	t, err := tail.TailFile(filepath.Join(instDir, filenames.SerialLog), cfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = t.Stop()
+		t.Cleanup()
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case line, ok := <-t.Lines:
+			if !ok {
+				return t.Err()
+			}
+			if line.Err != nil {
+				return line.Err
+			}
+			onLine(line.Text)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package store
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -8,9 +10,11 @@ import (
 	"github.com/containerd/containerd/identifiers"
 	"github.com/lima-vm/lima/pkg/limayaml"
 	"github.com/lima-vm/lima/pkg/store/dirnames"
+	"github.com/lima-vm/lima/pkg/store/filenames"
 )
 
 // Instances returns the names of the instances under LimaDir.
+// Only directories and symlinks to directories are considered; the instances are not validated.
 func Instances() ([]string, error) {
 	limaDir, err := dirnames.LimaDir()
 	if err != nil {
@@ -25,15 +29,55 @@ func Instances() ([]string, error) {
 		if strings.HasPrefix(f.Name(), ".") || strings.HasPrefix(f.Name(), "_") {
 			continue
 		}
+		if !f.IsDir() {
+			// e.g., an instance directory moved to another disk and symlinked
+			if f.Type()&os.ModeSymlink == 0 {
+				continue
+			}
+			if st, err := os.Stat(filepath.Join(limaDir, f.Name())); err != nil || !st.IsDir() {
+				continue
+			}
+		}
 		names = append(names, f.Name())
 	}
 	return names, nil
 }
 
+// ValidateInstName validates the instance name.
+//
+// The name must consist of alphanumerics, ".", "_", and "-", must begin with an alphanumeric,
+// and must not be longer than 76 characters (see containerd's identifiers.Validate).
+// The name is case-sensitive, but see CheckInstNameCollision.
+func ValidateInstName(name string) error {
+	if err := identifiers.Validate(name); err != nil {
+		return fmt.Errorf("invalid instance name %q: %w", name, err)
+	}
+	return nil
+}
+
+// CheckInstNameCollision returns an error if another instance exists under LimaDir
+// with a name that differs from name only by case.
+// Such instances would share the same directory on case-insensitive filesystems (e.g. APFS on macOS).
+func CheckInstNameCollision(name string) error {
+	names, err := Instances()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, f := range names {
+		if f != name && strings.EqualFold(f, name) {
+			return fmt.Errorf("instance name %q collides with existing instance %q (instance names must not differ only by case)", name, f)
+		}
+	}
+	return nil
+}
+
 // InstanceDir returns the instance dir.
 // InstanceDir does not check whether the instance exists
 func InstanceDir(name string) (string, error) {
-	if err := identifiers.Validate(name); err != nil {
+	if err := ValidateInstName(name); err != nil {
 		return "", err
 	}
 	limaDir, err := dirnames.LimaDir()
@@ -45,6 +89,15 @@ func InstanceDir(name string) (string, error) {
 }
 
 // LoadYAMLByFilePath loads and validates the yaml.
+// LoadYAMLByInstanceName loads and validates lima.yaml of the instance.
+func LoadYAMLByInstanceName(instName string) (*limayaml.LimaYAML, error) {
+	instDir, err := InstanceDir(instName)
+	if err != nil {
+		return nil, err
+	}
+	return LoadYAMLByFilePath(filepath.Join(instDir, filenames.LimaYAML))
+}
+
 func LoadYAMLByFilePath(filePath string) (*limayaml.LimaYAML, error) {
 	// We need to use the absolute path because it may be used to determine hostSocket locations.
 	absPath, err := filepath.Abs(filePath)
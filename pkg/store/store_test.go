@@ -0,0 +1,145 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/store/filenames"
+	"gotest.tools/v3/assert"
+)
+
+func TestValidateInstName(t *testing.T) {
+	for _, name := range []string{"default", "foo-bar", "foo_bar.1", "UPPER"} {
+		assert.NilError(t, ValidateInstName(name))
+	}
+	for _, name := range []string{"", "_config", ".hidden", "-foo", "foo/bar", "foo bar", strings.Repeat("a", 77)} {
+		assert.ErrorContains(t, ValidateInstName(name), "invalid instance name")
+	}
+}
+
+func TestCheckInstNameCollision(t *testing.T) {
+	limaHome := t.TempDir()
+	t.Setenv("LIMA_HOME", limaHome)
+	assert.NilError(t, os.Mkdir(filepath.Join(limaHome, "foo"), 0700))
+
+	assert.NilError(t, CheckInstNameCollision("foo"))
+	assert.NilError(t, CheckInstNameCollision("bar"))
+	assert.ErrorContains(t, CheckInstNameCollision("Foo"), "collides with existing instance \"foo\"")
+
+	t.Setenv("LIMA_HOME", filepath.Join(limaHome, "does-not-exist"))
+	assert.NilError(t, CheckInstNameCollision("foo"))
+}
+
+func TestInstanceStatus(t *testing.T) {
+	limaHome := t.TempDir()
+	t.Setenv("LIMA_HOME", limaHome)
+	instDir := filepath.Join(limaHome, "foo")
+	assert.NilError(t, os.Mkdir(instDir, 0700))
+
+	_, err := InstanceStatus("foo")
+	assert.Assert(t, errors.Is(err, os.ErrNotExist))
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.LimaYAML), nil, 0644))
+
+	status, err := InstanceStatus("foo")
+	assert.NilError(t, err)
+	assert.Equal(t, status, StatusStopped)
+
+	pid := []byte(strconv.Itoa(os.Getpid()))
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.HostAgentPID), pid, 0644))
+	status, err = InstanceStatus("foo")
+	assert.ErrorContains(t, err, "qemu is not")
+	assert.Equal(t, status, StatusBroken)
+
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.QemuPID), pid, 0644))
+	status, err = InstanceStatus("foo")
+	assert.NilError(t, err)
+	assert.Equal(t, status, StatusRunning)
+
+	names, err := Instances()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, names, []string{"foo"})
+}
+
+func TestInstancesSymlink(t *testing.T) {
+	limaHome := t.TempDir()
+	t.Setenv("LIMA_HOME", limaHome)
+	assert.NilError(t, os.Mkdir(filepath.Join(limaHome, "foo"), 0700))
+	assert.NilError(t, os.WriteFile(filepath.Join(limaHome, "file"), nil, 0644))
+	// a symlink to an instance directory elsewhere is an instance, but a symlink to a file is not
+	elsewhere := t.TempDir()
+	assert.NilError(t, os.Symlink(elsewhere, filepath.Join(limaHome, "bar")))
+	assert.NilError(t, os.Symlink(filepath.Join(limaHome, "file"), filepath.Join(limaHome, "baz")))
+	assert.NilError(t, os.Symlink(filepath.Join(limaHome, "missing"), filepath.Join(limaHome, "qux")))
+
+	names, err := Instances()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, names, []string{"bar", "foo"})
+}
+
+func TestReadHostAgentEvent(t *testing.T) {
+	limaHome := t.TempDir()
+	t.Setenv("LIMA_HOME", limaHome)
+	instDir := filepath.Join(limaHome, "foo")
+	assert.NilError(t, os.Mkdir(instDir, 0700))
+
+	_, err := ReadHostAgentEvent("foo")
+	assert.Assert(t, errors.Is(err, os.ErrNotExist))
+
+	ev := []byte(`{"time":"2021-12-01T00:00:00Z","status":{"running":true,"sshLocalPort":60022}}`)
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.HostAgentEvent), ev, 0644))
+	got, err := ReadHostAgentEvent("foo")
+	assert.NilError(t, err)
+	assert.Assert(t, got.Status.Running)
+	assert.Equal(t, got.Status.SSHLocalPort, 60022)
+}
+
+func TestDeleteInstance(t *testing.T) {
+	limaHome := t.TempDir()
+	t.Setenv("LIMA_HOME", limaHome)
+	instDir := filepath.Join(limaHome, "foo")
+	assert.NilError(t, os.Mkdir(instDir, 0700))
+	for _, f := range []string{filenames.LimaYAML, filenames.BaseDisk, filenames.DiffDisk, filenames.SerialLog} {
+		assert.NilError(t, os.WriteFile(filepath.Join(instDir, f), nil, 0644))
+	}
+
+	pid := []byte(strconv.Itoa(os.Getpid()))
+	assert.NilError(t, os.WriteFile(filepath.Join(instDir, filenames.QemuPID), pid, 0644))
+	assert.ErrorContains(t, DeleteInstance("foo"), "is running")
+	assert.NilError(t, os.Remove(filepath.Join(instDir, filenames.QemuPID)))
+
+	baseDisk := filepath.Join(limaHome, "basedisk-foo")
+	assert.NilError(t, DeleteInstance("foo", WithBaseDiskPreserved(baseDisk)))
+	_, err := os.Stat(instDir)
+	assert.Assert(t, errors.Is(err, os.ErrNotExist))
+	_, err = os.Stat(baseDisk)
+	assert.NilError(t, err)
+
+	assert.Assert(t, errors.Is(DeleteInstance("foo"), os.ErrNotExist))
+}
+
+func TestTailSerialLog(t *testing.T) {
+	limaHome := t.TempDir()
+	t.Setenv("LIMA_HOME", limaHome)
+	instDir := filepath.Join(limaHome, "foo")
+	assert.NilError(t, os.Mkdir(instDir, 0700))
+	serialLog := filepath.Join(instDir, filenames.SerialLog)
+	assert.NilError(t, os.WriteFile(serialLog, []byte("foo\nbar\n"), 0600))
+
+	var lines []string
+	onLine := func(line string) { lines = append(lines, line) }
+	assert.NilError(t, TailSerialLog(context.Background(), "foo", true, false, onLine))
+	assert.DeepEqual(t, []string{"foo", "bar"}, lines)
+
+	lines = nil
+	assert.NilError(t, TailSerialLog(context.Background(), "foo", false, false, onLine))
+	assert.Equal(t, 0, len(lines))
+
+	_, err := os.Stat(filepath.Join(limaHome, "bar"))
+	assert.Assert(t, errors.Is(err, os.ErrNotExist))
+	assert.Assert(t, TailSerialLog(context.Background(), "bar", true, false, onLine) != nil)
+}
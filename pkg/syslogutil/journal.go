@@ -0,0 +1,44 @@
+package syslogutil
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strconv"
+)
+
+// JournalSocket is the socket for the native protocol of systemd-journald.
+const JournalSocket = "/run/systemd/journal/socket"
+
+type journalSender struct {
+	conn *net.UnixConn
+}
+
+func newJournalSender() (*journalSender, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: JournalSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &journalSender{conn: conn}, nil
+}
+
+func (s *journalSender) send(priority int, message string, fields map[string]string) error {
+	var b bytes.Buffer
+	w := bufio.NewWriter(&b)
+	appendField(w, "MESSAGE", message)
+	appendField(w, "PRIORITY", strconv.Itoa(priority))
+	appendField(w, "SYSLOG_IDENTIFIER", Identifier)
+	for _, k := range sortedKeys(fields) {
+		appendField(w, k, fields[k])
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	// Messages larger than the socket buffer would need to be passed as a memfd; they are just dropped here.
+	_, err := s.conn.Write(b.Bytes())
+	return err
+}
+
+func (s *journalSender) Close() error {
+	return s.conn.Close()
+}
@@ -0,0 +1,23 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package syslogutil
+
+import (
+	"fmt"
+	"runtime"
+)
+
+type syslogSender struct{}
+
+func newSyslogSender() (*syslogSender, error) {
+	return nil, fmt.Errorf("syslog is not supported on %s", runtime.GOOS)
+}
+
+func (s *syslogSender) send(int, string, map[string]string) error {
+	return nil
+}
+
+func (s *syslogSender) Close() error {
+	return nil
+}
@@ -0,0 +1,48 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package syslogutil
+
+import (
+	"fmt"
+	"log/syslog"
+	"strings"
+)
+
+type syslogSender struct {
+	w *syslog.Writer
+}
+
+func newSyslogSender() (*syslogSender, error) {
+	w, err := syslog.New(syslog.LOG_DAEMON|syslog.LOG_INFO, Identifier)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogSender{w: w}, nil
+}
+
+// send appends the fields to the message as key=value pairs, as syslog has no structured fields.
+func (s *syslogSender) send(priority int, message string, fields map[string]string) error {
+	var sb strings.Builder
+	sb.WriteString(message)
+	for _, k := range sortedKeys(fields) {
+		fmt.Fprintf(&sb, " %s=%q", strings.ToLower(strings.TrimPrefix(k, "LIMA_")), fields[k])
+	}
+	msg := sb.String()
+	switch priority {
+	case prioErr:
+		return s.w.Err(msg)
+	case prioWarning:
+		return s.w.Warning(msg)
+	case prioNotice:
+		return s.w.Notice(msg)
+	case prioInfo:
+		return s.w.Info(msg)
+	default:
+		return s.w.Debug(msg)
+	}
+}
+
+func (s *syslogSender) Close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,255 @@
+// Package syslogutil sends the logs and the events of the host agent to the
+// systemd journal or to syslog, in addition to stdout and stderr.
+package syslogutil
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	Journal = "journal"
+	Syslog  = "syslog"
+)
+
+// Identifier is used as SYSLOG_IDENTIFIER (journal) and as the tag (syslog).
+const Identifier = "lima-hostagent"
+
+// Priorities as defined in syslog(3)
+const (
+	prioErr     = 3
+	prioWarning = 4
+	prioNotice  = 5
+	prioInfo    = 6
+	prioDebug   = 7
+)
+
+// sender sends a single message with structured fields.
+// Field names are upper case, as required by the journal.
+type sender interface {
+	send(priority int, message string, fields map[string]string) error
+	Close() error
+}
+
+// Logger sends logrus entries and host agent events of an instance to the journal or syslog.
+// All the messages have the fields LIMA_INSTANCE and LIMA_TRACE_ID.
+type Logger struct {
+	instName string
+	// traceID identifies the run of the host agent, so that the messages of a run can be told
+	// from the ones of the previous runs of the same instance
+	traceID string
+	sender  sender
+}
+
+// New opens the journal or syslog, depending on target.
+func New(target, instName string) (*Logger, error) {
+	var (
+		s   sender
+		err error
+	)
+	switch target {
+	case Journal:
+		s, err = newJournalSender()
+	case Syslog:
+		s, err = newSyslogSender()
+	default:
+		return nil, fmt.Errorf("unknown log target %q, must be %q or %q", target, Journal, Syslog)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", target, err)
+	}
+	traceID, err := newTraceID()
+	if err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+	return &Logger{instName: instName, traceID: traceID, sender: s}, nil
+}
+
+// newTraceID returns 16 random bytes in hex, like the trace ID of W3C Trace Context.
+func newTraceID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// TraceID returns the value of the LIMA_TRACE_ID field.
+func (l *Logger) TraceID() string {
+	return l.traceID
+}
+
+// commonFields returns the fields included in all the messages.
+func (l *Logger) commonFields() map[string]string {
+	return map[string]string{
+		"LIMA_INSTANCE": l.instName,
+		"LIMA_TRACE_ID": l.traceID,
+	}
+}
+
+func (l *Logger) Close() error {
+	return l.sender.Close()
+}
+
+// Hook returns a logrus hook that sends all the log entries.
+func (l *Logger) Hook() logrus.Hook {
+	return &hook{l: l}
+}
+
+type hook struct {
+	l *Logger
+}
+
+func (h *hook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *hook) Fire(entry *logrus.Entry) error {
+	fields := h.l.commonFields()
+	for k, v := range entry.Data {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		// the common fields are not overwritten by the fields of the entry
+		if k := "LIMA_" + fieldName(k); fields[k] == "" {
+			fields[k] = fmt.Sprint(v)
+		}
+	}
+	// Errors are only reported here; returning them would make logrus print to stderr
+	_ = h.l.sender.send(levelPriority(entry.Level), entry.Message, fields)
+	return nil
+}
+
+func levelPriority(lv logrus.Level) int {
+	switch lv {
+	case logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel:
+		return prioErr
+	case logrus.WarnLevel:
+		return prioWarning
+	case logrus.InfoLevel:
+		return prioInfo
+	default:
+		return prioDebug
+	}
+}
+
+// fieldName converts a logrus field name to a journal field name.
+// Journal field names may only contain upper case letters, digits, and underscores.
+func fieldName(k string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		default:
+			return '_'
+		}
+	}, k)
+}
+
+// EventWriter returns a writer that consumes the JSON lines of events.Event,
+// and sends them with the status as structured fields.
+// It is meant to be combined with the original event writer using io.MultiWriter.
+func (l *Logger) EventWriter() io.Writer {
+	return &eventWriter{l: l}
+}
+
+type eventWriter struct {
+	l   *Logger
+	buf bytes.Buffer
+}
+
+func (w *eventWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	for {
+		line, err := w.buf.ReadBytes('\n')
+		if err != nil {
+			// incomplete line; keep it for the next Write
+			w.buf.Reset()
+			w.buf.Write(line)
+			return len(p), nil
+		}
+		var ev events.Event
+		if err := json.Unmarshal(line, &ev); err != nil {
+			continue
+		}
+		w.l.sendEvent(ev)
+	}
+}
+
+func (l *Logger) sendEvent(ev events.Event) {
+	st := ev.Status
+	fields := l.commonFields()
+	fields["LIMA_RUNNING"] = strconv.FormatBool(st.Running)
+	fields["LIMA_DEGRADED"] = strconv.FormatBool(st.Degraded)
+	fields["LIMA_EXITING"] = strconv.FormatBool(st.Exiting)
+	if j, err := json.Marshal(st); err == nil {
+		fields["LIMA_STATUS"] = string(j)
+	}
+	if len(st.Errors) > 0 {
+		fields["LIMA_ERRORS"] = strings.Join(st.Errors, "\n")
+	}
+	priority := prioNotice
+	switch {
+	case len(st.Errors) > 0:
+		priority = prioErr
+	case st.Degraded:
+		priority = prioWarning
+	}
+	_ = l.sender.send(priority, "status: "+statusString(st), fields)
+}
+
+func statusString(st events.Status) string {
+	switch {
+	case st.Exiting:
+		return "exiting"
+	case st.Degraded:
+		return "running (degraded)"
+	case st.Running:
+		return "running"
+	case st.SSHReady:
+		return "ssh ready"
+	default:
+		return "booting"
+	}
+}
+
+// sortedKeys is used for deterministic output in syslog messages.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// appendField appends a field in the journal native protocol.
+// See https://systemd.io/JOURNAL_NATIVE_PROTOCOL/
+func appendField(w *bufio.Writer, k, v string) {
+	if !strings.Contains(v, "\n") {
+		fmt.Fprintf(w, "%s=%s\n", k, v)
+		return
+	}
+	var size [8]byte
+	n := uint64(len(v))
+	for i := range size {
+		size[i] = byte(n >> (8 * i))
+	}
+	_, _ = w.WriteString(k + "\n")
+	_, _ = w.Write(size[:])
+	_, _ = w.WriteString(v + "\n")
+}
@@ -0,0 +1,79 @@
+package syslogutil
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/lima-vm/lima/pkg/hostagent/events"
+	"github.com/sirupsen/logrus"
+	"gotest.tools/v3/assert"
+)
+
+type fakeSender struct {
+	messages []string
+	fields   []map[string]string
+}
+
+func (s *fakeSender) send(priority int, message string, fields map[string]string) error {
+	s.messages = append(s.messages, message)
+	s.fields = append(s.fields, fields)
+	return nil
+}
+
+func (s *fakeSender) Close() error {
+	return nil
+}
+
+func TestFieldName(t *testing.T) {
+	assert.Equal(t, fieldName("error"), "ERROR")
+	assert.Equal(t, fieldName("event.status-1"), "EVENT_STATUS_1")
+}
+
+func TestAppendField(t *testing.T) {
+	var b bytes.Buffer
+	w := bufio.NewWriter(&b)
+	appendField(w, "MESSAGE", "foo")
+	appendField(w, "LIMA_ERRORS", "a\nb")
+	assert.NilError(t, w.Flush())
+	assert.Equal(t, b.String(), "MESSAGE=foo\nLIMA_ERRORS\n\x03\x00\x00\x00\x00\x00\x00\x00a\nb\n")
+}
+
+func TestEventWriter(t *testing.T) {
+	s := &fakeSender{}
+	l := &Logger{instName: "default", traceID: "0123", sender: s}
+	w := l.EventWriter()
+	line := []byte(`{"status":{"running":true}}` + "\n")
+	// split a line across writes
+	_, err := w.Write(line[:5])
+	assert.NilError(t, err)
+	assert.Equal(t, len(s.messages), 0)
+	_, err = w.Write(line[5:])
+	assert.NilError(t, err)
+	assert.DeepEqual(t, s.messages, []string{"status: " + statusString(events.Status{Running: true})})
+	assert.Equal(t, s.fields[0]["LIMA_INSTANCE"], "default")
+	assert.Equal(t, s.fields[0]["LIMA_TRACE_ID"], "0123")
+	assert.Equal(t, s.fields[0]["LIMA_RUNNING"], "true")
+}
+
+func TestHook(t *testing.T) {
+	s := &fakeSender{}
+	l := &Logger{instName: "default", traceID: "0123", sender: s}
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	logger.AddHook(l.Hook())
+	logger.WithField("trace_id", "spoofed").WithField("port", 22).Warn("foo")
+	assert.DeepEqual(t, s.messages, []string{"foo"})
+	assert.Equal(t, s.fields[0]["LIMA_TRACE_ID"], "0123")
+	assert.Equal(t, s.fields[0]["LIMA_PORT"], "22")
+}
+
+func TestNewTraceID(t *testing.T) {
+	a, err := newTraceID()
+	assert.NilError(t, err)
+	b, err := newTraceID()
+	assert.NilError(t, err)
+	assert.Equal(t, len(a), 32)
+	assert.Assert(t, a != b)
+}
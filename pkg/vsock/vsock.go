@@ -0,0 +1,21 @@
+// Package vsock provides the minimal support of AF_VSOCK sockets for the communication
+// between the host agent and the guest agent.
+package vsock
+
+import (
+	"fmt"
+)
+
+// Addr is the address of a vsock socket.
+type Addr struct {
+	CID  uint32
+	Port uint32
+}
+
+func (a *Addr) Network() string {
+	return "vsock"
+}
+
+func (a *Addr) String() string {
+	return fmt.Sprintf("%d:%d", a.CID, a.Port)
+}
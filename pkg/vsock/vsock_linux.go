@@ -0,0 +1,222 @@
+package vsock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+	"unsafe"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// hostDevice is the device used by QEMU for `-device vhost-vsock-pci`.
+const hostDevice = "/dev/vhost-vsock"
+
+// HostAvailable returns whether QEMU can provide a vsock device to the guest.
+func HostAvailable() bool {
+	return unix.Access(hostDevice, unix.R_OK|unix.W_OK) == nil
+}
+
+// ioctls of /dev/vhost-vsock, see linux/vhost.h
+const (
+	vhostSetOwner         = 0xAF01     // _IO(VHOST_VIRTIO, 0x01)
+	vhostVSockSetGuestCID = 0x4008AF60 // _IOW(VHOST_VIRTIO, 0x60, __u64)
+)
+
+// CIDAvailable returns whether cid is not used by any guest on the host.
+// The CID is only probed, so it may be taken by another guest before QEMU starts.
+func CIDAvailable(cid uint32) (bool, error) {
+	fd, err := unix.Open(hostDevice, unix.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return false, err
+	}
+	defer unix.Close(fd)
+	if err := unix.IoctlSetInt(fd, vhostSetOwner, 0); err != nil {
+		return false, fmt.Errorf("failed to set the owner of %q: %w", hostDevice, err)
+	}
+	cid64 := uint64(cid)
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), vhostVSockSetGuestCID, uintptr(unsafe.Pointer(&cid64))); errno != 0 {
+		if errno == unix.EADDRINUSE {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to probe the vsock CID %d: %w", cid, errno)
+	}
+	return true, nil
+}
+
+// Listen listens on port for the connections from the host (VMADDR_CID_HOST).
+// The connections from the other CIDs, e.g., from the guest itself via VMADDR_CID_LOCAL, are rejected.
+func Listen(port uint32) (net.Listener, error) {
+	fd, err := unix.Socket(unix.AF_VSOCK, unix.SOCK_STREAM|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a vsock socket: %w", err)
+	}
+	if err := unix.Bind(fd, &unix.SockaddrVM{CID: unix.VMADDR_CID_ANY, Port: port}); err != nil {
+		_ = unix.Close(fd)
+		return nil, fmt.Errorf("failed to bind vsock port %d: %w", port, err)
+	}
+	if err := unix.Listen(fd, unix.SOMAXCONN); err != nil {
+		_ = unix.Close(fd)
+		return nil, fmt.Errorf("failed to listen on vsock port %d: %w", port, err)
+	}
+	// A non-blocking fd is registered to the runtime poller, so Accept can be interrupted by Close
+	f := os.NewFile(uintptr(fd), fmt.Sprintf("vsock:%d", port))
+	return &listener{f: f, addr: &Addr{CID: unix.VMADDR_CID_ANY, Port: port}}, nil
+}
+
+type listener struct {
+	f    *os.File
+	addr *Addr
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	rc, err := l.f.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		nfd       int
+		sa        unix.Sockaddr
+		acceptErr error
+	)
+	err = rc.Read(func(fd uintptr) bool {
+		for {
+			nfd, sa, acceptErr = unix.Accept4(int(fd), unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC)
+			if errors.Is(acceptErr, unix.EAGAIN) {
+				// wait for the next connection
+				return false
+			}
+			if acceptErr != nil {
+				return true
+			}
+			if vm, ok := sa.(*unix.SockaddrVM); ok && vm.CID == unix.VMADDR_CID_HOST {
+				return true
+			}
+			logrus.Warnf("rejected the vsock connection from %+v, only the host (CID %d) is allowed", sa, unix.VMADDR_CID_HOST)
+			_ = unix.Close(nfd)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if acceptErr != nil {
+		return nil, acceptErr
+	}
+	vm := sa.(*unix.SockaddrVM)
+	remote := &Addr{CID: vm.CID, Port: vm.Port}
+	return newConn(os.NewFile(uintptr(nfd), "vsock:"+remote.String()), l.addr, remote), nil
+}
+
+func (l *listener) Close() error {
+	return l.f.Close()
+}
+
+func (l *listener) Addr() net.Addr {
+	return l.addr
+}
+
+// Dial connects to port of cid.
+// The connection is canceled when ctx is done before the connection is established.
+func Dial(ctx context.Context, cid, port uint32) (net.Conn, error) {
+	fd, err := unix.Socket(unix.AF_VSOCK, unix.SOCK_STREAM|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a vsock socket: %w", err)
+	}
+	remote := &Addr{CID: cid, Port: port}
+	connectErr := unix.Connect(fd, &unix.SockaddrVM{CID: cid, Port: port})
+	if connectErr != nil && !errors.Is(connectErr, unix.EINPROGRESS) {
+		_ = unix.Close(fd)
+		return nil, fmt.Errorf("failed to connect to vsock %s: %w", remote, connectErr)
+	}
+	// A non-blocking fd is registered to the runtime poller, so waiting for the connection can be interrupted by a deadline
+	f := os.NewFile(uintptr(fd), "vsock:"+remote.String())
+	if connectErr != nil {
+		if err := waitConnect(ctx, f); err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("failed to connect to vsock %s: %w", remote, err)
+		}
+	}
+	local := &Addr{CID: unix.VMADDR_CID_HOST}
+	if sa, err := unix.Getsockname(fd); err == nil {
+		if vm, ok := sa.(*unix.SockaddrVM); ok {
+			local = &Addr{CID: vm.CID, Port: vm.Port}
+		}
+	}
+	return newConn(f, local, remote), nil
+}
+
+// waitConnect waits for the non-blocking connect of f to complete, or ctx to be done.
+func waitConnect(ctx context.Context, f *os.File) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := f.SetWriteDeadline(deadline); err != nil {
+			return err
+		}
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// wake up the pending write wait
+			_ = f.SetWriteDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var soErr error
+	err = rc.Write(func(fd uintptr) bool {
+		var errno int
+		errno, soErr = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_ERROR)
+		if soErr != nil {
+			return true
+		}
+		switch e := unix.Errno(errno); e {
+		case unix.EINPROGRESS, unix.EALREADY, unix.EINTR:
+			// wait until the socket is writable
+			return false
+		case 0:
+			return true
+		default:
+			soErr = e
+			return true
+		}
+	})
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if err != nil {
+		return err
+	}
+	if soErr != nil {
+		return soErr
+	}
+	return f.SetWriteDeadline(time.Time{})
+}
+
+type conn struct {
+	*os.File
+	local, remote *Addr
+}
+
+func newConn(f *os.File, local, remote *Addr) net.Conn {
+	return &conn{
+		File:   f,
+		local:  local,
+		remote: remote,
+	}
+}
+
+func (c *conn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *conn) RemoteAddr() net.Addr {
+	return c.remote
+}
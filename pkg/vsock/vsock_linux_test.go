@@ -0,0 +1,25 @@
+package vsock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gotest.tools/v3/assert"
+)
+
+func TestDialCanceled(t *testing.T) {
+	fd, err := unix.Socket(unix.AF_VSOCK, unix.SOCK_STREAM, 0)
+	if err != nil {
+		t.Skipf("vsock is not available: %v", err)
+	}
+	_ = unix.Close(fd)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	begin := time.Now()
+	// CID 0x7fffffff is unlikely to exist; the connection fails either immediately or by the cancellation
+	_, err = Dial(ctx, 0x7fffffff, 1024)
+	assert.Assert(t, err != nil)
+	assert.Assert(t, time.Since(begin) < 5*time.Second)
+}
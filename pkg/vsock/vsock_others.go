@@ -0,0 +1,32 @@
+//go:build !linux
+// +build !linux
+
+package vsock
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+var errUnsupported = errors.New("vsock is only supported on Linux")
+
+// HostAvailable returns whether QEMU can provide a vsock device to the guest.
+func HostAvailable() bool {
+	return false
+}
+
+// CIDAvailable returns whether cid is not used by any guest on the host.
+func CIDAvailable(cid uint32) (bool, error) {
+	return false, errUnsupported
+}
+
+// Listen listens on port for the connections from the host (VMADDR_CID_HOST).
+func Listen(port uint32) (net.Listener, error) {
+	return nil, errUnsupported
+}
+
+// Dial connects to port of cid.
+func Dial(ctx context.Context, cid, port uint32) (net.Conn, error) {
+	return nil, errUnsupported
+}